@@ -11,6 +11,9 @@ import (
 	"time"
 
 	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/redact"
+	"expense-api-gateway/internal/infrastructure/tlsconfig"
+	"expense-api-gateway/internal/middleware/quota"
 	"expense-api-gateway/internal/router"
 	"expense-api-gateway/internal/service/discovery"
 	"expense-api-gateway/internal/service/monitor"
@@ -56,15 +59,24 @@ func main() {
 	// 初始化代理服務
 	proxyService := proxy.NewProxyService(cfg, logger, routeParser, serviceDiscovery)
 
-	// 設置路由
+	// 初始化用量配額（關機時保存用量）
+	quotaMiddleware := quota.NewQuotaMiddleware(cfg, logger)
+	defer quotaMiddleware.Close()
+
+	// 設置路由（關機時停止限流器清理、規則熱重載等背景任務）
 	var r *gin.Engine
+	var closeRouter func()
 	if cfg.App.UseDynamicRouting {
 		// 使用動態路由（基於 services.yaml）
-		r = router.SetupWithProxy(cfg, logger, serviceDiscovery, monitorService, healthChecker, routeParser, proxyService)
+		r, closeRouter, err = router.SetupWithProxy(cfg, logger, serviceDiscovery, monitorService, healthChecker, routeParser, proxyService, quotaMiddleware)
+		if err != nil {
+			logger.Fatal("Failed to set up dynamic routes", zap.Error(err))
+		}
 	} else {
 		// 使用靜態路由
-		r = router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+		r, closeRouter = router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
 	}
+	defer closeRouter()
 
 	// 創建 HTTP 服務器
 	srv := &http.Server{
@@ -75,8 +87,34 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// 配置 TLS 終止
+	var certStore *tlsconfig.CertStore
+	if cfg.TLS.Enabled {
+		certStore, err = tlsconfig.NewCertStore(cfg.TLS, logger)
+		if err != nil {
+			logger.Fatal("Failed to load TLS certificates", zap.Error(err))
+		}
+		srv.TLSConfig, err = tlsconfig.NewServerTLSConfig(cfg.TLS, certStore)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", zap.Error(err))
+		}
+		certStore.Start()
+		defer certStore.Stop()
+	}
+
 	// 啟動服務器
 	go func() {
+		if cfg.TLS.Enabled {
+			logger.Info("Starting HTTPS server",
+				zap.String("address", srv.Addr),
+				zap.String("client_auth", cfg.TLS.ClientAuth.Mode))
+			// 證書由 TLSConfig.GetCertificate 提供
+			if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Failed to start server", zap.Error(err))
+			}
+			return
+		}
+
 		logger.Info("Starting HTTP server", zap.String("address", srv.Addr))
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Fatal("Failed to start server", zap.Error(err))
@@ -94,14 +132,15 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// 不使用 Fatal，確保已註冊的 defer（保存配額用量、停止背景任務）仍會執行
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+		logger.Error("Server forced to shutdown", zap.Error(err))
 	}
 
 	logger.Info("Server exited")
 }
 
-// initLogger 初始化日誌
+// initLogger 初始化日誌，啟用敏感資料遮蔽時所有日誌寫入前經過遮蔽
 func initLogger(cfg *config.Config) *zap.Logger {
 	var level zapcore.Level
 	switch cfg.Log.Level {
@@ -135,5 +174,5 @@ func initLogger(cfg *config.Config) *zap.Logger {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 
-	return logger
+	return redact.Logger(logger, redact.New(&cfg.Redaction))
 }
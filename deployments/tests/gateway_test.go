@@ -50,7 +50,8 @@ func TestHealthEndpoint(t *testing.T) {
 	healthChecker := healthcheck.New()
 
 	// 設置路由
-	r := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	r, closeRouter := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	defer closeRouter()
 
 	// 創建測試請求
 	req, _ := http.NewRequest("GET", "/health", nil)
@@ -75,7 +76,8 @@ func TestSystemStatusEndpoint(t *testing.T) {
 	healthChecker := healthcheck.New()
 
 	// 設置路由
-	r := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	r, closeRouter := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	defer closeRouter()
 
 	// 創建測試請求
 	req, _ := http.NewRequest("GET", "/api/v1/system/status", nil)
@@ -101,7 +103,8 @@ func TestGetMetricsEndpoint(t *testing.T) {
 	healthChecker := healthcheck.New()
 
 	// 設置路由
-	r := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	r, closeRouter := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	defer closeRouter()
 
 	// 創建測試請求
 	req, _ := http.NewRequest("GET", "/api/v1/system/metrics", nil)
@@ -127,7 +130,8 @@ func TestGetRoutesEndpoint(t *testing.T) {
 	healthChecker := healthcheck.New()
 
 	// 設置路由
-	r := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	r, closeRouter := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	defer closeRouter()
 
 	// 創建測試請求
 	req, _ := http.NewRequest("GET", "/admin/routes", nil)
@@ -153,7 +157,8 @@ func TestMaintenanceModeToggle(t *testing.T) {
 	healthChecker := healthcheck.New()
 
 	// 設置路由
-	r := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	r, closeRouter := router.Setup(cfg, logger, serviceDiscovery, monitorService, healthChecker)
+	defer closeRouter()
 
 	// 創建測試請求
 	req, _ := http.NewRequest("POST", "/admin/maintenance", nil)
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -10,14 +13,27 @@ import (
 
 // Config 配置結構
 type Config struct {
-	App       AppConfig       `yaml:"app"`
-	Log       LogConfig       `yaml:"log"`
-	JWT       JWTConfig       `yaml:"jwt"`
-	RateLimit RateLimitConfig `yaml:"rate_limit"`
-	Monitor   MonitorConfig   `yaml:"monitor"`
-	CORS      CORSConfig      `yaml:"cors"`
-	Discovery DiscoveryConfig `yaml:"discovery"`
-	Security  SecurityConfig  `yaml:"security"`
+	App         AppConfig         `yaml:"app"`
+	Server      ServerConfig      `yaml:"server"`
+	Log         LogConfig         `yaml:"log"`
+	JWT         JWTConfig         `yaml:"jwt"`
+	Auth        AuthConfig        `yaml:"auth"`
+	OIDC        OIDCConfig        `yaml:"oidc"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Redis       RedisConfig       `yaml:"redis"`
+	Monitor     MonitorConfig     `yaml:"monitor"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Discovery   DiscoveryConfig   `yaml:"discovery"`
+	Security    SecurityConfig    `yaml:"security"`
+	ClientIP    ClientIPConfig    `yaml:"client_ip"`
+	IPFilter    IPFilterConfig    `yaml:"ip_filter"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Audit       AuditConfig       `yaml:"audit"`
+	Quota       QuotaConfig       `yaml:"quota"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	Admission   AdmissionConfig   `yaml:"admission"`
+	LoginGuard  LoginGuardConfig  `yaml:"login_guard"`
+	Redaction   RedactionConfig   `yaml:"redaction"`
 }
 
 // AppConfig 應用配置
@@ -33,6 +49,11 @@ type AppConfig struct {
 	IdleTimeout       time.Duration `yaml:"idle_timeout"`
 }
 
+// ServerConfig 服務器配置
+type ServerConfig struct {
+	MaxBodySize int64 `yaml:"max_body_size"` // 請求體的全局上限（字節），路由與服務的 max_body_size 優先，0 表示不限制
+}
+
 // LogConfig 日誌配置
 type LogConfig struct {
 	Level  string `yaml:"level"`
@@ -47,19 +68,292 @@ type JWTConfig struct {
 	RefreshExpiration time.Duration `yaml:"refresh_expiration"`
 }
 
+// AuthConfig Token 驗證配置
+type AuthConfig struct {
+	DefaultValidator string              `yaml:"default_validator"` // jwt, introspection
+	Introspection    IntrospectionConfig `yaml:"introspection"`
+	Impersonation    ImpersonationConfig `yaml:"impersonation"`
+}
+
+// ImpersonationConfig 管理員代理登入配置
+type ImpersonationConfig struct {
+	Enabled            bool                     `yaml:"enabled"`
+	AdminRoles         []string                 `yaml:"admin_roles"`          // 可執行代理登入的角色
+	CrossCompanyRoles  []string                 `yaml:"cross_company_roles"`  // 可代理其他公司用戶的角色，空值表示僅限同公司
+	AllowedTargetRoles []string                 `yaml:"allowed_target_roles"` // 可被代理的角色
+	DefaultRole        string                   `yaml:"default_role"`         // X-Impersonate-User 模式下目標用戶的角色
+	TokenTTL           time.Duration            `yaml:"token_ttl"`
+	BlockedRoutes      []ImpersonationBlockRule `yaml:"blocked_routes"` // 代理期間禁止存取的路由
+}
+
+// ImpersonationBlockRule 代理期間禁止存取的路由規則
+type ImpersonationBlockRule struct {
+	Pattern string   `yaml:"pattern"` // 支援結尾 * 前綴匹配
+	Methods []string `yaml:"methods"` // 空值表示所有方法
+}
+
+// QuotaConfig 用量配額配置（按自然日或自然月計算，與短窗口限流分開）
+type QuotaConfig struct {
+	Enabled       bool             `yaml:"enabled"`
+	FilePath      string           `yaml:"file_path"`      // 用量計數持久化文件
+	Timezone      string           `yaml:"timezone"`       // 計算週期邊界的時區
+	FlushInterval time.Duration    `yaml:"flush_interval"` // 用量寫入文件的間隔
+	RefundOnError bool             `yaml:"refund_on_error"`
+	Policies      []QuotaPolicy    `yaml:"policies"`
+	Costs         map[string]int64 `yaml:"costs"` // 路由 ID 或路由模式對應的消耗單位
+}
+
+// QuotaPolicy 配額策略
+type QuotaPolicy struct {
+	Name      string           `yaml:"name"`
+	Scope     string           `yaml:"scope"`  // company, user
+	Period    string           `yaml:"period"` // day, month
+	Limit     int64            `yaml:"limit"`
+	Overrides map[string]int64 `yaml:"overrides"` // 指定公司或用戶的額度
+	Status    int              `yaml:"status"`    // 用盡時的狀態碼，默認 month 為 402、day 為 429
+}
+
+// ClientIPConfig 客戶端 IP 解析配置
+// 只有直接連線的對端屬於受信任代理時才讀取轉發請求頭
+type ClientIPConfig struct {
+	TrustedProxies []string `yaml:"trusted_proxies"` // 受信任代理的 IP 或 CIDR
+	Headers        []string `yaml:"headers"`         // 依序檢查的請求頭：Forwarded, X-Forwarded-For, X-Real-IP
+}
+
+// IPFilterConfig IP 訪問控制配置，全局、組與路由級別的規則在 services.yaml 的 ip_filter 中設置
+type IPFilterConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	GeoIPDatabase string        `yaml:"geoip_database"` // MaxMind 格式 (.mmdb) 的國家數據庫，用於國家規則
+	Admin         IPFilterRule  `yaml:"admin"`          // 管理端點的規則
+	DefaultTTL    time.Duration `yaml:"default_ttl"`    // 動態封鎖未指定 TTL 時的有效期
+	MaxTTL        time.Duration `yaml:"max_ttl"`        // 動態封鎖的最長有效期
+}
+
+// IPFilterRule IP 訪問控制規則
+// 命中 deny 或 deny_countries 時拒絕；設置了 allow 或 allow_countries 時，只允許命中其中之一的請求
+type IPFilterRule struct {
+	Allow          []string `yaml:"allow"`           // 允許的 IP 或 CIDR
+	Deny           []string `yaml:"deny"`            // 拒絕的 IP 或 CIDR
+	AllowCountries []string `yaml:"allow_countries"` // 允許的國家 ISO 代碼
+	DenyCountries  []string `yaml:"deny_countries"`  // 拒絕的國家 ISO 代碼
+}
+
+// IsEmpty 檢查規則是否沒有任何條件
+func (r IPFilterRule) IsEmpty() bool {
+	return len(r.Allow) == 0 && len(r.Deny) == 0 && len(r.AllowCountries) == 0 && len(r.DenyCountries) == 0
+}
+
+// ConcurrencyConfig 上游並發限制配置，各服務與路由的限制在 services.yaml 中設置
+type ConcurrencyConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	RetryAfter time.Duration `yaml:"retry_after"` // 飽和時 Retry-After 建議的等待時間
+}
+
+// ConcurrencyRule 並發限制規則
+type ConcurrencyRule struct {
+	Mode          string        `yaml:"mode"`           // fixed, aimd, gradient
+	MaxConcurrent int           `yaml:"max_concurrent"` // 固定模式的上限，自適應模式的初始值
+	MinLimit      int           `yaml:"min_limit"`      // 自適應模式的下限，默認 1
+	MaxLimit      int           `yaml:"max_limit"`      // 自適應模式的上限，默認為 max_concurrent 的 4 倍
+	MaxQueue      int           `yaml:"max_queue"`      // 等待隊列長度，0 表示不排隊直接拒絕
+	QueueTimeout  time.Duration `yaml:"queue_timeout"`  // 排隊等待的最長時間
+	// aimd 模式：上游延遲超過此值時視為過載並降低上限
+	LatencyThreshold time.Duration `yaml:"latency_threshold"`
+}
+
+// AdmissionConfig 過載時按優先級准入的配置
+// 負載取在途請求、平均延遲與 CPU 使用率相對目標值的最大比值，超過優先級的閾值時拒絕該優先級的請求
+type AdmissionConfig struct {
+	Enabled         bool               `yaml:"enabled"`
+	MaxInFlight     int                `yaml:"max_in_flight"`    // 全局在途請求目標值
+	TargetLatency   time.Duration      `yaml:"target_latency"`   // 平均延遲目標值，0 表示不使用延遲信號
+	CPUThreshold    float64            `yaml:"cpu_threshold"`    // CPU 使用率目標值 (0-1)，0 表示不使用 CPU 信號
+	PriorityHeader  string             `yaml:"priority_header"`  // 受信任客戶端指定優先級的請求頭
+	TrustedClients  []string           `yaml:"trusted_clients"`  // 可使用優先級請求頭的客戶端證書服務帳號，空值表示所有客戶端證書
+	DefaultPriority string             `yaml:"default_priority"` // critical, high, normal, low
+	RolePriorities  map[string]string  `yaml:"role_priorities"`  // 角色對應的優先級
+	Thresholds      map[string]float64 `yaml:"thresholds"`       // 各優先級開始被拒絕的負載，critical 不會被拒絕
+	RetryAfter      time.Duration      `yaml:"retry_after"`
+}
+
+// IsValidPriority 檢查請求優先級是否有效
+func IsValidPriority(priority string) bool {
+	switch priority {
+	case "critical", "high", "normal", "low":
+		return true
+	}
+	return false
+}
+
+// LoginGuardConfig 登入防護配置，services.yaml 中設置了 login_guard 的路由生效
+// 依上游響應狀態碼判斷登入失敗，按用戶名與 IP 分別計數
+type LoginGuardConfig struct {
+	Enabled           bool                 `yaml:"enabled"`
+	UsernameFields    []string             `yaml:"username_fields"`      // 請求體（JSON 或表單）中用戶名的字段
+	FailureStatuses   []int                `yaml:"failure_statuses"`     // 上游返回這些狀態碼時視為登入失敗
+	Window            time.Duration        `yaml:"window"`               // 失敗次數的統計窗口
+	MaxUsernamesPerIP int                  `yaml:"max_usernames_per_ip"` // 窗口內單個 IP 登入失敗的不同用戶名上限，超過時鎖定該 IP，0 表示不檢測
+	Delay             LoginDelayConfig     `yaml:"delay"`
+	Lockout           LoginLockoutConfig   `yaml:"lockout"`
+	Challenge         LoginChallengeConfig `yaml:"challenge"`
+}
+
+// LoginDelayConfig 登入失敗後的遞增延遲，延遲期間的登入請求返回 429
+type LoginDelayConfig struct {
+	After int           `yaml:"after"` // 失敗次數達到此值後開始延遲，0 表示不延遲
+	Base  time.Duration `yaml:"base"`  // 首次延遲，之後每次失敗加倍
+	Max   time.Duration `yaml:"max"`
+}
+
+// LoginLockoutConfig 登入失敗過多時的臨時鎖定，重複鎖定的時長加倍
+type LoginLockoutConfig struct {
+	UserThreshold int           `yaml:"user_threshold"` // 用戶名的失敗次數上限，0 表示不鎖定
+	IPThreshold   int           `yaml:"ip_threshold"`   // IP 的失敗次數上限，0 表示不鎖定
+	Duration      time.Duration `yaml:"duration"`
+	MaxDuration   time.Duration `yaml:"max_duration"`
+}
+
+// 登入挑戰類型
+const (
+	LoginChallengePoW     = "pow"     // 工作量證明，由網關簽發與驗證
+	LoginChallengeCaptcha = "captcha" // 驗證碼 token，由 verify_url 驗證（reCAPTCHA、hCaptcha、Turnstile 兼容）
+)
+
+// LoginChallengeConfig 失敗次數達到閾值後要求的挑戰
+type LoginChallengeConfig struct {
+	Type       string        `yaml:"type"`        // pow, captcha，空值表示不要求挑戰
+	After      int           `yaml:"after"`       // 用戶名或 IP 的失敗次數達到此值後要求挑戰
+	Difficulty int           `yaml:"difficulty"`  // pow 要求的 SHA-256 前導零位數
+	TTL        time.Duration `yaml:"ttl"`         // pow 挑戰的有效期
+	MaxPending int           `yaml:"max_pending"` // 未使用的 pow 挑戰上限，超過時淘汰最早簽發的挑戰
+	VerifyURL  string        `yaml:"verify_url"`  // captcha 驗證地址
+	Secret     string        `yaml:"secret"`      // captcha 驗證密鑰
+	Timeout    time.Duration `yaml:"timeout"`     // captcha 驗證超時
+}
+
+// 敏感值檢測器
+const (
+	RedactDetectorJWT        = "jwt"            // JWT（三段 base64url，以 eyJ 開頭）
+	RedactDetectorCard       = "card"           // 通過 Luhn 校驗的 13–19 位卡號
+	RedactDetectorIBAN       = "iban"           // 通過 mod-97 校驗的 IBAN
+	RedactDetectorNationalID = "tw_national_id" // 通過校驗碼的台灣身分證與居留證統一證號
+	RedactDetectorEmail      = "email"
+)
+
+// RedactionConfig 敏感資料遮蔽配置，作用於日誌、訪問日誌、審計日誌與網關錯誤詳情
+// 名稱匹配不區分大小寫，且 - 與 _ 視為相同
+type RedactionConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Fields      []string `yaml:"fields"`       // 日誌字段與審計詳情中值需遮蔽的鍵名
+	Headers     []string `yaml:"headers"`      // 值需遮蔽的請求頭與響應頭
+	QueryParams []string `yaml:"query_params"` // 值需遮蔽的查詢參數
+	Detectors   []string `yaml:"detectors"`    // 在任意值中檢測並遮蔽的敏感值，空值表示全部啟用
+	Mask        string   `yaml:"mask"`         // 遮蔽後的替代文字
+}
+
+// AuditConfig 審計日誌配置
+type AuditConfig struct {
+	FilePath string `yaml:"file_path"`
+}
+
+// IntrospectionConfig OAuth2 Token Introspection (RFC 7662) 配置
+type IntrospectionConfig struct {
+	Endpoint         string        `yaml:"endpoint"`
+	ClientID         string        `yaml:"client_id"`
+	ClientSecret     string        `yaml:"client_secret"`
+	Timeout          time.Duration `yaml:"timeout"`
+	CacheTTL         time.Duration `yaml:"cache_ttl"`          // 有效 token 快取上限，實際不超過 token 的 exp
+	NegativeCacheTTL time.Duration `yaml:"negative_cache_ttl"` // 無效 token 快取時間
+	MaxCacheEntries  int           `yaml:"max_cache_entries"`
+	FieldMapping     ClaimMapping  `yaml:"field_mapping"`
+}
+
+// ClaimMapping Token 聲明欄位到用戶信息的映射
+type ClaimMapping struct {
+	UserID    string `yaml:"user_id"`
+	Username  string `yaml:"username"`
+	Email     string `yaml:"email"`
+	CompanyID string `yaml:"company_id"`
+	Role      string `yaml:"role"`
+	Roles     string `yaml:"roles"` // 支援字串陣列或以空格分隔的字串（如 scope）
+}
+
+// OIDCConfig OIDC 登入配置（網關作為 Relying Party）
+type OIDCConfig struct {
+	Enabled            bool                `yaml:"enabled"`
+	Issuer             string              `yaml:"issuer"`
+	ClientID           string              `yaml:"client_id"`
+	ClientSecret       string              `yaml:"client_secret"`
+	RedirectURL        string              `yaml:"redirect_url"`
+	Scopes             []string            `yaml:"scopes"`
+	PostLoginRedirect  string              `yaml:"post_login_redirect"`
+	PostLogoutRedirect string              `yaml:"post_logout_redirect"`
+	RefreshBefore      time.Duration       `yaml:"refresh_before"` // access token 到期前多久進行靜默刷新
+	Timeout            time.Duration       `yaml:"timeout"`
+	ClaimMapping       ClaimMapping        `yaml:"claim_mapping"`
+	Session            SessionCookieConfig `yaml:"session"`
+}
+
+// SessionCookieConfig 會話 Cookie 配置
+type SessionCookieConfig struct {
+	Name     string        `yaml:"name"`
+	Domain   string        `yaml:"domain"`
+	Path     string        `yaml:"path"`
+	Secret   string        `yaml:"secret"` // 加密密鑰，至少 32 字元
+	Secure   bool          `yaml:"secure"`
+	SameSite string        `yaml:"same_site"` // lax, strict, none
+	MaxAge   time.Duration `yaml:"max_age"`   // 會話絕對有效期
+}
+
 // RateLimitConfig 限流配置
 type RateLimitConfig struct {
 	Enabled     bool                     `yaml:"enabled"`
+	Algorithm   string                   `yaml:"algorithm"` // sliding_log, token_bucket, gcra
 	GlobalLimit int                      `yaml:"global_limit"`
+	GlobalBurst int                      `yaml:"global_burst"`
 	IPLimit     RateLimitRule            `yaml:"ip_limit"`
 	UserLimit   RateLimitRule            `yaml:"user_limit"`
 	APILimit    map[string]RateLimitRule `yaml:"api_limit"`
+	Shards      int                      `yaml:"shards"`
+	IdleTimeout time.Duration            `yaml:"idle_timeout"`
+	Backend     string                   `yaml:"backend"`    // memory, redis
+	FailMode    string                   `yaml:"fail_mode"`  // Redis 不可用時: local, open, closed
+	KeyPrefix   string                   `yaml:"key_prefix"` // Redis 鍵前綴，各限流器的鍵再以限流器名稱區分
+	Headers     string                   `yaml:"headers"`    // 限流響應頭: limited, all, none
+}
+
+// RedisConfig Redis 連接配置
+type RedisConfig struct {
+	Host        string        `yaml:"host"`
+	Port        int           `yaml:"port"`
+	Password    string        `yaml:"password"`
+	DB          int           `yaml:"db"`
+	PoolSize    int           `yaml:"pool_size"`
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	Timeout     time.Duration `yaml:"timeout"` // 單個命令的讀寫超時
 }
 
 // RateLimitRule 限流規則
 type RateLimitRule struct {
 	Requests int           `yaml:"requests"`
 	Window   time.Duration `yaml:"window"`
+	Burst    int           `yaml:"burst"` // 允許的瞬間突發量，0 表示等於 requests
+	// 限流鍵維度: user, company, ip, api_key, header:<名稱>, param:<名稱>；未設置時按用戶（匿名時按 IP）
+	KeyBy []string `yaml:"key_by"`
+}
+
+// IsValidRateLimitKeyBy 檢查限流鍵維度是否有效
+func IsValidRateLimitKeyBy(dimension string) bool {
+	switch dimension {
+	case "user", "company", "ip", "api_key":
+		return true
+	}
+	for _, prefix := range []string{"header:", "param:"} {
+		if strings.HasPrefix(dimension, prefix) && len(dimension) > len(prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // MonitorConfig 監控配置
@@ -69,13 +363,72 @@ type MonitorConfig struct {
 	PrometheusEnabled bool   `yaml:"prometheus_enabled"`
 }
 
-// CORSConfig CORS 配置
+// CORSConfig CORS 配置，config.yaml 的 cors 為默認策略，services.yaml 的路由組可以 cors 覆寫
 type CORSConfig struct {
-	Enabled        bool     `yaml:"enabled"`
-	AllowedOrigins []string `yaml:"allowed_origins"`
-	AllowedMethods []string `yaml:"allowed_methods"`
-	AllowedHeaders []string `yaml:"allowed_headers"`
-	MaxAge         int      `yaml:"max_age"`
+	Enabled bool `yaml:"enabled"`
+	// 允許的來源：* 表示所有來源（不允許攜帶憑證），https://*.example.com 匹配任意子域名，
+	// regex: 前綴為正則表達式（自動加上首尾錨點），其餘為精確匹配
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"` // * 表示允許預檢請求聲明的所有請求頭
+	ExposedHeaders   []string `yaml:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"` // 只對明確列出或匹配模式的來源生效
+	MaxAge           int      `yaml:"max_age"`           // 預檢結果的緩存秒數
+}
+
+// CORSRegexPrefix 來源以正則表達式匹配時的前綴
+const CORSRegexPrefix = "regex:"
+
+// Inherit 合併上層的 CORS 策略，下層未設置的列表與緩存時間繼承上層，是否允許憑證以下層為準
+func (c *CORSConfig) Inherit(parent *CORSConfig) *CORSConfig {
+	if parent == nil {
+		return c
+	}
+	if c == nil {
+		merged := *parent
+		return &merged
+	}
+	merged := *c
+	if len(merged.AllowedOrigins) == 0 {
+		merged.AllowedOrigins = parent.AllowedOrigins
+	}
+	if len(merged.AllowedMethods) == 0 {
+		merged.AllowedMethods = parent.AllowedMethods
+	}
+	if len(merged.AllowedHeaders) == 0 {
+		merged.AllowedHeaders = parent.AllowedHeaders
+	}
+	if len(merged.ExposedHeaders) == 0 {
+		merged.ExposedHeaders = parent.ExposedHeaders
+	}
+	if merged.MaxAge == 0 {
+		merged.MaxAge = parent.MaxAge
+	}
+	return &merged
+}
+
+// Validate 驗證允許的來源格式
+func (c *CORSConfig) Validate() error {
+	for _, origin := range c.AllowedOrigins {
+		switch {
+		case origin == "*":
+		case strings.HasPrefix(origin, CORSRegexPrefix):
+			if _, err := regexp.Compile(strings.TrimPrefix(origin, CORSRegexPrefix)); err != nil {
+				return fmt.Errorf("invalid cors origin pattern %q: %w", origin, err)
+			}
+		case strings.Contains(origin, "*"):
+			scheme, host, found := strings.Cut(origin, "://")
+			if !found || scheme == "" || !strings.HasPrefix(host, "*.") || strings.Count(host, "*") != 1 || strings.ContainsAny(host, "/?#") {
+				return fmt.Errorf("invalid cors origin %q: wildcard must be a leading subdomain, e.g. https://*.example.com", origin)
+			}
+		case !strings.Contains(origin, "://") && origin != "null":
+			return fmt.Errorf("invalid cors origin %q: scheme is required", origin)
+		}
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("cors max_age cannot be negative")
+	}
+	return nil
 }
 
 // DiscoveryConfig 服務發現配置
@@ -97,18 +450,285 @@ type ServiceConfig struct {
 
 // SecurityConfig 安全配置
 type SecurityConfig struct {
-	XSS          XSSConfig          `yaml:"xss"`
-	SQLInjection SQLInjectionConfig `yaml:"sql_injection"`
+	XSS          XSSConfig             `yaml:"xss"`
+	SQLInjection SQLInjectionConfig    `yaml:"sql_injection"`
+	CSRF         CSRFConfig            `yaml:"csrf"`
+	WAF          WAFConfig             `yaml:"waf"`
+	Upload       UploadConfig          `yaml:"upload"`
+	Headers      SecurityHeadersConfig `yaml:"headers"`
+}
+
+// WAFConfig WAF 規則引擎配置，XSS 與 SQL 注入防護依規則累計異常分數判斷
+type WAFConfig struct {
+	RulesFile        string                 `yaml:"rules_file"`        // YAML 或 JSON 規則文件，與內建規則合併；空值時只使用內建規則
+	ReloadInterval   time.Duration          `yaml:"reload_interval"`   // 規則文件熱重載檢查間隔，0 表示不重載
+	ParanoiaLevel    int                    `yaml:"paranoia_level"`    // 1-4，只啟用等級不高於此值的規則
+	AnomalyThreshold int                    `yaml:"anomaly_threshold"` // 單個類別累計分數達到閾值時攔截
+	Multipart        MultipartInspectConfig `yaml:"multipart"`
+}
+
+// MultipartInspectConfig 多部分表單的串流檢查限制，檢查所有無文件名的字段，文件部分不檢查
+// 超過限制的請求無法完整檢查，視為命中攔截
+type MultipartInspectConfig struct {
+	MaxFieldSize int64 `yaml:"max_field_size"` // 單個字段檢查的最大字節數
+	MaxFields    int   `yaml:"max_fields"`     // 檢查的字段數上限
+	MemoryLimit  int64 `yaml:"memory_limit"`   // 轉發前暫存請求體的記憶體上限，超過時寫入臨時文件
+}
+
+// 安全檢測模式
+const (
+	SecurityModeBlock   = "block"   // 命中時攔截請求
+	SecurityModeMonitor = "monitor" // 只記錄安全事件與指標，不攔截
+	SecurityModeOff     = "off"     // 不檢測
+)
+
+// IsValidSecurityMode 檢查安全檢測模式是否有效
+func IsValidSecurityMode(mode string) bool {
+	switch mode {
+	case SecurityModeBlock, SecurityModeMonitor, SecurityModeOff:
+		return true
+	}
+	return false
+}
+
+// RouteSecurityConfig 全局、組或路由級別的安全檢查設定（services.yaml 的 security）
+type RouteSecurityConfig struct {
+	Mode         string                  `yaml:"mode"`          // 所有檢測的模式：block, monitor, off
+	XSS          *DetectorSecurityConfig `yaml:"xss"`           // XSS 檢測的設定，覆寫共同設定
+	SQLInjection *DetectorSecurityConfig `yaml:"sql_injection"` // SQL 注入檢測的設定，覆寫共同設定
+	ExcludeRules []string                `yaml:"exclude_rules"` // 排除的規則 ID，或以 tag:<標籤> 排除整組規則
+	ExemptFields []string                `yaml:"exempt_fields"` // 不檢查的查詢參數或請求體字段，如 description、items.notes
+	Headers      *SecurityHeadersConfig  `yaml:"headers"`       // 安全響應頭策略，覆寫 config.yaml 的 security.headers
+}
+
+// DetectorSecurityConfig 單個檢測中間件的設定
+type DetectorSecurityConfig struct {
+	Mode         string   `yaml:"mode"`
+	ExemptFields []string `yaml:"exempt_fields"`
+}
+
+// Inherit 合併上層（全局或組）的設定，模式以下層為準，排除規則與豁免字段取聯集
+func (s *RouteSecurityConfig) Inherit(parent *RouteSecurityConfig) *RouteSecurityConfig {
+	if parent == nil {
+		return s
+	}
+	if s == nil {
+		merged := *parent
+		return &merged
+	}
+	merged := *s
+	if merged.Mode == "" {
+		merged.Mode = parent.Mode
+	}
+	merged.XSS = s.XSS.inherit(parent.XSS)
+	merged.SQLInjection = s.SQLInjection.inherit(parent.SQLInjection)
+	merged.ExcludeRules = union(parent.ExcludeRules, s.ExcludeRules)
+	merged.ExemptFields = union(parent.ExemptFields, s.ExemptFields)
+	merged.Headers = s.Headers.Inherit(parent.Headers)
+	return &merged
+}
+
+// inherit 合併上層的檢測設定
+func (d *DetectorSecurityConfig) inherit(parent *DetectorSecurityConfig) *DetectorSecurityConfig {
+	if parent == nil {
+		return d
+	}
+	if d == nil {
+		merged := *parent
+		return &merged
+	}
+	merged := *d
+	if merged.Mode == "" {
+		merged.Mode = parent.Mode
+	}
+	merged.ExemptFields = union(parent.ExemptFields, d.ExemptFields)
+	return &merged
+}
+
+// union 合併兩個字符串列表並去除重複項
+func union(a, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(a)+len(b))
+	merged := make([]string, 0, len(a)+len(b))
+	for _, value := range append(append([]string{}, a...), b...) {
+		if !seen[value] {
+			seen[value] = true
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// 上游響應已設置同名安全響應頭時的處理方式
+const (
+	UpstreamHeadersPreserve = "preserve" // 保留上游的值
+	UpstreamHeadersOverride = "override" // 以策略的值覆寫
+)
+
+// HeaderOff 響應頭設為此值時不發送，用於在組或路由級別關閉上層設置的響應頭
+const HeaderOff = "off"
+
+// SecurityHeadersConfig 安全響應頭策略，config.yaml 的 security.headers 為全局策略，
+// services.yaml 的 security.headers 可依全局、組或路由覆寫；字符串為空時繼承上層，設為 off 時不發送
+type SecurityHeadersConfig struct {
+	Upstream                  string      `yaml:"upstream"` // preserve, override
+	CSP                       *CSPConfig  `yaml:"csp"`
+	HSTS                      *HSTSConfig `yaml:"hsts"`
+	ReferrerPolicy            string      `yaml:"referrer_policy"`
+	PermissionsPolicy         string      `yaml:"permissions_policy"`
+	CrossOriginOpenerPolicy   string      `yaml:"cross_origin_opener_policy"`
+	CrossOriginEmbedderPolicy string      `yaml:"cross_origin_embedder_policy"`
+	CrossOriginResourcePolicy string      `yaml:"cross_origin_resource_policy"`
+	FrameOptions              string      `yaml:"frame_options"`
+	ContentTypeOptions        string      `yaml:"content_type_options"`
+}
+
+// CSPConfig 內容安全策略
+type CSPConfig struct {
+	Policy     string `yaml:"policy"`      // 策略內容，{nonce} 替換為每個請求隨機生成的值；空值或 off 表示不發送
+	ReportOnly bool   `yaml:"report_only"` // 以 Content-Security-Policy-Report-Only 發送，只報告不攔截
+	ReportURI  string `yaml:"report_uri"`  // 違規報告地址，附加為 report-uri 與 report-to 指令
+}
+
+// HSTSConfig HTTP 嚴格傳輸安全
+type HSTSConfig struct {
+	MaxAge            time.Duration `yaml:"max_age"` // 0 表示不發送
+	IncludeSubdomains bool          `yaml:"include_subdomains"`
+	Preload           bool          `yaml:"preload"`
+}
+
+// Inherit 合併上層的響應頭策略，下層設置的字段優先，CSP 與 HSTS 整塊覆寫
+func (h *SecurityHeadersConfig) Inherit(parent *SecurityHeadersConfig) *SecurityHeadersConfig {
+	if parent == nil {
+		return h
+	}
+	if h == nil {
+		merged := *parent
+		return &merged
+	}
+	merged := *h
+	if merged.CSP == nil {
+		merged.CSP = parent.CSP
+	}
+	if merged.HSTS == nil {
+		merged.HSTS = parent.HSTS
+	}
+	for _, field := range []struct {
+		own    *string
+		parent string
+	}{
+		{&merged.Upstream, parent.Upstream},
+		{&merged.ReferrerPolicy, parent.ReferrerPolicy},
+		{&merged.PermissionsPolicy, parent.PermissionsPolicy},
+		{&merged.CrossOriginOpenerPolicy, parent.CrossOriginOpenerPolicy},
+		{&merged.CrossOriginEmbedderPolicy, parent.CrossOriginEmbedderPolicy},
+		{&merged.CrossOriginResourcePolicy, parent.CrossOriginResourcePolicy},
+		{&merged.FrameOptions, parent.FrameOptions},
+		{&merged.ContentTypeOptions, parent.ContentTypeOptions},
+	} {
+		if *field.own == "" {
+			*field.own = field.parent
+		}
+	}
+	return &merged
+}
+
+// UploadConfig 上傳文件檢查配置，各路由的上傳策略在 services.yaml 的 upload 中設置
+type UploadConfig struct {
+	MemoryLimit int64               `yaml:"memory_limit"` // 單個文件與重建後請求體暫存的記憶體上限，超過時寫入臨時文件
+	Scanner     UploadScannerConfig `yaml:"scanner"`
+}
+
+// 惡意軟件掃描器類型
+const (
+	UploadScannerClamd = "clamd" // 以 INSTREAM 協議交由 clamd 掃描
+	UploadScannerStub  = "stub"  // 本地替身，只識別 EICAR 測試文件，供開發與測試使用
+)
+
+// UploadScannerConfig 惡意軟件掃描配置
+type UploadScannerConfig struct {
+	Type     string        `yaml:"type"`      // clamd, stub，空值表示不掃描
+	Address  string        `yaml:"address"`   // clamd 地址，如 127.0.0.1:3310 或 unix:/var/run/clamav/clamd.ctl
+	Timeout  time.Duration `yaml:"timeout"`   // 單個文件的掃描超時
+	FailMode string        `yaml:"fail_mode"` // closed 掃描失敗時拒絕上傳，open 掃描失敗時放行
+}
+
+// UploadPolicy 路由級別的上傳策略（services.yaml 的 upload）
+type UploadPolicy struct {
+	AllowedTypes   []string `yaml:"allowed_types"`    // 允許的 MIME 類型，依文件內容判斷而非聲明的 Content-Type，可寫為 image/*；空值表示不限制
+	MaxFiles       int      `yaml:"max_files"`        // 單個請求的文件數上限，0 表示不限制
+	MaxFileSize    int64    `yaml:"max_file_size"`    // 單個文件的字節數上限，0 表示不限制
+	MaxImageWidth  int      `yaml:"max_image_width"`  // 圖片寬度上限（像素），0 表示不限制
+	MaxImageHeight int      `yaml:"max_image_height"` // 圖片高度上限（像素），0 表示不限制
+	Scan           bool     `yaml:"scan"`             // 是否交由 security.upload.scanner 掃描
 }
 
 // XSSConfig XSS 防護配置
 type XSSConfig struct {
-	Enabled bool `yaml:"enabled"`
+	Enabled bool   `yaml:"enabled"`
+	Mode    string `yaml:"mode"` // block, monitor, off，services.yaml 的 security 可依組或路由覆寫
 }
 
 // SQLInjectionConfig SQL 注入防護配置
 type SQLInjectionConfig struct {
-	Enabled bool `yaml:"enabled"`
+	Enabled bool   `yaml:"enabled"`
+	Mode    string `yaml:"mode"` // block, monitor, off，services.yaml 的 security 可依組或路由覆寫
+}
+
+// CSRFConfig CSRF 防護配置（僅作用於會話 Cookie 認證的請求）
+type CSRFConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	CookieName     string   `yaml:"cookie_name"`
+	HeaderName     string   `yaml:"header_name"`
+	TrustedOrigins []string `yaml:"trusted_origins"` // 除同源外允許的 Origin
+}
+
+// TLSConfig TLS 終止配置
+type TLSConfig struct {
+	Enabled        bool                `yaml:"enabled"`
+	CertFile       string              `yaml:"cert_file"`
+	KeyFile        string              `yaml:"key_file"`
+	Certificates   []CertificateConfig `yaml:"certificates"` // 依 SNI 選擇的額外證書
+	MinVersion     string              `yaml:"min_version"`
+	ReloadInterval time.Duration       `yaml:"reload_interval"`
+	ClientAuth     ClientAuthConfig    `yaml:"client_auth"`
+}
+
+// CertificateConfig 證書配置
+type CertificateConfig struct {
+	CertFile    string   `yaml:"cert_file"`
+	KeyFile     string   `yaml:"key_file"`
+	ServerNames []string `yaml:"server_names"` // 未設置時使用證書中的 SAN
+}
+
+// ClientAuthConfig 客戶端證書認證配置
+type ClientAuthConfig struct {
+	Mode       string                 `yaml:"mode"` // none, request, verify_if_given, require
+	CAFile     string                 `yaml:"ca_file"`
+	Identities []ClientIdentityConfig `yaml:"identities"`
+}
+
+// ClientIdentityConfig 客戶端證書身份映射
+// 以證書的 CN 或 SAN（DNS、URI、Email）對應到服務帳號，同時設置兩者時需全部符合
+type ClientIdentityConfig struct {
+	CommonName     string   `yaml:"common_name"`
+	SAN            string   `yaml:"san"`
+	ServiceAccount string   `yaml:"service_account"`
+	CompanyID      string   `yaml:"company_id"`
+	Roles          []string `yaml:"roles"`
+}
+
+// UpstreamTLSConfig 上游服務 TLS 配置
+type UpstreamTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	MinVersion         string `yaml:"min_version"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
 // Load 載入配置
@@ -159,6 +779,9 @@ func (c *Config) setDefaults() {
 	if c.App.Mode == "" {
 		c.App.Mode = "release"
 	}
+	if c.Server.MaxBodySize == 0 {
+		c.Server.MaxBodySize = 32 << 20
+	}
 	if c.App.ReadTimeout == 0 {
 		c.App.ReadTimeout = 30 * time.Second
 	}
@@ -188,7 +811,169 @@ func (c *Config) setDefaults() {
 		c.JWT.RefreshExpiration = 7 * 24 * time.Hour
 	}
 
+	// Token 驗證配置默認值
+	if c.Auth.DefaultValidator == "" {
+		c.Auth.DefaultValidator = "jwt"
+	}
+	if c.Auth.Introspection.Timeout == 0 {
+		c.Auth.Introspection.Timeout = 5 * time.Second
+	}
+	if c.Auth.Introspection.CacheTTL == 0 {
+		c.Auth.Introspection.CacheTTL = 5 * time.Minute
+	}
+	if c.Auth.Introspection.NegativeCacheTTL == 0 {
+		c.Auth.Introspection.NegativeCacheTTL = 30 * time.Second
+	}
+	if c.Auth.Introspection.MaxCacheEntries == 0 {
+		c.Auth.Introspection.MaxCacheEntries = 10000
+	}
+
+	// 代理登入配置默認值
+	if len(c.Auth.Impersonation.AdminRoles) == 0 {
+		c.Auth.Impersonation.AdminRoles = []string{"admin"}
+	}
+	if len(c.Auth.Impersonation.AllowedTargetRoles) == 0 {
+		c.Auth.Impersonation.AllowedTargetRoles = []string{"user", "manager"}
+	}
+	if c.Auth.Impersonation.DefaultRole == "" {
+		c.Auth.Impersonation.DefaultRole = "user"
+	}
+	if c.Auth.Impersonation.TokenTTL == 0 {
+		c.Auth.Impersonation.TokenTTL = 15 * time.Minute
+	}
+
+	// 審計日誌配置默認值
+	if c.Audit.FilePath == "" {
+		c.Audit.FilePath = "logs/audit.jsonl"
+	}
+
+	// 配額配置默認值
+	if c.Quota.FilePath == "" {
+		c.Quota.FilePath = "data/quota.json"
+	}
+	if c.Quota.Timezone == "" {
+		c.Quota.Timezone = "UTC"
+	}
+	if c.Quota.FlushInterval == 0 {
+		c.Quota.FlushInterval = 5 * time.Second
+	}
+
+	// 客戶端 IP 解析配置默認值
+	if len(c.ClientIP.Headers) == 0 {
+		c.ClientIP.Headers = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+	}
+
+	// IP 訪問控制配置默認值
+	if c.IPFilter.DefaultTTL == 0 {
+		c.IPFilter.DefaultTTL = time.Hour
+	}
+	if c.IPFilter.MaxTTL == 0 {
+		c.IPFilter.MaxTTL = 30 * 24 * time.Hour
+	}
+
+	// 並發限制配置默認值
+	if c.Concurrency.RetryAfter == 0 {
+		c.Concurrency.RetryAfter = time.Second
+	}
+
+	// 准入控制配置默認值
+	if c.Admission.MaxInFlight == 0 {
+		c.Admission.MaxInFlight = 1000
+	}
+	if c.Admission.PriorityHeader == "" {
+		c.Admission.PriorityHeader = "X-Request-Priority"
+	}
+	if c.Admission.DefaultPriority == "" {
+		c.Admission.DefaultPriority = "normal"
+	}
+	if c.Admission.RetryAfter == 0 {
+		c.Admission.RetryAfter = time.Second
+	}
+
+	// 登入防護配置默認值
+	if len(c.LoginGuard.UsernameFields) == 0 {
+		c.LoginGuard.UsernameFields = []string{"username", "email", "login"}
+	}
+	if len(c.LoginGuard.FailureStatuses) == 0 {
+		c.LoginGuard.FailureStatuses = []int{401}
+	}
+	if c.LoginGuard.Window == 0 {
+		c.LoginGuard.Window = 15 * time.Minute
+	}
+	if c.LoginGuard.Delay.Base == 0 {
+		c.LoginGuard.Delay.Base = time.Second
+	}
+	if c.LoginGuard.Delay.Max == 0 {
+		c.LoginGuard.Delay.Max = 30 * time.Second
+	}
+	if c.LoginGuard.Lockout.Duration == 0 {
+		c.LoginGuard.Lockout.Duration = 15 * time.Minute
+	}
+	if c.LoginGuard.Lockout.MaxDuration == 0 {
+		c.LoginGuard.Lockout.MaxDuration = 24 * time.Hour
+	}
+	if c.LoginGuard.Challenge.Difficulty == 0 {
+		c.LoginGuard.Challenge.Difficulty = 18
+	}
+	if c.LoginGuard.Challenge.TTL == 0 {
+		c.LoginGuard.Challenge.TTL = 2 * time.Minute
+	}
+	if c.LoginGuard.Challenge.MaxPending == 0 {
+		c.LoginGuard.Challenge.MaxPending = 10000
+	}
+	if c.LoginGuard.Challenge.Timeout == 0 {
+		c.LoginGuard.Challenge.Timeout = 5 * time.Second
+	}
+
+	// 敏感資料遮蔽配置默認值
+	if len(c.Redaction.Fields) == 0 {
+		c.Redaction.Fields = []string{"password", "passwd", "secret", "client_secret", "token", "access_token",
+			"refresh_token", "id_token", "api_key", "authorization", "cookie", "card_number", "account_number",
+			"bank_account", "iban", "national_id"}
+	}
+	if len(c.Redaction.Headers) == 0 {
+		c.Redaction.Headers = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+			"X-API-Key", "X-Captcha-Token"}
+	}
+	if len(c.Redaction.QueryParams) == 0 {
+		c.Redaction.QueryParams = []string{"token", "access_token", "refresh_token", "id_token", "api_key",
+			"apikey", "key", "signature", "sig", "password", "code", "account_number", "bank_account", "card_number"}
+	}
+	if len(c.Redaction.Detectors) == 0 {
+		c.Redaction.Detectors = []string{RedactDetectorJWT, RedactDetectorCard, RedactDetectorIBAN,
+			RedactDetectorNationalID, RedactDetectorEmail}
+	}
+	if c.Redaction.Mask == "" {
+		c.Redaction.Mask = "[REDACTED]"
+	}
+
+	// OIDC 配置默認值
+	if len(c.OIDC.Scopes) == 0 {
+		c.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.OIDC.RefreshBefore == 0 {
+		c.OIDC.RefreshBefore = time.Minute
+	}
+	if c.OIDC.Timeout == 0 {
+		c.OIDC.Timeout = 10 * time.Second
+	}
+	if c.OIDC.Session.Name == "" {
+		c.OIDC.Session.Name = "gw_session"
+	}
+	if c.OIDC.Session.Path == "" {
+		c.OIDC.Session.Path = "/"
+	}
+	if c.OIDC.Session.SameSite == "" {
+		c.OIDC.Session.SameSite = "lax"
+	}
+	if c.OIDC.Session.MaxAge == 0 {
+		c.OIDC.Session.MaxAge = 8 * time.Hour
+	}
+
 	// 限流配置默認值
+	if c.RateLimit.Algorithm == "" {
+		c.RateLimit.Algorithm = "gcra"
+	}
 	if c.RateLimit.GlobalLimit == 0 {
 		c.RateLimit.GlobalLimit = 1000
 	}
@@ -205,6 +990,36 @@ func (c *Config) setDefaults() {
 		c.RateLimit.UserLimit.Window = time.Minute
 	}
 
+	if c.RateLimit.Backend == "" {
+		c.RateLimit.Backend = "memory"
+	}
+	if c.RateLimit.FailMode == "" {
+		c.RateLimit.FailMode = "local"
+	}
+	if c.RateLimit.KeyPrefix == "" {
+		c.RateLimit.KeyPrefix = "gw:rl:"
+	}
+	if c.RateLimit.Headers == "" {
+		c.RateLimit.Headers = "limited"
+	}
+
+	// Redis 配置默認值
+	if c.Redis.Host == "" {
+		c.Redis.Host = "localhost"
+	}
+	if c.Redis.Port == 0 {
+		c.Redis.Port = 6379
+	}
+	if c.Redis.PoolSize == 0 {
+		c.Redis.PoolSize = 10
+	}
+	if c.Redis.DialTimeout == 0 {
+		c.Redis.DialTimeout = time.Second
+	}
+	if c.Redis.Timeout == 0 {
+		c.Redis.Timeout = 200 * time.Millisecond
+	}
+
 	// 監控配置默認值
 	if c.Monitor.MetricsPath == "" {
 		c.Monitor.MetricsPath = "/metrics"
@@ -235,6 +1050,25 @@ func (c *Config) setDefaults() {
 		c.Discovery.Timeout = 5 * time.Second
 	}
 
+	// TLS 配置默認值
+	if c.TLS.MinVersion == "" {
+		c.TLS.MinVersion = "1.2"
+	}
+	if c.TLS.ReloadInterval == 0 {
+		c.TLS.ReloadInterval = time.Minute
+	}
+	if c.TLS.ClientAuth.Mode == "" {
+		c.TLS.ClientAuth.Mode = "none"
+	}
+
+	// CSRF 配置默認值
+	if c.Security.CSRF.CookieName == "" {
+		c.Security.CSRF.CookieName = "gw_csrf"
+	}
+	if c.Security.CSRF.HeaderName == "" {
+		c.Security.CSRF.HeaderName = "X-CSRF-Token"
+	}
+
 	// 安全配置默認值
 	if !c.Security.XSS.Enabled {
 		c.Security.XSS.Enabled = true // 默認啟用 XSS 防護
@@ -242,6 +1076,45 @@ func (c *Config) setDefaults() {
 	if !c.Security.SQLInjection.Enabled {
 		c.Security.SQLInjection.Enabled = true // 默認啟用 SQL 注入防護
 	}
+	if c.Security.XSS.Mode == "" {
+		c.Security.XSS.Mode = SecurityModeBlock
+	}
+	if c.Security.SQLInjection.Mode == "" {
+		c.Security.SQLInjection.Mode = SecurityModeBlock
+	}
+	if c.Security.WAF.ParanoiaLevel == 0 {
+		c.Security.WAF.ParanoiaLevel = 1
+	}
+	if c.Security.WAF.AnomalyThreshold == 0 {
+		c.Security.WAF.AnomalyThreshold = 5
+	}
+	if c.Security.WAF.Multipart.MaxFieldSize == 0 {
+		c.Security.WAF.Multipart.MaxFieldSize = 64 << 10
+	}
+	if c.Security.WAF.Multipart.MaxFields == 0 {
+		c.Security.WAF.Multipart.MaxFields = 100
+	}
+	if c.Security.WAF.Multipart.MemoryLimit == 0 {
+		c.Security.WAF.Multipart.MemoryLimit = 1 << 20
+	}
+	if c.Security.Headers.Upstream == "" {
+		c.Security.Headers.Upstream = UpstreamHeadersPreserve
+	}
+	if c.Security.Headers.FrameOptions == "" {
+		c.Security.Headers.FrameOptions = "DENY"
+	}
+	if c.Security.Headers.ContentTypeOptions == "" {
+		c.Security.Headers.ContentTypeOptions = "nosniff"
+	}
+	if c.Security.Upload.MemoryLimit == 0 {
+		c.Security.Upload.MemoryLimit = 1 << 20
+	}
+	if c.Security.Upload.Scanner.Timeout == 0 {
+		c.Security.Upload.Scanner.Timeout = 30 * time.Second
+	}
+	if c.Security.Upload.Scanner.FailMode == "" {
+		c.Security.Upload.Scanner.FailMode = "closed"
+	}
 }
 
 // validate 驗證配置
@@ -250,12 +1123,49 @@ func (c *Config) validate() error {
 	if c.App.Port <= 0 || c.App.Port > 65535 {
 		return fmt.Errorf("invalid port: %d", c.App.Port)
 	}
+	if c.Server.MaxBodySize < 0 {
+		return fmt.Errorf("server max_body_size cannot be negative")
+	}
 
 	// 驗證 JWT 密鑰
 	if c.JWT.Secret == "" {
 		return fmt.Errorf("JWT secret is required")
 	}
 
+	if err := c.CORS.Validate(); err != nil {
+		return err
+	}
+
+	// 驗證 Token 驗證器配置
+	switch c.Auth.DefaultValidator {
+	case "jwt":
+	case "introspection":
+		if c.Auth.Introspection.Endpoint == "" {
+			return fmt.Errorf("auth.introspection.endpoint is required for introspection validator")
+		}
+	default:
+		return fmt.Errorf("invalid default token validator: %s", c.Auth.DefaultValidator)
+	}
+
+	// 驗證 OIDC 配置
+	if c.OIDC.Enabled {
+		if c.OIDC.Issuer == "" || c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			return fmt.Errorf("oidc issuer, client_id and redirect_url are required when OIDC is enabled")
+		}
+		if len(c.OIDC.Session.Secret) < 32 {
+			return fmt.Errorf("oidc session secret must be at least 32 characters")
+		}
+		switch c.OIDC.Session.SameSite {
+		case "lax", "strict":
+		case "none":
+			if !c.OIDC.Session.Secure {
+				return fmt.Errorf("oidc session same_site none requires secure cookies")
+			}
+		default:
+			return fmt.Errorf("invalid oidc session same_site: %s", c.OIDC.Session.SameSite)
+		}
+	}
+
 	// 驗證限流配置
 	if c.RateLimit.Enabled {
 		if c.RateLimit.GlobalLimit <= 0 {
@@ -267,6 +1177,213 @@ func (c *Config) validate() error {
 		if c.RateLimit.UserLimit.Requests < 0 {
 			return fmt.Errorf("user rate limit requests cannot be negative")
 		}
+		switch c.RateLimit.Algorithm {
+		case "", "sliding_log", "token_bucket", "gcra":
+		default:
+			return fmt.Errorf("invalid rate limit algorithm: %s", c.RateLimit.Algorithm)
+		}
+		switch c.RateLimit.Backend {
+		case "", "memory", "redis":
+		default:
+			return fmt.Errorf("invalid rate limit backend: %s", c.RateLimit.Backend)
+		}
+		switch c.RateLimit.Headers {
+		case "", "limited", "all", "none":
+		default:
+			return fmt.Errorf("invalid rate limit headers mode: %s", c.RateLimit.Headers)
+		}
+		switch c.RateLimit.FailMode {
+		case "", "local", "open", "closed":
+		default:
+			return fmt.Errorf("invalid rate limit fail_mode: %s", c.RateLimit.FailMode)
+		}
+		for name, rule := range c.RateLimit.APILimit {
+			for _, dimension := range rule.KeyBy {
+				if !IsValidRateLimitKeyBy(dimension) {
+					return fmt.Errorf("invalid rate limit key_by %q for api_limit %s", dimension, name)
+				}
+			}
+		}
+		if c.RateLimit.GlobalBurst < 0 || c.RateLimit.IPLimit.Burst < 0 || c.RateLimit.UserLimit.Burst < 0 {
+			return fmt.Errorf("rate limit burst cannot be negative")
+		}
+	}
+
+	// 驗證配額配置
+	if c.Quota.Enabled {
+		if _, err := time.LoadLocation(c.Quota.Timezone); err != nil {
+			return fmt.Errorf("invalid quota timezone: %w", err)
+		}
+		names := make(map[string]bool)
+		for _, policy := range c.Quota.Policies {
+			if policy.Name == "" || names[policy.Name] {
+				return fmt.Errorf("quota policy name must be unique and non-empty: %q", policy.Name)
+			}
+			names[policy.Name] = true
+			if policy.Scope != "company" && policy.Scope != "user" {
+				return fmt.Errorf("invalid quota scope for policy %s: %s", policy.Name, policy.Scope)
+			}
+			if policy.Period != "day" && policy.Period != "month" {
+				return fmt.Errorf("invalid quota period for policy %s: %s", policy.Name, policy.Period)
+			}
+			if policy.Limit < 0 {
+				return fmt.Errorf("quota limit cannot be negative for policy %s", policy.Name)
+			}
+		}
+		for name, cost := range c.Quota.Costs {
+			if cost < 0 {
+				return fmt.Errorf("quota cost cannot be negative for %s", name)
+			}
+		}
+	}
+
+	// 驗證客戶端 IP 解析配置
+	for _, proxy := range c.ClientIP.TrustedProxies {
+		if !isValidIPOrCIDR(proxy) {
+			return fmt.Errorf("invalid client_ip trusted proxy: %s", proxy)
+		}
+	}
+	for _, header := range c.ClientIP.Headers {
+		switch strings.ToLower(header) {
+		case "forwarded", "x-forwarded-for", "x-real-ip":
+		default:
+			return fmt.Errorf("unsupported client_ip header: %s", header)
+		}
+	}
+
+	// 驗證 IP 訪問控制配置
+	if c.IPFilter.Enabled {
+		for _, cidr := range append(append([]string{}, c.IPFilter.Admin.Allow...), c.IPFilter.Admin.Deny...) {
+			if !isValidIPOrCIDR(cidr) {
+				return fmt.Errorf("invalid ip_filter admin address: %s", cidr)
+			}
+		}
+		if c.IPFilter.DefaultTTL < 0 || c.IPFilter.MaxTTL < 0 {
+			return fmt.Errorf("ip_filter ttl cannot be negative")
+		}
+	}
+
+	// 驗證 XSS 與 SQL 注入檢測模式
+	if !IsValidSecurityMode(c.Security.XSS.Mode) {
+		return fmt.Errorf("invalid xss mode: %s", c.Security.XSS.Mode)
+	}
+	if !IsValidSecurityMode(c.Security.SQLInjection.Mode) {
+		return fmt.Errorf("invalid sql_injection mode: %s", c.Security.SQLInjection.Mode)
+	}
+
+	// 驗證 WAF 配置
+	if c.Security.WAF.ParanoiaLevel < 1 || c.Security.WAF.ParanoiaLevel > 4 {
+		return fmt.Errorf("invalid waf paranoia_level: %d", c.Security.WAF.ParanoiaLevel)
+	}
+	if c.Security.WAF.AnomalyThreshold < 0 || c.Security.WAF.ReloadInterval < 0 {
+		return fmt.Errorf("waf anomaly_threshold and reload_interval cannot be negative")
+	}
+	if c.Security.WAF.Multipart.MaxFieldSize < 0 || c.Security.WAF.Multipart.MaxFields < 0 || c.Security.WAF.Multipart.MemoryLimit < 0 {
+		return fmt.Errorf("waf multipart limits cannot be negative")
+	}
+
+	// 驗證安全響應頭配置
+	if c.Security.Headers.Upstream != UpstreamHeadersPreserve && c.Security.Headers.Upstream != UpstreamHeadersOverride {
+		return fmt.Errorf("invalid security headers upstream mode: %s", c.Security.Headers.Upstream)
+	}
+	if c.Security.Headers.HSTS != nil && c.Security.Headers.HSTS.MaxAge < 0 {
+		return fmt.Errorf("security headers hsts max_age cannot be negative")
+	}
+
+	// 驗證上傳檢查配置
+	if c.Security.Upload.MemoryLimit < 0 || c.Security.Upload.Scanner.Timeout < 0 {
+		return fmt.Errorf("upload memory_limit and scanner timeout cannot be negative")
+	}
+	switch c.Security.Upload.Scanner.Type {
+	case "", UploadScannerStub:
+	case UploadScannerClamd:
+		if c.Security.Upload.Scanner.Address == "" {
+			return fmt.Errorf("upload scanner address is required for type clamd")
+		}
+	default:
+		return fmt.Errorf("invalid upload scanner type: %s", c.Security.Upload.Scanner.Type)
+	}
+	if c.Security.Upload.Scanner.FailMode != "open" && c.Security.Upload.Scanner.FailMode != "closed" {
+		return fmt.Errorf("invalid upload scanner fail_mode: %s", c.Security.Upload.Scanner.FailMode)
+	}
+
+	// 驗證並發限制配置
+	if c.Concurrency.RetryAfter < 0 {
+		return fmt.Errorf("concurrency retry_after cannot be negative")
+	}
+
+	// 驗證准入控制配置
+	if c.Admission.Enabled {
+		if c.Admission.MaxInFlight < 0 || c.Admission.TargetLatency < 0 || c.Admission.RetryAfter < 0 {
+			return fmt.Errorf("admission max_in_flight, target_latency and retry_after cannot be negative")
+		}
+		if c.Admission.CPUThreshold < 0 || c.Admission.CPUThreshold > 1 {
+			return fmt.Errorf("admission cpu_threshold must be between 0 and 1")
+		}
+		if !IsValidPriority(c.Admission.DefaultPriority) {
+			return fmt.Errorf("invalid admission default_priority: %s", c.Admission.DefaultPriority)
+		}
+		for role, priority := range c.Admission.RolePriorities {
+			if !IsValidPriority(priority) {
+				return fmt.Errorf("invalid admission priority for role %s: %s", role, priority)
+			}
+		}
+		for priority, threshold := range c.Admission.Thresholds {
+			if !IsValidPriority(priority) || threshold <= 0 {
+				return fmt.Errorf("invalid admission threshold for priority %s", priority)
+			}
+		}
+	}
+
+	// 驗證登入防護配置
+	if c.LoginGuard.Enabled {
+		guard := c.LoginGuard
+		if guard.Window < 0 || guard.Delay.Base < 0 || guard.Delay.Max < 0 ||
+			guard.Lockout.Duration < 0 || guard.Lockout.MaxDuration < 0 || guard.Challenge.TTL < 0 {
+			return fmt.Errorf("login_guard durations cannot be negative")
+		}
+		if guard.MaxUsernamesPerIP < 0 || guard.Delay.After < 0 || guard.Lockout.UserThreshold < 0 ||
+			guard.Lockout.IPThreshold < 0 || guard.Challenge.After < 0 || guard.Challenge.MaxPending < 0 {
+			return fmt.Errorf("login_guard thresholds cannot be negative")
+		}
+		switch guard.Challenge.Type {
+		case "":
+		case LoginChallengePoW:
+			if guard.Challenge.Difficulty < 1 || guard.Challenge.Difficulty > 32 {
+				return fmt.Errorf("login_guard challenge difficulty must be between 1 and 32")
+			}
+		case LoginChallengeCaptcha:
+			if guard.Challenge.VerifyURL == "" || guard.Challenge.Secret == "" {
+				return fmt.Errorf("login_guard challenge verify_url and secret are required for type captcha")
+			}
+		default:
+			return fmt.Errorf("invalid login_guard challenge type: %s", guard.Challenge.Type)
+		}
+	}
+
+	// 驗證敏感資料遮蔽配置
+	for _, detector := range c.Redaction.Detectors {
+		switch detector {
+		case RedactDetectorJWT, RedactDetectorCard, RedactDetectorIBAN, RedactDetectorNationalID, RedactDetectorEmail:
+		default:
+			return fmt.Errorf("invalid redaction detector: %s", detector)
+		}
+	}
+
+	// 驗證 TLS 配置
+	if c.TLS.Enabled {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			return fmt.Errorf("TLS cert_file and key_file are required when TLS is enabled")
+		}
+		switch c.TLS.ClientAuth.Mode {
+		case "none", "request":
+		case "verify_if_given", "require":
+			if c.TLS.ClientAuth.CAFile == "" {
+				return fmt.Errorf("client_auth.ca_file is required for mode %s", c.TLS.ClientAuth.Mode)
+			}
+		default:
+			return fmt.Errorf("invalid client_auth mode: %s", c.TLS.ClientAuth.Mode)
+		}
 	}
 
 	return nil
@@ -283,3 +1400,12 @@ func (c *Config) IsServiceEnabled(serviceName string) bool {
 	_, exists := c.Discovery.Services[serviceName]
 	return exists
 }
+
+// isValidIPOrCIDR 檢查是否為有效的 IP 或 CIDR
+func isValidIPOrCIDR(value string) bool {
+	if strings.Contains(value, "/") {
+		_, _, err := net.ParseCIDR(value)
+		return err == nil
+	}
+	return net.ParseIP(value) != nil
+}
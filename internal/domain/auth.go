@@ -13,6 +13,8 @@ type AuthUser struct {
 	CompanyID string   `json:"company_id"`
 	Role      string   `json:"role"`
 	Roles     []string `json:"roles"`
+
+	ImpersonatorID string `json:"impersonator_id,omitempty"` // 代理登入時為執行代理的管理員ID
 }
 
 // HasRole 檢查用戶是否具有指定角色
@@ -28,6 +30,11 @@ func (u *AuthUser) HasRole(role string) bool {
 	return false
 }
 
+// IsImpersonated 檢查是否為管理員代理登入的身份
+func (u *AuthUser) IsImpersonated() bool {
+	return u.ImpersonatorID != ""
+}
+
 // BelongsToCompany 檢查用戶是否屬於指定公司
 func (u *AuthUser) BelongsToCompany(companyID string) bool {
 	return u.CompanyID == companyID
@@ -45,6 +52,8 @@ type JWTClaims struct {
 	Iat       int64    `json:"iat"`
 	IssuedAt  int64    `json:"issued_at"`
 	ExpiresAt int64    `json:"expires_at"`
+
+	ImpersonatorID string `json:"impersonator_id,omitempty"` // 代理登入 token 的簽發管理員
 }
 
 // ToAuthUser 將 JWTClaims 轉換為 AuthUser
@@ -56,6 +65,8 @@ func (c *JWTClaims) ToAuthUser() *AuthUser {
 		CompanyID: c.CompanyID,
 		Role:      c.Role,
 		Roles:     c.Roles,
+
+		ImpersonatorID: c.ImpersonatorID,
 	}
 }
 
@@ -82,6 +93,12 @@ type AuthResult struct {
 	Message string        `json:"message"`
 }
 
+// TokenValidator Token 驗證器介面
+// 本地 JWT 驗證與 OAuth2 Token Introspection 皆實現此介面
+type TokenValidator interface {
+	ValidateToken(tokenString string) (*AuthResult, error)
+}
+
 // JWTConfig JWT 配置
 type JWTConfig struct {
 	Secret            string        `json:"secret"`
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"expense-api-gateway/internal/config"
@@ -367,35 +368,92 @@ func (h *Handler) ToggleMaintenanceMode(c *gin.Context) {
 	})
 }
 
-// GetRateLimitStats 獲取限流統計
+// GetRateLimitStats 獲取限流統計，可用 top 參數指定每個限流器返回的被拒絕最多的 key 數量
 func (h *Handler) GetRateLimitStats(c *gin.Context) {
-	if h.rateLimitMiddleware != nil {
-		stats := h.rateLimitMiddleware.GetRateLimitStats()
-		c.JSON(http.StatusOK, stats)
+	if h.rateLimitMiddleware == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Rate limiting not enabled",
+		})
+		return
+	}
+
+	top, _ := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(ratelimit.DefaultTopKeys)))
+	c.JSON(http.StatusOK, h.rateLimitMiddleware.GetRateLimitStats(top))
+}
+
+// GetRateLimitKey 查詢限流 key 在各限流器中的當前狀態
+func (h *Handler) GetRateLimitKey(c *gin.Context) {
+	if h.rateLimitMiddleware == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Rate limiting not enabled",
+		})
+		return
+	}
+
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "key is required",
+		})
+		return
+	}
+
+	states := h.rateLimitMiddleware.LookupKey(key)
+	if len(states) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Rate limit key not found",
+		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "error",
-		"message": "Rate limiting not enabled",
+		"status": "success",
+		"data":   states,
 	})
 }
 
-// ResetRateLimit 重置限流
+// ResetRateLimit 重置限流，以 key 指定單個 key，或以 pattern 指定匹配模式（* 匹配任意字符）
 func (h *Handler) ResetRateLimit(c *gin.Context) {
-	key := c.Query("key")
-	if h.rateLimitMiddleware != nil {
-		h.rateLimitMiddleware.ResetRateLimit(key)
+	if h.rateLimitMiddleware == nil {
 		c.JSON(http.StatusOK, gin.H{
-			"status":  "success",
-			"message": "Rate limit reset successfully",
+			"status":  "error",
+			"message": "Rate limiting not enabled",
 		})
 		return
 	}
 
+	key := c.Query("key")
+	pattern := c.Query("pattern")
+	if (key == "") == (pattern == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Exactly one of key or pattern is required",
+		})
+		return
+	}
+
+	var reset int
+	if key != "" {
+		reset = h.rateLimitMiddleware.ResetRateLimit(key)
+	} else {
+		reset = h.rateLimitMiddleware.ResetPattern(pattern)
+	}
+
+	h.logger.Info("Rate limit reset",
+		zap.String("key", key),
+		zap.String("pattern", pattern),
+		zap.Int("reset", reset))
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "error",
-		"message": "Rate limiting not enabled",
+		"status":  "success",
+		"message": "Rate limit reset successfully",
+		"data": gin.H{
+			"reset": reset,
+		},
 	})
 }
 
@@ -0,0 +1,91 @@
+package claims
+
+import (
+	"fmt"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+)
+
+// WithDefaults 補齊預設欄位映射
+func WithDefaults(mapping config.ClaimMapping) config.ClaimMapping {
+	if mapping.UserID == "" {
+		mapping.UserID = "sub"
+	}
+	if mapping.Username == "" {
+		mapping.Username = "username"
+	}
+	if mapping.Email == "" {
+		mapping.Email = "email"
+	}
+	if mapping.CompanyID == "" {
+		mapping.CompanyID = "company_id"
+	}
+	if mapping.Role == "" {
+		mapping.Role = "role"
+	}
+	if mapping.Roles == "" {
+		mapping.Roles = "roles"
+	}
+	return mapping
+}
+
+// ToAuthUser 依欄位映射將聲明轉換為 AuthUser
+func ToAuthUser(values map[string]interface{}, mapping config.ClaimMapping) *domain.AuthUser {
+	user := &domain.AuthUser{
+		ID:        String(values, mapping.UserID),
+		Username:  String(values, mapping.Username),
+		Email:     String(values, mapping.Email),
+		CompanyID: String(values, mapping.CompanyID),
+		Role:      String(values, mapping.Role),
+		Roles:     List(values, mapping.Roles),
+	}
+
+	if user.Role == "" && len(user.Roles) > 0 {
+		user.Role = user.Roles[0]
+	}
+
+	return user
+}
+
+// String 讀取字串欄位
+func String(values map[string]interface{}, field string) string {
+	switch value := values[field].(type) {
+	case string:
+		return value
+	case float64:
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return ""
+	}
+}
+
+// List 讀取字串陣列欄位，字串時以空格分隔
+func List(values map[string]interface{}, field string) []string {
+	switch value := values[field].(type) {
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	case []string:
+		return value
+	case string:
+		return strings.Fields(value)
+	default:
+		return nil
+	}
+}
+
+// Int64 讀取數值欄位
+func Int64(values map[string]interface{}, field string) (int64, bool) {
+	value, ok := values[field].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int64(value), true
+}
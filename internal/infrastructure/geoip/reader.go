@@ -0,0 +1,397 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// metadataMarker MaxMind DB 元數據起始標記
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator 搜索樹與數據區之間的 16 個零字節
+const dataSectionSeparator = 16
+
+// ErrInvalidDatabase 數據庫文件格式錯誤
+var ErrInvalidDatabase = errors.New("geoip: invalid MaxMind DB file")
+
+// Metadata 數據庫元數據
+type Metadata struct {
+	DatabaseType string
+	IPVersion    int
+	RecordSize   int
+	NodeCount    uint32
+}
+
+// Reader MaxMind DB (MMDB) 格式的只讀解析器，整個文件載入記憶體
+type Reader struct {
+	buffer      []byte
+	metadata    Metadata
+	treeSize    int
+	ipv4Start   uint32
+	ipv4Resolve bool
+}
+
+// Open 讀取並解析數據庫文件
+func Open(path string) (*Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: read database: %w", err)
+	}
+	return FromBytes(data)
+}
+
+// FromBytes 從記憶體中的數據庫內容創建解析器
+func FromBytes(buffer []byte) (*Reader, error) {
+	start := bytes.LastIndex(buffer, metadataMarker)
+	if start < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	metaStart := start + len(metadataMarker)
+	d := decoder{buffer: buffer[metaStart:]}
+	raw, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: decode metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	r := &Reader{buffer: buffer[:start]}
+	r.metadata.DatabaseType, _ = meta["database_type"].(string)
+	r.metadata.IPVersion = int(toUint(meta["ip_version"]))
+	r.metadata.RecordSize = int(toUint(meta["record_size"]))
+	r.metadata.NodeCount = uint32(toUint(meta["node_count"]))
+
+	switch r.metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", r.metadata.RecordSize)
+	}
+	if r.metadata.IPVersion != 4 && r.metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported ip version %d", r.metadata.IPVersion)
+	}
+
+	r.treeSize = int(r.metadata.NodeCount) * r.metadata.RecordSize / 4
+	if r.treeSize+dataSectionSeparator > len(r.buffer) {
+		return nil, ErrInvalidDatabase
+	}
+
+	// IPv6 數據庫中的 IPv4 地址位於 ::/96 下
+	if r.metadata.IPVersion == 6 {
+		node := uint32(0)
+		for i := 0; i < 96 && node < r.metadata.NodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+		r.ipv4Resolve = true
+	}
+	return r, nil
+}
+
+// Metadata 返回數據庫元數據
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup 查詢 IP 對應的記錄，沒有記錄時返回 nil
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	pointer, err := r.lookupPointer(ip)
+	if err != nil || pointer == 0 {
+		return nil, err
+	}
+
+	offset := int(pointer) - int(r.metadata.NodeCount) - dataSectionSeparator
+	d := decoder{buffer: r.buffer[r.treeSize+dataSectionSeparator:]}
+	value, _, err := d.decode(offset)
+	return value, err
+}
+
+// Country 查詢 IP 所屬國家的 ISO 代碼，優先使用 country，沒有時使用 registered_country
+func (r *Reader) Country(ip net.IP) (string, error) {
+	record, err := r.Lookup(ip)
+	if err != nil || record == nil {
+		return "", err
+	}
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		country, ok := fields[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if code, ok := country["iso_code"].(string); ok && code != "" {
+			return code, nil
+		}
+	}
+	return "", nil
+}
+
+// lookupPointer 走訪搜索樹，返回數據指針（0 表示沒有記錄）
+func (r *Reader) lookupPointer(ip net.IP) (uint32, error) {
+	bitCount := 128
+	node := uint32(0)
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+		bitCount = 32
+		if r.ipv4Resolve {
+			node = r.ipv4Start
+		}
+	} else if r.metadata.IPVersion == 4 {
+		return 0, fmt.Errorf("geoip: cannot look up IPv6 address in IPv4-only database")
+	} else {
+		ip = ip.To16()
+	}
+
+	nodeCount := r.metadata.NodeCount
+	for i := 0; i < bitCount && node < nodeCount; i++ {
+		bit := (ip[i>>3] >> (7 - uint(i&7))) & 1
+		node = r.readNode(node, int(bit))
+	}
+
+	switch {
+	case node == nodeCount:
+		return 0, nil
+	case node > nodeCount:
+		return node, nil
+	default:
+		return 0, ErrInvalidDatabase
+	}
+}
+
+// readNode 讀取節點的左 (0) 或右 (1) 記錄
+func (r *Reader) readNode(node uint32, index int) uint32 {
+	switch r.metadata.RecordSize {
+	case 24:
+		offset := int(node)*6 + index*3
+		b := r.buffer[offset : offset+3]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		offset := int(node) * 7
+		b := r.buffer[offset : offset+7]
+		if index == 0 {
+			return uint32(b[3]&0xf0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0f)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		offset := int(node)*8 + index*4
+		return binary.BigEndian.Uint32(r.buffer[offset : offset+4])
+	}
+}
+
+// MMDB 數據類型
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// maxDecodeDepth 限制巢狀深度，避免惡意文件造成無限遞迴
+const maxDecodeDepth = 32
+
+// decoder 數據區解碼器
+type decoder struct {
+	buffer []byte
+	depth  int
+}
+
+// decode 解碼 offset 處的值，返回值與下一個值的位置
+func (d *decoder) decode(offset int) (interface{}, int, error) {
+	if d.depth > maxDecodeDepth {
+		return nil, 0, ErrInvalidDatabase
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	if offset < 0 || offset >= len(d.buffer) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buffer[offset]
+	offset++
+	kind := int(ctrl >> 5)
+
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		if offset >= len(d.buffer) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		kind = 7 + int(d.buffer[offset])
+		offset++
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case typeMap:
+		result := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[name] = value
+			offset = next
+		}
+		return result, offset, nil
+	case typeArray:
+		result := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.buffer) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	raw := d.buffer[offset : offset+size]
+	next := offset + size
+
+	switch kind {
+	case typeString:
+		return string(raw), next, nil
+	case typeBytes:
+		return append([]byte(nil), raw...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return decodeUint(raw), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return int32(uint32(decodeUint(raw))), next, nil
+	case typeUint128:
+		// 僅保留原始字節，網關不需要此類型的數值
+		return append([]byte(nil), raw...), next, nil
+	default:
+		return nil, 0, fmt.Errorf("geoip: unsupported data type %d", kind)
+	}
+}
+
+// size 解析控制字節中的長度
+func (d *decoder) size(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl & 0x1f)
+	extra := 0
+	switch size {
+	case 29:
+		extra = 1
+	case 30:
+		extra = 2
+	case 31:
+		extra = 3
+	default:
+		return size, offset, nil
+	}
+	if offset+extra > len(d.buffer) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	value := int(decodeUint(d.buffer[offset : offset+extra]))
+	switch size {
+	case 29:
+		size = 29 + value
+	case 30:
+		size = 285 + value
+	default:
+		size = 65821 + value
+	}
+	return size, offset + extra, nil
+}
+
+// pointer 解析指針，返回指向的位置與指針之後的位置
+func (d *decoder) pointer(ctrl byte, offset int) (int, int, error) {
+	pointerSize := int((ctrl>>3)&0x3) + 1
+	if offset+pointerSize > len(d.buffer) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	raw := d.buffer[offset : offset+pointerSize]
+	next := offset + pointerSize
+
+	prefix := uint64(ctrl & 0x7)
+	switch pointerSize {
+	case 1:
+		return int(prefix<<8 | decodeUint(raw)), next, nil
+	case 2:
+		return int(prefix<<16|decodeUint(raw)) + 2048, next, nil
+	case 3:
+		return int(prefix<<24|decodeUint(raw)) + 526336, next, nil
+	default:
+		return int(decodeUint(raw)), next, nil
+	}
+}
+
+// decodeUint 解碼大端序無符號整數
+func decodeUint(raw []byte) uint64 {
+	var value uint64
+	for _, b := range raw {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// toUint 將元數據中的整數轉為 uint64
+func toUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int32:
+		return uint64(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,243 @@
+package introspection
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/infrastructure/claims"
+
+	"go.uber.org/zap"
+)
+
+// cacheEntry 快取的驗證結果
+type cacheEntry struct {
+	user      *domain.AuthUser // nil 表示 token 無效
+	expiresAt time.Time
+}
+
+// Validator OAuth2 Token Introspection (RFC 7662) 驗證器
+type Validator struct {
+	config     config.IntrospectionConfig
+	mapping    config.ClaimMapping
+	logger     *zap.Logger
+	httpClient *http.Client
+	cache      map[string]*cacheEntry
+	mutex      sync.RWMutex
+	now        func() time.Time
+}
+
+// NewValidator 創建新的 Introspection 驗證器
+func NewValidator(cfg config.IntrospectionConfig, logger *zap.Logger) *Validator {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &Validator{
+		config:     cfg,
+		mapping:    claims.WithDefaults(cfg.FieldMapping),
+		logger:     logger,
+		httpClient: &http.Client{Timeout: timeout},
+		cache:      make(map[string]*cacheEntry),
+		now:        time.Now,
+	}
+}
+
+// ValidateToken 透過 introspection 端點驗證 token，實現 domain.TokenValidator
+func (v *Validator) ValidateToken(tokenString string) (*domain.AuthResult, error) {
+	if tokenString == "" {
+		return invalidResult("Invalid token format"), domain.ErrInvalidToken
+	}
+
+	key := cacheKey(tokenString)
+	if entry, found := v.lookup(key); found {
+		if entry.user == nil {
+			return invalidResult("Token is not active"), domain.ErrInvalidToken
+		}
+		return validResult(entry.user), nil
+	}
+
+	response, err := v.introspect(tokenString)
+	if err != nil {
+		// 端點錯誤不快取，下次請求重試
+		v.logger.Warn("Token introspection failed", zap.Error(err))
+		return invalidResult("Token validation failed"), err
+	}
+
+	if !v.isActive(response) {
+		v.store(key, nil, v.config.NegativeCacheTTL)
+		return invalidResult("Token is not active"), domain.ErrInvalidToken
+	}
+
+	user := claims.ToAuthUser(response, v.mapping)
+	v.store(key, user, v.positiveTTL(response))
+
+	v.logger.Debug("Token introspected successfully",
+		zap.String("user_id", user.ID),
+		zap.String("company_id", user.CompanyID))
+
+	return validResult(user), nil
+}
+
+// introspect 調用 introspection 端點
+func (v *Validator) introspect(tokenString string) (map[string]interface{}, error) {
+	form := url.Values{}
+	form.Set("token", tokenString)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequest(http.MethodPost, v.config.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.config.ClientID), url.QueryEscape(v.config.ClientSecret))
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned status %d", resp.StatusCode)
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+
+	return response, nil
+}
+
+// isActive 檢查 token 是否有效
+func (v *Validator) isActive(response map[string]interface{}) bool {
+	active, _ := response["active"].(bool)
+	if !active {
+		return false
+	}
+
+	if exp, ok := claims.Int64(response, "exp"); ok && v.now().Unix() >= exp {
+		return false
+	}
+	if nbf, ok := claims.Int64(response, "nbf"); ok && v.now().Unix() < nbf {
+		return false
+	}
+
+	return true
+}
+
+// positiveTTL 計算有效 token 的快取時間，不超過 token 的過期時間
+func (v *Validator) positiveTTL(response map[string]interface{}) time.Duration {
+	ttl := v.config.CacheTTL
+	if exp, ok := claims.Int64(response, "exp"); ok {
+		remaining := time.Unix(exp, 0).Sub(v.now())
+		if ttl <= 0 || remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl
+}
+
+// lookup 查詢快取
+func (v *Validator) lookup(key string) (*cacheEntry, bool) {
+	v.mutex.RLock()
+	entry, exists := v.cache[key]
+	v.mutex.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+	if !v.now().Before(entry.expiresAt) {
+		v.mutex.Lock()
+		delete(v.cache, key)
+		v.mutex.Unlock()
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// store 寫入快取
+func (v *Validator) store(key string, user *domain.AuthUser, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.config.MaxCacheEntries > 0 && len(v.cache) >= v.config.MaxCacheEntries {
+		v.evict()
+	}
+
+	v.cache[key] = &cacheEntry{
+		user:      user,
+		expiresAt: v.now().Add(ttl),
+	}
+}
+
+// evict 清理過期快取，仍超出上限時移除部分項目（需持有寫鎖）
+func (v *Validator) evict() {
+	now := v.now()
+	for key, entry := range v.cache {
+		if !now.Before(entry.expiresAt) {
+			delete(v.cache, key)
+		}
+	}
+
+	for key := range v.cache {
+		if len(v.cache) < v.config.MaxCacheEntries {
+			break
+		}
+		delete(v.cache, key)
+	}
+}
+
+// CacheSize 獲取目前快取數量
+func (v *Validator) CacheSize() int {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return len(v.cache)
+}
+
+// SetClock 設置時間來源（用於測試）
+func (v *Validator) SetClock(now func() time.Time) {
+	v.now = now
+}
+
+// cacheKey 以 token 雜湊作為快取鍵，避免在記憶體中保存原始 token
+func cacheKey(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+// validResult 創建驗證成功結果
+func validResult(user *domain.AuthUser) *domain.AuthResult {
+	return &domain.AuthResult{
+		Success: true,
+		User:    user,
+		Message: "Token validated successfully",
+	}
+}
+
+// invalidResult 創建驗證失敗結果
+func invalidResult(message string) *domain.AuthResult {
+	return &domain.AuthResult{
+		Success: false,
+		Error:   domain.ErrInvalidToken,
+		Message: message,
+	}
+}
@@ -1,10 +1,14 @@
 package jwt
 
 import (
+	"fmt"
+	"sort"
+	"time"
+
 	"expense-api-gateway/internal/config"
 	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/infrastructure/introspection"
 	"expense-api-gateway/pkg/auth"
-	"time"
 
 	"go.uber.org/zap"
 )
@@ -14,8 +18,17 @@ type JWTService struct {
 	manager *auth.JWTManager
 	config  *config.Config
 	logger  *zap.Logger
+
+	validators       map[string]domain.TokenValidator
+	defaultValidator string
 }
 
+// 驗證器名稱
+const (
+	ValidatorJWT           = "jwt"
+	ValidatorIntrospection = "introspection"
+)
+
 // NewJWTService 創建新的 JWT 服務
 func NewJWTService(cfg *config.Config, logger *zap.Logger) *JWTService {
 	manager := auth.NewJWTManager(
@@ -25,15 +38,89 @@ func NewJWTService(cfg *config.Config, logger *zap.Logger) *JWTService {
 		"expense-api-gateway",
 	)
 
-	return &JWTService{
+	defaultValidator := cfg.Auth.DefaultValidator
+	if defaultValidator == "" {
+		defaultValidator = ValidatorJWT
+	}
+
+	svc := &JWTService{
+		manager:          manager,
+		config:           cfg,
+		logger:           logger,
+		validators:       make(map[string]domain.TokenValidator),
+		defaultValidator: defaultValidator,
+	}
+
+	svc.RegisterValidator(ValidatorJWT, NewLocalValidator(manager, logger))
+	if cfg.Auth.Introspection.Endpoint != "" {
+		svc.RegisterValidator(ValidatorIntrospection, introspection.NewValidator(cfg.Auth.Introspection, logger))
+	}
+
+	return svc
+}
+
+// ValidateToken 使用預設驗證器驗證 Token
+func (j *JWTService) ValidateToken(tokenString string) (*domain.AuthResult, error) {
+	return j.ValidateTokenWith("", tokenString)
+}
+
+// ValidateTokenWith 使用指定驗證器驗證 Token，name 為空時使用預設驗證器
+func (j *JWTService) ValidateTokenWith(name, tokenString string) (*domain.AuthResult, error) {
+	validator, err := j.Validator(name)
+	if err != nil {
+		return &domain.AuthResult{
+			Success: false,
+			Error:   domain.ErrInvalidToken,
+			Message: "Token validation failed",
+		}, err
+	}
+	return validator.ValidateToken(tokenString)
+}
+
+// Validator 獲取指定名稱的驗證器
+func (j *JWTService) Validator(name string) (domain.TokenValidator, error) {
+	if name == "" {
+		name = j.defaultValidator
+	}
+
+	validator, exists := j.validators[name]
+	if !exists {
+		return nil, fmt.Errorf("token validator not found: %s", name)
+	}
+	return validator, nil
+}
+
+// ValidatorNames 返回已註冊的驗證器名稱
+func (j *JWTService) ValidatorNames() []string {
+	names := make([]string, 0, len(j.validators))
+	for name := range j.validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterValidator 註冊 Token 驗證器
+func (j *JWTService) RegisterValidator(name string, validator domain.TokenValidator) {
+	j.validators[name] = validator
+}
+
+// LocalValidator 本地 JWT 驗證器
+type LocalValidator struct {
+	manager *auth.JWTManager
+	logger  *zap.Logger
+}
+
+// NewLocalValidator 創建新的本地 JWT 驗證器
+func NewLocalValidator(manager *auth.JWTManager, logger *zap.Logger) *LocalValidator {
+	return &LocalValidator{
 		manager: manager,
-		config:  cfg,
 		logger:  logger,
 	}
 }
 
-// ValidateToken 驗證 JWT Token
-func (j *JWTService) ValidateToken(tokenString string) (*domain.AuthResult, error) {
+// ValidateToken 驗證本地簽發的 JWT Token
+func (j *LocalValidator) ValidateToken(tokenString string) (*domain.AuthResult, error) {
 	// 驗證 Token 格式
 	if err := auth.ValidateTokenString(tokenString); err != nil {
 		j.logger.Debug("Invalid token format", zap.Error(err))
@@ -98,6 +185,21 @@ func (j *JWTService) GenerateToken(user *domain.AuthUser) (*auth.TokenPair, erro
 	return tokenPair, nil
 }
 
+// GenerateImpersonationToken 生成短效的代理登入 Token（不含刷新 Token）
+func (j *JWTService) GenerateImpersonationToken(target *domain.AuthUser, expiry time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(expiry)
+	token, err := j.manager.GenerateTokenWithExpiry(target, expiry)
+	if err != nil {
+		j.logger.Error("Failed to generate impersonation token",
+			zap.String("user_id", target.ID),
+			zap.String("impersonator_id", target.ImpersonatorID),
+			zap.Error(err))
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
 // RefreshToken 刷新 Token
 func (j *JWTService) RefreshToken(refreshToken string, user *domain.AuthUser) (*auth.TokenPair, error) {
 	accessToken, newRefreshToken, err := j.manager.RefreshToken(refreshToken, user)
@@ -175,6 +277,9 @@ func (j *JWTService) CreateAuthHeaders(user *domain.AuthUser) map[string]string
 		"X-User-Role":  user.Role,
 		"X-User-Email": user.Email,
 	}
+	if user.ImpersonatorID != "" {
+		headers["X-Impersonator-ID"] = user.ImpersonatorID
+	}
 
 	j.logger.Debug("Created auth headers",
 		zap.String("user_id", user.ID),
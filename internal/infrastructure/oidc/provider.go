@@ -0,0 +1,343 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// jwksRefreshInterval JWKS 遇到未知 kid 時的最短重新下載間隔
+const jwksRefreshInterval = 30 * time.Second
+
+// Discovery OIDC 發現文件
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// TokenResponse Token 端點回應
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// jsonWebKey JWKS 中的單個公鑰
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Provider OIDC 身份提供者客戶端
+type Provider struct {
+	config     config.OIDCConfig
+	logger     *zap.Logger
+	httpClient *http.Client
+
+	discovery   *Discovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+	mutex       sync.Mutex
+}
+
+// NewProvider 創建新的 OIDC 提供者客戶端
+// 發現文件在首次使用時才載入，避免 IdP 暫時不可用時阻擋網關啟動
+func NewProvider(cfg config.OIDCConfig, logger *zap.Logger) *Provider {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &Provider{
+		config:     cfg,
+		logger:     logger,
+		httpClient: &http.Client{Timeout: timeout},
+		keys:       make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Discover 載入 OIDC 發現文件
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var discovery Discovery
+	if err := p.getJSON(wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC discovery: %w", err)
+	}
+
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: expected %s, got %s", p.config.Issuer, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete OIDC discovery document")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// AuthCodeURL 產生授權端點 URL（PKCE S256）
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange 以授權碼交換 token
+func (p *Provider) Exchange(code, codeVerifier string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	return p.tokenRequest(form)
+}
+
+// Refresh 以 refresh token 取得新 token
+func (p *Provider) Refresh(refreshToken string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return p.tokenRequest(form)
+}
+
+// VerifyIDToken 驗證 ID Token 的簽名、issuer、audience、有效期與 nonce
+// nonce 為空時不檢查（如刷新時取得的 ID Token）
+func (p *Provider) VerifyIDToken(rawIDToken, nonce string) (map[string]interface{}, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwtlib.MapClaims{}
+	parser := jwtlib.NewParser(jwtlib.WithValidMethods([]string{"RS256", "RS384", "RS512"}))
+	_, err = parser.ParseWithClaims(rawIDToken, claims, func(token *jwtlib.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(discovery.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(p.config.Issuer, true) {
+		return nil, fmt.Errorf("invalid ID token issuer")
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, fmt.Errorf("invalid ID token audience")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("ID token has expired")
+	}
+	if nonce != "" {
+		tokenNonce, _ := claims["nonce"].(string)
+		if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+			return nil, fmt.Errorf("invalid ID token nonce")
+		}
+	}
+
+	return claims, nil
+}
+
+// EndSessionURL 產生 IdP 登出 URL，IdP 不支援時返回空字串
+func (p *Provider) EndSessionURL(idTokenHint, postLogoutRedirect string) string {
+	discovery, err := p.Discover()
+	if err != nil || discovery.EndSessionEndpoint == "" {
+		return ""
+	}
+
+	params := url.Values{}
+	params.Set("client_id", p.config.ClientID)
+	if idTokenHint != "" {
+		params.Set("id_token_hint", idTokenHint)
+	}
+	if postLogoutRedirect != "" {
+		params.Set("post_logout_redirect_uri", postLogoutRedirect)
+	}
+	return discovery.EndSessionEndpoint + "?" + params.Encode()
+}
+
+// tokenRequest 調用 token 端點
+func (p *Provider) tokenRequest(form url.Values) (*TokenResponse, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var token TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	return &token, nil
+}
+
+// publicKey 依 kid 查找 JWKS 公鑰，找不到時重新下載
+func (p *Provider) publicKey(jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetched) < jwksRefreshInterval && len(p.keys) > 0 {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+
+	if err := p.fetchKeys(jwksURI); err != nil {
+		return nil, err
+	}
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key: %s", kid)
+}
+
+// lookupKey 查找公鑰（需持有鎖），kid 為空且只有一把公鑰時直接使用
+func (p *Provider) lookupKey(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// fetchKeys 下載 JWKS（需持有鎖）
+func (p *Provider) fetchKeys(jwksURI string) error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to load JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			p.logger.Warn("Skipping invalid JWKS key", zap.String("kid", jwk.Kid), zap.Error(err))
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+	return nil
+}
+
+// getJSON 下載並解析 JSON 文件
+func (p *Provider) getJSON(target string, out interface{}) error {
+	resp, err := p.httpClient.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, target)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// parseRSAKey 將 JWK 轉換為 RSA 公鑰
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent too large")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// CodeChallenge 計算 PKCE S256 code challenge
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,98 @@
+package oidc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"expense-api-gateway/internal/domain"
+)
+
+// Session 網關管理的登入會話，加密後存放於 HttpOnly Cookie
+type Session struct {
+	User         *domain.AuthUser `json:"user"`
+	RefreshToken string           `json:"refresh_token,omitempty"`
+	IDToken      string           `json:"id_token,omitempty"`
+	ExpiresAt    int64            `json:"expires_at"` // access token 到期時間，用於判斷靜默刷新
+	IssuedAt     int64            `json:"issued_at"`  // 會話建立時間，用於絕對有效期
+}
+
+// LoginState 登入流程暫存狀態（state、nonce、PKCE verifier）
+type LoginState struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	ReturnTo     string `json:"return_to,omitempty"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// Codec 使用 AES-GCM 加密與解密 Cookie 內容
+type Codec struct {
+	aead cipher.AEAD
+}
+
+// NewCodec 以密鑰創建新的 Cookie 編解碼器
+func NewCodec(secret string) (*Codec, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &Codec{aead: aead}, nil
+}
+
+// Encode 加密數據，name 作為附加驗證數據以防止 Cookie 互換
+func (c *Codec) Encode(name string, value interface{}) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cookie value: %w", err)
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, plaintext, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode 解密數據
+func (c *Codec) Decode(name, encoded string, value interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid cookie encoding: %w", err)
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return fmt.Errorf("cookie value too short")
+	}
+
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt cookie: %w", err)
+	}
+
+	return json.Unmarshal(plaintext, value)
+}
+
+// RandomString 產生 URL 安全的隨機字串
+func RandomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,169 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// core 遮蔽日誌訊息與字段的 zapcore.Core
+type core struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+// NewCore 包裝 zapcore.Core，寫入前遮蔽訊息與字段；redactor 為 nil 時返回原 core
+// 鍵名敏感的字段整體遮蔽，字符串、錯誤與 Stringer 字段遮蔽檢測到的敏感值
+// zap.Any、zap.Strings、zap.Object 等結構化字段先編碼為 JSON 值，再逐層遮蔽敏感鍵與字符串
+func NewCore(inner zapcore.Core, redactor *Redactor) zapcore.Core {
+	if redactor == nil {
+		return inner
+	}
+	return &core{Core: inner, redactor: redactor}
+}
+
+// Logger 返回寫入前遮蔽敏感資料的日誌記錄器
+func Logger(logger *zap.Logger, redactor *Redactor) *zap.Logger {
+	if redactor == nil {
+		return logger
+	}
+	return logger.WithOptions(zap.WrapCore(func(inner zapcore.Core) zapcore.Core {
+		return NewCore(inner, redactor)
+	}))
+}
+
+// With 實現 zapcore.Core
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{Core: c.Core.With(c.fields(fields)), redactor: c.redactor}
+}
+
+// Check 實現 zapcore.Core，使 Write 經過遮蔽
+func (c *core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write 實現 zapcore.Core
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.redactor.String(entry.Message)
+	return c.Core.Write(entry, c.fields(fields))
+}
+
+// fields 返回遮蔽後的字段副本
+func (c *core) fields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = c.field(field)
+	}
+	return redacted
+}
+
+// field 遮蔽單個字段
+func (c *core) field(field zapcore.Field) zapcore.Field {
+	switch field.Type {
+	case zapcore.NamespaceType, zapcore.SkipType:
+		return field
+	}
+	if c.redactor.SensitiveField(field.Key) {
+		return zap.String(field.Key, c.redactor.Mask())
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = c.redactor.String(field.String)
+	case zapcore.ByteStringType:
+		if value, ok := field.Interface.([]byte); ok {
+			return zap.String(field.Key, c.redactor.String(string(value)))
+		}
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok && err != nil {
+			return zap.String(field.Key, c.redactor.String(err.Error()))
+		}
+	case zapcore.StringerType:
+		if value, ok := stringerValue(field.Interface); ok {
+			return zap.String(field.Key, c.redactor.String(value))
+		}
+	case zapcore.ReflectType:
+		return c.reflected(field.Key, field.Interface)
+	case zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType:
+		encoder := zapcore.NewMapObjectEncoder()
+		field.AddTo(encoder)
+		return c.reflected(field.Key, encoder.Fields[field.Key])
+	case zapcore.InlineMarshalerType:
+		encoder := zapcore.NewMapObjectEncoder()
+		field.AddTo(encoder)
+		redacted, _ := c.value(jsonValue(encoder.Fields)).(map[string]interface{})
+		return zap.Inline(zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for key, value := range redacted {
+				if err := enc.AddReflected(key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+	return field
+}
+
+// reflected 以 JSON 編碼結構化字段的值後遮蔽
+func (c *core) reflected(key string, value interface{}) zapcore.Field {
+	return zap.Reflect(key, c.value(jsonValue(value)))
+}
+
+// value 逐層遮蔽 JSON 值：鍵名敏感的值整體遮蔽，字符串遮蔽檢測到的敏感值
+func (c *core) value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if c.redactor.SensitiveField(key) {
+				v[key] = c.redactor.Mask()
+			} else {
+				v[key] = c.value(item)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = c.value(item)
+		}
+		return v
+	case string:
+		return c.redactor.String(v)
+	}
+	return value
+}
+
+// jsonValue 將值編碼為 JSON 再解碼為 map、slice 與基本類型，無法編碼時以字符串表示
+func jsonValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+	// 保留數字原文，避免大整數失去精度
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return string(data)
+	}
+	return decoded
+}
+
+// stringerValue 調用 String 方法，nil 指針等導致 panic 時交由原 core 按 zap 的方式處理
+func stringerValue(value interface{}) (s string, ok bool) {
+	stringer, ok := value.(fmt.Stringer)
+	if !ok {
+		return "", false
+	}
+	defer func() {
+		if recover() != nil {
+			s, ok = "", false
+		}
+	}()
+	return stringer.String(), true
+}
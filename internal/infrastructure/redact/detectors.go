@@ -0,0 +1,115 @@
+package redact
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+)
+
+// detector 敏感值檢測器，pattern 匹配候選值，valid 為 nil 時所有候選值都遮蔽
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	valid   func(candidate string) bool
+}
+
+// detectors 所有可用的檢測器，按檢測順序排列
+// 卡號、IBAN 與身分證號只遮蔽通過校驗的值，卡號另要求發卡機構代碼以 2–6 開頭，避免誤遮蔽訂單號、毫秒時間戳等普通數字
+var detectors = []detector{
+	{
+		name:    config.RedactDetectorJWT,
+		pattern: regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	{
+		name:    config.RedactDetectorEmail,
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	{
+		name:    config.RedactDetectorIBAN,
+		pattern: regexp.MustCompile(`\b[A-Z]{2}[0-9]{2}(?: ?[A-Z0-9]){11,30}\b`),
+		valid:   validIBAN,
+	},
+	{
+		name:    config.RedactDetectorNationalID,
+		pattern: regexp.MustCompile(`\b[A-Z][1289][0-9]{8}\b`),
+		valid:   validNationalID,
+	},
+	{
+		name:    config.RedactDetectorCard,
+		pattern: regexp.MustCompile(`\b[2-6](?:[ -]?[0-9]){12,18}\b`),
+		valid:   validCardNumber,
+	},
+}
+
+// validCardNumber 檢查卡號長度與 Luhn 校驗碼，允許以空格或 - 分組
+func validCardNumber(candidate string) bool {
+	digits := stripSeparators(candidate)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIBAN 檢查 IBAN 長度與 mod-97 校驗碼，允許以空格分組
+func validIBAN(candidate string) bool {
+	iban := stripSeparators(candidate)
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	// 前四位移到末尾，字母轉為 10–35 後整體模 97 應為 1
+	var numeric strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			numeric.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			numeric.WriteString(big.NewInt(int64(r-'A') + 10).String())
+		default:
+			return false
+		}
+	}
+	value, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && value.Mod(value, big.NewInt(97)).Int64() == 1
+}
+
+// nationalIDLetters 台灣身分證首字母對應的數值
+var nationalIDLetters = map[byte]int{
+	'A': 10, 'B': 11, 'C': 12, 'D': 13, 'E': 14, 'F': 15, 'G': 16, 'H': 17, 'I': 34,
+	'J': 18, 'K': 19, 'L': 20, 'M': 21, 'N': 22, 'O': 35, 'P': 23, 'Q': 24, 'R': 25,
+	'S': 26, 'T': 27, 'U': 28, 'V': 29, 'W': 32, 'X': 30, 'Y': 31, 'Z': 33,
+}
+
+// validNationalID 檢查台灣身分證字號與新式居留證統一證號的校驗碼
+func validNationalID(candidate string) bool {
+	letter, ok := nationalIDLetters[candidate[0]]
+	if !ok || len(candidate) != 10 {
+		return false
+	}
+
+	sum := letter/10 + (letter%10)*9
+	for i := 1; i < 9; i++ {
+		sum += int(candidate[i]-'0') * (9 - i)
+	}
+	sum += int(candidate[9] - '0')
+	return sum%10 == 0
+}
+
+// stripSeparators 移除分組用的空格與 -
+func stripSeparators(value string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(value)
+}
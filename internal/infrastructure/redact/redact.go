@@ -0,0 +1,175 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+)
+
+// Redactor 敏感資料遮蔽器，按名稱遮蔽字段、請求頭與查詢參數的值，並在任意文字中檢測敏感值
+// nil 表示不遮蔽，所有方法原樣返回輸入
+type Redactor struct {
+	fields      map[string]struct{}
+	headers     map[string]struct{}
+	queryParams map[string]struct{}
+	detectors   []detector
+	mask        string
+}
+
+// New 創建遮蔽器，未啟用時返回 nil
+func New(cfg *config.RedactionConfig) *Redactor {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	r := &Redactor{
+		fields:      nameSet(cfg.Fields),
+		headers:     nameSet(cfg.Headers),
+		queryParams: nameSet(cfg.QueryParams),
+		mask:        cfg.Mask,
+	}
+	if r.mask == "" {
+		r.mask = "[REDACTED]"
+	}
+
+	enabled := nameSet(cfg.Detectors)
+	for _, d := range detectors {
+		if _, ok := enabled[d.name]; ok || len(cfg.Detectors) == 0 {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	return r
+}
+
+// Mask 返回遮蔽後的替代文字
+func (r *Redactor) Mask() string {
+	if r == nil {
+		return ""
+	}
+	return r.mask
+}
+
+// SensitiveField 檢查字段名是否需遮蔽，請求頭名稱同樣視為敏感字段
+func (r *Redactor) SensitiveField(name string) bool {
+	if r == nil {
+		return false
+	}
+	name = normalizeName(name)
+	_, field := r.fields[name]
+	_, header := r.headers[name]
+	return field || header
+}
+
+// String 遮蔽文字中檢測到的敏感值，文字包含查詢字符串時同時按參數名遮蔽
+func (r *Redactor) String(value string) string {
+	if r == nil || value == "" {
+		return value
+	}
+	if path, query, found := strings.Cut(value, "?"); found {
+		value = path + "?" + r.Query(query)
+	}
+	return r.detect(value)
+}
+
+// Value 遮蔽鍵值對的值：鍵名敏感時整體遮蔽，否則只遮蔽檢測到的敏感值
+func (r *Redactor) Value(key, value string) string {
+	if r == nil || value == "" {
+		return value
+	}
+	if r.SensitiveField(key) {
+		return r.mask
+	}
+	return r.String(value)
+}
+
+// Query 遮蔽查詢字符串，保留參數順序；參數值在檢測前先解碼，避免以 URL 編碼繞過檢測
+func (r *Redactor) Query(rawQuery string) string {
+	if r == nil || rawQuery == "" {
+		return rawQuery
+	}
+
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		rawKey, rawValue, found := strings.Cut(param, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		if _, sensitive := r.queryParams[normalizeName(key)]; sensitive && found {
+			params[i] = rawKey + "=" + r.mask
+			continue
+		}
+
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			value = rawValue
+		}
+		if redacted := r.detect(value); redacted != value {
+			params[i] = rawKey + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// Headers 返回遮蔽後的請求頭副本
+func (r *Redactor) Headers(header http.Header) http.Header {
+	if r == nil || header == nil {
+		return header
+	}
+
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		_, sensitive := r.headers[normalizeName(name)]
+		redacted[name] = make([]string, len(values))
+		for i, value := range values {
+			if sensitive {
+				redacted[name][i] = r.mask
+			} else {
+				redacted[name][i] = r.detect(value)
+			}
+		}
+	}
+	return redacted
+}
+
+// Map 返回遮蔽後的鍵值對副本
+func (r *Redactor) Map(values map[string]string) map[string]string {
+	if r == nil || values == nil {
+		return values
+	}
+
+	redacted := make(map[string]string, len(values))
+	for key, value := range values {
+		redacted[key] = r.Value(key, value)
+	}
+	return redacted
+}
+
+// detect 以啟用的檢測器遮蔽文字中的敏感值
+func (r *Redactor) detect(value string) string {
+	for _, d := range r.detectors {
+		value = d.pattern.ReplaceAllStringFunc(value, func(candidate string) string {
+			if d.valid != nil && !d.valid(candidate) {
+				return candidate
+			}
+			return r.mask
+		})
+	}
+	return value
+}
+
+// nameSet 建立標準化名稱的集合
+func nameSet(names []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[normalizeName(name)] = struct{}{}
+	}
+	return set
+}
+
+// normalizeName 標準化名稱：不區分大小寫，- 與 _ 視為相同
+func normalizeName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "-", "_")
+}
@@ -0,0 +1,29 @@
+package redact
+
+import (
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/dto"
+)
+
+// GatewayError 返回詳情遮蔽後的網關錯誤副本，在寫出響應或日誌前調用
+// 預定義錯誤為共用變量，不修改原錯誤
+func (r *Redactor) GatewayError(err *domain.GatewayError) *domain.GatewayError {
+	if r == nil || err == nil || err.Detail == "" {
+		return err
+	}
+	redacted := *err
+	redacted.Detail = r.String(err.Detail)
+	return &redacted
+}
+
+// APIResponse 返回錯誤詳情遮蔽後的響應副本，在寫出響應前調用
+func (r *Redactor) APIResponse(response *dto.APIResponse) *dto.APIResponse {
+	if r == nil || response == nil || response.Error == nil || response.Error.Detail == "" {
+		return response
+	}
+	errorInfo := *response.Error
+	errorInfo.Detail = r.String(errorInfo.Detail)
+	redacted := *response
+	redacted.Error = &errorInfo
+	return &redacted
+}
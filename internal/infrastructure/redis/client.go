@@ -0,0 +1,330 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+)
+
+// ErrClosed 客戶端已關閉
+var ErrClosed = errors.New("redis: client closed")
+
+// Error Redis 服務端返回的錯誤回覆
+type Error string
+
+// Error 實現 error 接口
+func (e Error) Error() string {
+	return string(e)
+}
+
+// conn 單個 RESP 連接
+type conn struct {
+	netConn net.Conn
+	rd      *bufio.Reader
+	wr      *bufio.Writer
+}
+
+// Client 輕量 RESP 客戶端，內建連接池
+type Client struct {
+	addr        string
+	password    string
+	db          int
+	dialTimeout time.Duration
+	timeout     time.Duration
+
+	slots chan struct{} // 限制同時使用的連接數
+	idle  chan *conn
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// New 創建新的 Redis 客戶端，連接在首次使用時建立
+func New(cfg config.RedisConfig) *Client {
+	poolSize := cfg.PoolSize
+	if poolSize <= 0 {
+		poolSize = 10
+	}
+	dialTimeout := cfg.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = time.Second
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 200 * time.Millisecond
+	}
+	host := cfg.Host
+	if host == "" {
+		host = "localhost"
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 6379
+	}
+
+	return &Client{
+		addr:        net.JoinHostPort(host, strconv.Itoa(port)),
+		password:    cfg.Password,
+		db:          cfg.DB,
+		dialTimeout: dialTimeout,
+		timeout:     timeout,
+		slots:       make(chan struct{}, poolSize),
+		idle:        make(chan *conn, poolSize),
+	}
+}
+
+// Addr 返回服務端地址
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Do 執行命令並返回回覆
+// 回覆類型：string（簡單字符串、批量字符串）、int64、[]interface{}、nil；錯誤回覆以 Error 返回
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.slots }()
+
+	cn, err := c.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(ctx, cn, args)
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		// 網絡錯誤後連接狀態未知，直接丟棄
+		cn.netConn.Close()
+		return nil, err
+	}
+
+	c.putConn(cn)
+	return reply, err
+}
+
+// Timeout 返回單個命令的讀寫超時
+func (c *Client) Timeout() time.Duration {
+	return c.timeout
+}
+
+// Ping 檢查連接
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Eval 執行 Lua 腳本
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	return c.Do(ctx, scriptArgs("EVAL", script, keys, args)...)
+}
+
+// EvalSHA 以 SHA1 執行已緩存的 Lua 腳本
+func (c *Client) EvalSHA(ctx context.Context, sha string, keys []string, args ...string) (interface{}, error) {
+	return c.Do(ctx, scriptArgs("EVALSHA", sha, keys, args)...)
+}
+
+// Del 刪除鍵
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	_, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Close 關閉所有空閒連接，之後的命令返回 ErrClosed
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.netConn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// getConn 取得空閒連接或建立新連接
+func (c *Client) getConn(ctx context.Context) (*conn, error) {
+	c.mutex.Lock()
+	closed := c.closed
+	c.mutex.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: c.dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: dial %s: %w", c.addr, err)
+	}
+	cn := &conn{
+		netConn: netConn,
+		rd:      bufio.NewReader(netConn),
+		wr:      bufio.NewWriter(netConn),
+	}
+
+	if c.password != "" {
+		if _, err := c.roundTrip(ctx, cn, []string{"AUTH", c.password}); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis: auth: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTrip(ctx, cn, []string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis: select db: %w", err)
+		}
+	}
+
+	return cn, nil
+}
+
+// putConn 歸還連接，池已滿或客戶端已關閉時關閉連接
+func (c *Client) putConn(cn *conn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		cn.netConn.Close()
+		return
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.netConn.Close()
+	}
+}
+
+// roundTrip 發送命令並讀取回覆
+func (c *Client) roundTrip(ctx context.Context, cn *conn, args []string) (interface{}, error) {
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := cn.netConn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if err := writeCommand(cn.wr, args); err != nil {
+		return nil, err
+	}
+	if err := cn.wr.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.rd)
+}
+
+// writeCommand 以 RESP 數組格式寫入命令
+func writeCommand(w *bufio.Writer, args []string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply 讀取一個 RESP 回覆
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readReply(r)
+			var redisErr Error
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = redisErr
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
+
+// readLine 讀取以 CRLF 結尾的一行
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// scriptArgs 組合 EVAL/EVALSHA 參數
+func scriptArgs(cmd, script string, keys, args []string) []string {
+	out := make([]string, 0, 3+len(keys)+len(args))
+	out = append(out, cmd, script, strconv.Itoa(len(keys)))
+	out = append(out, keys...)
+	return append(out, args...)
+}
+
+// IsNoScript 檢查錯誤是否為腳本未緩存
+func IsNoScript(err error) bool {
+	var redisErr Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT")
+}
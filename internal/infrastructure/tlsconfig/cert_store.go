@@ -0,0 +1,218 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// certEntry 已載入的證書及其來源文件
+type certEntry struct {
+	certFile    string
+	keyFile     string
+	serverNames []string
+	cert        *tls.Certificate
+	modTime     time.Time
+}
+
+// CertStore 證書存儲，支援 SNI 選擇和熱重載
+type CertStore struct {
+	logger      *zap.Logger
+	defaultCert *certEntry
+	sniCerts    []*certEntry
+	byName      map[string]*tls.Certificate
+	mutex       sync.RWMutex
+	interval    time.Duration
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewCertStore 創建新的證書存儲並載入所有證書
+func NewCertStore(cfg config.TLSConfig, logger *zap.Logger) (*CertStore, error) {
+	store := &CertStore{
+		logger:   logger,
+		interval: cfg.ReloadInterval,
+		stopCh:   make(chan struct{}),
+		defaultCert: &certEntry{
+			certFile: cfg.CertFile,
+			keyFile:  cfg.KeyFile,
+		},
+	}
+
+	for _, certCfg := range cfg.Certificates {
+		store.sniCerts = append(store.sniCerts, &certEntry{
+			certFile:    certCfg.CertFile,
+			keyFile:     certCfg.KeyFile,
+			serverNames: certCfg.ServerNames,
+		})
+	}
+
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Reload 重新載入所有證書
+func (s *CertStore) Reload() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := append([]*certEntry{s.defaultCert}, s.sniCerts...)
+	for _, entry := range entries {
+		if err := loadEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	s.rebuildIndex()
+	return nil
+}
+
+// GetCertificate 依 SNI 選擇證書，實現 tls.Config.GetCertificate
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, exists := s.byName[name]; exists {
+			return cert, nil
+		}
+
+		// 萬用字元匹配 *.example.com
+		if idx := strings.Index(name, "."); idx > 0 {
+			if cert, exists := s.byName["*"+name[idx:]]; exists {
+				return cert, nil
+			}
+		}
+	}
+
+	return s.defaultCert.cert, nil
+}
+
+// Start 啟動證書熱重載
+func (s *CertStore) Start() {
+	if s.interval <= 0 {
+		return
+	}
+	go s.watchLoop()
+}
+
+// Stop 停止證書熱重載
+func (s *CertStore) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
+
+// watchLoop 定期檢查證書文件是否變更
+func (s *CertStore) watchLoop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.reloadChanged()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// reloadChanged 只重載已變更的證書
+func (s *CertStore) reloadChanged() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := false
+	entries := append([]*certEntry{s.defaultCert}, s.sniCerts...)
+	for _, entry := range entries {
+		modTime, err := latestModTime(entry.certFile, entry.keyFile)
+		if err != nil || !modTime.After(entry.modTime) {
+			continue
+		}
+
+		if err := loadEntry(entry); err != nil {
+			// 載入失敗時保留舊證書
+			s.logger.Error("Failed to reload TLS certificate",
+				zap.String("cert_file", entry.certFile),
+				zap.Error(err))
+			continue
+		}
+
+		changed = true
+		s.logger.Info("TLS certificate reloaded",
+			zap.String("cert_file", entry.certFile),
+			zap.Time("not_after", entry.cert.Leaf.NotAfter))
+	}
+
+	if changed {
+		s.rebuildIndex()
+	}
+}
+
+// rebuildIndex 重建 SNI 名稱索引（需持有寫鎖）
+func (s *CertStore) rebuildIndex() {
+	byName := make(map[string]*tls.Certificate)
+	for _, entry := range s.sniCerts {
+		names := entry.serverNames
+		if len(names) == 0 {
+			names = entry.cert.Leaf.DNSNames
+		}
+		for _, name := range names {
+			byName[strings.ToLower(name)] = entry.cert
+		}
+	}
+	s.byName = byName
+}
+
+// loadEntry 載入單個證書
+func loadEntry(entry *certEntry) error {
+	modTime, err := latestModTime(entry.certFile, entry.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(entry.certFile, entry.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", entry.certFile, err)
+	}
+
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate %s: %w", entry.certFile, err)
+		}
+		cert.Leaf = leaf
+	}
+
+	entry.cert = &cert
+	entry.modTime = modTime
+	return nil
+}
+
+// latestModTime 取得證書與私鑰文件中較新的修改時間
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,107 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"expense-api-gateway/internal/config"
+)
+
+// NewServerTLSConfig 創建服務端 TLS 配置
+func NewServerTLSConfig(cfg config.TLSConfig, store *CertStore) (*tls.Config, error) {
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: store.GetCertificate,
+	}
+
+	switch cfg.ClientAuth.Mode {
+	case "", "none":
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case "request":
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	case "verify_if_given":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client auth mode: %s", cfg.ClientAuth.Mode)
+	}
+
+	if cfg.ClientAuth.CAFile != "" {
+		pool, err := LoadCertPool(cfg.ClientAuth.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// NewUpstreamTLSConfig 創建上游服務 TLS 配置
+func NewUpstreamTLSConfig(cfg *config.UpstreamTLSConfig) (*tls.Config, error) {
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	// 自定義 CA，未設置時使用系統 CA
+	if cfg.CAFile != "" {
+		pool, err := LoadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// 客戶端證書（mTLS）
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// LoadCertPool 從 PEM 文件載入 CA 證書池
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no valid certificates found in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// ParseVersion 解析 TLS 版本字串
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version: %s", version)
+	}
+}
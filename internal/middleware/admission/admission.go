@@ -0,0 +1,301 @@
+package admission
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 請求優先級
+const (
+	PriorityCritical = "critical"
+	PriorityHigh     = "high"
+	PriorityNormal   = "normal"
+	PriorityLow      = "low"
+)
+
+// 延遲信號參數
+const (
+	latencyAlpha     = 0.1
+	latencyIdleReset = 5 * time.Second // 超過此時間沒有樣本時忽略延遲信號
+)
+
+// priorityRank 優先級排序，數值越小越優先
+var priorityRank = map[string]int{
+	PriorityCritical: 0,
+	PriorityHigh:     1,
+	PriorityNormal:   2,
+	PriorityLow:      3,
+}
+
+// defaultThresholds 各優先級開始被拒絕的默認負載
+var defaultThresholds = map[string]float64{
+	PriorityLow:    0.7,
+	PriorityNormal: 0.85,
+	PriorityHigh:   1.0,
+}
+
+// Signals 當前負載信號
+type Signals struct {
+	InFlight int64         `json:"in_flight"`
+	Latency  time.Duration `json:"avg_latency"`
+	CPU      float64       `json:"cpu"`
+	Load     float64       `json:"load"` // 各信號相對目標值的最大比值
+}
+
+// AdmissionMiddleware 全局准入控制中間件，過載時優先拒絕低優先級請求
+type AdmissionMiddleware struct {
+	config   *config.Config
+	logger   *zap.Logger
+	monitor  *monitor.Monitor
+	inFlight int64
+
+	mutex      sync.Mutex
+	latency    float64 // 平均延遲（納秒）
+	lastSample time.Time
+	now        func() time.Time
+	cpuUsage   func(now time.Time) float64
+}
+
+// NewAdmissionMiddleware 創建新的准入控制中間件，monitorService 為 nil 時不上報指標
+func NewAdmissionMiddleware(cfg *config.Config, logger *zap.Logger, monitorService *monitor.Monitor) *AdmissionMiddleware {
+	sampler := &cpuSampler{}
+	return &AdmissionMiddleware{
+		config:   cfg,
+		logger:   logger,
+		monitor:  monitorService,
+		now:      time.Now,
+		cpuUsage: sampler.Usage,
+	}
+}
+
+// SetClock 設置時間來源（用於測試）
+func (m *AdmissionMiddleware) SetClock(now func() time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.now = now
+}
+
+// SetCPUSource 設置 CPU 使用率來源（用於測試）
+func (m *AdmissionMiddleware) SetCPUSource(usage func(now time.Time) float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cpuUsage = usage
+}
+
+// Enabled 是否啟用准入控制
+func (m *AdmissionMiddleware) Enabled() bool {
+	return m.config.Admission.Enabled
+}
+
+// Admit 准入控制中間件，需放在認證之後以便按角色判斷優先級
+// routePriority 為路由配置的優先級，空值時按請求頭、角色或默認值判斷
+func (m *AdmissionMiddleware) Admit(routePriority string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.config.Admission.Enabled {
+			c.Next()
+			return
+		}
+
+		priority := m.Priority(c, routePriority)
+		signals := m.Signals()
+		if m.shouldShed(priority, signals.Load) {
+			m.record(priority, false)
+			m.logger.Warn("Request shed by admission control",
+				zap.String("priority", priority),
+				zap.Float64("load", signals.Load),
+				zap.String("path", c.Request.URL.Path))
+			m.reject(c)
+			return
+		}
+		m.record(priority, true)
+		c.Set("request_priority", priority)
+
+		atomic.AddInt64(&m.inFlight, 1)
+		m.mutex.Lock()
+		start := m.now()
+		m.mutex.Unlock()
+		defer func() {
+			atomic.AddInt64(&m.inFlight, -1)
+			m.observe(start)
+		}()
+
+		c.Next()
+	}
+}
+
+// Priority 判斷請求優先級
+// 優先順序：受信任客戶端的優先級請求頭 > 路由配置 > 用戶角色中最高的優先級 > 默認值
+func (m *AdmissionMiddleware) Priority(c *gin.Context, routePriority string) string {
+	if priority := strings.ToLower(c.GetHeader(m.priorityHeader())); priority != "" && m.isTrustedClient(c) {
+		if _, valid := priorityRank[priority]; valid {
+			return priority
+		}
+	}
+	if _, valid := priorityRank[routePriority]; valid {
+		return routePriority
+	}
+
+	best := ""
+	if user, err := auth.GetAuthUserFromContext(c); err == nil {
+		for role, priority := range m.config.Admission.RolePriorities {
+			if _, valid := priorityRank[priority]; !valid || !user.HasRole(role) {
+				continue
+			}
+			if best == "" || priorityRank[priority] < priorityRank[best] {
+				best = priority
+			}
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	if _, valid := priorityRank[m.config.Admission.DefaultPriority]; valid {
+		return m.config.Admission.DefaultPriority
+	}
+	return PriorityNormal
+}
+
+// Signals 返回當前負載信號
+func (m *AdmissionMiddleware) Signals() Signals {
+	cfg := m.config.Admission
+	signals := Signals{InFlight: atomic.LoadInt64(&m.inFlight)}
+
+	m.mutex.Lock()
+	now := m.now()
+	latency := m.latency
+	fresh := !m.lastSample.IsZero() && now.Sub(m.lastSample) < latencyIdleReset
+	cpuUsage := m.cpuUsage
+	m.mutex.Unlock()
+
+	if cfg.MaxInFlight > 0 {
+		signals.Load = float64(signals.InFlight) / float64(cfg.MaxInFlight)
+	}
+	if fresh {
+		signals.Latency = time.Duration(latency)
+		if cfg.TargetLatency > 0 {
+			signals.Load = math.Max(signals.Load, latency/float64(cfg.TargetLatency))
+		}
+	}
+	if cfg.CPUThreshold > 0 && cpuUsage != nil {
+		signals.CPU = cpuUsage(now)
+		signals.Load = math.Max(signals.Load, signals.CPU/cfg.CPUThreshold)
+	}
+	return signals
+}
+
+// GetStats 查詢准入控制狀態（管理端點）
+func (m *AdmissionMiddleware) GetStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		thresholds := make(map[string]float64, len(defaultThresholds))
+		for priority := range defaultThresholds {
+			thresholds[priority] = m.threshold(priority)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"enabled":    m.config.Admission.Enabled,
+				"signals":    m.Signals(),
+				"thresholds": thresholds,
+			},
+		})
+	}
+}
+
+// shouldShed 檢查是否拒絕指定優先級的請求，critical 永不拒絕
+func (m *AdmissionMiddleware) shouldShed(priority string, load float64) bool {
+	if priority == PriorityCritical {
+		return false
+	}
+	return load >= m.threshold(priority)
+}
+
+// threshold 優先級開始被拒絕的負載
+func (m *AdmissionMiddleware) threshold(priority string) float64 {
+	if threshold, exists := m.config.Admission.Thresholds[priority]; exists && threshold > 0 {
+		return threshold
+	}
+	return defaultThresholds[priority]
+}
+
+// observe 記錄請求延遲
+func (m *AdmissionMiddleware) observe(start time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	sample := float64(now.Sub(start))
+	if m.lastSample.IsZero() || now.Sub(m.lastSample) >= latencyIdleReset {
+		m.latency = sample
+	} else {
+		m.latency += (sample - m.latency) * latencyAlpha
+	}
+	m.lastSample = now
+}
+
+// isTrustedClient 檢查請求是否來自可指定優先級的客戶端證書
+func (m *AdmissionMiddleware) isTrustedClient(c *gin.Context) bool {
+	if auth.GetAuthMethodFromContext(c) != auth.AuthMethodClientCert {
+		return false
+	}
+	trusted := m.config.Admission.TrustedClients
+	if len(trusted) == 0 {
+		return true
+	}
+	userID, err := auth.GetUserIDFromContext(c)
+	if err != nil {
+		return false
+	}
+	for _, client := range trusted {
+		if client == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// priorityHeader 優先級請求頭名稱
+func (m *AdmissionMiddleware) priorityHeader() string {
+	if m.config.Admission.PriorityHeader == "" {
+		return "X-Request-Priority"
+	}
+	return m.config.Admission.PriorityHeader
+}
+
+// record 上報准入決策
+func (m *AdmissionMiddleware) record(priority string, admitted bool) {
+	if m.monitor != nil {
+		m.monitor.RecordAdmission(priority, admitted)
+	}
+}
+
+// reject 返回 503 並附帶 Retry-After
+func (m *AdmissionMiddleware) reject(c *gin.Context) {
+	retryAfter := m.config.Admission.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"status":      "error",
+		"message":     "Gateway is overloaded, please retry later",
+		"code":        "GATEWAY_OVERLOADED",
+		"retry_after": seconds,
+	})
+	c.Abort()
+}
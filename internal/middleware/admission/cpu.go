@@ -0,0 +1,75 @@
+package admission
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cpuSampleInterval CPU 使用率的取樣間隔
+const cpuSampleInterval = time.Second
+
+// cpuSampler 讀取 /proc/stat 計算主機 CPU 使用率，無法讀取時返回 0
+type cpuSampler struct {
+	mutex     sync.Mutex
+	lastRead  time.Time
+	lastIdle  uint64
+	lastTotal uint64
+	usage     float64
+}
+
+// Usage 返回最近一個取樣間隔的 CPU 使用率 (0-1)
+func (s *cpuSampler) Usage(now time.Time) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.Sub(s.lastRead) < cpuSampleInterval {
+		return s.usage
+	}
+	s.lastRead = now
+
+	idle, total, ok := readProcStat()
+	if !ok {
+		return 0
+	}
+	if s.lastTotal != 0 && total > s.lastTotal {
+		busy := float64(total-s.lastTotal) - float64(idle-s.lastIdle)
+		s.usage = busy / float64(total-s.lastTotal)
+	}
+	s.lastIdle = idle
+	s.lastTotal = total
+	return s.usage
+}
+
+// readProcStat 讀取 /proc/stat 的總 CPU 時間，idle 包含 iowait
+func readProcStat() (idle, total uint64, ok bool) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return 0, 0, false
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, false
+	}
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		total += value
+		// 第 4、5 個欄位為 idle 與 iowait
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return idle, total, true
+}
@@ -0,0 +1,428 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/infrastructure/jwt"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/service/audit"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 代理登入相關 headers
+const (
+	HeaderImpersonateUser    = "X-Impersonate-User"
+	HeaderImpersonateCompany = "X-Impersonate-Company"
+	HeaderImpersonatorID     = "X-Impersonator-ID"
+)
+
+// 上下文鍵
+const (
+	impersonationHandledKey = "impersonation_handled" // 標記請求已完成代理登入處理，避免組與路由重複處理
+	impersonationTargetKey  = "impersonation_target"  // 客戶端請求代理的目標，由 StripHeaders 保存
+)
+
+// impersonationTarget 客戶端通過 headers 指定的代理目標
+type impersonationTarget struct {
+	userID    string
+	companyID string
+}
+
+// ImpersonationMiddleware 管理員代理登入中間件
+type ImpersonationMiddleware struct {
+	config  *config.Config
+	logger  *zap.Logger
+	jwtSvc  *jwt.JWTService
+	auditor *audit.Service
+}
+
+// ImpersonateRequest 簽發代理登入 token 請求
+type ImpersonateRequest struct {
+	UserID    string `json:"user_id" binding:"required"`
+	CompanyID string `json:"company_id"`
+	Role      string `json:"role"`
+	Reason    string `json:"reason" binding:"required"`
+}
+
+// NewImpersonationMiddleware 創建新的代理登入中間件，jwtSvc 應與認證中間件共用
+// 審計日誌無法開啟時，所有代理登入請求都會被拒絕
+func NewImpersonationMiddleware(cfg *config.Config, logger *zap.Logger, jwtSvc *jwt.JWTService) *ImpersonationMiddleware {
+	m := &ImpersonationMiddleware{
+		config: cfg,
+		logger: logger,
+		jwtSvc: jwtSvc,
+	}
+
+	if cfg.Auth.Impersonation.Enabled {
+		auditor, err := audit.New(cfg, logger)
+		if err != nil {
+			logger.Error("Failed to open audit log, impersonation disabled", zap.Error(err))
+		}
+		m.auditor = auditor
+	}
+
+	return m
+}
+
+// Close 關閉審計日誌
+func (m *ImpersonationMiddleware) Close() {
+	if m.auditor == nil {
+		return
+	}
+	if err := m.auditor.Close(); err != nil {
+		m.logger.Error("Failed to close audit log", zap.Error(err))
+	}
+}
+
+// StripHeaders 全局中間件，保存客戶端指定的代理目標並移除所有代理相關 headers
+// 需放在所有認證中間件之前，確保未掛載 Impersonate 的路由不會轉發客戶端提供的值
+func (m *ImpersonationMiddleware) StripHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		captureTarget(c)
+		c.Next()
+	}
+}
+
+// captureTarget 讀取並移除代理相關 headers，重複調用時返回首次保存的目標
+func captureTarget(c *gin.Context) impersonationTarget {
+	if value, exists := c.Get(impersonationTargetKey); exists {
+		if target, ok := value.(impersonationTarget); ok {
+			return target
+		}
+	}
+
+	target := impersonationTarget{
+		userID:    c.GetHeader(HeaderImpersonateUser),
+		companyID: c.GetHeader(HeaderImpersonateCompany),
+	}
+	// 代理相關 headers 只由網關設置，不接受也不轉發客戶端提供的值
+	c.Request.Header.Del(HeaderImpersonateUser)
+	c.Request.Header.Del(HeaderImpersonateCompany)
+	c.Request.Header.Del(HeaderImpersonatorID)
+	c.Set(impersonationTargetKey, target)
+	return target
+}
+
+// Impersonate 代理登入中間件，需放在認證中間件之後、角色檢查之前
+func (m *ImpersonationMiddleware) Impersonate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(impersonationHandledKey) {
+			c.Next()
+			return
+		}
+		c.Set(impersonationHandledKey, true)
+
+		requested := captureTarget(c)
+		targetID := requested.userID
+		targetCompany := requested.companyID
+
+		user, err := GetAuthUserFromContext(c)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		switch {
+		case user.IsImpersonated():
+			// 代理登入 token
+			if targetID != "" {
+				_ = m.audit(c, "impersonation.request", user, "rejected", map[string]string{"mode": "token", "nested_target": targetID})
+				m.reject(c, http.StatusForbidden, "Nested impersonation is not allowed")
+				return
+			}
+			m.forward(c, user, "token")
+		case targetID != "":
+			// 管理員 token + X-Impersonate-User
+			target, ok := m.resolveTarget(c, user, targetID, targetCompany)
+			if !ok {
+				return
+			}
+			m.forward(c, target, "header")
+		default:
+			c.Next()
+		}
+	}
+}
+
+// MintToken 簽發短效代理登入 token
+func (m *ImpersonationMiddleware) MintToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.config.Auth.Impersonation.Enabled {
+			m.reject(c, http.StatusNotFound, "Impersonation is disabled")
+			return
+		}
+
+		admin, err := GetAuthUserFromContext(c)
+		if err != nil {
+			m.reject(c, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		if admin.IsImpersonated() || !m.isAdmin(admin) {
+			m.reject(c, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+
+		var req ImpersonateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			m.reject(c, http.StatusBadRequest, "user_id and reason are required")
+			return
+		}
+
+		role := req.Role
+		if role == "" {
+			role = m.defaultRole()
+		}
+		if !m.isAllowedTarget(role) {
+			m.reject(c, http.StatusForbidden, "Target role cannot be impersonated")
+			return
+		}
+		companyID := req.CompanyID
+		if companyID == "" {
+			companyID = admin.CompanyID
+		}
+		if !m.canAccessCompany(admin, companyID) {
+			m.reject(c, http.StatusForbidden, "Cross-company impersonation is not allowed")
+			return
+		}
+
+		target := &domain.AuthUser{
+			ID:             req.UserID,
+			CompanyID:      companyID,
+			Role:           role,
+			Roles:          []string{role},
+			ImpersonatorID: admin.ID,
+		}
+
+		if err := m.audit(c, "impersonation.token_issued", target, "issued", map[string]string{"reason": req.Reason}); err != nil {
+			m.reject(c, http.StatusServiceUnavailable, "Audit log unavailable")
+			return
+		}
+
+		token, expiresAt, err := m.jwtSvc.GenerateImpersonationToken(target, m.tokenTTL())
+		if err != nil {
+			m.reject(c, http.StatusInternalServerError, "Failed to issue impersonation token")
+			return
+		}
+
+		m.logger.Info("Impersonation token issued",
+			zap.String("impersonator_id", admin.ID),
+			zap.String("target_user_id", target.ID),
+			zap.String("reason", req.Reason))
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"token":      token,
+				"token_type": "Bearer",
+				"expires_at": expiresAt,
+				"user_id":    target.ID,
+			},
+		})
+	}
+}
+
+// resolveTarget 驗證管理員權限並建立目標用戶身份
+func (m *ImpersonationMiddleware) resolveTarget(c *gin.Context, admin *domain.AuthUser, targetID, targetCompany string) (*domain.AuthUser, bool) {
+	if !m.config.Auth.Impersonation.Enabled {
+		m.reject(c, http.StatusForbidden, "Impersonation is disabled")
+		return nil, false
+	}
+	if !m.isAdmin(admin) {
+		m.logger.Warn("Impersonation attempt without admin role",
+			zap.String("user_id", admin.ID),
+			zap.String("target_user_id", targetID),
+			zap.String("path", c.Request.URL.Path))
+		m.reject(c, http.StatusForbidden, "Insufficient permissions")
+		return nil, false
+	}
+
+	role := m.defaultRole()
+	if !m.isAllowedTarget(role) {
+		m.logger.Warn("Impersonation target role not allowed",
+			zap.String("user_id", admin.ID),
+			zap.String("target_user_id", targetID),
+			zap.String("role", role))
+		m.reject(c, http.StatusForbidden, "Target role cannot be impersonated")
+		return nil, false
+	}
+
+	if targetCompany == "" {
+		targetCompany = admin.CompanyID
+	}
+	if !m.canAccessCompany(admin, targetCompany) {
+		m.logger.Warn("Cross-company impersonation attempt",
+			zap.String("user_id", admin.ID),
+			zap.String("company_id", admin.CompanyID),
+			zap.String("target_user_id", targetID),
+			zap.String("target_company_id", targetCompany))
+		m.reject(c, http.StatusForbidden, "Cross-company impersonation is not allowed")
+		return nil, false
+	}
+
+	return &domain.AuthUser{
+		ID:             targetID,
+		CompanyID:      targetCompany,
+		Role:           role,
+		Roles:          []string{role},
+		ImpersonatorID: admin.ID,
+	}, true
+}
+
+// forward 以目標用戶身份轉發請求並寫入審計記錄
+func (m *ImpersonationMiddleware) forward(c *gin.Context, target *domain.AuthUser, mode string) {
+	if !m.config.Auth.Impersonation.Enabled {
+		m.reject(c, http.StatusForbidden, "Impersonation is disabled")
+		return
+	}
+
+	details := map[string]string{"mode": mode}
+	if m.isBlocked(c.Request.Method, c.Request.URL.Path) {
+		_ = m.audit(c, "impersonation.request", target, "blocked", details)
+		m.logger.Warn("Blocked route accessed during impersonation",
+			zap.String("impersonator_id", target.ImpersonatorID),
+			zap.String("target_user_id", target.ID),
+			zap.String("path", c.Request.URL.Path))
+		m.reject(c, http.StatusForbidden, "This operation is not allowed during impersonation")
+		return
+	}
+
+	// 審計記錄寫入失敗時不轉發請求
+	if err := m.audit(c, "impersonation.request", target, "forwarded", details); err != nil {
+		m.reject(c, http.StatusServiceUnavailable, "Audit log unavailable")
+		return
+	}
+
+	SetAuthContext(c, target, GetAuthMethodFromContext(c), map[string]string{
+		"X-User-ID":          target.ID,
+		"X-Company-ID":       target.CompanyID,
+		"X-User-Role":        target.Role,
+		"X-User-Email":       target.Email,
+		HeaderImpersonatorID: target.ImpersonatorID,
+	})
+	c.Set("impersonator_id", target.ImpersonatorID)
+
+	c.Next()
+}
+
+// audit 寫入審計記錄
+func (m *ImpersonationMiddleware) audit(c *gin.Context, event string, target *domain.AuthUser, outcome string, details map[string]string) error {
+	if m.auditor == nil {
+		m.logger.Error("Audit log unavailable", zap.String("event", event))
+		return domain.ErrServiceDown
+	}
+
+	err := m.auditor.Record(audit.Entry{
+		Event:           event,
+		ActorID:         target.ImpersonatorID,
+		TargetUserID:    target.ID,
+		TargetCompanyID: target.CompanyID,
+		Method:          c.Request.Method,
+		Path:            c.Request.URL.Path,
+		ClientIP:        clientip.FromContext(c),
+		RequestID:       c.GetHeader("X-Request-ID"),
+		Outcome:         outcome,
+		Details:         details,
+	})
+	if err != nil {
+		m.logger.Error("Failed to write audit entry", zap.String("event", event), zap.Error(err))
+	}
+	return err
+}
+
+// isBlocked 檢查路由是否禁止在代理期間存取
+func (m *ImpersonationMiddleware) isBlocked(method, path string) bool {
+	for _, rule := range m.config.Auth.Impersonation.BlockedRoutes {
+		if !matchPathPattern(rule.Pattern, path) {
+			continue
+		}
+		if len(rule.Methods) == 0 {
+			return true
+		}
+		for _, blockedMethod := range rule.Methods {
+			if strings.EqualFold(blockedMethod, method) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAdmin 檢查用戶是否可執行代理登入
+func (m *ImpersonationMiddleware) isAdmin(user *domain.AuthUser) bool {
+	roles := m.config.Auth.Impersonation.AdminRoles
+	if len(roles) == 0 {
+		roles = []string{"admin"}
+	}
+	for _, role := range roles {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessCompany 檢查管理員是否可代理該公司的用戶，跨公司代理需具備 cross_company_roles 中的角色
+func (m *ImpersonationMiddleware) canAccessCompany(admin *domain.AuthUser, companyID string) bool {
+	if companyID == admin.CompanyID {
+		return true
+	}
+	for _, role := range m.config.Auth.Impersonation.CrossCompanyRoles {
+		if admin.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedTarget 檢查角色是否可被代理
+func (m *ImpersonationMiddleware) isAllowedTarget(role string) bool {
+	allowed := m.config.Auth.Impersonation.AllowedTargetRoles
+	if len(allowed) == 0 {
+		allowed = []string{"user", "manager"}
+	}
+	for _, r := range allowed {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultRole 代理目標的預設角色
+func (m *ImpersonationMiddleware) defaultRole() string {
+	if m.config.Auth.Impersonation.DefaultRole == "" {
+		return "user"
+	}
+	return m.config.Auth.Impersonation.DefaultRole
+}
+
+// tokenTTL 代理登入 token 有效期
+func (m *ImpersonationMiddleware) tokenTTL() time.Duration {
+	if m.config.Auth.Impersonation.TokenTTL <= 0 {
+		return 15 * time.Minute
+	}
+	return m.config.Auth.Impersonation.TokenTTL
+}
+
+// reject 返回錯誤並中斷請求
+func (m *ImpersonationMiddleware) reject(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"message": message,
+	})
+	c.Abort()
+}
+
+// matchPathPattern 路徑匹配，pattern 結尾為 * 時使用前綴匹配
+func matchPathPattern(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == path
+}
@@ -5,12 +5,21 @@ import (
 	"net/http"
 
 	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
 	"expense-api-gateway/internal/infrastructure/jwt"
+	"expense-api-gateway/internal/middleware/clientip"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// 認證方式
+const (
+	AuthMethodBearer     = "bearer"
+	AuthMethodClientCert = "client_cert"
+	AuthMethodSession    = "session"
+)
+
 // JWTMiddleware JWT 認證中間件
 type JWTMiddleware struct {
 	config *config.Config
@@ -20,7 +29,11 @@ type JWTMiddleware struct {
 
 // NewJWTMiddleware 創建新的 JWT 中間件
 func NewJWTMiddleware(cfg *config.Config, logger *zap.Logger) *JWTMiddleware {
-	jwtSvc := jwt.NewJWTService(cfg, logger)
+	return NewJWTMiddlewareWithService(cfg, logger, jwt.NewJWTService(cfg, logger))
+}
+
+// NewJWTMiddlewareWithService 使用共用的 JWT 服務創建 JWT 中間件
+func NewJWTMiddlewareWithService(cfg *config.Config, logger *zap.Logger, jwtSvc *jwt.JWTService) *JWTMiddleware {
 	return &JWTMiddleware{
 		config: cfg,
 		logger: logger,
@@ -30,7 +43,18 @@ func NewJWTMiddleware(cfg *config.Config, logger *zap.Logger) *JWTMiddleware {
 
 // Authenticate JWT 認證中間件 - 驗證 token 並設置轉發 headers
 func (m *JWTMiddleware) Authenticate() gin.HandlerFunc {
+	return m.AuthenticateWith("")
+}
+
+// AuthenticateWith 使用指定的 Token 驗證器進行認證，validator 為空時使用預設驗證器
+func (m *JWTMiddleware) AuthenticateWith(validator string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 已由其他認證方式（如客戶端證書）完成認證
+		if _, err := GetAuthUserFromContext(c); err == nil {
+			c.Next()
+			return
+		}
+
 		// 從請求頭獲取 Authorization
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -54,11 +78,12 @@ func (m *JWTMiddleware) Authenticate() gin.HandlerFunc {
 		}
 
 		// 驗證 token
-		authResult, err := m.jwtSvc.ValidateToken(tokenString)
+		authResult, err := m.jwtSvc.ValidateTokenWith(validator, tokenString)
 		if err != nil || !authResult.Success {
 			m.logger.Warn("Invalid JWT token",
-				zap.String("error", err.Error()),
-				zap.String("ip", c.ClientIP()),
+				zap.String("validator", validator),
+				zap.Error(err),
+				zap.String("ip", clientip.FromContext(c)),
 				zap.String("user_agent", c.GetHeader("User-Agent")))
 
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -69,16 +94,8 @@ func (m *JWTMiddleware) Authenticate() gin.HandlerFunc {
 			return
 		}
 
-		// 設置轉發給微服務的 headers
-		headers := m.jwtSvc.CreateAuthHeaders(authResult.User)
-		for key, value := range headers {
-			c.Request.Header.Set(key, value)
-		}
-
-		// 將基本信息存儲到上下文中（僅用於日誌和調試）
-		c.Set("user_id", authResult.User.ID)
-		c.Set("company_id", authResult.User.CompanyID)
-		c.Set("user_role", authResult.User.Role)
+		// 設置轉發 headers 並將基本信息存儲到上下文中
+		m.setAuthContext(c, authResult.User, AuthMethodBearer)
 
 		m.logger.Debug("Request authenticated",
 			zap.String("user_id", authResult.User.ID),
@@ -90,9 +107,23 @@ func (m *JWTMiddleware) Authenticate() gin.HandlerFunc {
 	}
 }
 
+// ValidatorNames 返回已註冊的 Token 驗證器名稱
+func (m *JWTMiddleware) ValidatorNames() []string {
+	return m.jwtSvc.ValidatorNames()
+}
+
 // RequireRoles 角色驗證中間件
 func (m *JWTMiddleware) RequireRoles(requiredRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 已認證的身份直接檢查角色
+		if user, err := GetAuthUserFromContext(c); err == nil {
+			if !m.checkRoles(c, user, requiredRoles) {
+				return
+			}
+			c.Next()
+			return
+		}
+
 		// 從 JWT claims 中獲取角色信息
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -125,36 +156,37 @@ func (m *JWTMiddleware) RequireRoles(requiredRoles ...string) gin.HandlerFunc {
 		}
 
 		// 檢查用戶是否具有所需角色
-		if !m.jwtSvc.ValidateRole(authResult.User, requiredRoles) {
-			m.logger.Warn("Access denied - insufficient permissions",
-				zap.String("user_id", authResult.User.ID),
-				zap.String("user_role", authResult.User.Role),
-				zap.Strings("required_roles", requiredRoles),
-				zap.String("path", c.Request.URL.Path))
-
-			c.JSON(http.StatusForbidden, gin.H{
-				"status":  "error",
-				"message": "Insufficient permissions",
-			})
-			c.Abort()
+		if !m.checkRoles(c, authResult.User, requiredRoles) {
 			return
 		}
 
-		// 設置轉發給微服務的 headers
-		headers := m.jwtSvc.CreateAuthHeaders(authResult.User)
-		for key, value := range headers {
-			c.Request.Header.Set(key, value)
-		}
-
-		// 將基本信息存儲到上下文中
-		c.Set("user_id", authResult.User.ID)
-		c.Set("company_id", authResult.User.CompanyID)
-		c.Set("user_role", authResult.User.Role)
+		// 設置轉發 headers 並將基本信息存儲到上下文中
+		m.setAuthContext(c, authResult.User, AuthMethodBearer)
 
 		c.Next()
 	}
 }
 
+// checkRoles 檢查用戶角色，不符合時中斷請求
+func (m *JWTMiddleware) checkRoles(c *gin.Context, user *domain.AuthUser, requiredRoles []string) bool {
+	if m.jwtSvc.ValidateRole(user, requiredRoles) {
+		return true
+	}
+
+	m.logger.Warn("Access denied - insufficient permissions",
+		zap.String("user_id", user.ID),
+		zap.String("user_role", user.Role),
+		zap.Strings("required_roles", requiredRoles),
+		zap.String("path", c.Request.URL.Path))
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"status":  "error",
+		"message": "Insufficient permissions",
+	})
+	c.Abort()
+	return false
+}
+
 // OptionalAuth 可選認證中間件（不強制要求認證）
 func (m *JWTMiddleware) OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -164,6 +196,12 @@ func (m *JWTMiddleware) OptionalAuth() gin.HandlerFunc {
 			return
 		}
 
+		// 已由其他認證方式完成認證
+		if _, err := GetAuthUserFromContext(c); err == nil {
+			c.Next()
+			return
+		}
+
 		tokenString, err := m.jwtSvc.ExtractTokenFromAuthHeader(authHeader)
 		if err != nil {
 			// 可選認證失敗時不中斷請求
@@ -178,21 +216,51 @@ func (m *JWTMiddleware) OptionalAuth() gin.HandlerFunc {
 			return
 		}
 
-		// 設置轉發給微服務的 headers
-		headers := m.jwtSvc.CreateAuthHeaders(authResult.User)
-		for key, value := range headers {
-			c.Request.Header.Set(key, value)
-		}
-
-		// 將基本信息存儲到上下文中
-		c.Set("user_id", authResult.User.ID)
-		c.Set("company_id", authResult.User.CompanyID)
-		c.Set("user_role", authResult.User.Role)
+		// 設置轉發 headers 並將基本信息存儲到上下文中
+		m.setAuthContext(c, authResult.User, AuthMethodBearer)
 
 		c.Next()
 	}
 }
 
+// setAuthContext 設置轉發給微服務的 headers 並將認證信息存儲到上下文中
+func (m *JWTMiddleware) setAuthContext(c *gin.Context, user *domain.AuthUser, method string) {
+	SetAuthContext(c, user, method, m.jwtSvc.CreateAuthHeaders(user))
+}
+
+// SetAuthContext 將已認證的用戶寫入上下文並設置轉發 headers
+func SetAuthContext(c *gin.Context, user *domain.AuthUser, method string, headers map[string]string) {
+	for key, value := range headers {
+		c.Request.Header.Set(key, value)
+	}
+
+	c.Set("auth_user", user)
+	c.Set("auth_method", method)
+	c.Set("user_id", user.ID)
+	c.Set("company_id", user.CompanyID)
+	c.Set("user_role", user.Role)
+}
+
+// GetAuthUserFromContext 從上下文中獲取已認證的用戶
+func GetAuthUserFromContext(c *gin.Context) (*domain.AuthUser, error) {
+	value, exists := c.Get("auth_user")
+	if !exists {
+		return nil, fmt.Errorf("auth_user not found in context")
+	}
+
+	user, ok := value.(*domain.AuthUser)
+	if !ok || user == nil {
+		return nil, fmt.Errorf("invalid auth_user in context")
+	}
+
+	return user, nil
+}
+
+// GetAuthMethodFromContext 從上下文中獲取認證方式
+func GetAuthMethodFromContext(c *gin.Context) string {
+	return c.GetString("auth_method")
+}
+
 // GetUserIDFromContext 從上下文中獲取用戶ID
 func GetUserIDFromContext(c *gin.Context) (string, error) {
 	userID, exists := c.Get("user_id")
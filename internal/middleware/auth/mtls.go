@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/x509"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ClientCertMiddleware 客戶端證書認證中間件
+type ClientCertMiddleware struct {
+	config *config.Config
+	logger *zap.Logger
+}
+
+// NewClientCertMiddleware 創建新的客戶端證書認證中間件
+func NewClientCertMiddleware(cfg *config.Config, logger *zap.Logger) *ClientCertMiddleware {
+	return &ClientCertMiddleware{
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Authenticate 將已驗證的客戶端證書映射為服務帳號身份
+// 未提供證書或證書未映射時不中斷請求，交由後續認證中間件處理
+func (m *ClientCertMiddleware) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tlsState := c.Request.TLS
+		// 只信任經過 CA 驗證的證書
+		if tlsState == nil || len(tlsState.VerifiedChains) == 0 || len(tlsState.PeerCertificates) == 0 {
+			c.Next()
+			return
+		}
+
+		cert := tlsState.PeerCertificates[0]
+		user := m.ResolveIdentity(cert)
+		if user == nil {
+			m.logger.Debug("Client certificate not mapped to identity",
+				zap.String("subject", cert.Subject.String()),
+				zap.String("path", c.Request.URL.Path))
+			c.Next()
+			return
+		}
+
+		headers := map[string]string{
+			"X-User-ID":             user.ID,
+			"X-Company-ID":          user.CompanyID,
+			"X-User-Role":           user.Role,
+			"X-Client-Cert-Subject": cert.Subject.CommonName,
+		}
+		SetAuthContext(c, user, AuthMethodClientCert, headers)
+
+		m.logger.Debug("Request authenticated by client certificate",
+			zap.String("service_account", user.ID),
+			zap.String("subject", cert.Subject.String()),
+			zap.String("path", c.Request.URL.Path))
+
+		c.Next()
+	}
+}
+
+// ResolveIdentity 依證書 CN 與 SAN 查找對應的服務帳號
+func (m *ClientCertMiddleware) ResolveIdentity(cert *x509.Certificate) *domain.AuthUser {
+	for _, identity := range m.config.TLS.ClientAuth.Identities {
+		if !matchIdentity(identity, cert) {
+			continue
+		}
+
+		user := &domain.AuthUser{
+			ID:        identity.ServiceAccount,
+			Username:  identity.ServiceAccount,
+			CompanyID: identity.CompanyID,
+			Roles:     identity.Roles,
+		}
+		if len(identity.Roles) > 0 {
+			user.Role = identity.Roles[0]
+		}
+		return user
+	}
+
+	return nil
+}
+
+// matchIdentity 檢查證書是否符合身份映射規則，同時設置 CN 與 SAN 時兩者都需符合
+func matchIdentity(identity config.ClientIdentityConfig, cert *x509.Certificate) bool {
+	if identity.CommonName == "" && identity.SAN == "" {
+		return false
+	}
+	if identity.CommonName != "" && identity.CommonName != cert.Subject.CommonName {
+		return false
+	}
+	return identity.SAN == "" || hasSAN(cert, identity.SAN)
+}
+
+// hasSAN 檢查證書的 DNS、Email 或 URI SAN 是否包含指定值
+func hasSAN(cert *x509.Certificate, san string) bool {
+	for _, name := range cert.DNSNames {
+		if name == san {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if email == san {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/infrastructure/claims"
+	"expense-api-gateway/internal/infrastructure/oidc"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// loginStateTTL 登入流程暫存狀態的有效期
+const loginStateTTL = 10 * time.Minute
+
+// gatewayCookiesKey 上下文中保存已移除的網關 Cookie
+const gatewayCookiesKey = "gateway_cookies"
+
+// SessionMiddleware OIDC 會話中間件，將加密的會話 Cookie 轉換為上游身份 headers
+type SessionMiddleware struct {
+	config   *config.Config
+	logger   *zap.Logger
+	provider *oidc.Provider
+	codec    *oidc.Codec
+	mapping  config.ClaimMapping
+}
+
+// NewSessionMiddleware 創建新的 OIDC 會話中間件
+func NewSessionMiddleware(cfg *config.Config, logger *zap.Logger) *SessionMiddleware {
+	codec, err := oidc.NewCodec(cfg.OIDC.Session.Secret)
+	if err != nil {
+		logger.Error("Failed to create session codec", zap.Error(err))
+	}
+
+	return &SessionMiddleware{
+		config:   cfg,
+		logger:   logger,
+		provider: oidc.NewProvider(cfg.OIDC, logger),
+		codec:    codec,
+		mapping:  claims.WithDefaults(cfg.OIDC.ClaimMapping),
+	}
+}
+
+// Authenticate 從會話 Cookie 還原身份，必要時靜默刷新
+// 無會話或會話無效時不中斷請求，交由後續認證中間件處理
+func (m *SessionMiddleware) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cookie, err := c.Request.Cookie(m.cookieName())
+		if err != nil || m.codec == nil {
+			c.Next()
+			return
+		}
+
+		// 會話 Cookie 只在網關使用，不轉發給上游服務
+		m.stripCookies(c)
+
+		// 已由其他認證方式完成認證
+		if _, err := GetAuthUserFromContext(c); err == nil {
+			c.Next()
+			return
+		}
+
+		var session oidc.Session
+		if err := m.codec.Decode(m.cookieName(), cookie.Value, &session); err != nil || session.User == nil {
+			m.logger.Debug("Invalid session cookie", zap.String("path", c.Request.URL.Path))
+			m.clearCookie(c, m.cookieName())
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		if m.config.OIDC.Session.MaxAge > 0 && now.Sub(time.Unix(session.IssuedAt, 0)) > m.config.OIDC.Session.MaxAge {
+			m.clearCookie(c, m.cookieName())
+			c.Next()
+			return
+		}
+
+		// access token 即將到期時靜默刷新
+		if time.Unix(session.ExpiresAt, 0).Sub(now) <= m.config.OIDC.RefreshBefore {
+			if err := m.refresh(c, &session); err != nil {
+				m.logger.Info("Session refresh failed",
+					zap.String("user_id", session.User.ID),
+					zap.Error(err))
+				m.clearCookie(c, m.cookieName())
+				c.Next()
+				return
+			}
+		}
+
+		SetAuthContext(c, session.User, AuthMethodSession, sessionHeaders(session.User))
+
+		c.Next()
+	}
+}
+
+// Login 重定向到 IdP 授權端點（授權碼流程 + PKCE）
+func (m *SessionMiddleware) Login() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, errState := oidc.RandomString(32)
+		nonce, errNonce := oidc.RandomString(32)
+		verifier, errVerifier := oidc.RandomString(48)
+		if errState != nil || errNonce != nil || errVerifier != nil {
+			m.abort(c, http.StatusInternalServerError, "Failed to start login")
+			return
+		}
+
+		authURL, err := m.provider.AuthCodeURL(state, nonce, verifier)
+		if err != nil {
+			m.logger.Error("Failed to build authorization URL", zap.Error(err))
+			m.abort(c, http.StatusBadGateway, "Identity provider unavailable")
+			return
+		}
+
+		loginState := oidc.LoginState{
+			State:        state,
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			ReturnTo:     safeReturnTo(c.Query("return_to")),
+			ExpiresAt:    time.Now().Add(loginStateTTL).Unix(),
+		}
+		if !m.setCookie(c, m.loginCookieName(), loginState, loginStateTTL, http.SameSiteLaxMode) {
+			m.abort(c, http.StatusInternalServerError, "Failed to start login")
+			return
+		}
+
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// Callback 處理 IdP 回調，交換授權碼並建立會話
+func (m *SessionMiddleware) Callback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if idpErr := c.Query("error"); idpErr != "" {
+			m.logger.Warn("Identity provider returned error",
+				zap.String("error", idpErr),
+				zap.String("description", c.Query("error_description")))
+			m.abort(c, http.StatusUnauthorized, "Login failed")
+			return
+		}
+
+		cookie, err := m.cookie(c, m.loginCookieName())
+		if err != nil || m.codec == nil {
+			m.abort(c, http.StatusBadRequest, "Login session not found")
+			return
+		}
+		m.clearCookie(c, m.loginCookieName())
+
+		var loginState oidc.LoginState
+		if err := m.codec.Decode(m.loginCookieName(), cookie.Value, &loginState); err != nil {
+			m.abort(c, http.StatusBadRequest, "Invalid login session")
+			return
+		}
+		if time.Now().Unix() > loginState.ExpiresAt {
+			m.abort(c, http.StatusBadRequest, "Login session expired")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(loginState.State)) != 1 {
+			m.abort(c, http.StatusBadRequest, "Invalid state parameter")
+			return
+		}
+
+		token, err := m.provider.Exchange(c.Query("code"), loginState.CodeVerifier)
+		if err != nil {
+			m.logger.Warn("Authorization code exchange failed", zap.Error(err))
+			m.abort(c, http.StatusUnauthorized, "Login failed")
+			return
+		}
+
+		idClaims, err := m.provider.VerifyIDToken(token.IDToken, loginState.Nonce)
+		if err != nil {
+			m.logger.Warn("ID token verification failed", zap.Error(err))
+			m.abort(c, http.StatusUnauthorized, "Login failed")
+			return
+		}
+
+		now := time.Now()
+		session := oidc.Session{
+			User:         claims.ToAuthUser(idClaims, m.mapping),
+			RefreshToken: token.RefreshToken,
+			IDToken:      token.IDToken,
+			ExpiresAt:    m.tokenExpiry(token, idClaims, now),
+			IssuedAt:     now.Unix(),
+		}
+		if !m.setCookie(c, m.cookieName(), session, m.config.OIDC.Session.MaxAge, m.sameSite()) {
+			m.abort(c, http.StatusInternalServerError, "Failed to create session")
+			return
+		}
+
+		m.logger.Info("User logged in via OIDC",
+			zap.String("user_id", session.User.ID),
+			zap.String("company_id", session.User.CompanyID))
+
+		returnTo := loginState.ReturnTo
+		if returnTo == "" {
+			returnTo = m.config.OIDC.PostLoginRedirect
+		}
+		if returnTo == "" {
+			returnTo = "/"
+		}
+		c.Redirect(http.StatusFound, returnTo)
+	}
+}
+
+// Logout 清除會話並重定向到 IdP 登出端點
+func (m *SessionMiddleware) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var idToken string
+		if cookie, err := m.cookie(c, m.cookieName()); err == nil && m.codec != nil {
+			var session oidc.Session
+			if err := m.codec.Decode(m.cookieName(), cookie.Value, &session); err == nil {
+				idToken = session.IDToken
+			}
+		}
+		m.clearCookie(c, m.cookieName())
+
+		target := m.provider.EndSessionURL(idToken, m.config.OIDC.PostLogoutRedirect)
+		if target == "" {
+			target = m.config.OIDC.PostLogoutRedirect
+		}
+		if target == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "success",
+				"message": "Logged out",
+			})
+			return
+		}
+
+		c.Redirect(http.StatusFound, target)
+	}
+}
+
+// refresh 以 refresh token 更新會話並重新寫入 Cookie
+func (m *SessionMiddleware) refresh(c *gin.Context, session *oidc.Session) error {
+	if session.RefreshToken == "" {
+		return domain.ErrTokenExpired
+	}
+
+	token, err := m.provider.Refresh(session.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	var idClaims map[string]interface{}
+	if token.IDToken != "" {
+		idClaims, err = m.provider.VerifyIDToken(token.IDToken, "")
+		if err != nil {
+			return err
+		}
+		session.User = claims.ToAuthUser(idClaims, m.mapping)
+		session.IDToken = token.IDToken
+	}
+	if token.RefreshToken != "" {
+		session.RefreshToken = token.RefreshToken
+	}
+
+	now := time.Now()
+	session.ExpiresAt = m.tokenExpiry(token, idClaims, now)
+
+	// Cookie 有效期不超過會話的絕對有效期
+	remaining := m.config.OIDC.Session.MaxAge - now.Sub(time.Unix(session.IssuedAt, 0))
+	m.setCookie(c, m.cookieName(), session, remaining, m.sameSite())
+
+	m.logger.Debug("Session refreshed", zap.String("user_id", session.User.ID))
+	return nil
+}
+
+// setCookie 加密並寫入 Cookie
+func (m *SessionMiddleware) setCookie(c *gin.Context, name string, value interface{}, maxAge time.Duration, sameSite http.SameSite) bool {
+	encoded, err := m.codec.Encode(name, value)
+	if err != nil {
+		m.logger.Error("Failed to encode cookie", zap.String("cookie", name), zap.Error(err))
+		return false
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    encoded,
+		Path:     m.cookiePath(),
+		Domain:   m.config.OIDC.Session.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   m.config.OIDC.Session.Secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+	return true
+}
+
+// clearCookie 清除 Cookie
+func (m *SessionMiddleware) clearCookie(c *gin.Context, name string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     m.cookiePath(),
+		Domain:   m.config.OIDC.Session.Domain,
+		MaxAge:   -1,
+		Secure:   m.config.OIDC.Session.Secure,
+		HttpOnly: true,
+	})
+}
+
+// stripCookies 從轉發請求中移除網關專用的 Cookie，並保存在上下文中供登入端點使用
+func (m *SessionMiddleware) stripCookies(c *gin.Context) {
+	cookies := c.Request.Cookies()
+	c.Request.Header.Del("Cookie")
+
+	var kept []string
+	var stripped []*http.Cookie
+	for _, cookie := range cookies {
+		if cookie.Name == m.cookieName() || cookie.Name == m.loginCookieName() {
+			stripped = append(stripped, cookie)
+			continue
+		}
+		kept = append(kept, cookie.String())
+	}
+	if len(kept) > 0 {
+		c.Request.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+	c.Set(gatewayCookiesKey, stripped)
+}
+
+// cookie 讀取網關 Cookie，包含已從請求中移除的 Cookie
+func (m *SessionMiddleware) cookie(c *gin.Context, name string) (*http.Cookie, error) {
+	if cookie, err := c.Request.Cookie(name); err == nil {
+		return cookie, nil
+	}
+
+	if value, exists := c.Get(gatewayCookiesKey); exists {
+		if cookies, ok := value.([]*http.Cookie); ok {
+			for _, cookie := range cookies {
+				if cookie.Name == name {
+					return cookie, nil
+				}
+			}
+		}
+	}
+
+	return nil, http.ErrNoCookie
+}
+
+// abort 返回錯誤並中斷請求
+func (m *SessionMiddleware) abort(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"message": message,
+	})
+	c.Abort()
+}
+
+// cookieName 會話 Cookie 名稱
+func (m *SessionMiddleware) cookieName() string {
+	if m.config.OIDC.Session.Name == "" {
+		return "gw_session"
+	}
+	return m.config.OIDC.Session.Name
+}
+
+// loginCookieName 登入狀態 Cookie 名稱
+func (m *SessionMiddleware) loginCookieName() string {
+	return m.cookieName() + "_login"
+}
+
+// cookiePath Cookie 路徑
+func (m *SessionMiddleware) cookiePath() string {
+	if m.config.OIDC.Session.Path == "" {
+		return "/"
+	}
+	return m.config.OIDC.Session.Path
+}
+
+// sameSite 會話 Cookie 的 SameSite 設定
+func (m *SessionMiddleware) sameSite() http.SameSite {
+	switch m.config.OIDC.Session.SameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// tokenExpiry 計算 access token 到期時間
+// 未提供 expires_in 時使用 ID Token 的 exp，皆無時以會話有效期為準
+func (m *SessionMiddleware) tokenExpiry(token *oidc.TokenResponse, idClaims map[string]interface{}, now time.Time) int64 {
+	if token.ExpiresIn > 0 {
+		return now.Add(time.Duration(token.ExpiresIn) * time.Second).Unix()
+	}
+	if exp, ok := claims.Int64(idClaims, "exp"); ok {
+		return exp
+	}
+	return now.Add(m.config.OIDC.Session.MaxAge).Unix()
+}
+
+// sessionHeaders 會話身份轉發 headers
+func sessionHeaders(user *domain.AuthUser) map[string]string {
+	return map[string]string{
+		"X-User-ID":    user.ID,
+		"X-Company-ID": user.CompanyID,
+		"X-User-Role":  user.Role,
+		"X-User-Email": user.Email,
+	}
+}
+
+// safeReturnTo 只允許站內相對路徑，避免開放重定向
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return ""
+	}
+	return returnTo
+}
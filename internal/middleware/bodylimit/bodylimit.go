@@ -0,0 +1,118 @@
+package bodylimit
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/middleware/clientip"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// BodyLimitMiddleware 請求體大小限制中間件
+type BodyLimitMiddleware struct {
+	config *config.Config
+	logger *zap.Logger
+
+	mutex  sync.RWMutex
+	routes map[string]int64 // 路由完整模式對應的上限
+}
+
+// NewBodyLimitMiddleware 創建新的請求體大小限制中間件
+func NewBodyLimitMiddleware(cfg *config.Config, logger *zap.Logger) *BodyLimitMiddleware {
+	return &BodyLimitMiddleware{
+		config: cfg,
+		logger: logger,
+		routes: make(map[string]int64),
+	}
+}
+
+// ResolveLimit 取得路由的請求體上限
+// 優先順序：路由的 max_body_size > services.yaml 中服務的 max_body_size > config.yaml 中服務的 max_body_size > server.max_body_size
+func (m *BodyLimitMiddleware) ResolveLimit(routeLimit int64, serviceName string, serviceLimit int64) int64 {
+	if routeLimit > 0 {
+		return routeLimit
+	}
+	if serviceLimit > 0 {
+		return serviceLimit
+	}
+	if service, exists := m.config.Discovery.Services[serviceName]; exists && service.MaxBodySize > 0 {
+		return service.MaxBodySize
+	}
+	return m.config.Server.MaxBodySize
+}
+
+// SetRouteLimit 設置路由的請求體上限，pattern 為路由的完整模式，limit 不大於 0 時使用全局上限
+func (m *BodyLimitMiddleware) SetRouteLimit(pattern string, limit int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if limit <= 0 {
+		delete(m.routes, pattern)
+		return
+	}
+	m.routes[pattern] = limit
+}
+
+// Limit 返回路由的請求體上限，未設置時返回 server.max_body_size
+func (m *BodyLimitMiddleware) Limit(pattern string) int64 {
+	m.mutex.RLock()
+	limit, exists := m.routes[pattern]
+	m.mutex.RUnlock()
+
+	if exists {
+		return limit
+	}
+	return m.config.Server.MaxBodySize
+}
+
+// Global 全局中間件，需放在所有讀取請求體的中間件之前
+// 聲明的 Content-Length 超過上限時直接拒絕；未聲明長度的請求（如分塊傳輸）以限制讀取器包裝，
+// 讀取超過上限時返回 *http.MaxBytesError，由讀取方以 ExceededLimit 判斷後返回 413
+func (m *BodyLimitMiddleware) Global() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := m.Limit(c.FullPath())
+		if limit <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			m.logger.Warn("Request body too large",
+				zap.String("ip", clientip.FromContext(c)),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Int64("content_length", c.Request.ContentLength),
+				zap.Int64("limit", limit))
+			Reject(c, limit)
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// ExceededLimit 檢查錯誤是否由請求體超過上限引起，是時返回該上限
+func ExceededLimit(err error) (int64, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return maxBytesErr.Limit, true
+	}
+	return 0, false
+}
+
+// Reject 返回 413 並中斷請求
+func Reject(c *gin.Context, limit int64) {
+	c.JSON(domain.ErrPayloadTooLarge.StatusCode, gin.H{
+		"status":  "error",
+		"message": domain.ErrPayloadTooLarge.Message,
+		"code":    domain.ErrCodePayloadTooLarge,
+		"limit":   limit,
+	})
+	c.Abort()
+}
@@ -0,0 +1,281 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 支援的客戶端 IP 請求頭
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// contextKey 客戶端 IP 在 gin 上下文中的鍵
+const contextKey = "client_ip"
+
+// DefaultHeaders 默認依序檢查的請求頭
+var DefaultHeaders = []string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP}
+
+// untrusted 不信任任何代理的解析器，用於未經中間件處理的請求
+var untrusted = &Resolver{}
+
+// Resolver 客戶端 IP 解析器
+// 只有直接連線的對端是受信任代理時才讀取請求頭，並由右至左跳過受信任代理，
+// 第一個不受信任的地址即為客戶端 IP
+type Resolver struct {
+	trusted []*net.IPNet
+	headers []string
+}
+
+// NewResolver 創建客戶端 IP 解析器
+func NewResolver(cfg config.ClientIPConfig) (*Resolver, error) {
+	r := &Resolver{headers: cfg.Headers}
+	if len(r.headers) == 0 {
+		r.headers = DefaultHeaders
+	}
+	for _, header := range r.headers {
+		if !IsSupportedHeader(header) {
+			return nil, fmt.Errorf("unsupported client ip header: %s", header)
+		}
+	}
+
+	for _, proxy := range cfg.TrustedProxies {
+		network, err := ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+		r.trusted = append(r.trusted, network)
+	}
+	return r, nil
+}
+
+// Resolve 解析請求的客戶端 IP
+func (r *Resolver) Resolve(req *http.Request) string {
+	peer := RemoteIP(req)
+	if !r.IsTrusted(peer) {
+		return peer
+	}
+
+	for _, header := range r.headers {
+		chain := headerChain(req.Header, header)
+		if len(chain) == 0 {
+			continue
+		}
+		if client := r.walk(chain); client != "" {
+			return client
+		}
+	}
+	return peer
+}
+
+// ForwardedChain 返回可轉發給上游的 X-Forwarded-For 鏈（不含直接連線的對端）
+// 對端不受信任時返回 nil，對端受信任時只保留解析出的客戶端及其右側的受信任代理
+func (r *Resolver) ForwardedChain(req *http.Request) []string {
+	peer := RemoteIP(req)
+	if !r.IsTrusted(peer) {
+		return nil
+	}
+
+	for _, header := range r.headers {
+		chain := headerChain(req.Header, header)
+		if len(chain) == 0 {
+			continue
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip := parseIP(chain[i])
+			if ip == "" {
+				return normalizeChain(chain[i+1:])
+			}
+			if !r.IsTrusted(ip) || i == 0 {
+				return normalizeChain(chain[i:])
+			}
+		}
+	}
+	return nil
+}
+
+// IsTrusted 檢查 IP 是否屬於受信任代理
+func (r *Resolver) IsTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range r.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk 由右至左跳過受信任代理，遇到無效地址時停止並返回最後一個有效地址
+func (r *Resolver) walk(chain []string) string {
+	last := ""
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseIP(chain[i])
+		if ip == "" {
+			return last
+		}
+		last = ip
+		if !r.IsTrusted(ip) {
+			return ip
+		}
+	}
+	// 全部為受信任代理時取最左側的地址
+	return last
+}
+
+// Middleware 在上下文中保存解析出的客戶端 IP，需作為第一個全局中間件
+func Middleware(resolver *Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(contextKey, resolver.Resolve(c.Request))
+		c.Next()
+	}
+}
+
+// FromContext 返回客戶端 IP，未經中間件處理時返回直接連線的對端地址
+func FromContext(c *gin.Context) string {
+	if ip := c.GetString(contextKey); ip != "" {
+		return ip
+	}
+	return untrusted.Resolve(c.Request)
+}
+
+// RemoteIP 返回直接連線的對端 IP
+func RemoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(req.RemoteAddr)
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// ParseCIDR 解析 CIDR 或單個 IP
+func ParseCIDR(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", value)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %s", value)
+	}
+	return network, nil
+}
+
+// IsSupportedHeader 檢查請求頭是否支援
+func IsSupportedHeader(header string) bool {
+	switch http.CanonicalHeaderKey(header) {
+	case HeaderForwarded, HeaderXForwardedFor, http.CanonicalHeaderKey(HeaderXRealIP):
+		return true
+	}
+	return false
+}
+
+// headerChain 讀取請求頭中的地址鏈，由客戶端至最近的代理排列
+func headerChain(header http.Header, name string) []string {
+	switch http.CanonicalHeaderKey(name) {
+	case HeaderForwarded:
+		return parseForwarded(header.Values(HeaderForwarded))
+	case HeaderXForwardedFor:
+		var chain []string
+		for _, value := range header.Values(HeaderXForwardedFor) {
+			for _, part := range strings.Split(value, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					chain = append(chain, part)
+				}
+			}
+		}
+		return chain
+	default:
+		if value := strings.TrimSpace(header.Get(HeaderXRealIP)); value != "" {
+			return []string{value}
+		}
+		return nil
+	}
+}
+
+// parseForwarded 解析 RFC 7239 Forwarded 請求頭的 for 參數
+// 沒有 for 參數的元素以空字符串佔位，使鏈在該處中斷
+func parseForwarded(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			node := ""
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(strings.TrimSpace(key), "for") {
+					node = strings.Trim(strings.TrimSpace(val), `"`)
+				}
+			}
+			chain = append(chain, node)
+		}
+	}
+	return chain
+}
+
+// splitQuoted 以分隔符切分字符串，忽略引號內的分隔符
+func splitQuoted(value string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// parseIP 解析地址鏈中的節點，支援 IPv6 方括號與端口，無效時返回空字符串
+func parseIP(node string) string {
+	node = strings.TrimSpace(node)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	node = strings.Trim(node, "[]")
+	if ip := net.ParseIP(node); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// normalizeChain 將地址鏈統一為不含端口的 IP
+func normalizeChain(chain []string) []string {
+	normalized := make([]string, 0, len(chain))
+	for _, node := range chain {
+		if ip := parseIP(node); ip != "" {
+			normalized = append(normalized, ip)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	return normalized
+}
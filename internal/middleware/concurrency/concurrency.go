@@ -0,0 +1,165 @@
+package concurrency
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ConcurrencyMiddleware 上游並發限制中間件
+type ConcurrencyMiddleware struct {
+	config   *config.Config
+	logger   *zap.Logger
+	monitor  *monitor.Monitor
+	mutex    sync.Mutex
+	limiters map[string]*Limiter
+}
+
+// NewConcurrencyMiddleware 創建新的並發限制中間件，monitorService 為 nil 時不上報指標
+func NewConcurrencyMiddleware(cfg *config.Config, logger *zap.Logger, monitorService *monitor.Monitor) *ConcurrencyMiddleware {
+	return &ConcurrencyMiddleware{
+		config:   cfg,
+		logger:   logger,
+		monitor:  monitorService,
+		limiters: make(map[string]*Limiter),
+	}
+}
+
+// ResolveLimiters 取得路由適用的限制器（路由級別在前，服務級別在後）
+// 服務級別的限制器由同一服務的所有路由共用
+func (m *ConcurrencyMiddleware) ResolveLimiters(routeName string, routeRule *config.ConcurrencyRule, serviceName string, serviceRule *config.ConcurrencyRule) []*Limiter {
+	if !m.config.Concurrency.Enabled {
+		return nil
+	}
+
+	var limiters []*Limiter
+	if routeRule != nil {
+		limiters = append(limiters, m.limiter("route:"+routeName, *routeRule))
+	}
+	if serviceRule != nil && serviceName != "" {
+		limiters = append(limiters, m.limiter("service:"+serviceName, *serviceRule))
+	}
+	return limiters
+}
+
+// Limit 並發限制中間件，名額不足且隊列已滿或排隊超時時返回 503
+func (m *ConcurrencyMiddleware) Limit(limiters ...*Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for i, limiter := range limiters {
+			if err := limiter.Acquire(c.Request.Context()); err != nil {
+				for _, acquired := range limiters[:i] {
+					acquired.Cancel()
+				}
+				m.logger.Warn("Upstream concurrency limit exceeded",
+					zap.String("limiter", limiter.Name()),
+					zap.String("path", c.Request.URL.Path),
+					zap.Error(err))
+				m.reject(c)
+				return
+			}
+		}
+
+		// 在 defer 中釋放名額，下游 panic（如客戶端斷開時反向代理的 http.ErrAbortHandler）時視為丟棄
+		start := time.Now()
+		completed := false
+		defer func() {
+			rtt := time.Since(start)
+			dropped := !completed || isOverloadStatus(c.Writer.Status())
+			for _, limiter := range limiters {
+				limiter.Release(rtt, dropped)
+			}
+		}()
+
+		c.Next()
+		completed = true
+	}
+}
+
+// Stats 返回所有限制器的狀態
+func (m *ConcurrencyMiddleware) Stats() []Stats {
+	m.mutex.Lock()
+	limiters := make([]*Limiter, 0, len(m.limiters))
+	for _, limiter := range m.limiters {
+		limiters = append(limiters, limiter)
+	}
+	m.mutex.Unlock()
+
+	stats := make([]Stats, 0, len(limiters))
+	for _, limiter := range limiters {
+		stats = append(stats, limiter.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// GetStats 查詢並發限制狀態（管理端點）
+func (m *ConcurrencyMiddleware) GetStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"enabled":  m.config.Concurrency.Enabled,
+				"limiters": m.Stats(),
+			},
+		})
+	}
+}
+
+// limiter 取得或創建指定名稱的限制器
+func (m *ConcurrencyMiddleware) limiter(name string, rule config.ConcurrencyRule) *Limiter {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if limiter, exists := m.limiters[name]; exists {
+		return limiter
+	}
+
+	limiter := NewLimiter(name, rule)
+	if m.monitor != nil {
+		limiter.SetObserver(func(stats Stats) {
+			m.monitor.UpdateConcurrency(stats.Name, monitor.ConcurrencyMetrics{
+				Limit:    stats.Limit,
+				InFlight: stats.InFlight,
+				Queued:   stats.Queued,
+				Rejected: stats.Rejected,
+				Timeouts: stats.Timeouts,
+			})
+		})
+	}
+	m.limiters[name] = limiter
+	return limiter
+}
+
+// reject 返回 503 並附帶 Retry-After
+func (m *ConcurrencyMiddleware) reject(c *gin.Context) {
+	retryAfter := m.config.Concurrency.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"status":      "error",
+		"message":     "Upstream service is saturated, please retry later",
+		"code":        "UPSTREAM_SATURATED",
+		"retry_after": seconds,
+	})
+	c.Abort()
+}
+
+// isOverloadStatus 檢查狀態碼是否表示上游過載
+func isOverloadStatus(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,286 @@
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+)
+
+// 並發限制模式
+const (
+	ModeFixed    = "fixed"
+	ModeAIMD     = "aimd"
+	ModeGradient = "gradient"
+)
+
+// 默認參數
+const (
+	defaultQueueTimeout = 5 * time.Second
+	aimdBackoffRatio    = 0.9
+	gradientSmoothing   = 0.2
+	gradientLongWindow  = 100.0 // 長期延遲 EWMA 的樣本數
+	gradientMinRatio    = 0.5
+)
+
+var (
+	// ErrQueueFull 等待隊列已滿
+	ErrQueueFull = errors.New("concurrency queue is full")
+	// ErrQueueTimeout 排隊等待超時
+	ErrQueueTimeout = errors.New("timed out waiting for concurrency slot")
+)
+
+// Stats 並發限制狀態
+type Stats struct {
+	Name     string `json:"name"`
+	Mode     string `json:"mode"`
+	Limit    int    `json:"limit"`
+	InFlight int    `json:"in_flight"`
+	Queued   int    `json:"queued"`
+	MaxQueue int    `json:"max_queue"`
+	Rejected int64  `json:"rejected"`
+	Timeouts int64  `json:"timeouts"`
+}
+
+// waiter 排隊中的請求
+type waiter struct {
+	ready chan struct{}
+}
+
+// Limiter 並發限制器，超過上限的請求按 FIFO 排隊
+// 自適應模式根據上游延遲調整上限：
+//   - aimd：成功時加一，過載（5xx 或延遲超過閾值）時乘以 0.9
+//   - gradient：以長期平均延遲與本次延遲的比值縮放上限，並保留 sqrt(limit) 的排隊空間
+type Limiter struct {
+	name             string
+	mode             string
+	minLimit         float64
+	maxLimit         float64
+	maxQueue         int
+	queueTimeout     time.Duration
+	latencyThreshold time.Duration
+
+	mutex    sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  *list.List
+	longRTT  float64 // 長期平均延遲（納秒）
+	rejected int64
+	timeouts int64
+	observer func(Stats)
+}
+
+// NewLimiter 創建並發限制器
+func NewLimiter(name string, rule config.ConcurrencyRule) *Limiter {
+	rule = normalizeRule(rule)
+	return &Limiter{
+		name:             name,
+		mode:             rule.Mode,
+		minLimit:         float64(rule.MinLimit),
+		maxLimit:         float64(rule.MaxLimit),
+		maxQueue:         rule.MaxQueue,
+		queueTimeout:     rule.QueueTimeout,
+		latencyThreshold: rule.LatencyThreshold,
+		limit:            float64(rule.MaxConcurrent),
+		waiters:          list.New(),
+	}
+}
+
+// SetObserver 設置狀態變化時的回調（在鎖外調用）
+func (l *Limiter) SetObserver(observer func(Stats)) {
+	l.mutex.Lock()
+	l.observer = observer
+	l.mutex.Unlock()
+}
+
+// Name 返回限制器名稱
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Acquire 取得名額，名額不足時排隊等待，隊列已滿或等待超時返回錯誤
+func (l *Limiter) Acquire(ctx context.Context) error {
+	l.mutex.Lock()
+	if l.waiters.Len() == 0 && l.inFlight < l.currentLimit() {
+		l.inFlight++
+		l.unlockAndPublish()
+		return nil
+	}
+	if l.waiters.Len() >= l.maxQueue {
+		l.rejected++
+		l.unlockAndPublish()
+		return ErrQueueFull
+	}
+	w := &waiter{ready: make(chan struct{})}
+	elem := l.waiters.PushBack(w)
+	l.unlockAndPublish()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mutex.Lock()
+	select {
+	case <-w.ready:
+		// 超時的同時已獲得名額
+		l.mutex.Unlock()
+		return nil
+	default:
+	}
+	l.waiters.Remove(elem)
+	if errors.Is(err, ErrQueueTimeout) {
+		l.timeouts++
+	}
+	l.unlockAndPublish()
+	return err
+}
+
+// Release 歸還名額並以本次請求的上游延遲調整上限
+// dropped 表示上游過載（例如 502/503/504）
+func (l *Limiter) Release(rtt time.Duration, dropped bool) {
+	l.mutex.Lock()
+	inFlight := l.inFlight
+	l.inFlight--
+	l.adjust(rtt, dropped, inFlight)
+	l.grant()
+	l.unlockAndPublish()
+}
+
+// Cancel 歸還名額但不計入延遲樣本
+func (l *Limiter) Cancel() {
+	l.mutex.Lock()
+	l.inFlight--
+	l.grant()
+	l.unlockAndPublish()
+}
+
+// Stats 返回當前狀態
+func (l *Limiter) Stats() Stats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.snapshot()
+}
+
+// adjust 依模式調整上限，inFlight 為本次請求完成前的並發數
+func (l *Limiter) adjust(rtt time.Duration, dropped bool, inFlight int) {
+	switch l.mode {
+	case ModeAIMD:
+		if dropped || (l.latencyThreshold > 0 && rtt > l.latencyThreshold) {
+			l.limit *= aimdBackoffRatio
+		} else if float64(inFlight)*2 >= l.limit {
+			// 只有在使用率足夠高時才增加，避免閒置時上限無限增長
+			l.limit++
+		}
+	case ModeGradient:
+		sample := float64(rtt)
+		if sample <= 0 {
+			return
+		}
+		if l.longRTT == 0 {
+			l.longRTT = sample
+		} else {
+			l.longRTT += (sample - l.longRTT) / gradientLongWindow
+		}
+		if float64(inFlight)*2 < l.limit && !dropped {
+			return
+		}
+
+		gradient := math.Max(gradientMinRatio, math.Min(1, l.longRTT/sample))
+		if dropped {
+			gradient = gradientMinRatio
+		}
+		target := l.limit*gradient + math.Sqrt(l.limit)
+		l.limit = l.limit*(1-gradientSmoothing) + target*gradientSmoothing
+	default:
+		return
+	}
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.limit))
+}
+
+// grant 在名額允許時喚醒排隊的請求
+func (l *Limiter) grant() {
+	for l.waiters.Len() > 0 && l.inFlight < l.currentLimit() {
+		w := l.waiters.Remove(l.waiters.Front()).(*waiter)
+		l.inFlight++
+		close(w.ready)
+	}
+}
+
+// currentLimit 當前整數上限，至少為 1
+func (l *Limiter) currentLimit() int {
+	if l.limit < 1 {
+		return 1
+	}
+	return int(l.limit)
+}
+
+// snapshot 在鎖內組合狀態
+func (l *Limiter) snapshot() Stats {
+	return Stats{
+		Name:     l.name,
+		Mode:     l.mode,
+		Limit:    l.currentLimit(),
+		InFlight: l.inFlight,
+		Queued:   l.waiters.Len(),
+		MaxQueue: l.maxQueue,
+		Rejected: l.rejected,
+		Timeouts: l.timeouts,
+	}
+}
+
+// unlockAndPublish 解鎖並通知觀察者
+func (l *Limiter) unlockAndPublish() {
+	observer := l.observer
+	stats := l.snapshot()
+	l.mutex.Unlock()
+	if observer != nil {
+		observer(stats)
+	}
+}
+
+// normalizeRule 修正無效的規則參數
+func normalizeRule(rule config.ConcurrencyRule) config.ConcurrencyRule {
+	switch rule.Mode {
+	case ModeAIMD, ModeGradient:
+	default:
+		rule.Mode = ModeFixed
+	}
+	if rule.MaxConcurrent <= 0 {
+		rule.MaxConcurrent = 1
+	}
+	if rule.MaxQueue < 0 {
+		rule.MaxQueue = 0
+	}
+	if rule.QueueTimeout <= 0 {
+		rule.QueueTimeout = defaultQueueTimeout
+	}
+	if rule.MinLimit <= 0 {
+		rule.MinLimit = 1
+	}
+	if rule.MaxLimit <= 0 {
+		rule.MaxLimit = rule.MaxConcurrent * 4
+	}
+	if rule.MaxLimit < rule.MinLimit {
+		rule.MaxLimit = rule.MinLimit
+	}
+	if rule.MaxConcurrent < rule.MinLimit {
+		rule.MaxConcurrent = rule.MinLimit
+	}
+	if rule.MaxConcurrent > rule.MaxLimit {
+		rule.MaxConcurrent = rule.MaxLimit
+	}
+	return rule
+}
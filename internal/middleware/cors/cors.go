@@ -1,63 +1,123 @@
 package cors
 
 import (
+	"net/http"
+	"strings"
+	"sync"
+
 	"expense-api-gateway/internal/config"
-	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-// Middleware CORS中間件
-func Middleware(cfg *config.Config) gin.HandlerFunc {
-	corsConfig := cors.Config{
-		AllowOrigins:     cfg.CORS.AllowedOrigins,
-		AllowMethods:     cfg.CORS.AllowedMethods,
-		AllowHeaders:     cfg.CORS.AllowedHeaders,
-		AllowCredentials: true,
-		MaxAge:           time.Duration(cfg.CORS.MaxAge) * time.Second,
+// CORSMiddleware CORS 中間件，依請求路徑選擇路由組的策略，未屬於任何組的請求使用默認策略
+// 以全局中間件處理，使未註冊 OPTIONS 方法的路由也能回應預檢請求
+type CORSMiddleware struct {
+	config *config.Config
+	logger *zap.Logger
+
+	mutex  sync.RWMutex
+	global *Policy
+	groups map[string]*Policy // 組前綴對應的策略，nil 表示組未啟用 CORS
+}
+
+// NewCORSMiddleware 創建新的 CORS 中間件，默認策略取 config.yaml 的 cors
+func NewCORSMiddleware(cfg *config.Config, logger *zap.Logger) *CORSMiddleware {
+	global, err := NewPolicy(&cfg.CORS)
+	if err != nil {
+		logger.Error("Invalid CORS configuration, cross-origin requests rejected", zap.Error(err))
+		global = &Policy{}
+	}
+	return &CORSMiddleware{
+		config: cfg,
+		logger: logger,
+		global: global,
+		groups: make(map[string]*Policy),
 	}
+}
 
-	// 如果配置為允許所有來源，使用AllowAllOrigins
-	if len(corsConfig.AllowOrigins) == 1 && corsConfig.AllowOrigins[0] == "*" {
-		corsConfig.AllowAllOrigins = true
-		corsConfig.AllowOrigins = nil
+// SetGroupPolicy 設置路由組的策略，policy 為 nil 時組內請求不發送 CORS 響應頭
+// 未設置的字段繼承 config.yaml 的 cors；策略無效時記錄錯誤並拒絕組內的跨源請求
+func (m *CORSMiddleware) SetGroupPolicy(prefix string, policy *config.CORSConfig) {
+	var compiled *Policy
+	if policy != nil {
+		var err error
+		compiled, err = NewPolicy(policy.Inherit(&m.config.CORS))
+		if err != nil {
+			m.logger.Error("Invalid CORS policy, cross-origin requests rejected",
+				zap.String("group", prefix),
+				zap.Error(err))
+			compiled = &Policy{}
+		}
 	}
 
-	return cors.New(corsConfig)
+	m.mutex.Lock()
+	m.groups[strings.TrimSuffix(prefix, "/")] = compiled
+	m.mutex.Unlock()
 }
 
-// CustomCORS 自定義CORS中間件
-func CustomCORS(cfg *config.Config) gin.HandlerFunc {
+// Global 全局中間件
+func (m *CORSMiddleware) Global() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
+		policy := m.policy(c.Request.URL.Path)
+		if policy == nil {
+			c.Next()
+			return
+		}
 
-		// 檢查來源是否被允許
-		if isAllowedOrigin(origin, cfg.CORS.AllowedOrigins) {
-			c.Header("Access-Control-Allow-Origin", origin)
-		} else if len(cfg.CORS.AllowedOrigins) == 1 && cfg.CORS.AllowedOrigins[0] == "*" {
-			c.Header("Access-Control-Allow-Origin", "*")
+		switch policy.handle(c) {
+		case proceed:
+			c.Next()
+		case rejected:
+			m.logger.Warn("CORS origin rejected",
+				zap.String("origin", c.GetHeader("Origin")),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path))
 		}
+	}
+}
 
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+// policy 以最長前綴匹配路由組的策略
+func (m *CORSMiddleware) policy(path string) *Policy {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	matched := -1
+	policy := m.global
+	for prefix, groupPolicy := range m.groups {
+		if len(prefix) <= matched {
+			continue
+		}
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			matched = len(prefix)
+			policy = groupPolicy
 		}
+	}
+	return policy
+}
 
-		c.Next()
+// Middleware 以 config.yaml 的 cors 策略處理所有請求的 CORS 中間件，配置無效時拒絕跨源請求
+func Middleware(cfg *config.Config) gin.HandlerFunc {
+	policy, err := NewPolicy(&cfg.CORS)
+	if err != nil {
+		policy = &Policy{}
+	}
+	return func(c *gin.Context) {
+		if policy.handle(c) == proceed {
+			c.Next()
+		}
 	}
 }
 
-// isAllowedOrigin 檢查來源是否被允許
-func isAllowedOrigin(origin string, allowedOrigins []string) bool {
-	for _, allowed := range allowedOrigins {
-		if allowed == "*" || allowed == origin {
-			return true
+// MergeUpstream 網關已處理 CORS 時移除上游響應中的 CORS 響應頭，避免反向代理複製後出現重複的值
+func MergeUpstream(c *gin.Context, upstream http.Header) {
+	if c.Writer.Header().Get("Access-Control-Allow-Origin") == "" {
+		return
+	}
+	for name := range upstream {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "Access-Control-") {
+			upstream.Del(name)
 		}
 	}
-	return false
 }
@@ -0,0 +1,180 @@
+package cors
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wildcardOrigin 子域名萬用字元來源，如 https://*.example.com 拆為 https:// 與 .example.com
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+// match 檢查來源是否為模式的子域名
+func (w wildcardOrigin) match(origin string) bool {
+	if len(origin) <= len(w.prefix)+len(w.suffix) ||
+		!strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+		return false
+	}
+	subdomain := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+	return !strings.ContainsAny(subdomain, "/:@?#")
+}
+
+// outcome CORS 處理結果
+type outcome int
+
+const (
+	proceed   outcome = iota // 繼續處理請求
+	preflight                // 預檢請求已回應
+	rejected                 // 來源不被允許，請求已中斷
+)
+
+// Policy 編譯後的 CORS 策略
+type Policy struct {
+	allowAll    bool
+	origins     map[string]struct{}
+	wildcards   []wildcardOrigin
+	patterns    []*regexp.Regexp
+	methods     string
+	anyMethod   bool
+	headers     string
+	anyHeader   bool
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// NewPolicy 編譯 CORS 策略
+func NewPolicy(cfg *config.CORSConfig) (*Policy, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &Policy{
+		origins:     make(map[string]struct{}),
+		credentials: cfg.AllowCredentials,
+		exposed:     strings.Join(cfg.ExposedHeaders, ", "),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		switch {
+		case origin == "*":
+			p.allowAll = true
+		case strings.HasPrefix(origin, config.CORSRegexPrefix):
+			p.patterns = append(p.patterns, regexp.MustCompile("^(?:"+strings.TrimPrefix(origin, config.CORSRegexPrefix)+")$"))
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(strings.ToLower(origin), "*")
+			p.wildcards = append(p.wildcards, wildcardOrigin{prefix: prefix, suffix: suffix})
+		default:
+			p.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = struct{}{}
+		}
+	}
+
+	methods := make([]string, 0, len(cfg.AllowedMethods))
+	for _, method := range cfg.AllowedMethods {
+		if method == "*" {
+			p.anyMethod = true
+		}
+		methods = append(methods, strings.ToUpper(method))
+	}
+	p.methods = strings.Join(methods, ", ")
+	for _, header := range cfg.AllowedHeaders {
+		if header == "*" {
+			p.anyHeader = true
+		}
+	}
+	p.headers = strings.Join(cfg.AllowedHeaders, ", ")
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(cfg.MaxAge)
+	}
+	return p, nil
+}
+
+// match 檢查來源是否被允許，explicit 表示來源被明確列出或匹配模式，只有此時才回顯來源並允許攜帶憑證
+func (p *Policy) match(origin string) (allowed, explicit bool) {
+	normalized := strings.ToLower(origin)
+	if _, exists := p.origins[normalized]; exists {
+		return true, true
+	}
+	for _, wildcard := range p.wildcards {
+		if wildcard.match(normalized) {
+			return true, true
+		}
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true, true
+		}
+	}
+	return p.allowAll, false
+}
+
+// handle 設置 CORS 響應頭，預檢請求與不允許的來源會中斷請求
+func (p *Policy) handle(c *gin.Context) outcome {
+	origin := c.GetHeader("Origin")
+	if origin == "" || sameOrigin(c.Request, origin) {
+		return proceed
+	}
+
+	header := c.Writer.Header()
+	header.Add("Vary", "Origin")
+	allowed, explicit := p.match(origin)
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Origin not allowed",
+			"code":    "CORS_ORIGIN_NOT_ALLOWED",
+		})
+		c.Abort()
+		return rejected
+	}
+	if explicit {
+		header.Set("Access-Control-Allow-Origin", origin)
+		if p.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	} else {
+		// 萬用字元來源不回顯，瀏覽器不會為 * 發送憑證
+		header.Set("Access-Control-Allow-Origin", "*")
+	}
+
+	requestMethod := c.GetHeader("Access-Control-Request-Method")
+	if c.Request.Method != http.MethodOptions || requestMethod == "" {
+		if p.exposed != "" {
+			header.Set("Access-Control-Expose-Headers", p.exposed)
+		}
+		return proceed
+	}
+
+	// 預檢請求：* 以請求聲明的值回應，攜帶憑證時瀏覽器不接受字面上的 *
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if p.anyMethod {
+		header.Set("Access-Control-Allow-Methods", strings.ToUpper(requestMethod))
+	} else if p.methods != "" {
+		header.Set("Access-Control-Allow-Methods", p.methods)
+	}
+	if p.anyHeader {
+		if requestHeaders := c.GetHeader("Access-Control-Request-Headers"); requestHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+	} else if p.headers != "" {
+		header.Set("Access-Control-Allow-Headers", p.headers)
+	}
+	if p.maxAge != "" {
+		header.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+	return preflight
+}
+
+// sameOrigin 檢查來源是否為網關自身，同源請求不需要 CORS 響應頭
+func sameOrigin(r *http.Request, origin string) bool {
+	return strings.EqualFold(origin, "http://"+r.Host) || strings.EqualFold(origin, "https://"+r.Host)
+}
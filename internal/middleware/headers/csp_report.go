@@ -0,0 +1,167 @@
+package headers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"expense-api-gateway/internal/middleware/clientip"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxReportSize CSP 違規報告請求體的最大字節數
+const maxReportSize = 64 << 10
+
+// maxReportField 違規報告中單個字段記錄到日誌的最大長度
+const maxReportField = 512
+
+// CSPViolation CSP 違規報告，兼容 report-uri（application/csp-report）與 Reporting API（application/reports+json）兩種格式
+type CSPViolation struct {
+	DocumentURI        string `json:"document_uri"`
+	Referrer           string `json:"referrer,omitempty"`
+	BlockedURI         string `json:"blocked_uri"`
+	EffectiveDirective string `json:"effective_directive"`
+	OriginalPolicy     string `json:"original_policy,omitempty"`
+	Disposition        string `json:"disposition,omitempty"` // enforce, report
+	SourceFile         string `json:"source_file,omitempty"`
+	LineNumber         int    `json:"line_number,omitempty"`
+	ColumnNumber       int    `json:"column_number,omitempty"`
+	Sample             string `json:"sample,omitempty"`
+	StatusCode         int    `json:"status_code,omitempty"`
+}
+
+// legacyReport report-uri 發送的報告
+type legacyReport struct {
+	Body struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		ScriptSample       string `json:"script-sample"`
+		StatusCode         int    `json:"status-code"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport Reporting API 發送的報告
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		Sample             string `json:"sample"`
+		StatusCode         int    `json:"statusCode"`
+	} `json:"body"`
+}
+
+// CSPReport CSP 違規報告收集端點，記錄每條違規後返回 204
+func (m *HeadersMiddleware) CSPReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxReportSize+1))
+		if err != nil || len(body) > maxReportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"status":  "error",
+				"message": "CSP report too large",
+				"code":    "INVALID_CSP_REPORT",
+			})
+			return
+		}
+
+		violations := ParseCSPReports(body)
+		if len(violations) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid CSP report",
+				"code":    "INVALID_CSP_REPORT",
+			})
+			return
+		}
+
+		for _, violation := range violations {
+			m.logger.Warn("CSP violation",
+				zap.String("ip", clientip.FromContext(c)),
+				zap.String("user_agent", truncate(c.Request.UserAgent())),
+				zap.String("document_uri", truncate(violation.DocumentURI)),
+				zap.String("blocked_uri", truncate(violation.BlockedURI)),
+				zap.String("effective_directive", truncate(violation.EffectiveDirective)),
+				zap.String("disposition", violation.Disposition),
+				zap.String("source_file", truncate(violation.SourceFile)),
+				zap.Int("line_number", violation.LineNumber),
+				zap.Int("column_number", violation.ColumnNumber),
+				zap.String("sample", truncate(violation.Sample)))
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ParseCSPReports 解析 CSP 違規報告，Reporting API 的批量報告中只保留 csp-violation 類型
+func ParseCSPReports(body []byte) []CSPViolation {
+	var legacy legacyReport
+	if err := json.Unmarshal(body, &legacy); err == nil && legacy.Body.DocumentURI != "" {
+		report := legacy.Body
+		directive := report.EffectiveDirective
+		if directive == "" {
+			directive = report.ViolatedDirective
+		}
+		return []CSPViolation{{
+			DocumentURI:        report.DocumentURI,
+			Referrer:           report.Referrer,
+			BlockedURI:         report.BlockedURI,
+			EffectiveDirective: directive,
+			OriginalPolicy:     report.OriginalPolicy,
+			Disposition:        report.Disposition,
+			SourceFile:         report.SourceFile,
+			LineNumber:         report.LineNumber,
+			ColumnNumber:       report.ColumnNumber,
+			Sample:             report.ScriptSample,
+			StatusCode:         report.StatusCode,
+		}}
+	}
+
+	var reports []reportingAPIReport
+	if err := json.Unmarshal(body, &reports); err != nil {
+		return nil
+	}
+	var violations []CSPViolation
+	for _, report := range reports {
+		if report.Type != "csp-violation" || report.Body.DocumentURL == "" {
+			continue
+		}
+		violations = append(violations, CSPViolation{
+			DocumentURI:        report.Body.DocumentURL,
+			Referrer:           report.Body.Referrer,
+			BlockedURI:         report.Body.BlockedURL,
+			EffectiveDirective: report.Body.EffectiveDirective,
+			OriginalPolicy:     report.Body.OriginalPolicy,
+			Disposition:        report.Body.Disposition,
+			SourceFile:         report.Body.SourceFile,
+			LineNumber:         report.Body.LineNumber,
+			ColumnNumber:       report.Body.ColumnNumber,
+			Sample:             report.Body.Sample,
+			StatusCode:         report.Body.StatusCode,
+		})
+	}
+	return violations
+}
+
+// truncate 截斷過長的字段，避免報告內容佔滿日誌
+func truncate(value string) string {
+	if len(value) <= maxReportField {
+		return value
+	}
+	return value[:maxReportField] + "..."
+}
@@ -0,0 +1,222 @@
+package headers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"expense-api-gateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 上下文鍵
+const (
+	appliedContextKey = "security_headers"
+	nonceContextKey   = "csp_nonce"
+)
+
+// NonceHeader 轉發給上游的 CSP nonce 請求頭，上游渲染頁面時在 script、style 標籤上使用
+const NonceHeader = "X-CSP-Nonce"
+
+// noncePlaceholder CSP 策略中的 nonce 佔位符
+const noncePlaceholder = "{nonce}"
+
+// ReportPath CSP 違規報告收集端點的路徑
+const ReportPath = "/csp-report"
+
+// reportGroup report-to 指令使用的報告端點名稱
+const reportGroup = "csp-endpoint"
+
+// header 單個響應頭
+type header struct {
+	name  string
+	value string
+}
+
+// policy 編譯後的響應頭策略
+type policy struct {
+	headers  []header
+	override bool
+}
+
+// applied 請求已設置的響應頭，轉發上游響應時依此合併
+type applied struct {
+	headers  []header
+	override bool
+}
+
+// HeadersMiddleware 安全響應頭中間件
+type HeadersMiddleware struct {
+	config *config.Config
+	logger *zap.Logger
+
+	mutex  sync.RWMutex
+	global *policy
+}
+
+// NewHeadersMiddleware 創建新的安全響應頭中間件，全局策略取 config.yaml 的 security.headers
+func NewHeadersMiddleware(cfg *config.Config, logger *zap.Logger) *HeadersMiddleware {
+	global := cfg.Security.Headers
+	return &HeadersMiddleware{
+		config: cfg,
+		logger: logger,
+		global: compile(&global),
+	}
+}
+
+// SetGlobalPolicy 以 services.yaml 的全局設定覆寫 config.yaml 的策略
+func (m *HeadersMiddleware) SetGlobalPolicy(headers *config.SecurityHeadersConfig) {
+	global := m.config.Security.Headers
+	compiled := compile(headers.Inherit(&global))
+
+	m.mutex.Lock()
+	m.global = compiled
+	m.mutex.Unlock()
+}
+
+// Global 全局中間件，為所有響應設置全局策略的響應頭
+func (m *HeadersMiddleware) Global() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.mutex.RLock()
+		global := m.global
+		m.mutex.RUnlock()
+
+		apply(c, global)
+		c.Next()
+	}
+}
+
+// Policy 組或路由級別的中間件，headers 為已合併 services.yaml 全局與組設定的策略，替換全局中間件設置的響應頭
+func (m *HeadersMiddleware) Policy(headers *config.SecurityHeadersConfig) gin.HandlerFunc {
+	global := m.config.Security.Headers
+	compiled := compile(headers.Inherit(&global))
+
+	return func(c *gin.Context) {
+		apply(c, compiled)
+		c.Next()
+	}
+}
+
+// ApplyUpstream 將請求的策略合併到上游響應頭：preserve 模式保留上游已設置的同名響應頭，override 模式以策略覆寫
+// 網關預先設置在 ResponseWriter 上的同名響應頭會被移除，避免反向代理複製上游響應頭時出現重複
+func ApplyUpstream(c *gin.Context, upstream http.Header) {
+	value, exists := c.Get(appliedContextKey)
+	if !exists {
+		return
+	}
+	current, ok := value.(*applied)
+	if !ok {
+		return
+	}
+
+	for _, h := range current.headers {
+		c.Writer.Header().Del(h.name)
+		if !current.override && upstream.Get(h.name) != "" {
+			continue
+		}
+		upstream.Set(h.name, h.value)
+	}
+}
+
+// Nonce 返回請求的 CSP nonce，策略未使用 nonce 時返回空值
+func Nonce(c *gin.Context) string {
+	return c.GetString(nonceContextKey)
+}
+
+// apply 設置策略的響應頭，先移除先前中間件設置的響應頭
+func apply(c *gin.Context, p *policy) {
+	// nonce 只能由網關生成，移除客戶端偽造的請求頭
+	if Nonce(c) == "" {
+		c.Request.Header.Del(NonceHeader)
+	}
+	if value, exists := c.Get(appliedContextKey); exists {
+		if previous, ok := value.(*applied); ok {
+			for _, h := range previous.headers {
+				c.Writer.Header().Del(h.name)
+			}
+		}
+	}
+
+	current := &applied{override: p.override, headers: make([]header, 0, len(p.headers))}
+	for _, h := range p.headers {
+		if strings.Contains(h.value, noncePlaceholder) {
+			h.value = strings.ReplaceAll(h.value, noncePlaceholder, requestNonce(c))
+		}
+		c.Writer.Header().Set(h.name, h.value)
+		current.headers = append(current.headers, h)
+	}
+	c.Set(appliedContextKey, current)
+}
+
+// requestNonce 返回請求的 nonce，首次使用時生成並轉發給上游，同一請求的全局與路由策略共用
+func requestNonce(c *gin.Context) string {
+	if nonce := c.GetString(nonceContextKey); nonce != "" {
+		return nonce
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	nonce := base64.StdEncoding.EncodeToString(buf)
+	c.Set(nonceContextKey, nonce)
+	c.Request.Header.Set(NonceHeader, nonce)
+	return nonce
+}
+
+// compile 將策略轉為響應頭列表，空值與 off 的響應頭不發送
+func compile(cfg *config.SecurityHeadersConfig) *policy {
+	p := &policy{}
+	if cfg == nil {
+		return p
+	}
+	p.override = cfg.Upstream == config.UpstreamHeadersOverride
+
+	add := func(name, value string) {
+		if value != "" && value != config.HeaderOff {
+			p.headers = append(p.headers, header{name: name, value: value})
+		}
+	}
+	if cfg.CSP != nil {
+		name := "Content-Security-Policy"
+		if cfg.CSP.ReportOnly {
+			name = "Content-Security-Policy-Report-Only"
+		}
+		add(name, cspValue(cfg.CSP))
+		if cfg.CSP.ReportURI != "" && cspValue(cfg.CSP) != "" {
+			add("Reporting-Endpoints", reportGroup+`="`+cfg.CSP.ReportURI+`"`)
+		}
+	}
+	if cfg.HSTS != nil && cfg.HSTS.MaxAge > 0 {
+		value := "max-age=" + strconv.FormatInt(int64(cfg.HSTS.MaxAge.Seconds()), 10)
+		if cfg.HSTS.IncludeSubdomains {
+			value += "; includeSubDomains"
+		}
+		if cfg.HSTS.Preload {
+			value += "; preload"
+		}
+		add("Strict-Transport-Security", value)
+	}
+	add("Referrer-Policy", cfg.ReferrerPolicy)
+	add("Permissions-Policy", cfg.PermissionsPolicy)
+	add("Cross-Origin-Opener-Policy", cfg.CrossOriginOpenerPolicy)
+	add("Cross-Origin-Embedder-Policy", cfg.CrossOriginEmbedderPolicy)
+	add("Cross-Origin-Resource-Policy", cfg.CrossOriginResourcePolicy)
+	add("X-Frame-Options", cfg.FrameOptions)
+	add("X-Content-Type-Options", cfg.ContentTypeOptions)
+	return p
+}
+
+// cspValue 組裝 CSP 響應頭的值，設置了報告地址且策略未包含報告指令時附加 report-uri 與 report-to
+func cspValue(csp *config.CSPConfig) string {
+	value := strings.TrimRight(strings.TrimSpace(csp.Policy), "; ")
+	if value == "" || value == config.HeaderOff {
+		return ""
+	}
+	if csp.ReportURI != "" && !strings.Contains(value, "report-uri") && !strings.Contains(value, "report-to") {
+		value += "; report-uri " + csp.ReportURI + "; report-to " + reportGroup
+	}
+	return value
+}
@@ -0,0 +1,450 @@
+package ipfilter
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/geoip"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 拒絕原因
+const (
+	ReasonDynamic    = "dynamic_denylist"
+	ReasonDeny       = "denylist"
+	ReasonCountry    = "country"
+	ReasonNotAllowed = "not_allowlisted"
+)
+
+// DynamicRule 動態封鎖規則
+type DynamicRule struct {
+	CIDR      string    `json:"cidr"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	network   *net.IPNet
+}
+
+// AddRuleRequest 新增動態封鎖請求
+type AddRuleRequest struct {
+	CIDR   string `json:"cidr" binding:"required"`
+	TTL    string `json:"ttl"` // 例如 "30m"、"24h"，空值時使用 default_ttl
+	Reason string `json:"reason" binding:"required"`
+}
+
+// policy 編譯後的規則
+type policy struct {
+	allow          []*net.IPNet
+	deny           []*net.IPNet
+	allowCountries map[string]bool
+	denyCountries  map[string]bool
+}
+
+// IPFilterMiddleware IP 訪問控制中間件
+type IPFilterMiddleware struct {
+	config  *config.Config
+	logger  *zap.Logger
+	monitor *monitor.Monitor
+	geo     *geoip.Reader
+
+	mutex   sync.RWMutex
+	global  *policy
+	dynamic map[string]*DynamicRule
+	now     func() time.Time
+}
+
+// NewIPFilterMiddleware 創建新的 IP 訪問控制中間件，monitorService 為 nil 時不上報指標
+// 國家數據庫無法載入時，設置了 allow_countries 的規則會拒絕所有不在 allow 中的地址
+func NewIPFilterMiddleware(cfg *config.Config, logger *zap.Logger, monitorService *monitor.Monitor) *IPFilterMiddleware {
+	m := &IPFilterMiddleware{
+		config:  cfg,
+		logger:  logger,
+		monitor: monitorService,
+		dynamic: make(map[string]*DynamicRule),
+		now:     time.Now,
+	}
+
+	if cfg.IPFilter.Enabled && cfg.IPFilter.GeoIPDatabase != "" {
+		geo, err := geoip.Open(cfg.IPFilter.GeoIPDatabase)
+		if err != nil {
+			logger.Error("Failed to load GeoIP database, country rules unavailable", zap.Error(err))
+		}
+		m.geo = geo
+	}
+
+	return m
+}
+
+// SetClock 設置時間來源（用於測試）
+func (m *IPFilterMiddleware) SetClock(now func() time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.now = now
+}
+
+// Enabled 是否啟用 IP 訪問控制
+func (m *IPFilterMiddleware) Enabled() bool {
+	return m.config.IPFilter.Enabled
+}
+
+// SetGlobalRule 設置全局規則（services.yaml 的 ip_filter）
+func (m *IPFilterMiddleware) SetGlobalRule(rule *config.IPFilterRule) {
+	var compiled *policy
+	if rule != nil && !rule.IsEmpty() {
+		compiled = m.compile("global", *rule)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.global = compiled
+}
+
+// Global 全局中間件，檢查動態封鎖與全局規則
+func (m *IPFilterMiddleware) Global() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.config.IPFilter.Enabled {
+			c.Next()
+			return
+		}
+
+		ip := clientip.FromContext(c)
+		if m.isDynamicallyDenied(ip) {
+			m.block(c, "global", ip, ReasonDynamic)
+			return
+		}
+
+		m.mutex.RLock()
+		global := m.global
+		m.mutex.RUnlock()
+		if reason, blocked := m.evaluate(global, ip); blocked {
+			m.block(c, "global", ip, reason)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Filter 組或路由級別的中間件
+func (m *IPFilterMiddleware) Filter(name string, rule *config.IPFilterRule) gin.HandlerFunc {
+	var compiled *policy
+	if rule != nil && !rule.IsEmpty() {
+		compiled = m.compile(name, *rule)
+	}
+
+	return func(c *gin.Context) {
+		if !m.config.IPFilter.Enabled || compiled == nil {
+			c.Next()
+			return
+		}
+
+		ip := clientip.FromContext(c)
+		if reason, blocked := m.evaluate(compiled, ip); blocked {
+			m.block(c, name, ip, reason)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AddRule 新增動態封鎖，相同 CIDR 會覆蓋原有規則
+func (m *IPFilterMiddleware) AddRule(cidr string, ttl time.Duration, reason, createdBy string) (DynamicRule, error) {
+	network, err := clientip.ParseCIDR(cidr)
+	if err != nil {
+		return DynamicRule{}, err
+	}
+	if ttl <= 0 {
+		ttl = m.config.IPFilter.DefaultTTL
+	}
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	if maxTTL := m.config.IPFilter.MaxTTL; maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	rule := &DynamicRule{
+		CIDR:      network.String(),
+		Reason:    reason,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		network:   network,
+	}
+	m.dynamic[rule.CIDR] = rule
+	return *rule, nil
+}
+
+// RemoveRule 移除動態封鎖
+func (m *IPFilterMiddleware) RemoveRule(cidr string) bool {
+	network, err := clientip.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.dynamic[network.String()]; !exists {
+		return false
+	}
+	delete(m.dynamic, network.String())
+	return true
+}
+
+// Rules 返回未過期的動態封鎖，並清理已過期的規則
+func (m *IPFilterMiddleware) Rules() []DynamicRule {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	rules := make([]DynamicRule, 0, len(m.dynamic))
+	for key, rule := range m.dynamic {
+		if !now.Before(rule.ExpiresAt) {
+			delete(m.dynamic, key)
+			continue
+		}
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].CIDR < rules[j].CIDR })
+	return rules
+}
+
+// ListRules 查詢動態封鎖（管理端點）
+func (m *IPFilterMiddleware) ListRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"enabled": m.config.IPFilter.Enabled,
+				"rules":   m.Rules(),
+			},
+		})
+	}
+}
+
+// CreateRule 新增動態封鎖（管理端點）
+func (m *IPFilterMiddleware) CreateRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AddRuleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			m.reject(c, http.StatusBadRequest, "cidr and reason are required")
+			return
+		}
+
+		var ttl time.Duration
+		if req.TTL != "" {
+			parsed, err := time.ParseDuration(req.TTL)
+			if err != nil || parsed <= 0 {
+				m.reject(c, http.StatusBadRequest, "Invalid ttl")
+				return
+			}
+			ttl = parsed
+		}
+
+		createdBy, _ := auth.GetUserIDFromContext(c)
+		rule, err := m.AddRule(req.CIDR, ttl, req.Reason, createdBy)
+		if err != nil {
+			m.reject(c, http.StatusBadRequest, "Invalid cidr")
+			return
+		}
+
+		m.logger.Info("Dynamic IP deny rule added",
+			zap.String("cidr", rule.CIDR),
+			zap.Time("expires_at", rule.ExpiresAt),
+			zap.String("created_by", createdBy),
+			zap.String("reason", req.Reason))
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status": "success",
+			"data":   rule,
+		})
+	}
+}
+
+// DeleteRule 移除動態封鎖（管理端點），CIDR 以 cidr 查詢參數指定
+func (m *IPFilterMiddleware) DeleteRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cidr := c.Query("cidr")
+		if cidr == "" {
+			m.reject(c, http.StatusBadRequest, "cidr is required")
+			return
+		}
+		if !m.RemoveRule(cidr) {
+			m.reject(c, http.StatusNotFound, "Rule not found")
+			return
+		}
+
+		createdBy, _ := auth.GetUserIDFromContext(c)
+		m.logger.Info("Dynamic IP deny rule removed",
+			zap.String("cidr", cidr),
+			zap.String("removed_by", createdBy))
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "Rule removed",
+		})
+	}
+}
+
+// compile 編譯規則，無效的地址會被忽略並記錄錯誤
+func (m *IPFilterMiddleware) compile(name string, rule config.IPFilterRule) *policy {
+	p := &policy{
+		allow:          m.parseNetworks(name, rule.Allow),
+		deny:           m.parseNetworks(name, rule.Deny),
+		allowCountries: countrySet(rule.AllowCountries),
+		denyCountries:  countrySet(rule.DenyCountries),
+	}
+	if (len(p.allowCountries) > 0 || len(p.denyCountries) > 0) && m.geo == nil {
+		m.logger.Warn("Country rules configured without GeoIP database",
+			zap.String("rule", name))
+	}
+	return p
+}
+
+// parseNetworks 解析 IP 或 CIDR 列表
+func (m *IPFilterMiddleware) parseNetworks(name string, values []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		network, err := clientip.ParseCIDR(value)
+		if err != nil {
+			m.logger.Error("Invalid IP filter address ignored",
+				zap.String("rule", name),
+				zap.String("address", value))
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// evaluate 檢查 IP 是否被規則拒絕
+func (m *IPFilterMiddleware) evaluate(p *policy, ip string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ReasonNotAllowed, len(p.allow) > 0 || len(p.allowCountries) > 0
+	}
+
+	if containsIP(p.deny, parsed) {
+		return ReasonDeny, true
+	}
+
+	country := ""
+	if len(p.allowCountries) > 0 || len(p.denyCountries) > 0 {
+		country = m.country(parsed)
+	}
+	if country != "" && p.denyCountries[country] {
+		return ReasonCountry, true
+	}
+
+	if len(p.allow) == 0 && len(p.allowCountries) == 0 {
+		return "", false
+	}
+	if containsIP(p.allow, parsed) || (country != "" && p.allowCountries[country]) {
+		return "", false
+	}
+	if len(p.allow) == 0 {
+		return ReasonCountry, true
+	}
+	return ReasonNotAllowed, true
+}
+
+// country 查詢 IP 所屬國家，無數據庫或查詢失敗時返回空字符串
+func (m *IPFilterMiddleware) country(ip net.IP) string {
+	if m.geo == nil {
+		return ""
+	}
+	country, err := m.geo.Country(ip)
+	if err != nil {
+		m.logger.Debug("GeoIP lookup failed", zap.String("ip", ip.String()), zap.Error(err))
+		return ""
+	}
+	return strings.ToUpper(country)
+}
+
+// isDynamicallyDenied 檢查 IP 是否命中未過期的動態封鎖
+func (m *IPFilterMiddleware) isDynamicallyDenied(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := m.now()
+	for _, rule := range m.dynamic {
+		if now.Before(rule.ExpiresAt) && rule.network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// block 記錄並拒絕請求
+func (m *IPFilterMiddleware) block(c *gin.Context, scope, ip, reason string) {
+	m.logger.Warn("Request blocked by IP filter",
+		zap.String("scope", scope),
+		zap.String("ip", ip),
+		zap.String("reason", reason),
+		zap.String("path", c.Request.URL.Path))
+	if m.monitor != nil {
+		m.monitor.RecordBlocked(reason)
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"status":  "error",
+		"message": "Access denied from this IP address",
+		"code":    "IP_BLOCKED",
+	})
+	c.Abort()
+}
+
+// reject 返回錯誤並中斷請求
+func (m *IPFilterMiddleware) reject(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"message": message,
+	})
+	c.Abort()
+}
+
+// containsIP 檢查 IP 是否屬於任一網段
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// countrySet 將國家代碼列表轉為大寫集合
+func countrySet(countries []string) map[string]bool {
+	set := make(map[string]bool, len(countries))
+	for _, country := range countries {
+		if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+			set[country] = true
+		}
+	}
+	return set
+}
@@ -3,14 +3,16 @@ package logging
 import (
 	"time"
 
+	"expense-api-gateway/internal/infrastructure/redact"
+	"expense-api-gateway/internal/middleware/clientip"
 	"expense-api-gateway/internal/service/monitor"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-// Middleware 日誌中間件
-func Middleware(logger *zap.Logger, monitor *monitor.Monitor) gin.HandlerFunc {
+// Middleware 日誌中間件，redactor 不為 nil 時遮蔽路徑與查詢字符串中的敏感參數與敏感值
+func Middleware(logger *zap.Logger, monitor *monitor.Monitor, redactor *redact.Redactor) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
@@ -23,7 +25,7 @@ func Middleware(logger *zap.Logger, monitor *monitor.Monitor) gin.HandlerFunc {
 		latency := time.Since(start)
 
 		// 獲取請求信息
-		clientIP := c.ClientIP()
+		clientIP := clientip.FromContext(c)
 		method := c.Request.Method
 		statusCode := c.Writer.Status()
 		bodySize := c.Writer.Size()
@@ -33,6 +35,7 @@ func Middleware(logger *zap.Logger, monitor *monitor.Monitor) gin.HandlerFunc {
 		if raw != "" {
 			path = path + "?" + raw
 		}
+		path = redactor.String(path)
 
 		// 記錄日誌
 		logger.Info("HTTP Request",
@@ -60,7 +63,7 @@ func ErrorLogger(logger *zap.Logger) gin.HandlerFunc {
 				zap.String("error", err),
 				zap.String("path", c.Request.URL.Path),
 				zap.String("method", c.Request.Method),
-				zap.String("client_ip", c.ClientIP()),
+				zap.String("client_ip", clientip.FromContext(c)),
 			)
 		}
 		c.AbortWithStatus(500)
@@ -0,0 +1,275 @@
+package loginguard
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 挑戰請求頭，轉發給上游前移除
+const (
+	ChallengeHeader = "X-Login-Challenge" // pow 挑戰的 nonce
+	SolutionHeader  = "X-Login-Solution"  // pow 挑戰的解
+	CaptchaHeader   = "X-Captcha-Token"   // 驗證碼 token
+)
+
+// maxSolutionLength pow 解的最大長度
+const maxSolutionLength = 64
+
+// Challenge 返回給客戶端的挑戰
+// pow：找出字符串 solution，使 SHA-256(nonce + solution) 的前 difficulty 位為 0，
+// 以 X-Login-Challenge 與 X-Login-Solution 請求頭重新提交；captcha：以 X-Captcha-Token 提交驗證碼 token
+type Challenge struct {
+	Type       string     `json:"type"`
+	Algorithm  string     `json:"algorithm,omitempty"`
+	Nonce      string     `json:"nonce,omitempty"`
+	Difficulty int        `json:"difficulty,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// issuedChallenge 已簽發的 pow 挑戰，只能使用一次且綁定簽發時的 IP
+type issuedChallenge struct {
+	nonce     string
+	ip        string
+	expiresAt time.Time
+}
+
+// challengeStore 未使用的 pow 挑戰，同一 IP 只保留一個，總數不超過上限
+// 挑戰的有效期固定，簽發順序即到期順序，清理與淘汰都從最早簽發的挑戰開始
+type challengeStore struct {
+	mutex   sync.Mutex
+	limit   int
+	order   *list.List // *issuedChallenge，按簽發時間排序
+	byNonce map[string]*list.Element
+	byIP    map[string]*list.Element
+	stopCh  chan struct{}
+	stopped sync.Once
+}
+
+// newChallengeStore 創建挑戰存儲，limit <= 0 時不限制數量
+func newChallengeStore(limit int) *challengeStore {
+	return &challengeStore{
+		limit:   limit,
+		order:   list.New(),
+		byNonce: make(map[string]*list.Element),
+		byIP:    make(map[string]*list.Element),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// issue 返回 IP 未過期的挑戰，不存在時簽發新挑戰，達到上限時淘汰最早簽發的挑戰
+func (s *challengeStore) issue(ip string, now time.Time, ttl time.Duration) issuedChallenge {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if element, exists := s.byIP[ip]; exists {
+		issued := element.Value.(*issuedChallenge)
+		if now.Before(issued.expiresAt) {
+			return *issued
+		}
+		s.remove(element)
+	}
+	for s.limit > 0 && s.order.Len() >= s.limit {
+		s.remove(s.order.Front())
+	}
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	issued := &issuedChallenge{
+		nonce:     base64.RawURLEncoding.EncodeToString(buf),
+		ip:        ip,
+		expiresAt: now.Add(ttl),
+	}
+	element := s.order.PushBack(issued)
+	s.byNonce[issued.nonce] = element
+	s.byIP[ip] = element
+	return *issued
+}
+
+// consume 取出並刪除挑戰
+func (s *challengeStore) consume(nonce string) (issuedChallenge, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	element, exists := s.byNonce[nonce]
+	if !exists {
+		return issuedChallenge{}, false
+	}
+	s.remove(element)
+	return *element.Value.(*issuedChallenge), true
+}
+
+// purge 刪除已過期的挑戰
+func (s *challengeStore) purge(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for element := s.order.Front(); element != nil; element = s.order.Front() {
+		if now.Before(element.Value.(*issuedChallenge).expiresAt) {
+			return
+		}
+		s.remove(element)
+	}
+}
+
+// remove 刪除挑戰，需持有鎖
+func (s *challengeStore) remove(element *list.Element) {
+	issued := element.Value.(*issuedChallenge)
+	s.order.Remove(element)
+	delete(s.byNonce, issued.nonce)
+	if s.byIP[issued.ip] == element {
+		delete(s.byIP, issued.ip)
+	}
+}
+
+// len 返回未使用的挑戰數量
+func (s *challengeStore) len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.order.Len()
+}
+
+// sweepLoop 定期清理過期的挑戰
+func (s *challengeStore) sweepLoop(interval time.Duration, now func() time.Time) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.purge(now())
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// stop 停止定期清理
+func (s *challengeStore) stop() {
+	s.stopped.Do(func() {
+		close(s.stopCh)
+	})
+}
+
+// captchaResponse 驗證碼驗證地址的響應
+type captchaResponse struct {
+	Success bool `json:"success"`
+}
+
+// challengeRequired 檢查是否需要挑戰：用戶名或 IP 在窗口內的失敗次數達到 challenge.after
+func (m *LoginGuardMiddleware) challengeRequired(username, ip string) bool {
+	challenge := m.settings.Challenge
+	if challenge.Type == "" || challenge.After <= 0 {
+		return false
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	now := m.now()
+	return m.users[username].failureCount(now, m.settings.Window) >= challenge.After ||
+		m.ips[ip].failureCount(now, m.settings.Window) >= challenge.After
+}
+
+// verifyChallenge 驗證請求提交的挑戰，submitted 表示請求是否帶有挑戰
+func (m *LoginGuardMiddleware) verifyChallenge(c *gin.Context, ip string) (submitted, valid bool) {
+	switch m.settings.Challenge.Type {
+	case config.LoginChallengePoW:
+		nonce, solution := c.GetHeader(ChallengeHeader), c.GetHeader(SolutionHeader)
+		if nonce == "" {
+			return false, false
+		}
+		return true, m.verifyPoW(nonce, solution, ip)
+	case config.LoginChallengeCaptcha:
+		token := c.GetHeader(CaptchaHeader)
+		if token == "" {
+			return false, false
+		}
+		return true, m.verifyCaptcha(c.Request.Context(), token, ip)
+	}
+	return false, false
+}
+
+// newChallenge 為 IP 簽發挑戰，IP 已有未過期的 pow 挑戰時沿用
+func (m *LoginGuardMiddleware) newChallenge(ip string) Challenge {
+	if m.settings.Challenge.Type != config.LoginChallengePoW {
+		return Challenge{Type: m.settings.Challenge.Type}
+	}
+
+	issued := m.challenges.issue(ip, m.clock(), m.settings.Challenge.TTL)
+	expiresAt := issued.expiresAt
+	return Challenge{
+		Type:       config.LoginChallengePoW,
+		Algorithm:  "sha256",
+		Nonce:      issued.nonce,
+		Difficulty: m.settings.Challenge.Difficulty,
+		ExpiresAt:  &expiresAt,
+	}
+}
+
+// verifyPoW 驗證 pow 挑戰的解，挑戰無論成功與否都會被消耗
+func (m *LoginGuardMiddleware) verifyPoW(nonce, solution, ip string) bool {
+	issued, exists := m.challenges.consume(nonce)
+	now := m.clock()
+	if !exists || issued.ip != ip || !now.Before(issued.expiresAt) ||
+		solution == "" || len(solution) > maxSolutionLength {
+		return false
+	}
+	return leadingZeroBits(sha256.Sum256([]byte(nonce+solution))) >= m.settings.Challenge.Difficulty
+}
+
+// verifyCaptcha 以驗證地址驗證驗證碼 token，請求失敗時視為驗證失敗
+func (m *LoginGuardMiddleware) verifyCaptcha(ctx context.Context, token, ip string) bool {
+	ctx, cancel := context.WithTimeout(ctx, m.settings.Challenge.Timeout)
+	defer cancel()
+
+	form := url.Values{
+		"secret":   {m.settings.Challenge.Secret},
+		"response": {token},
+		"remoteip": {ip},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.settings.Challenge.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.logger.Error("Captcha verification failed", zap.Error(err))
+		return false
+	}
+	defer resp.Body.Close()
+
+	var result captchaResponse
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&result) != nil {
+		m.logger.Error("Captcha verification returned an invalid response", zap.Int("status", resp.StatusCode))
+		return false
+	}
+	return result.Success
+}
+
+// leadingZeroBits 計算摘要的前導零位數
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	count := 0
+	for _, b := range sum {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
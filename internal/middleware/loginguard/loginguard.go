@@ -0,0 +1,360 @@
+package loginguard
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/bodylimit"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 錯誤代碼
+const (
+	CodeThrottled         = "LOGIN_THROTTLED"
+	CodeLocked            = "LOGIN_LOCKED"
+	CodeChallengeRequired = "LOGIN_CHALLENGE_REQUIRED"
+	CodeChallengeFailed   = "LOGIN_CHALLENGE_FAILED"
+)
+
+// maxUsernameLength 記錄的用戶名最大長度
+const maxUsernameLength = 256
+
+// UnlockRequest 解除鎖定請求，用戶名與 IP 至少設置一個
+type UnlockRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+// LoginGuardMiddleware 登入防護中間件
+// 依上游響應判斷登入失敗，按用戶名與 IP 計數，觸發遞增延遲、臨時鎖定與挑戰；記錄保存在網關實例的記憶體中
+type LoginGuardMiddleware struct {
+	config   *config.Config
+	settings config.LoginGuardConfig
+	logger   *zap.Logger
+	monitor  *monitor.Monitor
+	client   *http.Client
+
+	mutex      sync.RWMutex
+	users      map[string]*record
+	ips        map[string]*record
+	challenges *challengeStore
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+// NewLoginGuardMiddleware 創建新的登入防護中間件，monitorService 為 nil 時不上報指標
+func NewLoginGuardMiddleware(cfg *config.Config, logger *zap.Logger, monitorService *monitor.Monitor) *LoginGuardMiddleware {
+	settings := cfg.LoginGuard
+	if len(settings.UsernameFields) == 0 {
+		settings.UsernameFields = []string{"username", "email", "login"}
+	}
+	if len(settings.FailureStatuses) == 0 {
+		settings.FailureStatuses = []int{http.StatusUnauthorized}
+	}
+	if settings.Window <= 0 {
+		settings.Window = 15 * time.Minute
+	}
+	if settings.Lockout.Duration <= 0 {
+		settings.Lockout.Duration = 15 * time.Minute
+	}
+	if settings.Challenge.TTL <= 0 {
+		settings.Challenge.TTL = 2 * time.Minute
+	}
+	if settings.Challenge.MaxPending <= 0 {
+		settings.Challenge.MaxPending = 10000
+	}
+	if settings.Challenge.Timeout <= 0 {
+		settings.Challenge.Timeout = 5 * time.Second
+	}
+
+	middleware := &LoginGuardMiddleware{
+		config:     cfg,
+		settings:   settings,
+		logger:     logger,
+		monitor:    monitorService,
+		client:     &http.Client{},
+		users:      make(map[string]*record),
+		ips:        make(map[string]*record),
+		challenges: newChallengeStore(settings.Challenge.MaxPending),
+		now:        time.Now,
+	}
+	// 過期的 pow 挑戰由背景定期清理，不在簽發時遍歷
+	if settings.Enabled && settings.Challenge.Type == config.LoginChallengePoW {
+		go middleware.challenges.sweepLoop(settings.Challenge.TTL, middleware.clock)
+	}
+	return middleware
+}
+
+// Close 停止背景清理
+func (m *LoginGuardMiddleware) Close() {
+	m.challenges.stop()
+}
+
+// SetClock 設置時間來源（用於測試）
+func (m *LoginGuardMiddleware) SetClock(now func() time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.now = now
+}
+
+// clock 返回當前時間
+func (m *LoginGuardMiddleware) clock() time.Time {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.now()
+}
+
+// PendingChallenges 返回未使用的 pow 挑戰數量
+func (m *LoginGuardMiddleware) PendingChallenges() int {
+	return m.challenges.len()
+}
+
+// Enabled 是否啟用登入防護
+func (m *LoginGuardMiddleware) Enabled() bool {
+	return m.config.LoginGuard.Enabled
+}
+
+// Protect 登入路由的中間件，需放在代理處理器之前
+func (m *LoginGuardMiddleware) Protect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.Enabled() {
+			c.Next()
+			return
+		}
+
+		ip := clientip.FromContext(c)
+		username, ok := m.username(c)
+		if !ok {
+			return
+		}
+
+		if m.rejectLocked(c, username, ip) {
+			return
+		}
+		if m.challengeRequired(username, ip) {
+			submitted, valid := m.verifyChallenge(c, ip)
+			if !valid {
+				code, message := CodeChallengeRequired, "Login challenge required"
+				if submitted {
+					code, message = CodeChallengeFailed, "Login challenge failed"
+				}
+				m.logger.Warn("Login challenge required",
+					zap.String("ip", ip),
+					zap.String("username", username),
+					zap.Bool("submitted", submitted))
+				c.JSON(http.StatusPreconditionRequired, gin.H{
+					"status":    "error",
+					"message":   message,
+					"code":      code,
+					"challenge": m.newChallenge(ip),
+				})
+				c.Abort()
+				return
+			}
+		}
+		c.Request.Header.Del(ChallengeHeader)
+		c.Request.Header.Del(SolutionHeader)
+		c.Request.Header.Del(CaptchaHeader)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		switch {
+		case m.isFailure(status):
+			m.onFailure(c, username, ip)
+		case status >= 200 && status < 300:
+			m.recordSuccess(username)
+		}
+	}
+}
+
+// rejectLocked 用戶名或 IP 鎖定或延遲期間拒絕請求，返回是否已拒絕
+func (m *LoginGuardMiddleware) rejectLocked(c *gin.Context, username, ip string) bool {
+	m.mutex.RLock()
+	now := m.now()
+	user, addr := m.users[username], m.ips[ip]
+	var code, scope string
+	var until time.Time
+	switch {
+	case addr.locked(now):
+		code, scope, until = CodeLocked, KindIP, addr.lockedUntil
+	case username != "" && user.locked(now):
+		code, scope, until = CodeLocked, KindUsername, user.lockedUntil
+	case addr.throttled(now):
+		code, scope, until = CodeThrottled, KindIP, addr.retryAt
+	case username != "" && user.throttled(now):
+		code, scope, until = CodeThrottled, KindUsername, user.retryAt
+	}
+	m.mutex.RUnlock()
+
+	if code == "" {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(until.Sub(now).Seconds()))
+	m.logger.Warn("Login attempt rejected",
+		zap.String("ip", ip),
+		zap.String("username", username),
+		zap.String("scope", scope),
+		zap.String("code", code),
+		zap.Int("retry_after", retryAfter))
+	if m.monitor != nil {
+		m.monitor.RecordSecurityEvent("login", false, []string{code})
+	}
+
+	message := "Too many failed login attempts, please try again later"
+	if code == CodeThrottled {
+		message = "Login attempts too frequent, please try again later"
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"status":      "error",
+		"message":     message,
+		"code":        code,
+		"retry_after": retryAfter,
+	})
+	c.Abort()
+	return true
+}
+
+// onFailure 記錄登入失敗，觸發鎖定或撞庫檢測時記錄安全事件
+func (m *LoginGuardMiddleware) onFailure(c *gin.Context, username, ip string) {
+	result := m.recordFailure(username, ip)
+	for _, reason := range result.reasons {
+		m.logger.Warn("Login lockout triggered",
+			zap.String("ip", ip),
+			zap.String("username", username),
+			zap.String("reason", reason),
+			zap.String("user_agent", c.Request.UserAgent()))
+	}
+	if m.monitor != nil && len(result.reasons) > 0 {
+		m.monitor.RecordSecurityEvent("login", false, result.reasons)
+	}
+}
+
+// isFailure 檢查上游響應狀態碼是否表示登入失敗
+func (m *LoginGuardMiddleware) isFailure(status int) bool {
+	for _, failure := range m.settings.FailureStatuses {
+		if status == failure {
+			return true
+		}
+	}
+	return false
+}
+
+// username 從 JSON 或表單請求體中讀取用戶名並恢復請求體，讀取失敗時返回錯誤並中斷請求
+func (m *LoginGuardMiddleware) username(c *gin.Context) (string, bool) {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return "", true
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		if limit, exceeded := bodylimit.ExceededLimit(err); exceeded {
+			bodylimit.Reject(c, limit)
+			return "", false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Failed to read request body",
+		})
+		c.Abort()
+		return "", false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var values func(field string) string
+	if strings.Contains(c.ContentType(), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", true
+		}
+		values = form.Get
+	} else {
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return "", true
+		}
+		values = func(field string) string {
+			value, _ := fields[field].(string)
+			return value
+		}
+	}
+
+	for _, field := range m.settings.UsernameFields {
+		if username := normalizeUsername(values(field)); username != "" {
+			return username, true
+		}
+	}
+	return "", true
+}
+
+// normalizeUsername 標準化用戶名，避免以大小寫或空白繞過計數
+func normalizeUsername(username string) string {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if len(username) > maxUsernameLength {
+		username = username[:maxUsernameLength]
+	}
+	return username
+}
+
+// ListEntries 查詢登入失敗記錄與鎖定（管理端點）
+func (m *LoginGuardMiddleware) ListEntries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"enabled": m.Enabled(),
+				"entries": m.Entries(),
+			},
+		})
+	}
+}
+
+// UnlockEntry 解除用戶名或 IP 的鎖定並清除失敗記錄（管理端點）
+func (m *LoginGuardMiddleware) UnlockEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UnlockRequest
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Username == "" && req.IP == "") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "username or ip is required",
+			})
+			c.Abort()
+			return
+		}
+		if !m.Unlock(req.Username, req.IP) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Entry not found",
+			})
+			c.Abort()
+			return
+		}
+
+		removedBy, _ := auth.GetUserIDFromContext(c)
+		m.logger.Info("Login lockout cleared",
+			zap.String("username", req.Username),
+			zap.String("ip", req.IP),
+			zap.String("removed_by", removedBy))
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "Entry unlocked",
+		})
+	}
+}
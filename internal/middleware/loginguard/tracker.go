@@ -0,0 +1,267 @@
+package loginguard
+
+import (
+	"sort"
+	"time"
+)
+
+// 記錄類型
+const (
+	KindUsername = "username"
+	KindIP       = "ip"
+)
+
+// 鎖定與告警原因
+const (
+	ReasonUserLockout        = "user_lockout"
+	ReasonIPLockout          = "ip_lockout"
+	ReasonCredentialStuffing = "credential_stuffing"
+)
+
+// maxTrackedUsernames 單個 IP 記錄的不同用戶名數量上限，超過檢測閾值後不再增加
+const maxTrackedUsernames = 1000
+
+// record 用戶名或 IP 的登入失敗記錄
+type record struct {
+	failures    int
+	windowStart time.Time
+	lastFailure time.Time
+	retryAt     time.Time // 遞增延遲的結束時間
+	lockedUntil time.Time
+	lockouts    int                 // 連續鎖定次數，決定下次鎖定的時長
+	usernames   map[string]struct{} // 只用於 IP，窗口內登入失敗的不同用戶名
+}
+
+// Entry 登入失敗記錄（管理端點）
+type Entry struct {
+	Kind        string     `json:"kind"` // username, ip
+	Key         string     `json:"key"`
+	Failures    int        `json:"failures"`
+	Usernames   int        `json:"usernames,omitempty"`
+	LastFailure time.Time  `json:"last_failure"`
+	RetryAt     *time.Time `json:"retry_at,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	Lockouts    int        `json:"lockouts"`
+}
+
+// failureResult 記錄一次登入失敗後觸發的事件
+type failureResult struct {
+	reasons []string
+}
+
+// expired 檢查記錄是否已無作用：最後一次失敗與鎖定結束後都已超過一個窗口，且不在延遲期間
+// 鎖定結束後的一個窗口內保留記錄，再次鎖定時時長加倍
+func (r *record) expired(now time.Time, window time.Duration) bool {
+	return !now.Before(r.lastFailure.Add(window)) && !now.Before(r.lockedUntil.Add(window)) && !now.Before(r.retryAt)
+}
+
+// locked 檢查記錄是否在鎖定期間
+func (r *record) locked(now time.Time) bool {
+	return r != nil && now.Before(r.lockedUntil)
+}
+
+// throttled 檢查記錄是否在遞增延遲期間
+func (r *record) throttled(now time.Time) bool {
+	return r != nil && now.Before(r.retryAt)
+}
+
+// failureCount 返回窗口內的失敗次數
+func (r *record) failureCount(now time.Time, window time.Duration) int {
+	if r == nil || !now.Before(r.windowStart.Add(window)) {
+		return 0
+	}
+	return r.failures
+}
+
+// fail 記錄一次失敗，返回窗口內的失敗次數
+func (r *record) fail(now time.Time, window time.Duration) int {
+	if !now.Before(r.windowStart.Add(window)) {
+		r.failures = 0
+		r.windowStart = now
+		r.usernames = nil
+	}
+	r.failures++
+	r.lastFailure = now
+	return r.failures
+}
+
+// lock 鎖定記錄，重複鎖定的時長加倍，鎖定後重新計數
+func (r *record) lock(now time.Time, duration, maxDuration time.Duration) {
+	r.lockouts++
+	for i := 1; i < r.lockouts && (maxDuration <= 0 || duration < maxDuration); i++ {
+		duration *= 2
+	}
+	if maxDuration > 0 && duration > maxDuration {
+		duration = maxDuration
+	}
+	r.lockedUntil = now.Add(duration)
+	r.failures = 0
+	r.windowStart = r.lockedUntil
+	r.usernames = nil
+}
+
+// delay 設置遞增延遲：失敗次數達到 after 後為 base，之後每次失敗加倍，不超過 max
+func (r *record) delay(now time.Time, after int, base, max time.Duration) {
+	if after <= 0 || base <= 0 || r.failures < after {
+		return
+	}
+	delay := base
+	for i := after; i < r.failures && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	r.retryAt = now.Add(delay)
+}
+
+// entry 轉為管理端點的記錄
+func (r *record) entry(kind, key string, now time.Time) Entry {
+	e := Entry{
+		Kind:        kind,
+		Key:         key,
+		Failures:    r.failures,
+		Usernames:   len(r.usernames),
+		LastFailure: r.lastFailure,
+		Lockouts:    r.lockouts,
+	}
+	if now.Before(r.retryAt) {
+		retryAt := r.retryAt
+		e.RetryAt = &retryAt
+	}
+	if now.Before(r.lockedUntil) {
+		lockedUntil := r.lockedUntil
+		e.LockedUntil = &lockedUntil
+	}
+	return e
+}
+
+// recordFailure 記錄用戶名與 IP 的一次登入失敗，返回觸發的鎖定與告警
+func (m *LoginGuardMiddleware) recordFailure(username, ip string) failureResult {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+	var result failureResult
+
+	if username != "" {
+		user := m.users[username]
+		if user == nil {
+			user = &record{}
+			m.users[username] = user
+		}
+		if failures := user.fail(now, m.settings.Window); m.settings.Lockout.UserThreshold > 0 && failures >= m.settings.Lockout.UserThreshold {
+			user.lock(now, m.settings.Lockout.Duration, m.settings.Lockout.MaxDuration)
+			result.reasons = append(result.reasons, ReasonUserLockout)
+		} else {
+			user.delay(now, m.settings.Delay.After, m.settings.Delay.Base, m.settings.Delay.Max)
+		}
+	}
+
+	if ip == "" {
+		return result
+	}
+	addr := m.ips[ip]
+	if addr == nil {
+		addr = &record{}
+		m.ips[ip] = addr
+	}
+	failures := addr.fail(now, m.settings.Window)
+	if username != "" && len(addr.usernames) < maxTrackedUsernames {
+		if addr.usernames == nil {
+			addr.usernames = make(map[string]struct{})
+		}
+		addr.usernames[username] = struct{}{}
+	}
+
+	switch {
+	case m.settings.MaxUsernamesPerIP > 0 && len(addr.usernames) > m.settings.MaxUsernamesPerIP:
+		addr.lock(now, m.settings.Lockout.Duration, m.settings.Lockout.MaxDuration)
+		result.reasons = append(result.reasons, ReasonCredentialStuffing)
+	case m.settings.Lockout.IPThreshold > 0 && failures >= m.settings.Lockout.IPThreshold:
+		addr.lock(now, m.settings.Lockout.Duration, m.settings.Lockout.MaxDuration)
+		result.reasons = append(result.reasons, ReasonIPLockout)
+	default:
+		addr.delay(now, m.settings.Delay.After, m.settings.Delay.Base, m.settings.Delay.Max)
+	}
+	return result
+}
+
+// recordSuccess 登入成功後清除用戶名的失敗記錄，IP 的記錄保留以檢測撞庫
+func (m *LoginGuardMiddleware) recordSuccess(username string) {
+	if username == "" {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.users, username)
+}
+
+// sweep 定期清理已無作用的記錄，需持有寫鎖
+func (m *LoginGuardMiddleware) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.settings.Window {
+		return
+	}
+	m.lastSweep = now
+	for key, r := range m.users {
+		if r.expired(now, m.settings.Window) {
+			delete(m.users, key)
+		}
+	}
+	for key, r := range m.ips {
+		if r.expired(now, m.settings.Window) {
+			delete(m.ips, key)
+		}
+	}
+}
+
+// Entries 返回仍有作用的登入失敗記錄，鎖定中的記錄排在前面
+func (m *LoginGuardMiddleware) Entries() []Entry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	entries := make([]Entry, 0, len(m.users)+len(m.ips))
+	for kind, records := range map[string]map[string]*record{KindUsername: m.users, KindIP: m.ips} {
+		for key, r := range records {
+			if r.expired(now, m.settings.Window) {
+				delete(records, key)
+				continue
+			}
+			entries = append(entries, r.entry(kind, key, now))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if (entries[i].LockedUntil != nil) != (entries[j].LockedUntil != nil) {
+			return entries[i].LockedUntil != nil
+		}
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// Unlock 清除用戶名或 IP 的失敗記錄與鎖定，返回是否有記錄被清除
+func (m *LoginGuardMiddleware) Unlock(username, ip string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	removed := false
+	if username = normalizeUsername(username); username != "" {
+		if _, exists := m.users[username]; exists {
+			delete(m.users, username)
+			removed = true
+		}
+	}
+	if ip != "" {
+		if _, exists := m.ips[ip]; exists {
+			delete(m.ips, ip)
+			removed = true
+		}
+	}
+	return removed
+}
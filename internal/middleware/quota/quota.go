@@ -0,0 +1,249 @@
+package quota
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/auth"
+	quotasvc "expense-api-gateway/internal/service/quota"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// QuotaMiddleware 用量配額中間件
+type QuotaMiddleware struct {
+	config  *config.Config
+	logger  *zap.Logger
+	service *quotasvc.Service
+}
+
+// TopUpRequest 追加額度請求
+type TopUpRequest struct {
+	Policy    string `json:"policy" binding:"required"`
+	SubjectID string `json:"subject_id" binding:"required"`
+	Amount    int64  `json:"amount" binding:"required"`
+	Reason    string `json:"reason" binding:"required"`
+}
+
+// NewQuotaMiddleware 創建新的配額中間件
+// 用量文件無法載入時，計費路由的請求會被拒絕
+func NewQuotaMiddleware(cfg *config.Config, logger *zap.Logger) *QuotaMiddleware {
+	m := &QuotaMiddleware{
+		config: cfg,
+		logger: logger,
+	}
+
+	if cfg.Quota.Enabled {
+		service, err := quotasvc.New(cfg, logger)
+		if err != nil {
+			logger.Error("Failed to initialize quota service", zap.Error(err))
+		}
+		m.service = service
+	}
+
+	return m
+}
+
+// Service 返回配額服務
+func (m *QuotaMiddleware) Service() *quotasvc.Service {
+	return m.service
+}
+
+// Close 保存用量並停止背景寫入
+func (m *QuotaMiddleware) Close() error {
+	if m.service == nil {
+		return nil
+	}
+	return m.service.Close()
+}
+
+// ResolveCost 取得路由的消耗單位
+// 優先順序：路由自身設定 > quota.costs[路由 ID] > quota.costs 中匹配路由模式的最長項目
+func (m *QuotaMiddleware) ResolveCost(id, pattern string, own int64) int64 {
+	if own > 0 {
+		return own
+	}
+	if id != "" {
+		if cost, exists := m.config.Quota.Costs[id]; exists {
+			return cost
+		}
+	}
+
+	matched := ""
+	var cost int64
+	for key, candidate := range m.config.Quota.Costs {
+		if !strings.HasPrefix(key, "/") || len(key) <= len(matched) {
+			continue
+		}
+		if matchCostPattern(key, pattern) {
+			matched = key
+			cost = candidate
+		}
+	}
+	return cost
+}
+
+// Enforce 配額檢查中間件，需放在認證中間件之後
+func (m *QuotaMiddleware) Enforce(name string, cost int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.config.Quota.Enabled || cost <= 0 {
+			c.Next()
+			return
+		}
+		if m.service == nil {
+			m.reject(c, http.StatusServiceUnavailable, "Quota service unavailable", "QUOTA_UNAVAILABLE")
+			return
+		}
+
+		subject := quotasvc.Subject{}
+		subject.UserID, _ = auth.GetUserIDFromContext(c)
+		subject.CompanyID, _ = auth.GetCompanyIDFromContext(c)
+		if subject.UserID == "" && subject.CompanyID == "" {
+			c.Next()
+			return
+		}
+
+		result := m.service.Consume(subject, cost)
+		m.setHeaders(c, result)
+
+		if !result.Allowed {
+			exceeded := result.Exceeded
+			m.logger.Warn("Quota exceeded",
+				zap.String("route", name),
+				zap.String("policy", exceeded.Policy),
+				zap.String("subject_id", exceeded.SubjectID),
+				zap.Int64("cost", cost),
+				zap.Int64("remaining", exceeded.Remaining))
+
+			if exceeded.Status == http.StatusTooManyRequests {
+				c.Header("Retry-After", strconv.FormatInt(secondsUntil(exceeded.ResetAt), 10))
+			}
+			c.JSON(exceeded.Status, gin.H{
+				"status":    "error",
+				"message":   "Quota exceeded",
+				"code":      "QUOTA_EXCEEDED",
+				"policy":    exceeded.Policy,
+				"period":    exceeded.Period,
+				"remaining": exceeded.Remaining,
+				"cost":      cost,
+				"reset_at":  exceeded.ResetAt,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		// 上游失敗時不計費
+		if m.config.Quota.RefundOnError && c.Writer.Status() >= http.StatusInternalServerError {
+			m.service.Refund(result, cost)
+		}
+	}
+}
+
+// GetUsage 查詢對象在各策略當前週期的用量
+func (m *QuotaMiddleware) GetUsage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.service == nil {
+			m.reject(c, http.StatusNotFound, "Quota is disabled", "QUOTA_DISABLED")
+			return
+		}
+
+		scope := c.DefaultQuery("scope", quotasvc.ScopeCompany)
+		subjectID := c.Query("id")
+		if subjectID == "" || (scope != quotasvc.ScopeCompany && scope != quotasvc.ScopeUser) {
+			m.reject(c, http.StatusBadRequest, "scope (company, user) and id are required", "INVALID_REQUEST")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"scope":      scope,
+				"subject_id": subjectID,
+				"usage":      m.service.Usage(scope, subjectID),
+			},
+		})
+	}
+}
+
+// TopUp 在當前週期追加額度
+func (m *QuotaMiddleware) TopUp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.service == nil {
+			m.reject(c, http.StatusNotFound, "Quota is disabled", "QUOTA_DISABLED")
+			return
+		}
+
+		var req TopUpRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Amount <= 0 {
+			m.reject(c, http.StatusBadRequest, "policy, subject_id, positive amount and reason are required", "INVALID_REQUEST")
+			return
+		}
+
+		usage, err := m.service.Grant(req.Policy, req.SubjectID, req.Amount)
+		if errors.Is(err, quotasvc.ErrUnknownPolicy) {
+			m.reject(c, http.StatusNotFound, "Quota policy not found", "QUOTA_POLICY_NOT_FOUND")
+			return
+		}
+
+		adminID, _ := auth.GetUserIDFromContext(c)
+		m.logger.Info("Quota top-up granted",
+			zap.String("admin_id", adminID),
+			zap.String("policy", req.Policy),
+			zap.String("subject_id", req.SubjectID),
+			zap.Int64("amount", req.Amount),
+			zap.String("reason", req.Reason))
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   usage,
+		})
+	}
+}
+
+// setHeaders 以剩餘額度最少的策略設置響應頭
+func (m *QuotaMiddleware) setHeaders(c *gin.Context, result quotasvc.Result) {
+	usage, ok := result.Lowest()
+	if !ok {
+		return
+	}
+	c.Header("X-Quota-Policy", usage.Policy)
+	c.Header("X-Quota-Limit", strconv.FormatInt(usage.Limit, 10))
+	c.Header("X-Quota-Remaining", strconv.FormatInt(usage.Remaining, 10))
+	c.Header("X-Quota-Reset", strconv.FormatInt(usage.ResetAt.Unix(), 10))
+}
+
+// reject 返回錯誤並中斷請求
+func (m *QuotaMiddleware) reject(c *gin.Context, status int, message, code string) {
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"message": message,
+		"code":    code,
+	})
+	c.Abort()
+}
+
+// matchCostPattern 檢查 quota.costs 項目是否匹配路由模式
+// 項目以 * 結尾時為前綴匹配，否則匹配相同路徑或其子路徑
+func matchCostPattern(key, pattern string) bool {
+	if strings.HasSuffix(key, "*") {
+		return strings.HasPrefix(pattern, strings.TrimSuffix(key, "*"))
+	}
+	key = strings.TrimSuffix(key, "/")
+	return pattern == key || strings.HasPrefix(pattern, key+"/")
+}
+
+// secondsUntil 距離指定時間的秒數（向上取整，至少為 1）
+func secondsUntil(t time.Time) int64 {
+	seconds := int64(time.Until(t).Seconds()) + 1
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 限流響應頭輸出方式
+const (
+	HeaderModeLimited = "limited" // 僅在 429 響應輸出
+	HeaderModeAll     = "all"     // 所有響應都輸出
+	HeaderModeNone    = "none"
+)
+
+// rateLimitDecisionsKey 當前請求各限流器決策在上下文中的鍵
+const rateLimitDecisionsKey = "rate_limit_decisions"
+
+// Decision 限流決策
+type Decision struct {
+	Allowed    bool
+	Limit      int           // 額度上限（突發容量）
+	Remaining  int           // 本次請求後的剩餘額度
+	Reset      time.Duration // 額度完全恢復所需時間
+	RetryAfter time.Duration // 被拒絕時，下一個請求可被允許前需等待的時間
+	Window     time.Duration // 限流窗口
+}
+
+// ResetSeconds 額度恢復秒數（向上取整）
+func (d Decision) ResetSeconds() int64 {
+	return ceilSeconds(d.Reset)
+}
+
+// RetryAfterSeconds 重試等待秒數（向上取整，被拒絕時至少為 1）
+func (d Decision) RetryAfterSeconds() int64 {
+	seconds := ceilSeconds(d.RetryAfter)
+	if !d.Allowed && seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// namedDecision 帶策略名稱的限流決策
+type namedDecision struct {
+	Name string
+	Decision
+}
+
+// recordDecision 記錄限流決策並依配置輸出響應頭
+// name 為響應頭中的策略名稱，limiter 與 key 用於管理端點的統計
+func (m *RateLimitMiddleware) recordDecision(c *gin.Context, name, limiter, key string, decision Decision) {
+	m.stats.record(limiter, key, decision.Allowed)
+
+	decisions := decisionsFromContext(c)
+	decisions = append(decisions, namedDecision{Name: name, Decision: decision})
+	c.Set(rateLimitDecisionsKey, decisions)
+
+	switch m.headerMode() {
+	case HeaderModeNone:
+		return
+	case HeaderModeAll:
+		m.GetRateLimitHeaders(c)
+	default:
+		if !decision.Allowed {
+			m.GetRateLimitHeaders(c)
+		}
+	}
+}
+
+// GetRateLimitHeaders 依當前請求最嚴格的限流決策設置響應頭
+// 包含 IETF RateLimit / RateLimit-Policy 與舊版 X-RateLimit-*，被拒絕時另設 Retry-After
+func (m *RateLimitMiddleware) GetRateLimitHeaders(c *gin.Context) {
+	decisions := decisionsFromContext(c)
+	if !m.config.RateLimit.Enabled || len(decisions) == 0 {
+		return
+	}
+
+	policies := make([]string, 0, len(decisions))
+	for _, d := range decisions {
+		policies = append(policies, fmt.Sprintf("%q;q=%d;w=%d", d.Name, d.Limit, ceilSeconds(d.Window)))
+	}
+	strictest := mostRestrictive(decisions)
+
+	c.Header("RateLimit-Policy", strings.Join(policies, ", "))
+	c.Header("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", strictest.Name, strictest.Remaining, strictest.ResetSeconds()))
+	c.Header("X-RateLimit-Limit", strconv.Itoa(strictest.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(strictest.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(strictest.Reset).Unix(), 10))
+
+	if strictest.Allowed {
+		c.Writer.Header().Del("Retry-After")
+	} else {
+		c.Header("Retry-After", strconv.FormatInt(strictest.RetryAfterSeconds(), 10))
+	}
+}
+
+// headerMode 限流響應頭輸出方式
+func (m *RateLimitMiddleware) headerMode() string {
+	if m.config.RateLimit.Headers == "" {
+		return HeaderModeLimited
+	}
+	return m.config.RateLimit.Headers
+}
+
+// decisionsFromContext 讀取當前請求已記錄的限流決策
+func decisionsFromContext(c *gin.Context) []namedDecision {
+	if value, exists := c.Get(rateLimitDecisionsKey); exists {
+		if decisions, ok := value.([]namedDecision); ok {
+			return decisions
+		}
+	}
+	return nil
+}
+
+// mostRestrictive 選出最嚴格的決策：被拒絕優先，其次剩餘額度最少、恢復時間最長
+func mostRestrictive(decisions []namedDecision) namedDecision {
+	strictest := decisions[0]
+	for _, d := range decisions[1:] {
+		switch {
+		case d.Allowed != strictest.Allowed:
+			if !d.Allowed {
+				strictest = d
+			}
+		case d.Remaining != strictest.Remaining:
+			if d.Remaining < strictest.Remaining {
+				strictest = d
+			}
+		case d.Reset > strictest.Reset:
+			strictest = d
+		}
+	}
+	return strictest
+}
+
+// ceilSeconds 將時間向上取整為秒
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// gcraState GCRA 狀態，只保存理論到達時間
+type gcraState struct {
+	tat int64 // 理論到達時間（UnixNano）
+}
+
+// GCRALimiter 通用信元速率算法（GCRA）限流器
+// 每個 key 只保存一個時間戳，與令牌桶等價但狀態更小
+type GCRALimiter struct {
+	store     *shardedStore[gcraState]
+	emission  int64 // 每個請求佔用的時間（納秒）
+	tolerance int64 // 允許超前的時間（納秒），決定突發量
+	burst     int
+	window    time.Duration
+	now       func() time.Time
+}
+
+// NewGCRALimiter 創建 GCRA 限流器，window 內允許 limit 個請求，瞬間突發上限為 burst
+func NewGCRALimiter(limit int, window time.Duration, opts LimiterOptions) *GCRALimiter {
+	limit, window, burst := normalizeRule(limit, window, opts.Burst)
+	emission := int64(window) / int64(limit)
+	if emission <= 0 {
+		emission = 1
+	}
+
+	l := &GCRALimiter{
+		store:     newShardedStore[gcraState](opts.Shards),
+		emission:  emission,
+		tolerance: emission * int64(burst),
+		burst:     burst,
+		window:    window,
+		now:       time.Now,
+	}
+	l.store.startSweeper(opts.SweepInterval, l.idle)
+	return l
+}
+
+// Allow 檢查是否允許請求
+func (l *GCRALimiter) Allow(key string) Decision {
+	now := l.now().UnixNano()
+	decision := Decision{Limit: l.burst, Window: l.window}
+
+	l.store.with(key, func() *gcraState {
+		return &gcraState{tat: now}
+	}, func(state *gcraState) {
+		tat := state.tat
+		if tat < now {
+			tat = now
+		}
+		newTAT := tat + l.emission
+		if newTAT-now > l.tolerance {
+			decision.Reset = time.Duration(tat - now)
+			decision.RetryAfter = time.Duration(newTAT - now - l.tolerance)
+			return
+		}
+		state.tat = newTAT
+		decision.Allowed = true
+		decision.Remaining = int((l.tolerance - (newTAT - now)) / l.emission)
+		decision.Reset = time.Duration(newTAT - now)
+	})
+
+	return decision
+}
+
+// Reset 重置限流器
+func (l *GCRALimiter) Reset(key string) {
+	l.store.delete(key)
+}
+
+// Keys 返回目前追蹤的 key
+func (l *GCRALimiter) Keys() []string {
+	return l.store.keys()
+}
+
+// Peek 查詢 key 的當前狀態，不消耗額度
+func (l *GCRALimiter) Peek(key string) (KeyState, bool) {
+	now := l.now().UnixNano()
+	state := KeyState{Key: key, Limit: l.burst}
+
+	found := l.store.get(key, func(s *gcraState) {
+		tat := s.tat
+		if tat < now {
+			tat = now
+		}
+		state.Remaining = int((l.tolerance - (tat - now)) / l.emission)
+		state.ResetSeconds = ceilSeconds(time.Duration(tat - now))
+	})
+	return state, found
+}
+
+// Len 返回目前追蹤的 key 數量
+func (l *GCRALimiter) Len() int {
+	return l.store.len()
+}
+
+// Sweep 立即清理閒置的 key
+func (l *GCRALimiter) Sweep() {
+	l.store.sweep(l.idle)
+}
+
+// Stop 停止背景清理
+func (l *GCRALimiter) Stop() {
+	l.store.stop()
+}
+
+// SetClock 設置時間來源（用於測試）
+func (l *GCRALimiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// idle 理論到達時間已過時，刪除狀態與保留狀態等價
+func (l *GCRALimiter) idle(state *gcraState) bool {
+	return state.tat <= l.now().UnixNano()
+}
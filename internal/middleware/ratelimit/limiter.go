@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"time"
+
+	"expense-api-gateway/internal/infrastructure/redis"
+
+	"go.uber.org/zap"
+)
+
+// 限流算法
+const (
+	AlgorithmSlidingLog  = "sliding_log"
+	AlgorithmTokenBucket = "token_bucket"
+	AlgorithmGCRA        = "gcra"
+)
+
+// KeyState 限流 key 的當前狀態
+type KeyState struct {
+	Key          string `json:"key"`
+	Limit        int    `json:"limit"`
+	Remaining    int    `json:"remaining"`
+	ResetSeconds int64  `json:"reset_seconds"` // 額度完全恢復所需秒數
+}
+
+// Inspector 可列出與查詢 key 狀態的限流器，供管理端點使用
+// Peek 不會消耗額度，也不會為不存在的 key 創建狀態
+type Inspector interface {
+	Keys() []string
+	Peek(key string) (KeyState, bool)
+}
+
+// LimiterOptions 限流器選項
+type LimiterOptions struct {
+	Algorithm     string
+	Burst         int           // 瞬間突發上限，0 表示等於 limit
+	Shards        int           // 分片數，0 表示依 CPU 數決定
+	SweepInterval time.Duration // 閒置 key 清理間隔，0 表示 1 分鐘
+
+	// 以下選項僅在使用 Redis 時生效
+	Redis     *redis.Client
+	KeyPrefix string
+	FailMode  string // local, open, closed
+	Logger    *zap.Logger
+}
+
+// NewRateLimiter 依算法創建限流器，未指定算法時使用 GCRA
+// 設置 Redis 時創建分佈式限流器，本地限流器作為回退
+func NewRateLimiter(limit int, window time.Duration, opts LimiterOptions) RateLimiter {
+	if opts.Redis != nil {
+		local := opts
+		local.Redis = nil
+		return NewRedisRateLimiter(opts.Redis, limit, window, opts, NewRateLimiter(limit, window, local))
+	}
+
+	switch opts.Algorithm {
+	case AlgorithmSlidingLog:
+		return NewMemoryRateLimiter(limit, window)
+	case AlgorithmTokenBucket:
+		return NewTokenBucketLimiter(limit, window, opts)
+	default:
+		return NewGCRALimiter(limit, window, opts)
+	}
+}
+
+// normalizeRule 修正無效的限流參數
+func normalizeRule(limit int, window time.Duration, burst int) (int, time.Duration, int) {
+	if limit <= 0 {
+		limit = 1
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	if burst <= 0 {
+		burst = limit
+	}
+	return limit, window, burst
+}
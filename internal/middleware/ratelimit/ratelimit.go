@@ -3,13 +3,13 @@ package ratelimit
 import (
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/redis"
 	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/clientip"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -17,11 +17,12 @@ import (
 
 // RateLimiter 限流器接口
 type RateLimiter interface {
-	Allow(key string) bool
+	Allow(key string) Decision
 	Reset(key string)
 }
 
-// MemoryRateLimiter 內存限流器實現
+// MemoryRateLimiter 內存滑動日誌限流器實現
+// 每個 key 保存窗口內所有請求時間，僅在 algorithm 為 sliding_log 時使用
 type MemoryRateLimiter struct {
 	requests map[string][]time.Time
 	mutex    sync.RWMutex
@@ -39,7 +40,7 @@ func NewMemoryRateLimiter(limit int, window time.Duration) *MemoryRateLimiter {
 }
 
 // Allow 檢查是否允許請求
-func (r *MemoryRateLimiter) Allow(key string) bool {
+func (r *MemoryRateLimiter) Allow(key string) Decision {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -60,13 +61,26 @@ func (r *MemoryRateLimiter) Allow(key string) bool {
 	}
 
 	// 檢查是否超過限制
-	if len(r.requests[key]) >= r.limit {
-		return false
+	times := r.requests[key]
+	if len(times) >= r.limit {
+		return Decision{
+			Allowed:    false,
+			Limit:      r.limit,
+			Reset:      times[len(times)-1].Add(r.window).Sub(now),
+			RetryAfter: times[0].Add(r.window).Sub(now),
+			Window:     r.window,
+		}
 	}
 
 	// 記錄當前請求
-	r.requests[key] = append(r.requests[key], now)
-	return true
+	r.requests[key] = append(times, now)
+	return Decision{
+		Allowed:   true,
+		Limit:     r.limit,
+		Remaining: r.limit - len(times) - 1,
+		Reset:     r.window,
+		Window:    r.window,
+	}
 }
 
 // Reset 重置限流器
@@ -76,12 +90,53 @@ func (r *MemoryRateLimiter) Reset(key string) {
 	delete(r.requests, key)
 }
 
+// Keys 返回目前追蹤的 key
+func (r *MemoryRateLimiter) Keys() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	keys := make([]string, 0, len(r.requests))
+	for key := range r.requests {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Peek 查詢 key 的當前狀態，不記錄請求
+func (r *MemoryRateLimiter) Peek(key string) (KeyState, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	times, exists := r.requests[key]
+	if !exists {
+		return KeyState{}, false
+	}
+
+	now := time.Now()
+	windowStart := now.Add(-r.window)
+	state := KeyState{Key: key, Limit: r.limit, Remaining: r.limit}
+	for _, t := range times {
+		if t.After(windowStart) {
+			state.Remaining--
+			if reset := ceilSeconds(t.Add(r.window).Sub(now)); reset > state.ResetSeconds {
+				state.ResetSeconds = reset
+			}
+		}
+	}
+	if state.Remaining < 0 {
+		state.Remaining = 0
+	}
+	return state, true
+}
+
 // RateLimitMiddleware 限流中間件
 type RateLimitMiddleware struct {
 	config        *config.Config
 	logger        *zap.Logger
 	limiters      map[string]RateLimiter
 	globalLimiter RateLimiter
+	redisClient   *redis.Client
+	stats         *statsRecorder
 	mutex         sync.RWMutex
 }
 
@@ -91,28 +146,40 @@ func NewRateLimitMiddleware(cfg *config.Config, logger *zap.Logger) *RateLimitMi
 		config:   cfg,
 		logger:   logger,
 		limiters: make(map[string]RateLimiter),
+		stats:    newStatsRecorder(),
+	}
+
+	// 多副本部署時以 Redis 共享限流狀態
+	if cfg.RateLimit.Enabled && cfg.RateLimit.Backend == "redis" {
+		middleware.redisClient = redis.New(cfg.Redis)
 	}
 
 	// 創建全局限流器
 	if cfg.RateLimit.Enabled {
-		middleware.globalLimiter = NewMemoryRateLimiter(
+		middleware.globalLimiter = middleware.newLimiter(
+			globalLimiterName,
 			cfg.RateLimit.GlobalLimit,
 			time.Minute, // 1分鐘窗口
+			cfg.RateLimit.GlobalBurst,
 		)
 
 		// 創建 IP 限流器
 		if cfg.RateLimit.IPLimit.Requests > 0 {
-			middleware.limiters["ip"] = NewMemoryRateLimiter(
+			middleware.limiters["ip"] = middleware.newLimiter(
+				"ip",
 				cfg.RateLimit.IPLimit.Requests,
 				cfg.RateLimit.IPLimit.Window,
+				cfg.RateLimit.IPLimit.Burst,
 			)
 		}
 
 		// 創建用戶限流器
 		if cfg.RateLimit.UserLimit.Requests > 0 {
-			middleware.limiters["user"] = NewMemoryRateLimiter(
+			middleware.limiters["user"] = middleware.newLimiter(
+				"user",
 				cfg.RateLimit.UserLimit.Requests,
 				cfg.RateLimit.UserLimit.Window,
+				cfg.RateLimit.UserLimit.Burst,
 			)
 		}
 	}
@@ -128,15 +195,18 @@ func (m *RateLimitMiddleware) GlobalRateLimit() gin.HandlerFunc {
 			return
 		}
 
-		if !m.globalLimiter.Allow("global") {
+		decision := m.globalLimiter.Allow("global")
+		m.recordDecision(c, "global", globalLimiterName, "global", decision)
+		if !decision.Allowed {
 			m.logger.Warn("Global rate limit exceeded",
-				zap.String("ip", c.ClientIP()),
+				zap.String("ip", clientip.FromContext(c)),
 				zap.String("path", c.Request.URL.Path))
 
 			c.JSON(http.StatusTooManyRequests, gin.H{
-				"status":  "error",
-				"message": "Too many requests",
-				"code":    "RATE_LIMIT_EXCEEDED",
+				"status":      "error",
+				"message":     "Too many requests",
+				"code":        "RATE_LIMIT_EXCEEDED",
+				"retry_after": decision.RetryAfterSeconds(),
 			})
 			c.Abort()
 			return
@@ -154,24 +224,27 @@ func (m *RateLimitMiddleware) IPRateLimit() gin.HandlerFunc {
 			return
 		}
 
-		limiter, exists := m.limiters["ip"]
+		limiter, exists := m.getLimiter("ip")
 		if !exists {
 			c.Next()
 			return
 		}
 
-		clientIP := m.getClientIP(c)
+		clientIP := clientip.FromContext(c)
 		key := fmt.Sprintf("ip:%s", clientIP)
 
-		if !limiter.Allow(key) {
+		decision := limiter.Allow(key)
+		m.recordDecision(c, "ip", "ip", key, decision)
+		if !decision.Allowed {
 			m.logger.Warn("IP rate limit exceeded",
 				zap.String("ip", clientIP),
 				zap.String("path", c.Request.URL.Path))
 
 			c.JSON(http.StatusTooManyRequests, gin.H{
-				"status":  "error",
-				"message": "IP rate limit exceeded",
-				"code":    "IP_RATE_LIMIT_EXCEEDED",
+				"status":      "error",
+				"message":     "IP rate limit exceeded",
+				"code":        "IP_RATE_LIMIT_EXCEEDED",
+				"retry_after": decision.RetryAfterSeconds(),
 			})
 			c.Abort()
 			return
@@ -189,7 +262,7 @@ func (m *RateLimitMiddleware) UserRateLimit() gin.HandlerFunc {
 			return
 		}
 
-		limiter, exists := m.limiters["user"]
+		limiter, exists := m.getLimiter("user")
 		if !exists {
 			c.Next()
 			return
@@ -199,18 +272,21 @@ func (m *RateLimitMiddleware) UserRateLimit() gin.HandlerFunc {
 		userID, err := auth.GetUserIDFromContext(c)
 		if err != nil {
 			// 如果沒有用戶信息，使用 IP 作為備用
-			clientIP := m.getClientIP(c)
+			clientIP := clientip.FromContext(c)
 			key := fmt.Sprintf("user:anonymous:%s", clientIP)
 
-			if !limiter.Allow(key) {
+			decision := limiter.Allow(key)
+			m.recordDecision(c, "user", "user", key, decision)
+			if !decision.Allowed {
 				m.logger.Warn("Anonymous user rate limit exceeded",
 					zap.String("ip", clientIP),
 					zap.String("path", c.Request.URL.Path))
 
 				c.JSON(http.StatusTooManyRequests, gin.H{
-					"status":  "error",
-					"message": "User rate limit exceeded",
-					"code":    "USER_RATE_LIMIT_EXCEEDED",
+					"status":      "error",
+					"message":     "User rate limit exceeded",
+					"code":        "USER_RATE_LIMIT_EXCEEDED",
+					"retry_after": decision.RetryAfterSeconds(),
 				})
 				c.Abort()
 				return
@@ -218,15 +294,18 @@ func (m *RateLimitMiddleware) UserRateLimit() gin.HandlerFunc {
 		} else {
 			key := fmt.Sprintf("user:%s", userID)
 
-			if !limiter.Allow(key) {
+			decision := limiter.Allow(key)
+			m.recordDecision(c, "user", "user", key, decision)
+			if !decision.Allowed {
 				m.logger.Warn("User rate limit exceeded",
 					zap.String("user_id", userID),
 					zap.String("path", c.Request.URL.Path))
 
 				c.JSON(http.StatusTooManyRequests, gin.H{
-					"status":  "error",
-					"message": "User rate limit exceeded",
-					"code":    "USER_RATE_LIMIT_EXCEEDED",
+					"status":      "error",
+					"message":     "User rate limit exceeded",
+					"code":        "USER_RATE_LIMIT_EXCEEDED",
+					"retry_after": decision.RetryAfterSeconds(),
 				})
 				c.Abort()
 				return
@@ -238,6 +317,7 @@ func (m *RateLimitMiddleware) UserRateLimit() gin.HandlerFunc {
 }
 
 // APIRateLimit API 端點限流中間件
+// 以 gin 匹配到的路由模式查找 api_limit，未匹配路由時使用請求路徑
 func (m *RateLimitMiddleware) APIRateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if !m.config.RateLimit.Enabled {
@@ -247,41 +327,38 @@ func (m *RateLimitMiddleware) APIRateLimit() gin.HandlerFunc {
 
 		path := c.Request.URL.Path
 		method := c.Request.Method
+		pattern := c.FullPath()
+		if pattern == "" {
+			pattern = path
+		}
 
 		// 檢查是否有針對此 API 的限流配置
-		apiLimit, exists := m.config.RateLimit.APILimit[path]
+		name, apiLimit, exists := m.matchAPILimit(pattern)
 		if !exists {
 			c.Next()
 			return
 		}
 
-		// 創建或獲取 API 限流器
-		limiterKey := fmt.Sprintf("api:%s:%s", method, path)
-		limiter := m.getOrCreateAPILimiter(limiterKey, apiLimit.Requests, apiLimit.Window)
-
-		// 生成限流鍵
-		var rateLimitKey string
-		userID, err := auth.GetUserIDFromContext(c)
-		if err != nil {
-			// 使用 IP 作為備用
-			clientIP := m.getClientIP(c)
-			rateLimitKey = fmt.Sprintf("%s:ip:%s", limiterKey, clientIP)
-		} else {
-			rateLimitKey = fmt.Sprintf("%s:user:%s", limiterKey, userID)
-		}
+		// 創建或獲取 API 限流器（以配置項目區分，避免按原始路徑無限增長）
+		limiterKey := fmt.Sprintf("api:%s:%s", method, name)
+		limiter := m.getOrCreateAPILimiter(limiterKey, apiLimit)
+		rateLimitKey := limiterKey + ":" + m.dimensionKey(c, apiLimit.KeyBy)
 
-		if !limiter.Allow(rateLimitKey) {
+		decision := limiter.Allow(rateLimitKey)
+		m.recordDecision(c, "api", limiterKey, rateLimitKey, decision)
+		if !decision.Allowed {
 			m.logger.Warn("API rate limit exceeded",
 				zap.String("path", path),
 				zap.String("method", method),
-				zap.String("user_id", userID),
-				zap.String("ip", m.getClientIP(c)))
+				zap.String("limit", name),
+				zap.String("key", rateLimitKey))
 
 			c.JSON(http.StatusTooManyRequests, gin.H{
-				"status":  "error",
-				"message": "API rate limit exceeded",
-				"code":    "API_RATE_LIMIT_EXCEEDED",
-				"path":    path,
+				"status":      "error",
+				"message":     "API rate limit exceeded",
+				"code":        "API_RATE_LIMIT_EXCEEDED",
+				"retry_after": decision.RetryAfterSeconds(),
+				"path":        path,
 			})
 			c.Abort()
 			return
@@ -291,8 +368,17 @@ func (m *RateLimitMiddleware) APIRateLimit() gin.HandlerFunc {
 	}
 }
 
+// getLimiter 獲取已創建的限流器，limiters 可能被 getOrCreateAPILimiter 並發寫入
+func (m *RateLimitMiddleware) getLimiter(key string) (RateLimiter, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	limiter, exists := m.limiters[key]
+	return limiter, exists
+}
+
 // getOrCreateAPILimiter 獲取或創建 API 限流器
-func (m *RateLimitMiddleware) getOrCreateAPILimiter(key string, limit int, window time.Duration) RateLimiter {
+func (m *RateLimitMiddleware) getOrCreateAPILimiter(key string, rule config.RateLimitRule) RateLimiter {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -300,61 +386,59 @@ func (m *RateLimitMiddleware) getOrCreateAPILimiter(key string, limit int, windo
 		return limiter
 	}
 
-	limiter := NewMemoryRateLimiter(limit, window)
+	limiter := m.newLimiter(key, rule.Requests, rule.Window, rule.Burst)
 	m.limiters[key] = limiter
 	return limiter
 }
 
-// getClientIP 獲取客戶端 IP
-func (m *RateLimitMiddleware) getClientIP(c *gin.Context) string {
-	// 檢查 X-Forwarded-For 頭
-	if forwardedFor := c.GetHeader("X-Forwarded-For"); forwardedFor != "" {
-		ips := strings.Split(forwardedFor, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// 檢查 X-Real-IP 頭
-	if realIP := c.GetHeader("X-Real-IP"); realIP != "" {
-		return realIP
-	}
-
-	// 使用客戶端 IP
-	return c.ClientIP()
+// newLimiter 依配置的算法創建限流器，name 為限流器名稱
+// Redis 鍵以限流器名稱區分命名空間，使各限流器的 key 枚舉與查詢互不干擾
+func (m *RateLimitMiddleware) newLimiter(name string, limit int, window time.Duration, burst int) RateLimiter {
+	return NewRateLimiter(limit, window, LimiterOptions{
+		Algorithm:     m.config.RateLimit.Algorithm,
+		Burst:         burst,
+		Shards:        m.config.RateLimit.Shards,
+		SweepInterval: m.config.RateLimit.IdleTimeout,
+		Redis:         m.redisClient,
+		KeyPrefix:     m.config.RateLimit.KeyPrefix + name + ":",
+		FailMode:      m.config.RateLimit.FailMode,
+		Logger:        m.logger,
+	})
 }
 
-// GetRateLimitHeaders 獲取限流相關的響應頭
-func (m *RateLimitMiddleware) GetRateLimitHeaders(c *gin.Context) {
-	if !m.config.RateLimit.Enabled {
-		return
-	}
-
-	// 設置限流相關的響應頭
-	c.Header("X-RateLimit-Limit", strconv.Itoa(m.config.RateLimit.GlobalLimit))
-	c.Header("X-RateLimit-Remaining", "0") // 這裡可以實現更精確的計算
-	c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
-}
+// Close 停止所有限流器的背景清理並關閉 Redis 連接
+func (m *RateLimitMiddleware) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
-// ResetRateLimit 重置限流器（用於管理端點）
-func (m *RateLimitMiddleware) ResetRateLimit(key string) {
-	if limiter, exists := m.limiters[key]; exists {
-		limiter.Reset(key)
+	stop := func(limiter RateLimiter) {
+		if s, ok := limiter.(interface{ Stop() }); ok {
+			s.Stop()
+		}
 	}
 	if m.globalLimiter != nil {
-		m.globalLimiter.Reset("global")
+		stop(m.globalLimiter)
+	}
+	for _, limiter := range m.limiters {
+		stop(limiter)
+	}
+	if m.redisClient != nil {
+		m.redisClient.Close()
 	}
 }
 
-// GetRateLimitStats 獲取限流統計信息
-func (m *RateLimitMiddleware) GetRateLimitStats() map[string]interface{} {
+// GetRateLimitStats 獲取限流配置與各限流器的即時統計，top 為每個限流器返回的被拒絕最多的 key 數量
+func (m *RateLimitMiddleware) GetRateLimitStats(top int) map[string]interface{} {
 	stats := make(map[string]interface{})
 
 	stats["enabled"] = m.config.RateLimit.Enabled
+	stats["algorithm"] = m.config.RateLimit.Algorithm
+	stats["backend"] = m.config.RateLimit.Backend
 	stats["global_limit"] = m.config.RateLimit.GlobalLimit
 	stats["ip_limit"] = m.config.RateLimit.IPLimit
 	stats["user_limit"] = m.config.RateLimit.UserLimit
 	stats["api_limits"] = len(m.config.RateLimit.APILimit)
+	stats["limiters"] = m.Stats(top)
 
 	return stats
 }
@@ -0,0 +1,305 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"expense-api-gateway/internal/infrastructure/redis"
+
+	"go.uber.org/zap"
+)
+
+// Redis 不可用時的處理方式
+const (
+	FailModeLocal  = "local"
+	FailModeOpen   = "open"
+	FailModeClosed = "closed"
+)
+
+// maxScanKeys 管理端點列出 Redis 限流 key 的上限，避免大量 key 時長時間阻塞
+const maxScanKeys = 10000
+
+// redisRetryInterval Redis 出錯後暫停使用的時間，避免每個請求都等待超時
+const redisRetryInterval = time.Second
+
+// gcraScript 以 Redis 服務端時間執行 GCRA，時間單位為微秒
+// KEYS[1] 限流鍵；ARGV[1] emission；ARGV[2] tolerance
+// 返回 {是否允許, 剩餘額度, 額度恢復微秒數, 重試等待微秒數}
+const gcraScript = `
+local emission = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+  tat = now
+end
+local new_tat = tat + emission
+if new_tat - now > tolerance then
+  return {0, 0, tat - now, new_tat - now - tolerance}
+end
+local ttl = math.ceil((new_tat - now) / 1000)
+redis.call('SET', KEYS[1], string.format('%.0f', new_tat), 'PX', ttl)
+return {1, math.floor((tolerance - (new_tat - now)) / emission), new_tat - now, 0}
+`
+
+// gcraScriptSHA 腳本的 SHA1，用於 EVALSHA
+var gcraScriptSHA = func() string {
+	sum := sha1.Sum([]byte(gcraScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisRateLimiter 基於 Redis 的分佈式 GCRA 限流器
+// 多個網關副本共享同一組限流狀態；Redis 不可用時依 FailMode 回退
+type RedisRateLimiter struct {
+	client    *redis.Client
+	prefix    string
+	emission  int64 // 微秒
+	tolerance int64 // 微秒
+	burst     int
+	window    time.Duration
+	timeout   time.Duration
+	failMode  string
+	fallback  RateLimiter
+	logger    *zap.Logger
+
+	unavailableUntil atomic.Int64 // UnixNano
+}
+
+// NewRedisRateLimiter 創建 Redis 限流器，fallback 在 FailMode 為 local 時使用
+func NewRedisRateLimiter(client *redis.Client, limit int, window time.Duration, opts LimiterOptions, fallback RateLimiter) *RedisRateLimiter {
+	limit, window, burst := normalizeRule(limit, window, opts.Burst)
+	emission := window.Microseconds() / int64(limit)
+	if emission <= 0 {
+		emission = 1
+	}
+
+	failMode := opts.FailMode
+	if failMode == "" {
+		failMode = FailModeLocal
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &RedisRateLimiter{
+		client:    client,
+		prefix:    opts.KeyPrefix,
+		emission:  emission,
+		tolerance: emission * int64(burst),
+		burst:     burst,
+		window:    window,
+		timeout:   client.Timeout(),
+		failMode:  failMode,
+		fallback:  fallback,
+		logger:    logger,
+	}
+}
+
+// Allow 檢查是否允許請求
+func (l *RedisRateLimiter) Allow(key string) Decision {
+	if l.available() {
+		decision, err := l.allowRemote(key)
+		if err == nil {
+			return decision
+		}
+		l.markUnavailable(err)
+	}
+
+	switch l.failMode {
+	case FailModeOpen:
+		return Decision{Allowed: true, Limit: l.burst, Remaining: l.burst, Window: l.window}
+	case FailModeClosed:
+		return Decision{Limit: l.burst, RetryAfter: redisRetryInterval, Window: l.window}
+	default:
+		if l.fallback == nil {
+			return Decision{Allowed: true, Limit: l.burst, Remaining: l.burst, Window: l.window}
+		}
+		return l.fallback.Allow(key)
+	}
+}
+
+// Reset 重置限流器
+func (l *RedisRateLimiter) Reset(key string) {
+	if l.fallback != nil {
+		l.fallback.Reset(key)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+	if err := l.client.Del(ctx, l.prefix+key); err != nil {
+		l.logger.Warn("Failed to reset rate limit key in Redis",
+			zap.String("key", key),
+			zap.Error(err))
+	}
+}
+
+// Keys 以 SCAN 列出 Redis 中的限流 key（去除前綴），並合併本地回退限流器的 key
+func (l *RedisRateLimiter) Keys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if l.available() {
+		ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+		defer cancel()
+
+		cursor := "0"
+		match := escapeGlob(l.prefix) + "*"
+		for {
+			reply, err := l.client.Do(ctx, "SCAN", cursor, "MATCH", match, "COUNT", "500")
+			if err != nil {
+				l.markUnavailable(err)
+				break
+			}
+			items, ok := reply.([]interface{})
+			if !ok || len(items) != 2 {
+				break
+			}
+			cursor, _ = items[0].(string)
+			found, _ := items[1].([]interface{})
+			for _, item := range found {
+				if key, ok := item.(string); ok {
+					add(strings.TrimPrefix(key, l.prefix))
+				}
+			}
+			if cursor == "0" || cursor == "" || len(keys) >= maxScanKeys {
+				break
+			}
+		}
+	}
+
+	if inspector, ok := l.fallback.(Inspector); ok {
+		for _, key := range inspector.Keys() {
+			add(key)
+		}
+	}
+	return keys
+}
+
+// Peek 查詢 key 的當前狀態，Redis 不可用時查詢本地回退限流器
+// 剩餘額度以本機時間計算，與 Redis 服務端時間的偏差會影響結果
+func (l *RedisRateLimiter) Peek(key string) (KeyState, bool) {
+	if !l.available() {
+		if inspector, ok := l.fallback.(Inspector); ok {
+			return inspector.Peek(key)
+		}
+		return KeyState{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	reply, err := l.client.Do(ctx, "GET", l.prefix+key)
+	if err != nil {
+		l.markUnavailable(err)
+		return KeyState{}, false
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return KeyState{}, false
+	}
+	tat, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return KeyState{}, false
+	}
+
+	now := time.Now().UnixMicro()
+	if tat < now {
+		tat = now
+	}
+	return KeyState{
+		Key:          key,
+		Limit:        l.burst,
+		Remaining:    int((l.tolerance - (tat - now)) / l.emission),
+		ResetSeconds: ceilSeconds(time.Duration(tat-now) * time.Microsecond),
+	}, true
+}
+
+// Stop 停止本地回退限流器的背景清理
+func (l *RedisRateLimiter) Stop() {
+	if s, ok := l.fallback.(interface{ Stop() }); ok {
+		s.Stop()
+	}
+}
+
+// allowRemote 在 Redis 執行 GCRA 腳本
+func (l *RedisRateLimiter) allowRemote(key string) (Decision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	keys := []string{l.prefix + key}
+	args := []string{strconv.FormatInt(l.emission, 10), strconv.FormatInt(l.tolerance, 10)}
+
+	reply, err := l.client.EvalSHA(ctx, gcraScriptSHA, keys, args...)
+	if redis.IsNoScript(err) {
+		// EVAL 會同時緩存腳本，之後的 EVALSHA 可直接命中
+		reply, err = l.client.Eval(ctx, gcraScript, keys, args...)
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok || len(items) < 4 {
+		return Decision{}, fmt.Errorf("unexpected rate limit script reply: %v", reply)
+	}
+	values := make([]int64, len(items))
+	for i, item := range items {
+		value, ok := item.(int64)
+		if !ok {
+			return Decision{}, fmt.Errorf("unexpected rate limit script reply: %v", reply)
+		}
+		values[i] = value
+	}
+
+	return Decision{
+		Allowed:    values[0] == 1,
+		Limit:      l.burst,
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Microsecond,
+		RetryAfter: time.Duration(values[3]) * time.Microsecond,
+		Window:     l.window,
+	}, nil
+}
+
+// available 檢查 Redis 是否處於可用狀態
+func (l *RedisRateLimiter) available() bool {
+	return time.Now().UnixNano() >= l.unavailableUntil.Load()
+}
+
+// markUnavailable 記錄 Redis 錯誤並暫停使用一段時間
+func (l *RedisRateLimiter) markUnavailable(err error) {
+	until := time.Now().Add(redisRetryInterval).UnixNano()
+	if previous := l.unavailableUntil.Swap(until); previous < time.Now().UnixNano() {
+		l.logger.Warn("Redis rate limiter unavailable, falling back",
+			zap.String("addr", l.client.Addr()),
+			zap.String("fail_mode", l.failMode),
+			zap.Error(err))
+	}
+}
+
+// escapeGlob 轉義 Redis MATCH 模式中的特殊字符
+func escapeGlob(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/clientip"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 限流鍵維度
+const (
+	KeyByUser         = "user"
+	KeyByCompany      = "company"
+	KeyByIP           = "ip"
+	KeyByAPIKey       = "api_key"
+	KeyByHeaderPrefix = "header:"
+	KeyByParamPrefix  = "param:"
+)
+
+// apiKeyHeader API Key 請求頭
+const apiKeyHeader = "X-API-Key"
+
+// ResolveRouteRule 取得路由的限流規則
+// 優先順序：路由自身設定 > api_limit[路由 ID] > api_limit 中匹配路由模式的最長項目
+func (m *RateLimitMiddleware) ResolveRouteRule(id, pattern string, own *config.RateLimitRule) (config.RateLimitRule, bool) {
+	if own != nil && own.Requests > 0 {
+		return *own, true
+	}
+	if id != "" {
+		if rule, exists := m.config.RateLimit.APILimit[id]; exists {
+			return rule, true
+		}
+	}
+	_, rule, matched := m.matchAPILimit(pattern)
+	return rule, matched
+}
+
+// RouteRateLimit 路由限流中間件，需放在認證中間件之後以便按用戶或公司計數
+func (m *RateLimitMiddleware) RouteRateLimit(name string, rule config.RateLimitRule) gin.HandlerFunc {
+	for _, dimension := range rule.KeyBy {
+		if !config.IsValidRateLimitKeyBy(dimension) {
+			m.logger.Warn("Unknown rate limit key dimension ignored",
+				zap.String("route", name),
+				zap.String("key_by", dimension))
+		}
+	}
+	limiter := m.getOrCreateAPILimiter("route:"+name, rule)
+
+	return func(c *gin.Context) {
+		if !m.config.RateLimit.Enabled {
+			c.Next()
+			return
+		}
+
+		key := "route:" + name + ":" + m.dimensionKey(c, rule.KeyBy)
+		decision := limiter.Allow(key)
+		m.recordDecision(c, name, "route:"+name, key, decision)
+		if !decision.Allowed {
+			m.logger.Warn("Route rate limit exceeded",
+				zap.String("route", name),
+				zap.String("key", key),
+				zap.String("path", c.Request.URL.Path))
+
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"status":      "error",
+				"message":     "API rate limit exceeded",
+				"code":        "API_RATE_LIMIT_EXCEEDED",
+				"retry_after": decision.RetryAfterSeconds(),
+				"route":       name,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// matchAPILimit 以路由模式匹配 api_limit，返回匹配的項目名稱與規則
+// 項目以 * 結尾時為前綴匹配，否則匹配相同路徑或其子路徑，多個匹配時取最長項目
+func (m *RateLimitMiddleware) matchAPILimit(pattern string) (string, config.RateLimitRule, bool) {
+	if pattern == "" {
+		return "", config.RateLimitRule{}, false
+	}
+
+	var (
+		matched string
+		rule    config.RateLimitRule
+	)
+	for key, candidate := range m.config.RateLimit.APILimit {
+		if !strings.HasPrefix(key, "/") || len(key) <= len(matched) {
+			continue
+		}
+		if matchLimitPattern(key, pattern) {
+			matched = key
+			rule = candidate
+		}
+	}
+	return matched, rule, matched != ""
+}
+
+// matchLimitPattern 檢查 api_limit 項目是否匹配路由模式
+func matchLimitPattern(key, pattern string) bool {
+	if strings.HasSuffix(key, "*") {
+		return strings.HasPrefix(pattern, strings.TrimSuffix(key, "*"))
+	}
+	key = strings.TrimSuffix(key, "/")
+	return pattern == key || strings.HasPrefix(pattern, key+"/")
+}
+
+// dimensionKey 依維度組合限流鍵，未設置時按用戶計數（匿名時使用 IP）
+func (m *RateLimitMiddleware) dimensionKey(c *gin.Context, keyBy []string) string {
+	if len(keyBy) == 0 {
+		keyBy = []string{KeyByUser}
+	}
+
+	parts := make([]string, 0, len(keyBy))
+	for _, dimension := range keyBy {
+		parts = append(parts, dimension+"="+m.dimensionValue(c, dimension))
+	}
+	return strings.Join(parts, "|")
+}
+
+// dimensionValue 取得單個維度的值
+func (m *RateLimitMiddleware) dimensionValue(c *gin.Context, dimension string) string {
+	switch {
+	case dimension == KeyByUser:
+		if userID, err := auth.GetUserIDFromContext(c); err == nil {
+			return userID
+		}
+		return "anonymous:" + clientip.FromContext(c)
+	case dimension == KeyByCompany:
+		if companyID, err := auth.GetCompanyIDFromContext(c); err == nil && companyID != "" {
+			return companyID
+		}
+		return "anonymous:" + clientip.FromContext(c)
+	case dimension == KeyByIP:
+		return clientip.FromContext(c)
+	case dimension == KeyByAPIKey:
+		apiKey := c.GetHeader(apiKeyHeader)
+		if apiKey == "" {
+			return "anonymous:" + clientip.FromContext(c)
+		}
+		// 不在限流狀態中保存原始 API Key
+		sum := sha256.Sum256([]byte(apiKey))
+		return hex.EncodeToString(sum[:8])
+	case strings.HasPrefix(dimension, KeyByHeaderPrefix):
+		return c.GetHeader(strings.TrimPrefix(dimension, KeyByHeaderPrefix))
+	case strings.HasPrefix(dimension, KeyByParamPrefix):
+		return c.Param(strings.TrimPrefix(dimension, KeyByParamPrefix))
+	default:
+		return ""
+	}
+}
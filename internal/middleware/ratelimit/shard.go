@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// 默認分片與閒置清理參數
+const (
+	defaultSweepInterval = time.Minute
+	maxShards            = 256
+)
+
+// shard 單個分片，持有自己的鎖以降低競爭
+type shard[T any] struct {
+	mutex sync.Mutex
+	items map[string]*T
+}
+
+// shardedStore 以 key 雜湊分片的狀態存儲，並在背景清理閒置 key
+type shardedStore[T any] struct {
+	shards   []*shard[T]
+	mask     uint32
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// newShardedStore 創建分片存儲，分片數取不小於 n 的 2 的冪
+func newShardedStore[T any](n int) *shardedStore[T] {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0) * 4
+	}
+	if n > maxShards {
+		n = maxShards
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+
+	store := &shardedStore[T]{
+		shards: make([]*shard[T], size),
+		mask:   uint32(size - 1),
+		stopCh: make(chan struct{}),
+	}
+	for i := range store.shards {
+		store.shards[i] = &shard[T]{items: make(map[string]*T)}
+	}
+	return store
+}
+
+// shardFor 返回 key 所屬的分片
+func (s *shardedStore[T]) shardFor(key string) *shard[T] {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return s.shards[h.Sum32()&s.mask]
+}
+
+// with 在分片鎖內操作 key 的狀態，不存在時以 create 創建
+func (s *shardedStore[T]) with(key string, create func() *T, fn func(state *T)) {
+	sh := s.shardFor(key)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	state, exists := sh.items[key]
+	if !exists {
+		state = create()
+		sh.items[key] = state
+	}
+	fn(state)
+}
+
+// get 在分片鎖內讀取 key 的狀態，不存在時返回 false
+func (s *shardedStore[T]) get(key string, fn func(state *T)) bool {
+	sh := s.shardFor(key)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	state, exists := sh.items[key]
+	if exists {
+		fn(state)
+	}
+	return exists
+}
+
+// delete 刪除 key 的狀態
+func (s *shardedStore[T]) delete(key string) {
+	sh := s.shardFor(key)
+	sh.mutex.Lock()
+	delete(sh.items, key)
+	sh.mutex.Unlock()
+}
+
+// len 返回目前保存的 key 數量
+func (s *shardedStore[T]) len() int {
+	total := 0
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+		total += len(sh.items)
+		sh.mutex.Unlock()
+	}
+	return total
+}
+
+// keys 返回目前保存的所有 key
+func (s *shardedStore[T]) keys() []string {
+	var keys []string
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+		for key := range sh.items {
+			keys = append(keys, key)
+		}
+		sh.mutex.Unlock()
+	}
+	return keys
+}
+
+// sweep 逐個分片刪除 idle 返回 true 的 key
+func (s *shardedStore[T]) sweep(idle func(state *T) bool) {
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+		for key, state := range sh.items {
+			if idle(state) {
+				delete(sh.items, key)
+			}
+		}
+		sh.mutex.Unlock()
+	}
+}
+
+// startSweeper 啟動背景清理
+func (s *shardedStore[T]) startSweeper(interval time.Duration, idle func(state *T) bool) {
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep(idle)
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop 停止背景清理
+func (s *shardedStore[T]) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
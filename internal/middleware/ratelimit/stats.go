@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxTrackedKeys 每個限流器記錄拒絕次數的 key 上限，超過時淘汰次數最少的 key
+const maxTrackedKeys = 1000
+
+// DefaultTopKeys 統計中默認返回的被拒絕最多的 key 數量
+const DefaultTopKeys = 10
+
+// globalLimiterName 全局限流器名稱
+const globalLimiterName = "global"
+
+// KeyCount key 被拒絕的次數
+type KeyCount struct {
+	Key      string `json:"key"`
+	Rejected int64  `json:"rejected"`
+}
+
+// LimiterStats 單個限流器的統計
+type LimiterStats struct {
+	Name         string     `json:"name"`
+	ActiveKeys   int        `json:"active_keys"`
+	Allowed      int64      `json:"allowed"`
+	Rejected     int64      `json:"rejected"`
+	TopThrottled []KeyCount `json:"top_throttled"`
+}
+
+// LimiterKeyState 限流器中 key 的狀態
+type LimiterKeyState struct {
+	Limiter string `json:"limiter"`
+	KeyState
+	Rejected int64 `json:"rejected"`
+}
+
+// limiterCounters 單個限流器的計數
+type limiterCounters struct {
+	allowed   int64
+	rejected  int64
+	throttled map[string]int64
+}
+
+// statsRecorder 記錄各限流器的放行、拒絕次數與被拒絕最多的 key
+type statsRecorder struct {
+	mutex    sync.Mutex
+	limiters map[string]*limiterCounters
+}
+
+// newStatsRecorder 創建統計記錄器
+func newStatsRecorder() *statsRecorder {
+	return &statsRecorder{limiters: make(map[string]*limiterCounters)}
+}
+
+// record 記錄一次限流決策
+func (s *statsRecorder) record(limiter, key string, allowed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counters, exists := s.limiters[limiter]
+	if !exists {
+		counters = &limiterCounters{throttled: make(map[string]int64)}
+		s.limiters[limiter] = counters
+	}
+	if allowed {
+		counters.allowed++
+		return
+	}
+
+	counters.rejected++
+	if _, tracked := counters.throttled[key]; !tracked && len(counters.throttled) >= maxTrackedKeys {
+		evictLeast(counters.throttled)
+	}
+	counters.throttled[key]++
+}
+
+// snapshot 返回限流器的計數與被拒絕最多的 top 個 key
+func (s *statsRecorder) snapshot(limiter string, top int) (int64, int64, []KeyCount) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counters, exists := s.limiters[limiter]
+	if !exists {
+		return 0, 0, []KeyCount{}
+	}
+
+	keys := make([]KeyCount, 0, len(counters.throttled))
+	for key, count := range counters.throttled {
+		keys = append(keys, KeyCount{Key: key, Rejected: count})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Rejected != keys[j].Rejected {
+			return keys[i].Rejected > keys[j].Rejected
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > top {
+		keys = keys[:top]
+	}
+	return counters.allowed, counters.rejected, keys
+}
+
+// rejected 返回 key 在限流器中被拒絕的次數
+func (s *statsRecorder) rejected(limiter, key string) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if counters, exists := s.limiters[limiter]; exists {
+		return counters.throttled[key]
+	}
+	return 0
+}
+
+// evictLeast 淘汰拒絕次數最少的 key
+func evictLeast(counts map[string]int64) {
+	var (
+		victim string
+		least  int64 = -1
+	)
+	for key, count := range counts {
+		if least < 0 || count < least {
+			victim, least = key, count
+		}
+	}
+	delete(counts, victim)
+}
+
+// allLimiters 返回所有限流器的快照（含全局限流器）
+func (m *RateLimitMiddleware) allLimiters() map[string]RateLimiter {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	limiters := make(map[string]RateLimiter, len(m.limiters)+1)
+	for name, limiter := range m.limiters {
+		limiters[name] = limiter
+	}
+	if m.globalLimiter != nil {
+		limiters[globalLimiterName] = m.globalLimiter
+	}
+	return limiters
+}
+
+// Stats 返回各限流器的即時統計，top 為每個限流器返回的被拒絕最多的 key 數量
+func (m *RateLimitMiddleware) Stats(top int) []LimiterStats {
+	if top <= 0 {
+		top = DefaultTopKeys
+	}
+
+	limiters := m.allLimiters()
+	stats := make([]LimiterStats, 0, len(limiters))
+	for name, limiter := range limiters {
+		entry := LimiterStats{Name: name}
+		if inspector, ok := limiter.(Inspector); ok {
+			entry.ActiveKeys = len(inspector.Keys())
+		}
+		entry.Allowed, entry.Rejected, entry.TopThrottled = m.stats.snapshot(name, top)
+		stats = append(stats, entry)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// LookupKey 在所有限流器中查詢 key 的當前狀態
+func (m *RateLimitMiddleware) LookupKey(key string) []LimiterKeyState {
+	var states []LimiterKeyState
+	for name, limiter := range m.allLimiters() {
+		inspector, ok := limiter.(Inspector)
+		if !ok {
+			continue
+		}
+		if state, found := inspector.Peek(key); found {
+			states = append(states, LimiterKeyState{
+				Limiter:  name,
+				KeyState: state,
+				Rejected: m.stats.rejected(name, key),
+			})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Limiter < states[j].Limiter })
+	return states
+}
+
+// ResetRateLimit 在所有限流器中重置指定 key，返回重置的限流器數量
+func (m *RateLimitMiddleware) ResetRateLimit(key string) int {
+	reset := 0
+	for _, limiter := range m.allLimiters() {
+		if inspector, ok := limiter.(Inspector); ok {
+			if _, found := inspector.Peek(key); !found {
+				continue
+			}
+		}
+		limiter.Reset(key)
+		reset++
+	}
+	return reset
+}
+
+// ResetPattern 在所有限流器中重置匹配模式的 key，* 匹配任意字符，? 匹配單個字符
+// 返回重置的 key 數量
+func (m *RateLimitMiddleware) ResetPattern(pattern string) int {
+	matcher := compileKeyPattern(pattern)
+	reset := 0
+	for _, limiter := range m.allLimiters() {
+		inspector, ok := limiter.(Inspector)
+		if !ok {
+			continue
+		}
+		for _, key := range inspector.Keys() {
+			if matcher.MatchString(key) {
+				limiter.Reset(key)
+				reset++
+			}
+		}
+	}
+	return reset
+}
+
+// compileKeyPattern 將 key 模式轉為正則表達式
+func compileKeyPattern(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("^" + quoted + "$")
+}
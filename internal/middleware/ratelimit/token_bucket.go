@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucketState 令牌桶狀態，每個 key 固定大小
+type bucketState struct {
+	tokens float64
+	last   int64 // 上次補充令牌的時間（UnixNano）
+}
+
+// TokenBucketLimiter 令牌桶限流器
+// 每個 key 只保存令牌數與時間戳，以分片鎖保護，令牌桶回滿的 key 會在背景清理
+type TokenBucketLimiter struct {
+	store  *shardedStore[bucketState]
+	rate   float64 // 每納秒補充的令牌數
+	burst  float64
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewTokenBucketLimiter 創建令牌桶限流器，window 內補充 limit 個令牌，桶容量為 burst
+func NewTokenBucketLimiter(limit int, window time.Duration, opts LimiterOptions) *TokenBucketLimiter {
+	limit, window, burst := normalizeRule(limit, window, opts.Burst)
+
+	l := &TokenBucketLimiter{
+		store:  newShardedStore[bucketState](opts.Shards),
+		rate:   float64(limit) / float64(window),
+		burst:  float64(burst),
+		window: window,
+		now:    time.Now,
+	}
+	l.store.startSweeper(opts.SweepInterval, l.idle)
+	return l
+}
+
+// Allow 檢查是否允許請求
+func (l *TokenBucketLimiter) Allow(key string) Decision {
+	now := l.now().UnixNano()
+	decision := Decision{Limit: int(l.burst), Window: l.window}
+
+	l.store.with(key, func() *bucketState {
+		return &bucketState{tokens: l.burst, last: now}
+	}, func(state *bucketState) {
+		if elapsed := now - state.last; elapsed > 0 {
+			state.tokens += float64(elapsed) * l.rate
+			if state.tokens > l.burst {
+				state.tokens = l.burst
+			}
+			state.last = now
+		}
+		if state.tokens >= 1 {
+			state.tokens--
+			decision.Allowed = true
+		} else {
+			decision.RetryAfter = l.refillTime(1 - state.tokens)
+		}
+		decision.Remaining = int(state.tokens)
+		decision.Reset = l.refillTime(l.burst - state.tokens)
+	})
+
+	return decision
+}
+
+// Reset 重置限流器
+func (l *TokenBucketLimiter) Reset(key string) {
+	l.store.delete(key)
+}
+
+// Keys 返回目前追蹤的 key
+func (l *TokenBucketLimiter) Keys() []string {
+	return l.store.keys()
+}
+
+// Peek 查詢 key 的當前狀態，不消耗令牌
+func (l *TokenBucketLimiter) Peek(key string) (KeyState, bool) {
+	now := l.now().UnixNano()
+	state := KeyState{Key: key, Limit: int(l.burst)}
+
+	found := l.store.get(key, func(s *bucketState) {
+		tokens := s.tokens
+		if elapsed := now - s.last; elapsed > 0 {
+			tokens = math.Min(l.burst, tokens+float64(elapsed)*l.rate)
+		}
+		state.Remaining = int(tokens)
+		state.ResetSeconds = ceilSeconds(l.refillTime(l.burst - tokens))
+	})
+	return state, found
+}
+
+// Len 返回目前追蹤的 key 數量
+func (l *TokenBucketLimiter) Len() int {
+	return l.store.len()
+}
+
+// Sweep 立即清理閒置的 key
+func (l *TokenBucketLimiter) Sweep() {
+	l.store.sweep(l.idle)
+}
+
+// Stop 停止背景清理
+func (l *TokenBucketLimiter) Stop() {
+	l.store.stop()
+}
+
+// SetClock 設置時間來源（用於測試）
+func (l *TokenBucketLimiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// refillTime 補充指定數量令牌所需時間（向上取整到納秒，忽略浮點誤差）
+func (l *TokenBucketLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens/l.rate - 1e-6))
+}
+
+// idle 令牌桶已回滿時，刪除狀態與保留狀態等價
+func (l *TokenBucketLimiter) idle(state *bucketState) bool {
+	elapsed := l.now().UnixNano() - state.last
+	return state.tokens+float64(elapsed)*l.rate >= l.burst
+}
@@ -0,0 +1,212 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/clientip"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CSRFMiddleware CSRF 防護中間件（Double Submit Cookie + Origin/Referer 檢查）
+// 僅對以會話 Cookie 認證的狀態變更請求生效，Bearer 與客戶端證書認證不受影響
+type CSRFMiddleware struct {
+	config   *config.Config
+	logger   *zap.Logger
+	clientIP *clientip.Resolver
+}
+
+// NewCSRFMiddleware 創建新的 CSRF 防護中間件
+func NewCSRFMiddleware(cfg *config.Config, logger *zap.Logger) *CSRFMiddleware {
+	resolver, err := clientip.NewResolver(cfg.ClientIP)
+	if err != nil {
+		logger.Error("Invalid client IP configuration, forwarded headers ignored", zap.Error(err))
+		resolver = &clientip.Resolver{}
+	}
+	return &CSRFMiddleware{
+		config:   cfg,
+		logger:   logger,
+		clientIP: resolver,
+	}
+}
+
+// CSRFProtection CSRF 防護中間件
+func (m *CSRFMiddleware) CSRFProtection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.config.Security.CSRF.Enabled || auth.GetAuthMethodFromContext(c) != auth.AuthMethodSession {
+			c.Next()
+			return
+		}
+
+		// 確保會話用戶持有 CSRF token
+		cookieToken := m.cookieToken(c)
+		if cookieToken == "" {
+			cookieToken = m.issueToken(c)
+		}
+
+		if isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		if !m.checkOrigin(c) {
+			m.reject(c, "origin not allowed")
+			return
+		}
+
+		headerToken := c.GetHeader(m.headerName())
+		if headerToken == "" || cookieToken == "" ||
+			subtle.ConstantTimeCompare([]byte(headerToken), []byte(cookieToken)) != 1 {
+			m.reject(c, "token mismatch")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// IssueToken 返回目前的 CSRF token，不存在時簽發新的
+func (m *CSRFMiddleware) IssueToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := m.cookieToken(c)
+		if token == "" {
+			token = m.issueToken(c)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"token":  token,
+				"header": m.headerName(),
+			},
+		})
+	}
+}
+
+// checkOrigin 檢查 Origin 或 Referer 是否為同源或受信任來源
+func (m *CSRFMiddleware) checkOrigin(c *gin.Context) bool {
+	source := c.GetHeader("Origin")
+	if source == "" {
+		source = c.GetHeader("Referer")
+	}
+	// 未提供來源時僅依賴 token 驗證
+	if source == "" {
+		return true
+	}
+	if source == "null" {
+		return false
+	}
+
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	origin := parsed.Scheme + "://" + parsed.Host
+
+	// 同源需協議與主機都相同，https 部署不接受 http 來源
+	if strings.EqualFold(parsed.Scheme, m.requestScheme(c)) && strings.EqualFold(parsed.Host, c.Request.Host) {
+		return true
+	}
+	for _, trusted := range m.config.Security.CSRF.TrustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestScheme 返回請求的協議
+// 僅直接連線的對端為受信任代理時採用 X-Forwarded-Proto，否則依連接是否使用 TLS 判斷
+func (m *CSRFMiddleware) requestScheme(c *gin.Context) string {
+	if m.clientIP.IsTrusted(clientip.RemoteIP(c.Request)) {
+		if proto, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Proto"), ","); strings.TrimSpace(proto) != "" {
+			return strings.ToLower(strings.TrimSpace(proto))
+		}
+	}
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// cookieToken 讀取 CSRF Cookie
+func (m *CSRFMiddleware) cookieToken(c *gin.Context) string {
+	cookie, err := c.Request.Cookie(m.cookieName())
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// issueToken 簽發新的 CSRF token 並寫入 Cookie
+// Cookie 不設置 HttpOnly，前端需讀取後放入請求頭
+func (m *CSRFMiddleware) issueToken(c *gin.Context) string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		m.logger.Error("Failed to generate CSRF token", zap.Error(err))
+		return ""
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     m.cookieName(),
+		Value:    token,
+		Path:     "/",
+		Domain:   m.config.OIDC.Session.Domain,
+		Secure:   m.config.OIDC.Session.Secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// reject 拒絕請求
+func (m *CSRFMiddleware) reject(c *gin.Context, reason string) {
+	m.logger.Warn("CSRF validation failed",
+		zap.String("reason", reason),
+		zap.String("path", c.Request.URL.Path),
+		zap.String("method", c.Request.Method),
+		zap.String("origin", c.GetHeader("Origin")),
+		zap.String("ip", clientip.FromContext(c)))
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"status":  "error",
+		"message": "CSRF 驗證失敗，請重新整理頁面後再試",
+		"code":    "CSRF_VALIDATION_FAILED",
+	})
+	c.Abort()
+}
+
+// cookieName CSRF Cookie 名稱
+func (m *CSRFMiddleware) cookieName() string {
+	if m.config.Security.CSRF.CookieName == "" {
+		return "gw_csrf"
+	}
+	return m.config.Security.CSRF.CookieName
+}
+
+// headerName CSRF 請求頭名稱
+func (m *CSRFMiddleware) headerName() string {
+	if m.config.Security.CSRF.HeaderName == "" {
+		return "X-CSRF-Token"
+	}
+	return m.config.Security.CSRF.HeaderName
+}
+
+// isSafeMethod 檢查是否為不改變狀態的 HTTP 方法
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,39 @@
+package security
+
+import (
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/middleware/waf"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 安全事件的處理結果
+const (
+	actionBlocked   = "blocked"
+	actionMonitored = "monitored"
+)
+
+// recordSecurityEvent 以結構化日誌記錄檢測命中並計入指標，日誌只包含命中的字段名，不包含字段值
+func recordSecurityEvent(logger *zap.Logger, monitorService *monitor.Monitor, c *gin.Context, category, mode string, result waf.Result) {
+	action := actionBlocked
+	if mode == config.SecurityModeMonitor {
+		action = actionMonitored
+	}
+
+	logger.Warn("Security event",
+		zap.String("category", category),
+		zap.String("action", action),
+		zap.String("ip", clientip.FromContext(c)),
+		zap.String("method", c.Request.Method),
+		zap.String("path", c.Request.URL.Path),
+		zap.String("route", c.FullPath()),
+		zap.Int("score", result.Score),
+		zap.Strings("rules", result.RuleIDs()),
+		zap.Any("matches", result.Matches))
+	if monitorService != nil {
+		monitorService.RecordSecurityEvent(category, action == actionMonitored, result.RuleIDs())
+	}
+}
@@ -1,15 +1,13 @@
 package security
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
 	"regexp"
 	"strings"
 
 	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/waf"
+	"expense-api-gateway/internal/service/monitor"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -19,41 +17,33 @@ import (
 type XSSMiddleware struct {
 	config *config.Config
 	logger *zap.Logger
-	// XSS 攻擊模式
-	xssPatterns []*regexp.Regexp
+	// WAF 規則引擎
+	engine *waf.Engine
+	// 監控服務，記錄安全事件指標
+	monitor *monitor.Monitor
 	// 允許的 HTML 標籤
 	allowedTags map[string]bool
 	// 允許的屬性
 	allowedAttributes map[string]bool
 }
 
-// NewXSSMiddleware 創建新的 XSS 防護中間件
+// NewXSSMiddleware 創建新的 XSS 防護中間件，規則文件無效時使用內建規則
 func NewXSSMiddleware(cfg *config.Config, logger *zap.Logger) *XSSMiddleware {
+	engine, err := waf.NewEngine(cfg.Security.WAF, logger)
+	if err != nil {
+		logger.Error("Failed to load WAF rules, using built-in rules", zap.Error(err))
+		engine = waf.NewDefaultEngine(cfg.Security.WAF, logger)
+	}
+	return NewXSSMiddlewareWithEngine(cfg, logger, engine, nil)
+}
+
+// NewXSSMiddlewareWithEngine 使用共用的 WAF 規則引擎創建 XSS 防護中間件，monitorService 可為 nil
+func NewXSSMiddlewareWithEngine(cfg *config.Config, logger *zap.Logger, engine *waf.Engine, monitorService *monitor.Monitor) *XSSMiddleware {
 	middleware := &XSSMiddleware{
-		config: cfg,
-		logger: logger,
-		xssPatterns: []*regexp.Regexp{
-			// 腳本標籤
-			regexp.MustCompile(`(?i)<script[^>]*>.*?</script>`),
-			// 事件處理器
-			regexp.MustCompile(`(?i)on\w+\s*=`),
-			// JavaScript 協議
-			regexp.MustCompile(`(?i)javascript:`),
-			// 數據協議
-			regexp.MustCompile(`(?i)data:`),
-			// VBScript
-			regexp.MustCompile(`(?i)vbscript:`),
-			// 表達式
-			regexp.MustCompile(`(?i)expression\s*\(`),
-			// 編碼的腳本
-			regexp.MustCompile(`(?i)%3Cscript|%3cscript`),
-			// 雙編碼
-			regexp.MustCompile(`(?i)%253Cscript|%253cscript`),
-			// 常見的 XSS 向量
-			regexp.MustCompile(`(?i)<iframe|<object|<embed|<form`),
-			// 危險的 CSS
-			regexp.MustCompile(`(?i)expression\s*\(|url\s*\(.*javascript:`),
-		},
+		config:  cfg,
+		logger:  logger,
+		engine:  engine,
+		monitor: monitorService,
 		allowedTags: map[string]bool{
 			"p": true, "div": true, "span": true, "br": true, "hr": true,
 			"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
@@ -79,34 +69,19 @@ func (m *XSSMiddleware) XSSProtection() gin.HandlerFunc {
 			return
 		}
 
-		// 設置安全標頭
-		c.Header("X-XSS-Protection", "1; mode=block")
-		c.Header("X-Content-Type-Options", "nosniff")
-		c.Header("X-Frame-Options", "DENY")
+		// 依路由設定決定檢測模式
+		mode := m.engine.Mode(waf.CategoryXSS, c.FullPath(), m.config.Security.XSS.Mode)
+		if mode == config.SecurityModeOff {
+			c.Next()
+			return
+		}
 
-		// 檢查請求方法
-		if c.Request.Method == http.MethodGet {
-			// 檢查查詢參數
-			if err := m.checkQueryParams(c); err != nil {
-				m.logger.Warn("XSS attack detected in query params",
-					zap.String("ip", c.ClientIP()),
-					zap.String("path", c.Request.URL.Path),
-					zap.Error(err))
-				c.JSON(http.StatusBadRequest, gin.H{
-					"status":  "error",
-					"message": "XSS 攻擊檢測到，請勿提交惡意內容",
-					"code":    "XSS_ATTACK_DETECTED",
-				})
-				c.Abort()
-				return
-			}
-		} else if c.Request.Method == http.MethodPost || c.Request.Method == http.MethodPut || c.Request.Method == http.MethodPatch {
-			// 檢查請求體
-			if err := m.checkRequestBody(c); err != nil {
-				m.logger.Warn("XSS attack detected in request body",
-					zap.String("ip", c.ClientIP()),
-					zap.String("path", c.Request.URL.Path),
-					zap.Error(err))
+		// 以 XSS 規則評分所有請求輸入，請求結束後釋放請求體暫存區
+		defer waf.Release(c)
+		result := m.engine.EvaluateRequest(c, waf.CategoryXSS)
+		if result.Blocked {
+			recordSecurityEvent(m.logger, m.monitor, c, waf.CategoryXSS, mode, result)
+			if mode == config.SecurityModeBlock {
 				c.JSON(http.StatusBadRequest, gin.H{
 					"status":  "error",
 					"message": "XSS 攻擊檢測到，請勿提交惡意內容",
@@ -121,138 +96,6 @@ func (m *XSSMiddleware) XSSProtection() gin.HandlerFunc {
 	}
 }
 
-// checkQueryParams 檢查查詢參數
-func (m *XSSMiddleware) checkQueryParams(c *gin.Context) error {
-	for key, values := range c.Request.URL.Query() {
-		for _, value := range values {
-			if m.isXSSAttack(value) {
-				return fmt.Errorf("XSS attack detected in query param %s: %s", key, value)
-			}
-		}
-	}
-	return nil
-}
-
-// checkRequestBody 檢查請求體
-func (m *XSSMiddleware) checkRequestBody(c *gin.Context) error {
-	contentType := c.GetHeader("Content-Type")
-
-	if strings.Contains(contentType, "application/json") {
-		return m.checkJSONBody(c)
-	} else if strings.Contains(contentType, "application/x-www-form-urlencoded") {
-		return m.checkFormBody(c)
-	} else if strings.Contains(contentType, "multipart/form-data") {
-		return m.checkMultipartBody(c)
-	}
-
-	return nil
-}
-
-// checkJSONBody 檢查 JSON 請求體
-func (m *XSSMiddleware) checkJSONBody(c *gin.Context) error {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		return err
-	}
-
-	// 恢復請求體
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
-
-	// 檢查 JSON 字符串中的 XSS
-	bodyStr := string(body)
-	if m.isXSSAttack(bodyStr) {
-		return fmt.Errorf("XSS attack detected in JSON body")
-	}
-
-	// 額外檢查：解析 JSON 並檢查每個字段
-	var jsonData map[string]interface{}
-	if err := json.Unmarshal(body, &jsonData); err == nil {
-		for _, value := range jsonData {
-			if strValue, ok := value.(string); ok {
-				if m.isXSSAttack(strValue) {
-					return fmt.Errorf("XSS attack detected in JSON field")
-				}
-			}
-		}
-	}
-
-	return nil
-}
-
-// checkFormBody 檢查表單請求體
-func (m *XSSMiddleware) checkFormBody(c *gin.Context) error {
-	if err := c.Request.ParseForm(); err != nil {
-		return err
-	}
-
-	for key, values := range c.Request.PostForm {
-		for _, value := range values {
-			if m.isXSSAttack(value) {
-				return fmt.Errorf("XSS attack detected in form field %s: %s", key, value)
-			}
-		}
-	}
-
-	return nil
-}
-
-// checkMultipartBody 檢查多部分表單請求體
-func (m *XSSMiddleware) checkMultipartBody(c *gin.Context) error {
-	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
-		return err
-	}
-
-	// 檢查表單字段
-	for key, values := range c.Request.MultipartForm.Value {
-		for _, value := range values {
-			if m.isXSSAttack(value) {
-				return fmt.Errorf("XSS attack detected in multipart form field %s: %s", key, value)
-			}
-		}
-	}
-
-	return nil
-}
-
-// isXSSAttack 檢查是否為 XSS 攻擊
-func (m *XSSMiddleware) isXSSAttack(input string) bool {
-	// 檢查 XSS 模式
-	for _, pattern := range m.xssPatterns {
-		if pattern.MatchString(input) {
-			return true
-		}
-	}
-
-	// 檢查編碼的攻擊向量
-	decoded := m.decodeURL(input)
-	for _, pattern := range m.xssPatterns {
-		if pattern.MatchString(decoded) {
-			return true
-		}
-	}
-
-	// 額外檢查腳本標籤（更寬鬆的匹配）
-	if regexp.MustCompile(`(?i)<script`).MatchString(input) {
-		return true
-	}
-
-	return false
-}
-
-// decodeURL 簡單的 URL 解碼
-func (m *XSSMiddleware) decodeURL(input string) string {
-	// 這裡可以實現更複雜的解碼邏輯
-	// 目前只是簡單的字符串替換
-	decoded := strings.ReplaceAll(input, "%3C", "<")
-	decoded = strings.ReplaceAll(decoded, "%3E", ">")
-	decoded = strings.ReplaceAll(decoded, "%22", "\"")
-	decoded = strings.ReplaceAll(decoded, "%27", "'")
-	decoded = strings.ReplaceAll(decoded, "%2F", "/")
-	decoded = strings.ReplaceAll(decoded, "%3B", ";")
-	decoded = strings.ReplaceAll(decoded, "%3D", "=")
-	return decoded
-}
-
 // SanitizeHTML 清理 HTML 內容
 func (m *XSSMiddleware) SanitizeHTML(input string) string {
 	// 移除所有腳本標籤
@@ -0,0 +1,90 @@
+package upload
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// buffer 暫存上傳內容，超過記憶體上限時寫入臨時文件，寫入完成後可多次讀取
+type buffer struct {
+	memoryLimit int64
+	memory      bytes.Buffer
+	file        *os.File
+	size        int64
+	err         error
+	closeOnce   sync.Once
+}
+
+// newBuffer 創建暫存區
+func newBuffer(memoryLimit int64) *buffer {
+	return &buffer{memoryLimit: memoryLimit}
+}
+
+// Write 寫入暫存區，超過記憶體上限時將已有內容轉存到臨時文件，寫入錯誤記錄在 err 中
+func (b *buffer) Write(p []byte) (n int, err error) {
+	defer func() {
+		if err != nil && b.err == nil {
+			b.err = err
+		}
+	}()
+
+	if b.file == nil && int64(b.memory.Len()+len(p)) > b.memoryLimit {
+		file, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			return 0, err
+		}
+		if _, err := file.Write(b.memory.Bytes()); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return 0, err
+		}
+		b.memory = bytes.Buffer{}
+		b.file = file
+	}
+
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.memory.Write(p)
+	}
+	b.size += int64(n)
+	return n, err
+}
+
+// Size 返回已寫入的字節數
+func (b *buffer) Size() int64 {
+	return b.size
+}
+
+// reader 返回從頭讀取全部內容的讀取器
+func (b *buffer) reader() io.Reader {
+	if b.file != nil {
+		return io.NewSectionReader(b.file, 0, b.size)
+	}
+	return bytes.NewReader(b.memory.Bytes())
+}
+
+// Close 關閉並刪除臨時文件，可重複調用
+func (b *buffer) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		if b.file != nil {
+			err = b.file.Close()
+			os.Remove(b.file.Name())
+		}
+	})
+	return err
+}
+
+// bufferBody 以暫存區內容作為請求體，關閉時釋放暫存區
+type bufferBody struct {
+	io.Reader
+	buffer *buffer
+}
+
+// Close 釋放暫存區
+func (b *bufferBody) Close() error {
+	return b.buffer.Close()
+}
@@ -0,0 +1,99 @@
+package upload
+
+import (
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameLength 文件名的最大字節數
+const maxFilenameLength = 255
+
+// defaultFilename 清理後為空時使用的文件名
+const defaultFilename = "upload"
+
+// reservedNames Windows 保留的設備名稱
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFilename 清理客戶端提供的文件名：只保留最後一段路徑，移除控制字符與路徑、保留字符，
+// 去除首尾的點與空白，避開 Windows 設備名稱，並在保留擴展名的前提下限制長度
+func SanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			continue
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			b.WriteRune('_')
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	name = strings.Trim(strings.Join(strings.Fields(b.String()), " "), ". ")
+	if name == "" {
+		return defaultFilename
+	}
+
+	base, ext := splitExtension(name)
+	if reservedNames[strings.ToUpper(base)] {
+		base = "_" + base
+	}
+	if len(ext) > maxFilenameLength/2 {
+		ext = ""
+	}
+	base = truncateUTF8(base, maxFilenameLength-len(ext))
+	if base == "" {
+		base = defaultFilename
+	}
+	return base + ext
+}
+
+// replaceExtension 將擴展名替換為內容類型對應的擴展名，並將文件名中其餘的點替換為底線，
+// 避免 receipt.php.jpg 之類的多重擴展名被下游伺服器按前一個擴展名處理
+func replaceExtension(name string, extensions []string) string {
+	if len(extensions) == 0 {
+		return name
+	}
+	base, ext := splitExtension(name)
+	matched := false
+	for _, candidate := range extensions {
+		if strings.EqualFold(ext, candidate) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		ext = extensions[0]
+	}
+	base = strings.ReplaceAll(base, ".", "_")
+	return truncateUTF8(base, maxFilenameLength-len(ext)) + ext
+}
+
+// splitExtension 拆分文件名與擴展名（含點），以點開頭的文件名視為沒有擴展名
+func splitExtension(name string) (string, string) {
+	index := strings.LastIndex(name, ".")
+	if index <= 0 {
+		return name, ""
+	}
+	return name[:index], name[index:]
+}
+
+// truncateUTF8 將字串截斷到指定字節數，不截斷多字節字符
+func truncateUTF8(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	for limit > 0 && !utf8.RuneStart(value[limit]) {
+		limit--
+	}
+	return strings.TrimRight(value[:limit], ". ")
+}
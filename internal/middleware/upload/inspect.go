@@ -0,0 +1,250 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"  // 註冊 GIF 解碼器，用於讀取圖片尺寸
+	_ "image/jpeg" // 註冊 JPEG 解碼器
+	_ "image/png"  // 註冊 PNG 解碼器
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// sniffLength 判斷文件類型時讀取的開頭字節數
+const sniffLength = 4096
+
+// zipTailLength 在文件末尾查找 ZIP 中央目錄結束記錄的範圍（記錄長度加最大註釋長度）
+const zipTailLength = 22 + 65535
+
+// markerOverlap 內容掃描時相鄰數據塊保留的重疊字節數，避免特徵被數據塊邊界切開
+const markerOverlap = 256
+
+// 文件類型
+const (
+	typeJPEG  = "image/jpeg"
+	typePNG   = "image/png"
+	typeGIF   = "image/gif"
+	typeWebP  = "image/webp"
+	typeHEIC  = "image/heic"
+	typeHEIF  = "image/heif"
+	typeTIFF  = "image/tiff"
+	typeBMP   = "image/bmp"
+	typeSVG   = "image/svg+xml"
+	typePDF   = "application/pdf"
+	typeText  = "text/plain"
+	typeOctet = "application/octet-stream"
+)
+
+// typeExtensions 文件類型對應的擴展名，第一個為標準擴展名
+var typeExtensions = map[string][]string{
+	typeJPEG: {".jpg", ".jpeg"},
+	typePNG:  {".png"},
+	typeGIF:  {".gif"},
+	typeWebP: {".webp"},
+	typeHEIC: {".heic"},
+	typeHEIF: {".heif"},
+	typeTIFF: {".tif", ".tiff"},
+	typeBMP:  {".bmp"},
+	typeSVG:  {".svg"},
+	typePDF:  {".pdf"},
+	typeText: {".txt"},
+}
+
+// typeAliases 客戶端常用的非標準類型名稱
+var typeAliases = map[string]string{
+	"image/jpg":           typeJPEG,
+	"image/pjpeg":         typeJPEG,
+	"image/x-png":         typePNG,
+	"image/heic-sequence": typeHEIC,
+	"image/heif-sequence": typeHEIF,
+	"image/x-ms-bmp":      typeBMP,
+	"application/x-pdf":   typePDF,
+}
+
+// heifBrands ISO BMFF ftyp 盒中表示 HEIC / HEIF 的品牌
+var heifBrands = map[string]string{
+	"heic": typeHEIC, "heix": typeHEIC, "hevc": typeHEIC, "hevx": typeHEIC,
+	"heim": typeHEIC, "heis": typeHEIC, "mif1": typeHEIF, "msf1": typeHEIF,
+}
+
+var (
+	// embeddedCodePattern 圖片與 PDF 中不應出現的腳本或標記，出現時視為多語言文件
+	embeddedCodePattern = regexp.MustCompile(`(?i)<script|<\?php|<%@|<html|<iframe|javascript:`)
+	// pdfActionPattern PDF 中的 JavaScript 與外部程序啟動動作
+	pdfActionPattern = regexp.MustCompile(`/JavaScript|/Launch`)
+	// svgScriptPattern SVG 中可執行腳本的元素、事件屬性與偽協議
+	svgScriptPattern = regexp.MustCompile(`(?i)<script|<foreignobject|<iframe|<embed|<object|javascript:|data:text/html|[\s"'/]on[a-z]+\s*=`)
+)
+
+// zipEndSignature ZIP 中央目錄結束記錄的簽名
+var zipEndSignature = []byte("PK\x05\x06")
+
+// detectType 依文件開頭的魔術字節判斷類型，無法識別時使用 http.DetectContentType
+func detectType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return typePDF
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return typeJPEG
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return typePNG
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return typeGIF
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return typeWebP
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && heifBrands[string(head[8:12])] != "":
+		return heifBrands[string(head[8:12])]
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return typeTIFF
+	}
+
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if isSVG(head, detected) {
+		return typeSVG
+	}
+	return detected
+}
+
+// isSVG 檢查文本內容是否為 SVG 文件
+func isSVG(head []byte, detected string) bool {
+	switch detected {
+	case "text/xml", "text/plain", "text/html":
+		return bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+	}
+	return false
+}
+
+// normalizeType 將聲明的 Content-Type 轉為標準類型名稱，無法解析時返回空值
+func normalizeType(declared string) string {
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return ""
+	}
+	if alias, exists := typeAliases[mediaType]; exists {
+		return alias
+	}
+	return mediaType
+}
+
+// resolveType 結合聲明類型與內容判斷的類型，返回文件的實際類型與兩者是否矛盾
+// 聲明為空或 application/octet-stream 時以內容為準；純文本內容可聲明為更具體的 text/* 類型，如 text/csv
+func resolveType(declared, detected string) (string, bool) {
+	declared = normalizeType(declared)
+	switch {
+	case declared == "" || declared == typeOctet || declared == detected:
+		return detected, false
+	case detected == typeText && strings.HasPrefix(declared, "text/") && declared != "text/html":
+		return declared, false
+	}
+	return detected, true
+}
+
+// typeAllowed 檢查類型是否在允許列表中，支持 image/* 與 */* 通配
+func typeAllowed(allowed []string, fileType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	major, _, _ := strings.Cut(fileType, "/")
+	for _, candidate := range allowed {
+		candidate = strings.ToLower(strings.TrimSpace(candidate))
+		if alias, exists := typeAliases[candidate]; exists {
+			candidate = alias
+		}
+		if candidate == fileType || candidate == "*/*" || candidate == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// unsafeContent 掃描文件內容，返回發現的危險特徵，未發現時返回空值
+// 圖片與 PDF 檢查嵌入的腳本標記與附加在末尾的 ZIP 壓縮包，PDF 另檢查 JavaScript 與 Launch 動作，SVG 檢查腳本與事件屬性
+func unsafeContent(r io.Reader, fileType string, size int64) (string, error) {
+	var patterns []*regexp.Regexp
+	checkZip := false
+	switch {
+	case fileType == typeSVG:
+		patterns = []*regexp.Regexp{svgScriptPattern}
+	case fileType == typePDF:
+		patterns = []*regexp.Regexp{embeddedCodePattern, pdfActionPattern}
+		checkZip = true
+	case strings.HasPrefix(fileType, "image/"):
+		patterns = []*regexp.Regexp{embeddedCodePattern}
+		checkZip = true
+	default:
+		return "", nil
+	}
+
+	window := make([]byte, 0, 32<<10+markerOverlap)
+	chunk := make([]byte, 32<<10)
+	var offset int64
+	for {
+		n, err := r.Read(chunk)
+		window = append(window, chunk[:n]...)
+		offset += int64(n)
+		for _, pattern := range patterns {
+			if match := pattern.Find(window); match != nil {
+				return "embedded " + strings.ToLower(strings.TrimSpace(string(match))), nil
+			}
+		}
+		if checkZip && offset > size-zipTailLength && bytes.Contains(window, zipEndSignature) {
+			return "appended zip archive", nil
+		}
+		if len(window) > markerOverlap {
+			window = append(window[:0], window[len(window)-markerOverlap:]...)
+		}
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// imageDimensions 讀取圖片的寬高，supported 為 false 表示不支持該格式
+// JPEG、PNG、GIF 由標準庫解析文件頭，WebP 從 VP8 / VP8L / VP8X 塊讀取
+func imageDimensions(r io.Reader, fileType string, head []byte) (width, height int, supported bool, err error) {
+	switch fileType {
+	case typeJPEG, typePNG, typeGIF:
+		cfg, _, err := image.DecodeConfig(r)
+		if err != nil {
+			return 0, 0, true, err
+		}
+		return cfg.Width, cfg.Height, true, nil
+	case typeWebP:
+		width, height, ok := webpDimensions(head)
+		if !ok {
+			return 0, 0, true, errors.New("invalid webp header")
+		}
+		return width, height, true, nil
+	}
+	return 0, 0, false, nil
+}
+
+// webpDimensions 解析 WebP 第一個塊中的寬高
+func webpDimensions(head []byte) (int, int, bool) {
+	if len(head) < 30 {
+		return 0, 0, false
+	}
+	chunk := head[12:]
+	switch string(chunk[:4]) {
+	case "VP8X":
+		width := int(uint32(chunk[12]) | uint32(chunk[13])<<8 | uint32(chunk[14])<<16)
+		height := int(uint32(chunk[15]) | uint32(chunk[16])<<8 | uint32(chunk[17])<<16)
+		return width + 1, height + 1, true
+	case "VP8 ":
+		width := int(binary.LittleEndian.Uint16(chunk[14:16]) & 0x3FFF)
+		height := int(binary.LittleEndian.Uint16(chunk[16:18]) & 0x3FFF)
+		return width, height, true
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(chunk[9:13])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, true
+	}
+	return 0, 0, false
+}
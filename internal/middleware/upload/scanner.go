@@ -0,0 +1,155 @@
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"expense-api-gateway/internal/config"
+)
+
+// clamdChunkSize INSTREAM 每個數據塊的大小
+const clamdChunkSize = 32 << 10
+
+// eicarSignature EICAR 防毒測試文件的特徵字串
+const eicarSignature = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// ScanResult 掃描結果
+type ScanResult struct {
+	Clean     bool   `json:"clean"`
+	Signature string `json:"signature,omitempty"` // 命中的病毒特徵名稱
+}
+
+// Scanner 惡意軟件掃描器，外部掃描服務實現此介面後可透過 NewUploadMiddlewareWithScanner 接入
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (ScanResult, error)
+}
+
+// NewScanner 依配置創建掃描器，未配置時返回 nil
+func NewScanner(cfg config.UploadScannerConfig) Scanner {
+	switch cfg.Type {
+	case config.UploadScannerClamd:
+		return NewClamdScanner(cfg.Address, cfg.Timeout)
+	case config.UploadScannerStub:
+		return StubScanner{}
+	}
+	return nil
+}
+
+// ClamdScanner 以 clamd 的 INSTREAM 協議掃描
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner 創建 clamd 掃描器，地址為 host:port、tcp://host:port 或 unix:/path/to/clamd.sock
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		network = "unix"
+		address = strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//")
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	}
+	return &ClamdScanner{network: network, address: address, timeout: timeout}
+}
+
+// Scan 以 zINSTREAM 命令發送內容：每個數據塊前為 4 字節大端序長度，長度為 0 的數據塊表示結束
+// clamd 回覆 "stream: OK" 表示未發現威脅，"stream: <特徵> FOUND" 表示命中
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return ScanResult{}, fmt.Errorf("connect clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, fmt.Errorf("send clamd command: %w", err)
+	}
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				return ScanResult{}, fmt.Errorf("send clamd stream: %w", err)
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return ScanResult{}, readErr
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return ScanResult{}, fmt.Errorf("send clamd stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return ScanResult{}, fmt.Errorf("read clamd reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply 解析 clamd 的掃描回覆
+func parseClamdReply(reply string) (ScanResult, error) {
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case reply == "OK":
+		return ScanResult{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return ScanResult{Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return ScanResult{}, fmt.Errorf("clamd error: %s", reply)
+}
+
+// StubScanner 本地掃描器替身，只識別 EICAR 測試文件，未部署 clamd 時用於驗證掃描流程
+type StubScanner struct{}
+
+// Scan 檢查內容是否包含 EICAR 測試特徵
+func (StubScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	signature := []byte(eicarSignature)
+	overlap := len(signature) - 1
+	buffer := make([]byte, 0, clamdChunkSize+overlap)
+	chunk := make([]byte, clamdChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return ScanResult{}, err
+		}
+		n, err := r.Read(chunk)
+		buffer = append(buffer, chunk[:n]...)
+		if bytes.Contains(buffer, signature) {
+			return ScanResult{Signature: "Eicar-Signature"}, nil
+		}
+		if len(buffer) > overlap {
+			buffer = append(buffer[:0], buffer[len(buffer)-overlap:]...)
+		}
+		if errors.Is(err, io.EOF) {
+			return ScanResult{Clean: true}, nil
+		}
+		if err != nil {
+			return ScanResult{}, err
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/middleware/bodylimit"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// eventCategory 上傳拒絕在安全事件指標中的類別
+const eventCategory = "upload"
+
+// File 通過檢查的上傳文件
+type File struct {
+	Field    string `json:"field,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+}
+
+// rejection 上傳被拒絕的原因
+type rejection struct {
+	status  int
+	code    string
+	message string
+}
+
+// Error 返回拒絕原因
+func (r *rejection) Error() string {
+	return r.message
+}
+
+// reject 創建拒絕原因
+func reject(status int, code, format string, args ...interface{}) error {
+	return &rejection{status: status, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// UploadMiddleware 上傳文件檢查中間件
+type UploadMiddleware struct {
+	config  *config.Config
+	logger  *zap.Logger
+	monitor *monitor.Monitor
+	scanner Scanner
+}
+
+// NewUploadMiddleware 創建新的上傳檢查中間件，依 security.upload.scanner 創建掃描器
+func NewUploadMiddleware(cfg *config.Config, logger *zap.Logger, monitorService *monitor.Monitor) *UploadMiddleware {
+	return NewUploadMiddlewareWithScanner(cfg, logger, monitorService, NewScanner(cfg.Security.Upload.Scanner))
+}
+
+// NewUploadMiddlewareWithScanner 使用指定掃描器創建上傳檢查中間件，scanner 為 nil 時要求掃描的路由依 fail_mode 處理
+func NewUploadMiddlewareWithScanner(cfg *config.Config, logger *zap.Logger, monitorService *monitor.Monitor, scanner Scanner) *UploadMiddleware {
+	return &UploadMiddleware{
+		config:  cfg,
+		logger:  logger,
+		monitor: monitorService,
+		scanner: scanner,
+	}
+}
+
+// Enforce 路由級別的上傳策略中間件
+// multipart/form-data 請求逐個檢查帶文件名的部分，文本字段原樣保留；其他請求體視為單個文件
+// 通過檢查後以清理過的文件名與檢測到的類型重建請求體轉發，任一文件不符合策略時拒絕整個請求
+func (m *UploadMiddleware) Enforce(name string, policy *config.UploadPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy == nil || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		var body *buffer
+		var files []File
+		var err error
+		mediaType, params, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if mediaType == "multipart/form-data" && params["boundary"] != "" {
+			body, files, err = m.rewriteMultipart(c.Request.Context(), c.Request.Body, params["boundary"], policy)
+		} else {
+			var file File
+			body, file, err = m.inspect(c.Request.Context(), c.Request.Body, c.GetHeader("Content-Type"), policy)
+			files = []File{file}
+		}
+		if err != nil {
+			m.rejectUpload(c, name, err)
+			return
+		}
+		defer body.Close()
+
+		c.Request.Body = &bufferBody{Reader: body.reader(), buffer: body}
+		c.Request.ContentLength = body.Size()
+		c.Request.TransferEncoding = nil
+		c.Request.Header.Set("Content-Length", strconv.FormatInt(body.Size(), 10))
+
+		m.logger.Debug("Upload accepted",
+			zap.String("route", name),
+			zap.Any("files", files))
+
+		c.Next()
+	}
+}
+
+// rewriteMultipart 逐個檢查文件部分，以相同的分隔符寫出新的請求體
+func (m *UploadMiddleware) rewriteMultipart(ctx context.Context, r io.Reader, boundary string, policy *config.UploadPolicy) (*buffer, []File, error) {
+	body := newBuffer(m.memoryLimit())
+	writer := multipart.NewWriter(body)
+	if err := writer.SetBoundary(boundary); err != nil {
+		body.Close()
+		return nil, nil, reject(http.StatusBadRequest, "INVALID_UPLOAD", "Invalid multipart boundary")
+	}
+
+	files, err := m.copyParts(ctx, multipart.NewReader(r, boundary), body, writer, policy)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil && body.err != nil {
+		err = body.err
+	}
+	if err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	return body, files, nil
+}
+
+// copyParts 將各部分寫入新的請求體，文件部分檢查後以清理過的文件名與檢測到的類型寫入
+func (m *UploadMiddleware) copyParts(ctx context.Context, reader *multipart.Reader, body *buffer, writer *multipart.Writer, policy *config.UploadPolicy) ([]File, error) {
+	var files []File
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, malformed(body, err)
+		}
+
+		if part.FileName() == "" {
+			w, err := writer.CreatePart(part.Header)
+			if err == nil {
+				_, err = io.Copy(w, part)
+			}
+			if err != nil {
+				return nil, malformed(body, err)
+			}
+			continue
+		}
+
+		if policy.MaxFiles > 0 && len(files) >= policy.MaxFiles {
+			return nil, reject(http.StatusRequestEntityTooLarge, "UPLOAD_TOO_MANY_FILES", "At most %d files are allowed", policy.MaxFiles)
+		}
+		content, file, err := m.inspect(ctx, part, part.Header.Get("Content-Type"), policy)
+		if err != nil {
+			return nil, err
+		}
+		file.Field = part.FormName()
+		file.Filename = replaceExtension(SanitizeFilename(part.FileName()), typeExtensions[file.Type])
+
+		header := make(map[string][]string, len(part.Header))
+		for key, values := range part.Header {
+			header[key] = values
+		}
+		header["Content-Disposition"] = []string{mime.FormatMediaType("form-data", map[string]string{
+			"name":     file.Field,
+			"filename": file.Filename,
+		})}
+		header["Content-Type"] = []string{file.Type}
+
+		w, err := writer.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(w, content.reader())
+		}
+		content.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+}
+
+// inspect 暫存單個文件並依策略檢查大小、類型、內容、圖片尺寸與掃描結果
+func (m *UploadMiddleware) inspect(ctx context.Context, r io.Reader, declared string, policy *config.UploadPolicy) (*buffer, File, error) {
+	content := newBuffer(m.memoryLimit())
+	if policy.MaxFileSize > 0 {
+		r = io.LimitReader(r, policy.MaxFileSize+1)
+	}
+	if _, err := io.Copy(content, r); err != nil {
+		content.Close()
+		return nil, File{}, malformed(content, err)
+	}
+
+	file, err := m.check(ctx, content, declared, policy)
+	if err != nil {
+		content.Close()
+		return nil, File{}, err
+	}
+	return content, file, nil
+}
+
+// check 檢查已暫存的文件
+func (m *UploadMiddleware) check(ctx context.Context, content *buffer, declared string, policy *config.UploadPolicy) (File, error) {
+	file := File{Size: content.Size()}
+	if policy.MaxFileSize > 0 && file.Size > policy.MaxFileSize {
+		return file, reject(http.StatusRequestEntityTooLarge, "UPLOAD_FILE_TOO_LARGE", "File exceeds the maximum size of %d bytes", policy.MaxFileSize)
+	}
+
+	head := make([]byte, sniffLength)
+	n, _ := io.ReadFull(content.reader(), head)
+	head = head[:n]
+
+	detected := detectType(head)
+	fileType, mismatch := resolveType(declared, detected)
+	file.Type = fileType
+	if !typeAllowed(policy.AllowedTypes, fileType) {
+		return file, reject(http.StatusUnsupportedMediaType, "UPLOAD_TYPE_NOT_ALLOWED", "File type %s is not allowed", fileType)
+	}
+	if mismatch {
+		return file, reject(http.StatusUnsupportedMediaType, "UPLOAD_TYPE_MISMATCH", "Declared type %s does not match file content %s", normalizeType(declared), fileType)
+	}
+
+	finding, err := unsafeContent(content.reader(), fileType, file.Size)
+	if err != nil {
+		return file, err
+	}
+	if finding != "" {
+		return file, reject(http.StatusUnprocessableEntity, "UPLOAD_UNSAFE_CONTENT", "File contains unsafe content: %s", finding)
+	}
+
+	if policy.MaxImageWidth > 0 || policy.MaxImageHeight > 0 {
+		width, height, supported, err := imageDimensions(content.reader(), fileType, head)
+		if supported && err != nil {
+			return file, reject(http.StatusUnprocessableEntity, "UPLOAD_INVALID_IMAGE", "Image header cannot be decoded")
+		}
+		if (policy.MaxImageWidth > 0 && width > policy.MaxImageWidth) || (policy.MaxImageHeight > 0 && height > policy.MaxImageHeight) {
+			return file, reject(http.StatusUnprocessableEntity, "UPLOAD_IMAGE_TOO_LARGE", "Image dimensions %dx%d exceed the limit", width, height)
+		}
+	}
+
+	if policy.Scan {
+		if err := m.scan(ctx, content); err != nil {
+			return file, err
+		}
+	}
+	return file, nil
+}
+
+// scan 交由掃描器檢查文件，掃描器不可用時依 fail_mode 決定是否放行
+func (m *UploadMiddleware) scan(ctx context.Context, content *buffer) error {
+	var result ScanResult
+	err := errors.New("scanner not configured")
+	if m.scanner != nil {
+		result, err = m.scanner.Scan(ctx, content.reader())
+	}
+	if err != nil {
+		if m.config.Security.Upload.Scanner.FailMode == "open" {
+			m.logger.Warn("Upload scan failed, allowing file", zap.Error(err))
+			return nil
+		}
+		m.logger.Error("Upload scan failed", zap.Error(err))
+		return reject(http.StatusServiceUnavailable, "UPLOAD_SCAN_UNAVAILABLE", "Malware scan is unavailable")
+	}
+	if !result.Clean {
+		return reject(http.StatusUnprocessableEntity, "UPLOAD_MALWARE_DETECTED", "Malware detected: %s", result.Signature)
+	}
+	return nil
+}
+
+// malformed 讀取請求體失敗時，區分暫存區寫入錯誤、超過大小上限與格式錯誤的請求體
+func malformed(body *buffer, err error) error {
+	if body.err != nil {
+		return body.err
+	}
+	if limit, exceeded := bodylimit.ExceededLimit(err); exceeded {
+		return reject(http.StatusRequestEntityTooLarge, string(domain.ErrCodePayloadTooLarge), "Request body exceeds the limit of %d bytes", limit)
+	}
+	return reject(http.StatusBadRequest, "INVALID_UPLOAD", "Malformed multipart body")
+}
+
+// memoryLimit 返回暫存的記憶體上限
+func (m *UploadMiddleware) memoryLimit() int64 {
+	if m.config.Security.Upload.MemoryLimit > 0 {
+		return m.config.Security.Upload.MemoryLimit
+	}
+	return 1 << 20
+}
+
+// rejectUpload 記錄並拒絕上傳
+func (m *UploadMiddleware) rejectUpload(c *gin.Context, name string, err error) {
+	var rejected *rejection
+	if !errors.As(err, &rejected) {
+		m.logger.Error("Failed to process upload", zap.String("route", name), zap.Error(err))
+		rejected = &rejection{status: http.StatusInternalServerError, code: "UPLOAD_FAILED", message: "Failed to process upload"}
+	} else {
+		m.logger.Warn("Upload rejected",
+			zap.String("route", name),
+			zap.String("ip", clientip.FromContext(c)),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("code", rejected.code),
+			zap.String("reason", rejected.message))
+		if m.monitor != nil {
+			m.monitor.RecordSecurityEvent(eventCategory, false, []string{rejected.code})
+		}
+	}
+
+	c.JSON(rejected.status, gin.H{
+		"status":  "error",
+		"message": rejected.message,
+		"code":    rejected.code,
+	})
+	c.Abort()
+}
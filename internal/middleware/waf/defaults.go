@@ -0,0 +1,60 @@
+package waf
+
+// defaultTargets 內建規則檢查的目標
+var defaultTargets = []string{TargetQuery, TargetBody, TargetPath, "header:User-Agent", "header:Referer"}
+
+// decodeTransforms 內建規則匹配前的標準化
+var decodeTransforms = []string{TransformNormalize}
+
+// builtinRules 內建規則，由原 XSS 與 SQL 注入中間件的檢測模式遷移而來
+// 容易誤判的模式（如單獨出現的 and/or/not）移至較高的偏執等級
+func builtinRules() []Rule {
+	xss := []string{CategoryXSS}
+	sqli := []string{CategorySQLi}
+
+	return []Rule{
+		// XSS
+		{ID: "941100", Description: "Script tag", Pattern: `(?i)<script`, Severity: SeverityCritical, Tags: xss},
+		{ID: "941110", Description: "Event handler attribute in tag", Pattern: `(?i)<[^>]*\bon[a-z]+\s*=`, Severity: SeverityCritical, Tags: xss},
+		{ID: "941120", Description: "JavaScript or VBScript URI", Pattern: `(?i)(?:java|vb)script\s*:`, Severity: SeverityCritical, Tags: xss},
+		{ID: "941130", Description: "Embedding tag", Pattern: `(?i)<(?:iframe|object|embed|form)\b`, Severity: SeverityCritical, Tags: xss},
+		{ID: "941140", Description: "CSS expression", Pattern: `(?i)expression\s*\(`, Severity: SeverityCritical, Tags: xss},
+		{ID: "941150", Description: "Executable data URI", Pattern: `(?i)\bdata:\s*(?:text/html|image/svg\+xml|[a-z]+/[a-z+-]*script)`, Severity: SeverityCritical, Tags: xss},
+		{ID: "941160", Description: "Double encoded script tag", Pattern: `(?i)%(?:25)+3c\s*script`, Severity: SeverityCritical, Tags: xss, Transforms: []string{}},
+		{ID: "941170", Description: "Event handler attribute", Pattern: `(?i)\bon[a-z]+\s*=`, Severity: SeverityWarning, ParanoiaLevel: 2, Tags: xss},
+		{ID: "941180", Description: "Data URI", Pattern: `(?i)\bdata:\s*[a-z]+/`, Severity: SeverityWarning, ParanoiaLevel: 2, Tags: xss},
+
+		// SQL 注入
+		{ID: "942100", Description: "UNION SELECT", Pattern: `(?i)\bunion\s+(?:all\s+)?select\b|\bselect\s+union\b`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942110", Description: "Schema modification", Pattern: `(?i)\b(?:drop|create|alter|truncate)\s+table\b|\bbackup\s+database\b`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942111", Description: "Data modification statement", Pattern: "(?i)\\binsert\\s+into\\b|\\bdelete\\s+from\\b|\\bupdate\\s+[\\w.`\"\\[\\]]+\\s+set\\s+\\w+\\s*=", Severity: SeverityError, Tags: sqli},
+		{ID: "942120", Description: "SQL comment sequence", Pattern: `--(?:\s|$)|/\*|\*/|['"]\s*#`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942130", Description: "Boolean tautology", Pattern: `(?i)\b(?:or|and)\b\s+['"]?\w+['"]?\s*(?:=|<>|!=|<|>|\blike\b)\s*['"]?\w+`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942140", Description: "Dangerous SQL function", Pattern: `(?i)\b(?:exec|execute|sp_executesql|xp_cmdshell|load_file)\s*\(|\binto\s+(?:outfile|dumpfile)\b`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942150", Description: "Time-based blind injection", Pattern: `(?i)\b(?:sleep|benchmark)\s*\(|\bwaitfor\s+delay\b`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942160", Description: "Stacked query", Pattern: `(?i);\s*(?:select|insert|update|delete|drop)\b`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942170", Description: "Hex encoded literal", Pattern: `(?i)\b0x[0-9a-f]{4,}\b`, Severity: SeverityCritical, Tags: sqli},
+		{ID: "942180", Description: "SELECT ... FROM", Pattern: `(?i)\bselect\b[\s\S]+?\bfrom\b`, Severity: SeverityError, Tags: sqli},
+		{ID: "942190", Description: "Encoded quote or terminator", Pattern: `(?i)%(?:25)*(?:27|22|3b)|%(?:25)*2d%(?:25)*2d`, Severity: SeverityWarning, Tags: sqli, Transforms: []string{}},
+		{ID: "942200", Description: "Trailing statement terminator", Pattern: `;\s*$`, Severity: SeverityNotice, ParanoiaLevel: 2, Tags: sqli},
+		{ID: "942210", Description: "Hash comment", Pattern: `#`, Severity: SeverityNotice, ParanoiaLevel: 3, Tags: sqli},
+		{ID: "942220", Description: "Boolean operator", Pattern: `(?i)\b(?:or|and|not)\b`, Severity: SeverityNotice, ParanoiaLevel: 4, Tags: sqli},
+	}
+}
+
+// DefaultRules 返回內建規則，未設置目標與轉換的規則使用共同設定
+func DefaultRules() []Rule {
+	rules := builtinRules()
+	for i := range rules {
+		if len(rules[i].Targets) == 0 {
+			rules[i].Targets = defaultTargets
+		}
+		if rules[i].Transforms == nil {
+			rules[i].Transforms = decodeTransforms
+		}
+		if rules[i].Operator == "" {
+			rules[i].Operator = OperatorRegex
+		}
+	}
+	return rules
+}
@@ -0,0 +1,398 @@
+package waf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// 默認評分參數
+const (
+	defaultParanoiaLevel    = 1
+	defaultAnomalyThreshold = 5
+)
+
+// excludeTagPrefix 以標籤排除規則的前綴
+const excludeTagPrefix = "tag:"
+
+// Input 待檢查的請求值
+type Input struct {
+	Target string // query, header, body, path
+	Name   string // 參數名、請求頭名或字段名，path 為空
+	Value  string
+}
+
+// Match 命中的規則
+type Match struct {
+	RuleID   string `json:"rule_id"`
+	Target   string `json:"target"`
+	Name     string `json:"name,omitempty"`
+	Severity string `json:"severity"`
+	Score    int    `json:"score"`
+}
+
+// Result 評分結果
+type Result struct {
+	Score   int
+	Matches []Match
+	Blocked bool
+}
+
+// RuleIDs 返回命中的規則 ID
+func (r Result) RuleIDs() []string {
+	ids := make([]string, 0, len(r.Matches))
+	for _, match := range r.Matches {
+		ids = append(ids, match.RuleID)
+	}
+	return ids
+}
+
+// Engine WAF 規則引擎，以異常分數判斷請求是否攔截，支援規則文件熱重載
+type Engine struct {
+	config   config.WAFConfig
+	logger   *zap.Logger
+	rules    []*compiledRule
+	routes   map[string]*routePolicy
+	global   *routePolicy
+	modTime  time.Time
+	mutex    sync.RWMutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEngine 創建規則引擎並載入內建規則與規則文件，規則文件無效時返回錯誤
+func NewEngine(cfg config.WAFConfig, logger *zap.Logger) (*Engine, error) {
+	engine := NewDefaultEngine(cfg, logger)
+	if cfg.RulesFile == "" {
+		return engine, nil
+	}
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// NewDefaultEngine 創建只使用內建規則的規則引擎
+func NewDefaultEngine(cfg config.WAFConfig, logger *zap.Logger) *Engine {
+	engine := &Engine{
+		config: cfg,
+		logger: logger,
+		routes: make(map[string]*routePolicy),
+		stopCh: make(chan struct{}),
+	}
+	rules, err := compileRules(DefaultRules(), nil)
+	if err != nil {
+		// 內建規則由測試保證有效
+		panic(err)
+	}
+	engine.rules = rules
+	return engine
+}
+
+// Reload 重新載入規則文件，失敗時保留原有規則
+func (e *Engine) Reload() error {
+	if e.config.RulesFile == "" {
+		return nil
+	}
+
+	info, err := os.Stat(e.config.RulesFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat waf rules file: %w", err)
+	}
+	data, err := os.ReadFile(e.config.RulesFile)
+	if err != nil {
+		return fmt.Errorf("failed to read waf rules file: %w", err)
+	}
+
+	var file RuleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse waf rules file: %w", err)
+	}
+
+	base := DefaultRules()
+	if file.ExcludeDefaults {
+		base = nil
+	}
+	rules, err := compileRules(base, file.Rules)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.rules = rules
+	e.modTime = info.ModTime()
+	return nil
+}
+
+// Start 啟動規則文件熱重載
+func (e *Engine) Start() {
+	if e.config.RulesFile == "" || e.config.ReloadInterval <= 0 {
+		return
+	}
+	go e.watchLoop()
+}
+
+// Stop 停止規則文件熱重載
+func (e *Engine) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+	})
+}
+
+// watchLoop 定期檢查規則文件是否變更
+func (e *Engine) watchLoop() {
+	ticker := time.NewTicker(e.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.reloadChanged()
+		case <-e.stopCh:
+			return
+		}
+	}
+}
+
+// reloadChanged 規則文件修改時間變更時重載
+func (e *Engine) reloadChanged() {
+	info, err := os.Stat(e.config.RulesFile)
+	if err != nil {
+		return
+	}
+	e.mutex.RLock()
+	changed := info.ModTime().After(e.modTime)
+	e.mutex.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := e.Reload(); err != nil {
+		e.logger.Error("Failed to reload WAF rules, keeping previous rules",
+			zap.String("rules_file", e.config.RulesFile),
+			zap.Error(err))
+		return
+	}
+	e.logger.Info("WAF rules reloaded",
+		zap.String("rules_file", e.config.RulesFile),
+		zap.Int("rules", len(e.Rules())))
+}
+
+// Rules 返回目前載入的規則
+func (e *Engine) Rules() []Rule {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	rules := make([]Rule, 0, len(e.rules))
+	for _, rule := range e.rules {
+		rules = append(rules, rule.Rule)
+	}
+	return rules
+}
+
+// SetRoutePolicy 設置路由的安全檢查設定，pattern 為 gin 的完整路由模式
+func (e *Engine) SetRoutePolicy(pattern string, policy config.RouteSecurityConfig) {
+	compiled := newRoutePolicy(policy)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.routes[pattern] = compiled
+}
+
+// SetGlobalPolicy 設置全局安全檢查設定，作用於未註冊設定的路由
+func (e *Engine) SetGlobalPolicy(policy *config.RouteSecurityConfig) {
+	var compiled *routePolicy
+	if policy != nil {
+		compiled = newRoutePolicy(*policy)
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.global = compiled
+}
+
+// policy 返回路由的安全檢查設定，未註冊時使用全局設定
+func (e *Engine) policy(route string) *routePolicy {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if policy, exists := e.routes[route]; exists {
+		return policy
+	}
+	if e.global != nil {
+		return e.global
+	}
+	return emptyPolicy
+}
+
+// Mode 返回路由對 category 檢測的模式，依序取檢測設定、路由共同設定與 base，無效值視為 block
+func (e *Engine) Mode(category, route, base string) string {
+	mode := base
+	policy := e.policy(route)
+	if policy.config.Mode != "" {
+		mode = policy.config.Mode
+	}
+	if detector := detectorPolicy(policy.config, category); detector != nil && detector.Mode != "" {
+		mode = detector.Mode
+	}
+	if !config.IsValidSecurityMode(mode) {
+		return config.SecurityModeBlock
+	}
+	return mode
+}
+
+// Threshold 返回攔截閾值
+func (e *Engine) Threshold() int {
+	if e.config.AnomalyThreshold > 0 {
+		return e.config.AnomalyThreshold
+	}
+	return defaultAnomalyThreshold
+}
+
+// Evaluate 以 category 標籤的規則檢查輸入並累計異常分數，route 為 gin 的完整路由模式
+// 路由排除的規則與豁免的字段不參與評分，每條規則只計分一次
+func (e *Engine) Evaluate(category, route string, inputs []Input) Result {
+	paranoia := e.config.ParanoiaLevel
+	if paranoia <= 0 {
+		paranoia = defaultParanoiaLevel
+	}
+
+	e.mutex.RLock()
+	rules := e.rules
+	e.mutex.RUnlock()
+
+	policy := e.policy(route)
+	if exempt := policy.exempt[category]; len(exempt) > 0 {
+		inputs = withoutExempt(inputs, exempt)
+	}
+
+	var result Result
+	for _, rule := range rules {
+		if rule.ParanoiaLevel > paranoia || !rule.hasTag(category) {
+			continue
+		}
+		if isExcluded(rule, policy.config.ExcludeRules) {
+			continue
+		}
+		for _, input := range inputs {
+			if !rule.appliesTo(input) || !rule.matches(input.Value) {
+				continue
+			}
+			result.Score += rule.score
+			result.Matches = append(result.Matches, Match{
+				RuleID:   rule.ID,
+				Target:   input.Target,
+				Name:     input.Name,
+				Severity: rule.Severity,
+				Score:    rule.score,
+			})
+			break
+		}
+	}
+	result.Blocked = result.Score >= e.Threshold()
+	return result
+}
+
+// compileRules 編譯內建規則與自定義規則，自定義規則以相同 ID 覆寫或停用內建規則
+func compileRules(base, custom []Rule) ([]*compiledRule, error) {
+	order := make([]string, 0, len(base)+len(custom))
+	byID := make(map[string]Rule, len(base)+len(custom))
+	for _, rule := range base {
+		order = append(order, rule.ID)
+		byID[rule.ID] = rule
+	}
+
+	seen := make(map[string]bool, len(custom))
+	for _, rule := range custom {
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("duplicate waf rule id: %s", rule.ID)
+		}
+		seen[rule.ID] = true
+		if _, exists := byID[rule.ID]; !exists {
+			order = append(order, rule.ID)
+		}
+		byID[rule.ID] = rule
+	}
+
+	rules := make([]*compiledRule, 0, len(order))
+	for _, id := range order {
+		rule := byID[id]
+		if rule.Disabled {
+			continue
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, compiled)
+	}
+	return rules, nil
+}
+
+// isExcluded 檢查規則是否被排除
+func isExcluded(rule *compiledRule, exclusions []string) bool {
+	for _, exclusion := range exclusions {
+		if tag, ok := strings.CutPrefix(exclusion, excludeTagPrefix); ok {
+			if rule.hasTag(tag) {
+				return true
+			}
+		} else if exclusion == rule.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// routePolicy 編譯後的路由安全檢查設定
+type routePolicy struct {
+	config config.RouteSecurityConfig
+	exempt map[string][]fieldMatcher // 依檢測類別合併共同與檢測設定的豁免字段
+}
+
+// emptyPolicy 未設置安全檢查設定的路由
+var emptyPolicy = &routePolicy{}
+
+// newRoutePolicy 編譯路由安全檢查設定
+func newRoutePolicy(policy config.RouteSecurityConfig) *routePolicy {
+	compiled := &routePolicy{config: policy, exempt: make(map[string][]fieldMatcher)}
+	for _, category := range []string{CategoryXSS, CategorySQLi} {
+		fields := policy.ExemptFields
+		if detector := detectorPolicy(policy, category); detector != nil {
+			fields = append(append([]string{}, fields...), detector.ExemptFields...)
+		}
+		if len(fields) > 0 {
+			compiled.exempt[category] = newFieldMatchers(fields)
+		}
+	}
+	return compiled
+}
+
+// detectorPolicy 返回 category 對應的檢測設定
+func detectorPolicy(policy config.RouteSecurityConfig, category string) *config.DetectorSecurityConfig {
+	switch category {
+	case CategoryXSS:
+		return policy.XSS
+	case CategorySQLi:
+		return policy.SQLInjection
+	default:
+		return nil
+	}
+}
+
+// withoutExempt 移除豁免字段的查詢參數與請求體輸入
+func withoutExempt(inputs []Input, exempt []fieldMatcher) []Input {
+	filtered := make([]Input, 0, len(inputs))
+	for _, input := range inputs {
+		if (input.Target == TargetQuery || input.Target == TargetBody) && matchAny(exempt, input.Name) {
+			continue
+		}
+		filtered = append(filtered, input)
+	}
+	return filtered
+}
@@ -0,0 +1,320 @@
+package waf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"expense-api-gateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上下文鍵
+const (
+	inputsContextKey  = "waf_inputs"  // 請求輸入，供 XSS 與 SQL 注入中間件共用
+	spoolContextKey   = "waf_spool"   // 多部分表單的請求體暫存區
+	limitedContextKey = "waf_limited" // 多部分表單超過檢查限制，無法完整檢查
+)
+
+// InspectionLimitRuleID 請求超過檢查限制時記錄的規則 ID
+const InspectionLimitRuleID = "inspection-limit"
+
+// JSONKeySuffix JSON 對象鍵名輸入的名稱後綴，如 payee.name#key
+const JSONKeySuffix = "#key"
+
+// 多部分表單檢查的默認限制
+const (
+	defaultMaxFieldSize = 64 << 10
+	defaultMaxFields    = 100
+	defaultMemoryLimit  = 1 << 20
+)
+
+// RequestInputs 收集請求中待檢查的值，包括查詢參數、路徑、請求頭與請求體
+// 請求體讀取後會恢復，結果緩存在上下文中；多部分表單使用暫存區，請求結束時需調用 Release
+func (e *Engine) RequestInputs(c *gin.Context) []Input {
+	if cached, exists := c.Get(inputsContextKey); exists {
+		if inputs, ok := cached.([]Input); ok {
+			return inputs
+		}
+	}
+
+	var inputs []Input
+	for key, values := range c.Request.URL.Query() {
+		for _, value := range values {
+			inputs = append(inputs, Input{Target: TargetQuery, Name: key, Value: value})
+		}
+	}
+	inputs = append(inputs, Input{Target: TargetPath, Value: c.Request.URL.Path})
+	for key, values := range c.Request.Header {
+		for _, value := range values {
+			inputs = append(inputs, Input{Target: TargetHeader, Name: key, Value: value})
+		}
+	}
+	inputs = append(inputs, e.bodyInputs(c)...)
+
+	c.Set(inputsContextKey, inputs)
+	return inputs
+}
+
+// EvaluateRequest 以 category 標籤的規則評分請求輸入
+// 多部分表單超過字段數或字段大小限制時無法完整檢查，視為命中攔截
+func (e *Engine) EvaluateRequest(c *gin.Context, category string) Result {
+	result := e.Evaluate(category, c.FullPath(), e.RequestInputs(c))
+	if c.GetBool(limitedContextKey) {
+		score := severityScores[SeverityCritical]
+		if threshold := e.Threshold(); score < threshold {
+			score = threshold
+		}
+		result.Score += score
+		result.Matches = append(result.Matches, Match{
+			RuleID:   InspectionLimitRuleID,
+			Target:   TargetBody,
+			Severity: SeverityCritical,
+			Score:    score,
+		})
+		result.Blocked = true
+	}
+	return result
+}
+
+// Release 釋放請求體暫存區，可重複調用
+func Release(c *gin.Context) {
+	if value, exists := c.Get(spoolContextKey); exists {
+		if s, ok := value.(*spool); ok {
+			s.Close()
+		}
+	}
+}
+
+// bodyInputs 依 Content-Type 解析請求體中的值
+func (e *Engine) bodyInputs(c *gin.Context) []Input {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil {
+		return nil
+	}
+
+	var parse func([]byte) []Input
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		parse = jsonInputs
+	case mediaType == "application/x-www-form-urlencoded":
+		parse = formInputs
+	case mediaType == "multipart/form-data":
+		// 多部分表單可能包含大型文件，串流解析而不整個讀入記憶體
+		return e.multipartInputs(c, params["boundary"])
+	default:
+		return nil
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		// 讀取失敗（如超過請求體上限）時轉發同樣的錯誤，避免轉發不完整的內容
+		c.Request.Body = &failedBody{err: err, rest: c.Request.Body}
+		return nil
+	}
+	// 恢復請求體
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		return nil
+	}
+	return parse(body)
+}
+
+// maxJSONDepth JSON 請求體的最大嵌套深度，超過時整個請求體作為一個輸入
+const maxJSONDepth = 64
+
+// errJSONTooDeep JSON 嵌套過深
+var errJSONTooDeep = errors.New("json nesting too deep")
+
+// jsonInputs 以串流方式遍歷 JSON 請求體的每個字符串值，字段名為 JSON 路徑，如 items[0].description
+// 無法解析時將整個請求體作為一個輸入
+func jsonInputs(body []byte) []Input {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var inputs []Input
+	for {
+		err := walkJSON(decoder, "", 0, &inputs)
+		if errors.Is(err, io.EOF) {
+			return inputs
+		}
+		if err != nil {
+			return []Input{{Target: TargetBody, Value: string(body)}}
+		}
+	}
+}
+
+// walkJSON 讀取一個 JSON 值並收集其中的鍵名與標量值
+func walkJSON(decoder *json.Decoder, path string, depth int, inputs *[]Input) error {
+	if depth > maxJSONDepth {
+		return errJSONTooDeep
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := keyToken.(string)
+				name := joinJSONPath(path, key)
+				// 鍵名同樣由客戶端控制，需一併檢查
+				*inputs = append(*inputs, Input{Target: TargetBody, Name: name + JSONKeySuffix, Value: key})
+				if err := walkJSON(decoder, name, depth+1, inputs); err != nil {
+					return unexpectedEOF(err)
+				}
+			}
+		case '[':
+			for i := 0; decoder.More(); i++ {
+				if err := walkJSON(decoder, path+"["+strconv.Itoa(i)+"]", depth+1, inputs); err != nil {
+					return unexpectedEOF(err)
+				}
+			}
+		}
+		// 讀取結束符
+		if _, err := decoder.Token(); err != nil {
+			return unexpectedEOF(err)
+		}
+	case string:
+		*inputs = append(*inputs, Input{Target: TargetBody, Name: path, Value: value})
+	case json.Number:
+		*inputs = append(*inputs, Input{Target: TargetBody, Name: path, Value: value.String()})
+	case bool:
+		*inputs = append(*inputs, Input{Target: TargetBody, Name: path, Value: strconv.FormatBool(value)})
+	}
+	return nil
+}
+
+// joinJSONPath 連接 JSON 路徑
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// unexpectedEOF 值未結束時遇到的 EOF 視為格式錯誤
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// formInputs 解析表單請求體
+func formInputs(body []byte) []Input {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return []Input{{Target: TargetBody, Value: string(body)}}
+	}
+
+	var inputs []Input
+	for key, list := range values {
+		for _, value := range list {
+			inputs = append(inputs, Input{Target: TargetBody, Name: key, Value: value})
+		}
+	}
+	return inputs
+}
+
+// multipartInputs 串流解析多部分表單的字段，只跳過帶文件名的文件部分
+// 字段數或字段大小超過限制時標記請求無法完整檢查
+// 讀取的內容同時寫入暫存區，解析後以暫存區與未讀取的部分恢復請求體，轉發的內容與原請求體一致
+func (e *Engine) multipartInputs(c *gin.Context, boundary string) []Input {
+	if boundary == "" {
+		return nil
+	}
+	limits := e.multipartLimits()
+
+	original := c.Request.Body
+	buffer := newSpool(limits.MemoryLimit)
+	c.Set(spoolContextKey, buffer)
+	reader := multipart.NewReader(io.TeeReader(original, buffer), boundary)
+
+	var inputs []Input
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		if isFilePart(part) {
+			part.Close()
+			continue
+		}
+		if len(inputs) >= limits.MaxFields {
+			// 其餘字段不再解析，無法確認其內容
+			part.Close()
+			c.Set(limitedContextKey, true)
+			break
+		}
+		value, err := io.ReadAll(io.LimitReader(part, limits.MaxFieldSize+1))
+		part.Close()
+		if err != nil {
+			break
+		}
+		truncated := int64(len(value)) > limits.MaxFieldSize
+		if truncated {
+			value = value[:limits.MaxFieldSize]
+		}
+		inputs = append(inputs, Input{Target: TargetBody, Name: part.FormName(), Value: string(value)})
+		if truncated {
+			// 超過部分無法檢查，已讀取的部分仍參與評分
+			c.Set(limitedContextKey, true)
+			break
+		}
+	}
+
+	if buffer.err != nil {
+		c.Request.Body = &failedBody{err: buffer.err, rest: original}
+		return inputs
+	}
+	body, err := buffer.body(original)
+	if err != nil {
+		c.Request.Body = &failedBody{err: err, rest: original}
+		return inputs
+	}
+	c.Request.Body = body
+	return inputs
+}
+
+// multipartLimits 返回多部分表單檢查限制，未設置時使用默認值
+func (e *Engine) multipartLimits() config.MultipartInspectConfig {
+	limits := e.config.Multipart
+	if limits.MaxFieldSize <= 0 {
+		limits.MaxFieldSize = defaultMaxFieldSize
+	}
+	if limits.MaxFields <= 0 {
+		limits.MaxFields = defaultMaxFields
+	}
+	if limits.MemoryLimit <= 0 {
+		limits.MemoryLimit = defaultMemoryLimit
+	}
+	return limits
+}
+
+// isFilePart 檢查是否為文件部分
+// 上游表單解析器（如 Go 的 ReadForm）只以文件名區分文件，無文件名的部分不論 Content-Type 都作為字段值
+// 沒有字段名的部分會被上游忽略，同樣跳過
+func isFilePart(part *multipart.Part) bool {
+	return part.FileName() != "" || part.FormName() == ""
+}
@@ -0,0 +1,81 @@
+package waf
+
+import (
+	"regexp"
+	"strings"
+)
+
+// fieldMatcher 字段路徑匹配器，路徑格式為 items[0].description，可帶 $. 前綴
+// 不含通配符時匹配完整路徑、去除索引後的路徑或其後綴，如 notes、items.notes 都匹配 items[0].notes
+// 含通配符時 [*] 匹配任意索引，* 匹配單個字段名，如 items[*].notes、*.notes
+type fieldMatcher struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+// newFieldMatcher 創建字段路徑匹配器
+func newFieldMatcher(pattern string) fieldMatcher {
+	pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "$"), ".")
+	if !strings.Contains(pattern, "*") {
+		return fieldMatcher{pattern: pattern}
+	}
+
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\[\*\]`, `\[\d+\]`)
+	quoted = strings.ReplaceAll(quoted, `\*`, `[^.\[\]]+`)
+	return fieldMatcher{pattern: pattern, regex: regexp.MustCompile("^" + quoted + "$")}
+}
+
+// newFieldMatchers 創建多個字段路徑匹配器
+func newFieldMatchers(patterns []string) []fieldMatcher {
+	matchers := make([]fieldMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		matchers = append(matchers, newFieldMatcher(pattern))
+	}
+	return matchers
+}
+
+// match 檢查字段路徑是否匹配
+func (m fieldMatcher) match(name string) bool {
+	if name == "" {
+		return false
+	}
+	if m.regex != nil {
+		return m.regex.MatchString(name)
+	}
+	if name == m.pattern {
+		return true
+	}
+	stripped := stripIndexes(name)
+	return stripped == m.pattern || strings.HasSuffix(stripped, "."+m.pattern)
+}
+
+// matchAny 檢查字段路徑是否匹配任一匹配器
+func matchAny(matchers []fieldMatcher, name string) bool {
+	for _, matcher := range matchers {
+		if matcher.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripIndexes 移除字段路徑中的數組索引
+func stripIndexes(name string) string {
+	if !strings.Contains(name, "[") {
+		return name
+	}
+	var b strings.Builder
+	depth := 0
+	for _, r := range name {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
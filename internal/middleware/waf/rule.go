@@ -0,0 +1,225 @@
+package waf
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 規則檢查目標，可寫為 header:User-Agent、body:description 等形式限定名稱
+// query 與 body 的名稱為字段路徑，如 body:items[*].description、body:$.payee.name
+const (
+	TargetQuery  = "query"
+	TargetHeader = "header"
+	TargetBody   = "body"
+	TargetPath   = "path"
+)
+
+// 規則運算符
+const (
+	OperatorRegex       = "regex"
+	OperatorContains    = "contains"
+	OperatorEquals      = "equals"
+	OperatorStartsWith  = "starts_with"
+	OperatorEndsWith    = "ends_with"
+	OperatorPhraseMatch = "pm" // 匹配 patterns 中任一詞組，不分大小寫
+)
+
+// 匹配前的值轉換
+const (
+	TransformURLDecode          = "url_decode"
+	TransformHTMLEntityDecode   = "html_entity_decode"
+	TransformUnicodeDecode      = "unicode_decode"
+	TransformLowercase          = "lowercase"
+	TransformCompressWhitespace = "compress_whitespace"
+	TransformNormalize          = "normalize" // 多次解碼後轉小寫並壓縮空白
+)
+
+// 攻擊類別標籤，決定規則由哪個中間件評分
+const (
+	CategoryXSS  = "xss"
+	CategorySQLi = "sqli"
+)
+
+// 嚴重程度
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+	SeverityNotice   = "notice"
+)
+
+// severityScores 各嚴重程度的異常分數
+var severityScores = map[string]int{
+	SeverityCritical: 5,
+	SeverityError:    4,
+	SeverityWarning:  3,
+	SeverityNotice:   2,
+}
+
+// Rule 檢測規則
+type Rule struct {
+	ID            string   `yaml:"id" json:"id"`
+	Description   string   `yaml:"description" json:"description,omitempty"`
+	Targets       []string `yaml:"targets" json:"targets"`
+	Operator      string   `yaml:"operator" json:"operator"`
+	Pattern       string   `yaml:"pattern" json:"pattern,omitempty"`
+	Patterns      []string `yaml:"patterns" json:"patterns,omitempty"` // pm 運算符的詞組
+	Transforms    []string `yaml:"transforms" json:"transforms,omitempty"`
+	Severity      string   `yaml:"severity" json:"severity"`
+	ParanoiaLevel int      `yaml:"paranoia_level" json:"paranoia_level"`
+	Tags          []string `yaml:"tags" json:"tags"`
+	Disabled      bool     `yaml:"disabled" json:"disabled,omitempty"` // 停用同 ID 的內建規則
+}
+
+// RuleFile 規則文件結構
+type RuleFile struct {
+	ExcludeDefaults bool   `yaml:"exclude_defaults"` // 不載入內建規則
+	Rules           []Rule `yaml:"rules"`
+}
+
+// target 解析後的檢查目標
+type target struct {
+	kind  string
+	name  string
+	field fieldMatcher // query 與 body 的字段路徑
+}
+
+// compiledRule 編譯後的規則
+type compiledRule struct {
+	Rule
+	score   int
+	targets []target
+	regex   *regexp.Regexp
+	phrases []string
+}
+
+// compileRule 驗證並編譯規則
+func compileRule(rule Rule) (*compiledRule, error) {
+	if rule.ID == "" {
+		return nil, fmt.Errorf("rule id is required")
+	}
+	if rule.Severity == "" {
+		rule.Severity = SeverityCritical
+	}
+	score, ok := severityScores[rule.Severity]
+	if !ok {
+		return nil, fmt.Errorf("rule %s: invalid severity %q", rule.ID, rule.Severity)
+	}
+	if rule.ParanoiaLevel == 0 {
+		rule.ParanoiaLevel = 1
+	}
+	if rule.ParanoiaLevel < 1 || rule.ParanoiaLevel > 4 {
+		return nil, fmt.Errorf("rule %s: invalid paranoia_level %d", rule.ID, rule.ParanoiaLevel)
+	}
+	if len(rule.Targets) == 0 {
+		return nil, fmt.Errorf("rule %s: at least one target is required", rule.ID)
+	}
+	for _, transform := range rule.Transforms {
+		if _, ok := transforms[transform]; !ok {
+			return nil, fmt.Errorf("rule %s: unknown transform %q", rule.ID, transform)
+		}
+	}
+
+	compiled := &compiledRule{Rule: rule, score: score}
+	for _, value := range rule.Targets {
+		kind, name, _ := strings.Cut(value, ":")
+		t := target{kind: kind, name: name}
+		switch kind {
+		case TargetQuery, TargetBody:
+			t.field = newFieldMatcher(name)
+		case TargetPath:
+		case TargetHeader:
+			t.name = http.CanonicalHeaderKey(name)
+		default:
+			return nil, fmt.Errorf("rule %s: invalid target %q", rule.ID, value)
+		}
+		compiled.targets = append(compiled.targets, t)
+	}
+
+	switch rule.Operator {
+	case "", OperatorRegex:
+		compiled.Operator = OperatorRegex
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid pattern: %w", rule.ID, err)
+		}
+		compiled.regex = regex
+	case OperatorPhraseMatch:
+		if len(rule.Patterns) == 0 {
+			return nil, fmt.Errorf("rule %s: pm operator requires patterns", rule.ID)
+		}
+		for _, phrase := range rule.Patterns {
+			compiled.phrases = append(compiled.phrases, strings.ToLower(phrase))
+		}
+	case OperatorContains, OperatorEquals, OperatorStartsWith, OperatorEndsWith:
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("rule %s: pattern is required", rule.ID)
+		}
+	default:
+		return nil, fmt.Errorf("rule %s: unknown operator %q", rule.ID, rule.Operator)
+	}
+
+	return compiled, nil
+}
+
+// hasTag 檢查規則是否帶有標籤
+func (r *compiledRule) hasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo 檢查規則是否檢查此輸入
+func (r *compiledRule) appliesTo(input Input) bool {
+	for _, t := range r.targets {
+		if t.kind != input.Target {
+			continue
+		}
+		if t.name == "" {
+			return true
+		}
+		switch t.kind {
+		case TargetHeader:
+			if t.name == http.CanonicalHeaderKey(input.Name) {
+				return true
+			}
+		case TargetQuery, TargetBody:
+			if t.field.match(input.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches 對轉換後的值執行運算符
+func (r *compiledRule) matches(value string) bool {
+	value = applyTransforms(value, r.Transforms)
+	switch r.Operator {
+	case OperatorRegex:
+		return r.regex.MatchString(value)
+	case OperatorPhraseMatch:
+		lower := strings.ToLower(value)
+		for _, phrase := range r.phrases {
+			if strings.Contains(lower, phrase) {
+				return true
+			}
+		}
+		return false
+	case OperatorContains:
+		return strings.Contains(value, r.Pattern)
+	case OperatorEquals:
+		return value == r.Pattern
+	case OperatorStartsWith:
+		return strings.HasPrefix(value, r.Pattern)
+	case OperatorEndsWith:
+		return strings.HasSuffix(value, r.Pattern)
+	default:
+		return false
+	}
+}
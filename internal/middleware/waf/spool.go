@@ -0,0 +1,103 @@
+package waf
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// spool 暫存檢查時讀取的請求體，超過記憶體上限時寫入臨時文件
+type spool struct {
+	memoryLimit int64
+	buffer      bytes.Buffer
+	file        *os.File
+	err         error
+	closeOnce   sync.Once
+}
+
+// newSpool 創建暫存區
+func newSpool(memoryLimit int64) *spool {
+	return &spool{memoryLimit: memoryLimit}
+}
+
+// Write 寫入暫存區，臨時文件無法創建時繼續使用記憶體
+func (s *spool) Write(p []byte) (n int, err error) {
+	defer func() {
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+	}()
+
+	if s.file == nil && int64(s.buffer.Len()+len(p)) > s.memoryLimit {
+		if file, err := os.CreateTemp("", "waf-spool-*"); err == nil {
+			if _, err := file.Write(s.buffer.Bytes()); err != nil {
+				file.Close()
+				os.Remove(file.Name())
+				return 0, err
+			}
+			s.buffer.Reset()
+			s.file = file
+		}
+	}
+	if s.file != nil {
+		return s.file.Write(p)
+	}
+	return s.buffer.Write(p)
+}
+
+// body 以暫存的內容與原請求體未讀取的部分組成新的請求體
+func (s *spool) body(rest io.ReadCloser) (io.ReadCloser, error) {
+	var head io.Reader = &s.buffer
+	if s.file != nil {
+		if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		head = s.file
+	}
+	return &spooledBody{Reader: io.MultiReader(head, rest), spool: s, rest: rest}, nil
+}
+
+// Close 關閉並刪除臨時文件
+func (s *spool) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		if s.file != nil {
+			err = s.file.Close()
+			os.Remove(s.file.Name())
+		}
+	})
+	return err
+}
+
+// spooledBody 由暫存區恢復的請求體
+type spooledBody struct {
+	io.Reader
+	spool *spool
+	rest  io.ReadCloser
+}
+
+// Close 關閉原請求體並釋放暫存區
+func (b *spooledBody) Close() error {
+	err := b.rest.Close()
+	if spoolErr := b.spool.Close(); err == nil {
+		err = spoolErr
+	}
+	return err
+}
+
+// failedBody 暫存失敗時的請求體，讀取時返回錯誤，避免轉發不完整的內容
+type failedBody struct {
+	err  error
+	rest io.ReadCloser
+}
+
+// Read 返回暫存錯誤
+func (b *failedBody) Read([]byte) (int, error) {
+	return 0, b.err
+}
+
+// Close 關閉原請求體
+func (b *failedBody) Close() error {
+	return b.rest.Close()
+}
@@ -0,0 +1,139 @@
+package waf
+
+import (
+	"html"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxDecodePasses normalize 轉換重複解碼的最大次數，防止多重編碼繞過
+const maxDecodePasses = 4
+
+// transforms 可用的值轉換
+var transforms = map[string]func(string) string{
+	TransformURLDecode:          urlDecode,
+	TransformHTMLEntityDecode:   html.UnescapeString,
+	TransformUnicodeDecode:      unicodeDecode,
+	TransformLowercase:          strings.ToLower,
+	TransformCompressWhitespace: compressWhitespace,
+	TransformNormalize:          normalize,
+}
+
+// normalize 將值轉為標準形式：重複 URL、HTML 實體與 Unicode 轉義解碼直到不再變化，
+// 再移除空字符、轉為小寫並壓縮空白
+func normalize(value string) string {
+	for i := 0; i < maxDecodePasses; i++ {
+		decoded := unicodeDecode(html.UnescapeString(urlDecode(value)))
+		if decoded == value {
+			break
+		}
+		value = decoded
+	}
+	value = strings.ReplaceAll(value, "\x00", "")
+	return compressWhitespace(strings.ToLower(value))
+}
+
+// applyTransforms 依序套用轉換
+func applyTransforms(value string, names []string) string {
+	for _, name := range names {
+		if transform, ok := transforms[name]; ok {
+			value = transform(value)
+		}
+	}
+	return value
+}
+
+// urlDecode 寬鬆的 URL 解碼，無效的 % 序列保持原樣
+func urlDecode(value string) string {
+	if !strings.ContainsAny(value, "%+") {
+		return value
+	}
+
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '%' && i+2 < len(value) && isHex(value[i+1]) && isHex(value[i+2]):
+			b.WriteByte(unhex(value[i+1])<<4 | unhex(value[i+2]))
+			i += 2
+		case value[i] == '+':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// unicodeDecode 解碼 \uXXXX、%uXXXX 與 \xXX 轉義，代理對合併為單個字符
+func unicodeDecode(value string) string {
+	if !strings.ContainsAny(value, "\\%") {
+		return value
+	}
+
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if r, n := unicodeEscape(value, i); n > 0 {
+			if utf16.IsSurrogate(r) {
+				if low, m := unicodeEscape(value, i+n); m > 0 {
+					if pair := utf16.DecodeRune(r, low); pair != '\uFFFD' {
+						b.WriteRune(pair)
+						i += n + m - 1
+						continue
+					}
+				}
+			}
+			b.WriteRune(r)
+			i += n - 1
+			continue
+		}
+		if value[i] == '\\' && i+3 < len(value) && (value[i+1] == 'x' || value[i+1] == 'X') && isHex(value[i+2]) && isHex(value[i+3]) {
+			b.WriteByte(unhex(value[i+2])<<4 | unhex(value[i+3]))
+			i += 3
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// unicodeEscape 解析位置 i 的 \uXXXX 或 %uXXXX，返回字符與長度，不是轉義時長度為 0
+func unicodeEscape(value string, i int) (rune, int) {
+	if i+6 > len(value) {
+		return 0, 0
+	}
+	if (value[i] != '\\' && value[i] != '%') || (value[i+1] != 'u' && value[i+1] != 'U') {
+		return 0, 0
+	}
+	var r rune
+	for _, c := range []byte(value[i+2 : i+6]) {
+		if !isHex(c) {
+			return 0, 0
+		}
+		r = r<<4 | rune(unhex(c))
+	}
+	return r, 6
+}
+
+// compressWhitespace 將連續空白壓縮為單個空格
+func compressWhitespace(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// isHex 檢查是否為十六進制字符
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// unhex 十六進制字符轉數值
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -1,13 +1,30 @@
 package router
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
 	"expense-api-gateway/internal/config"
 	"expense-api-gateway/internal/handler"
+	"expense-api-gateway/internal/infrastructure/jwt"
+	"expense-api-gateway/internal/infrastructure/redact"
+	"expense-api-gateway/internal/middleware/admission"
 	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/bodylimit"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/middleware/concurrency"
 	"expense-api-gateway/internal/middleware/cors"
+	"expense-api-gateway/internal/middleware/headers"
+	"expense-api-gateway/internal/middleware/ipfilter"
 	"expense-api-gateway/internal/middleware/logging"
+	"expense-api-gateway/internal/middleware/loginguard"
+	"expense-api-gateway/internal/middleware/quota"
 	"expense-api-gateway/internal/middleware/ratelimit"
 	"expense-api-gateway/internal/middleware/security"
+	"expense-api-gateway/internal/middleware/upload"
+	"expense-api-gateway/internal/middleware/waf"
 	"expense-api-gateway/internal/service/discovery"
 	"expense-api-gateway/internal/service/monitor"
 	"expense-api-gateway/internal/service/proxy"
@@ -17,28 +34,56 @@ import (
 	"go.uber.org/zap"
 )
 
-// Setup 設置路由
+// Setup 設置路由，返回的函數在關機時停止中間件的背景任務
 func Setup(
 	cfg *config.Config,
 	logger *zap.Logger,
 	serviceDiscovery discovery.ServiceDiscovery,
 	monitorService *monitor.Monitor,
 	healthChecker *healthcheck.HealthChecker,
-) *gin.Engine {
+) (*gin.Engine, func()) {
 	// 創建 Gin 引擎
 
 	r := gin.New()
+	// 客戶端 IP 統一由 clientip 解析器依受信任代理配置判斷
+	_ = r.SetTrustedProxies(nil)
 
 	// 初始化中間件
-	jwtMiddleware := auth.NewJWTMiddleware(cfg, logger)
+	// 認證與代理登入共用同一個 JWT 服務
+	jwtService := jwt.NewJWTService(cfg, logger)
+	jwtMiddleware := auth.NewJWTMiddlewareWithService(cfg, logger, jwtService)
 	rateLimitMiddleware := ratelimit.NewRateLimitMiddleware(cfg, logger)
-	xssMiddleware := security.NewXSSMiddleware(cfg, logger)
-	sqlInjectionMiddleware := security.NewSQLInjectionMiddleware(cfg, logger)
+	wafEngine := newWAFEngine(cfg, logger)
+	xssMiddleware := security.NewXSSMiddlewareWithEngine(cfg, logger, wafEngine, monitorService)
+	sqlInjectionMiddleware := security.NewSQLInjectionMiddlewareWithEngine(cfg, logger, wafEngine, monitorService)
+	impersonationMiddleware := auth.NewImpersonationMiddleware(cfg, logger, jwtService)
+	csrfMiddleware := security.NewCSRFMiddleware(cfg, logger)
+	bodyLimitMiddleware := bodylimit.NewBodyLimitMiddleware(cfg, logger)
+	headersMiddleware := headers.NewHeadersMiddleware(cfg, logger)
+	corsMiddleware := cors.NewCORSMiddleware(cfg, logger)
+
+	// 關機時停止背景任務
+	var closers shutdown
+	closers.add(rateLimitMiddleware.Close)
+	closers.add(wafEngine.Stop)
+	closers.add(impersonationMiddleware.Close)
 
 	// 添加全局中間件
-	r.Use(logging.Middleware(logger, monitorService))
-	r.Use(cors.Middleware(cfg))
+	r.Use(clientip.Middleware(newClientIPResolver(cfg, logger)))
+	r.Use(impersonationMiddleware.StripHeaders())
+	r.Use(logging.Middleware(logger, monitorService, redact.New(&cfg.Redaction)))
+	r.Use(headersMiddleware.Global())
+	r.Use(bodyLimitMiddleware.Global())
+	r.Use(corsMiddleware.Global())
 	r.Use(gin.Recovery())
+	if cfg.TLS.Enabled {
+		r.Use(auth.NewClientCertMiddleware(cfg, logger).Authenticate())
+	}
+	if cfg.OIDC.Enabled {
+		sessionMiddleware := auth.NewSessionMiddleware(cfg, logger)
+		r.Use(sessionMiddleware.Authenticate())
+		setupOIDCRoutes(r, sessionMiddleware, csrfMiddleware)
+	}
 	r.Use(xssMiddleware.XSSProtection())
 	r.Use(sqlInjectionMiddleware.SQLInjectionProtection())
 
@@ -49,11 +94,15 @@ func Setup(
 	}
 
 	// 創建處理器
-	h := handler.New(cfg, logger, serviceDiscovery, monitorService)
+	h := handler.NewWithRateLimit(cfg, logger, serviceDiscovery, monitorService, nil, rateLimitMiddleware)
 
 	// 健康檢查路由
 	r.GET("/health", healthChecker.Handler())
 
+	// CSP 違規報告收集（報告內容包含被攔截的腳本片段，不經 WAF 檢測）
+	wafEngine.SetRoutePolicy(headers.ReportPath, config.RouteSecurityConfig{Mode: config.SecurityModeOff})
+	r.POST(headers.ReportPath, headersMiddleware.CSPReport())
+
 	// API 版本管理
 	v1 := r.Group("/api/v1")
 	{
@@ -77,6 +126,8 @@ func Setup(
 		// 通用代理路由（用於其他服務）
 		proxy := v1.Group("/proxy")
 		proxy.Use(jwtMiddleware.OptionalAuth()) // 可選認證
+		proxy.Use(impersonationMiddleware.Impersonate())
+		proxy.Use(csrfMiddleware.CSRFProtection())
 		{
 			proxy.Any("/*path", h.ProxyHandler)
 		}
@@ -85,13 +136,17 @@ func Setup(
 	// 管理端點
 	admin := r.Group("/admin")
 	admin.Use(jwtMiddleware.Authenticate())
+	admin.Use(impersonationMiddleware.Impersonate())
 	admin.Use(jwtMiddleware.RequireRoles("admin"))
+	admin.Use(csrfMiddleware.CSRFProtection())
 	{
 		admin.GET("/config", h.GetConfig)
 		admin.POST("/config/reload", h.ReloadConfig)
 		admin.GET("/routes", h.GetRoutes)
 		admin.POST("/maintenance", h.ToggleMaintenanceMode)
+		admin.POST("/impersonate", impersonationMiddleware.MintToken())
 		admin.GET("/rate-limit/stats", h.GetRateLimitStats)
+		admin.GET("/rate-limit/keys", h.GetRateLimitKey)
 		admin.POST("/rate-limit/reset", h.ResetRateLimit)
 	}
 
@@ -100,10 +155,11 @@ func Setup(
 		r.GET(cfg.Monitor.MetricsPath, h.GetPrometheusMetrics)
 	}
 
-	return r
+	return r, closers.close
 }
 
-// SetupWithProxy 設置路由（使用新的代理服務）
+// SetupWithProxy 設置路由（使用新的代理服務），返回的函數在關機時停止中間件的背景任務
+// 路由配置無效（如上游 TLS 證書無法載入）時返回錯誤
 func SetupWithProxy(
 	cfg *config.Config,
 	logger *zap.Logger,
@@ -112,20 +168,57 @@ func SetupWithProxy(
 	healthChecker *healthcheck.HealthChecker,
 	routeParser *proxy.RouteParser,
 	proxyService *proxy.ProxyService,
-) *gin.Engine {
+	quotaMiddleware *quota.QuotaMiddleware,
+) (*gin.Engine, func(), error) {
 	// 創建 Gin 引擎
 	r := gin.New()
+	// 客戶端 IP 統一由 clientip 解析器依受信任代理配置判斷
+	_ = r.SetTrustedProxies(nil)
 
 	// 初始化中間件
-	jwtMiddleware := auth.NewJWTMiddleware(cfg, logger)
+	// 認證與代理登入共用同一個 JWT 服務
+	jwtService := jwt.NewJWTService(cfg, logger)
+	jwtMiddleware := auth.NewJWTMiddlewareWithService(cfg, logger, jwtService)
 	rateLimitMiddleware := ratelimit.NewRateLimitMiddleware(cfg, logger)
-	xssMiddleware := security.NewXSSMiddleware(cfg, logger)
-	sqlInjectionMiddleware := security.NewSQLInjectionMiddleware(cfg, logger)
+	wafEngine := newWAFEngine(cfg, logger)
+	xssMiddleware := security.NewXSSMiddlewareWithEngine(cfg, logger, wafEngine, monitorService)
+	sqlInjectionMiddleware := security.NewSQLInjectionMiddlewareWithEngine(cfg, logger, wafEngine, monitorService)
+	impersonationMiddleware := auth.NewImpersonationMiddleware(cfg, logger, jwtService)
+	csrfMiddleware := security.NewCSRFMiddleware(cfg, logger)
+	concurrencyMiddleware := concurrency.NewConcurrencyMiddleware(cfg, logger, monitorService)
+	admissionMiddleware := admission.NewAdmissionMiddleware(cfg, logger, monitorService)
+	ipFilterMiddleware := ipfilter.NewIPFilterMiddleware(cfg, logger, monitorService)
+	uploadMiddleware := upload.NewUploadMiddleware(cfg, logger, monitorService)
+	loginGuardMiddleware := loginguard.NewLoginGuardMiddleware(cfg, logger, monitorService)
+	bodyLimitMiddleware := bodylimit.NewBodyLimitMiddleware(cfg, logger)
+	headersMiddleware := headers.NewHeadersMiddleware(cfg, logger)
+	corsMiddleware := cors.NewCORSMiddleware(cfg, logger)
+
+	// 關機時停止背景任務
+	var closers shutdown
+	closers.add(rateLimitMiddleware.Close)
+	closers.add(wafEngine.Stop)
+	closers.add(impersonationMiddleware.Close)
+	closers.add(loginGuardMiddleware.Close)
 
 	// 添加全局中間件
-	r.Use(logging.Middleware(logger, monitorService))
-	r.Use(cors.Middleware(cfg))
+	r.Use(clientip.Middleware(newClientIPResolver(cfg, logger)))
+	r.Use(impersonationMiddleware.StripHeaders())
+	r.Use(logging.Middleware(logger, monitorService, redact.New(&cfg.Redaction)))
+	r.Use(headersMiddleware.Global())
+	r.Use(ipFilterMiddleware.Global())
+	// 請求體上限需在讀取請求體的安全檢查之前生效
+	r.Use(bodyLimitMiddleware.Global())
+	r.Use(corsMiddleware.Global())
 	r.Use(gin.Recovery())
+	if cfg.TLS.Enabled {
+		r.Use(auth.NewClientCertMiddleware(cfg, logger).Authenticate())
+	}
+	if cfg.OIDC.Enabled {
+		sessionMiddleware := auth.NewSessionMiddleware(cfg, logger)
+		r.Use(sessionMiddleware.Authenticate())
+		setupOIDCRoutes(r, sessionMiddleware, csrfMiddleware)
+	}
 	r.Use(xssMiddleware.XSSProtection())
 	r.Use(sqlInjectionMiddleware.SQLInjectionProtection())
 
@@ -134,17 +227,21 @@ func SetupWithProxy(
 		r.Use(rateLimitMiddleware.GlobalRateLimit())
 		r.Use(rateLimitMiddleware.IPRateLimit())
 		r.Use(rateLimitMiddleware.UserRateLimit())
-		r.Use(rateLimitMiddleware.APIRateLimit())
 	}
 
 	// 創建處理器
-	h := handler.NewWithProxy(cfg, logger, serviceDiscovery, monitorService, proxyService)
+	h := handler.NewWithRateLimit(cfg, logger, serviceDiscovery, monitorService, proxyService, rateLimitMiddleware)
 
 	// 健康檢查路由
 	r.GET("/health", healthChecker.Handler())
 
+	// CSP 違規報告收集（報告內容包含被攔截的腳本片段，不經 WAF 檢測）
+	wafEngine.SetRoutePolicy(headers.ReportPath, config.RouteSecurityConfig{Mode: config.SecurityModeOff})
+	r.POST(headers.ReportPath, headersMiddleware.CSPReport())
+
 	// 系統端點（由 Gateway 自己處理）
 	v1 := r.Group("/api/v1")
+	v1.Use(rateLimitMiddleware.APIRateLimit())
 	{
 		// 系統狀態端點
 		v1.GET("/system/status", h.GetSystemStatus)
@@ -160,26 +257,46 @@ func SetupWithProxy(
 		// 通用代理路由（用於其他服務）
 		proxy := v1.Group("/proxy")
 		proxy.Use(jwtMiddleware.OptionalAuth()) // 可選認證
+		proxy.Use(impersonationMiddleware.Impersonate())
+		proxy.Use(csrfMiddleware.CSRFProtection())
+		proxy.Use(admissionMiddleware.Admit(""))
 		{
 			proxy.Any("/*path", h.ProxyHandler)
 		}
 	}
 
 	// 動態路由（基於 services.yaml 配置）
-	setupDynamicRoutes(r, jwtMiddleware, h, routeParser)
+	if err := setupDynamicRoutes(r, jwtMiddleware, impersonationMiddleware, csrfMiddleware, rateLimitMiddleware, quotaMiddleware, concurrencyMiddleware, admissionMiddleware, ipFilterMiddleware, uploadMiddleware, loginGuardMiddleware, bodyLimitMiddleware, headersMiddleware, corsMiddleware, wafEngine, h, routeParser); err != nil {
+		closers.close()
+		return nil, nil, fmt.Errorf("failed to load route configuration: %w", err)
+	}
 
 	// 管理端點
 	admin := r.Group("/admin")
+	admin.Use(ipFilterMiddleware.Filter("admin", &cfg.IPFilter.Admin))
 	admin.Use(jwtMiddleware.Authenticate())
+	admin.Use(impersonationMiddleware.Impersonate())
 	admin.Use(jwtMiddleware.RequireRoles("admin"))
+	admin.Use(csrfMiddleware.CSRFProtection())
 	{
 		admin.GET("/config", h.GetConfig)
 		admin.POST("/config/reload", h.ReloadConfig)
 		admin.GET("/routes", h.GetRoutes)
 		admin.POST("/maintenance", h.ToggleMaintenanceMode)
+		admin.POST("/impersonate", impersonationMiddleware.MintToken())
 		admin.GET("/rate-limit/stats", h.GetRateLimitStats)
+		admin.GET("/rate-limit/keys", h.GetRateLimitKey)
 		admin.POST("/rate-limit/reset", h.ResetRateLimit)
 		admin.GET("/proxy/stats", h.GetProxyStats)
+		admin.GET("/quota", quotaMiddleware.GetUsage())
+		admin.POST("/quota/topup", quotaMiddleware.TopUp())
+		admin.GET("/concurrency", concurrencyMiddleware.GetStats())
+		admin.GET("/admission", admissionMiddleware.GetStats())
+		admin.GET("/ip-rules", ipFilterMiddleware.ListRules())
+		admin.POST("/ip-rules", ipFilterMiddleware.CreateRule())
+		admin.DELETE("/ip-rules", ipFilterMiddleware.DeleteRule())
+		admin.GET("/login-guard", loginGuardMiddleware.ListEntries())
+		admin.POST("/login-guard/unlock", loginGuardMiddleware.UnlockEntry())
 	}
 
 	// 監控端點
@@ -187,37 +304,126 @@ func SetupWithProxy(
 		r.GET(cfg.Monitor.MetricsPath, h.GetPrometheusMetrics)
 	}
 
-	return r
+	return r, closers.close, nil
+}
+
+// shutdown 路由中間件的關閉函數
+type shutdown []func()
+
+// add 註冊關閉函數
+func (s *shutdown) add(close func()) {
+	*s = append(*s, close)
+}
+
+// close 依註冊的相反順序調用關閉函數
+func (s shutdown) close() {
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i]()
+	}
+}
+
+// newClientIPResolver 創建客戶端 IP 解析器，配置無效時不信任任何代理
+func newClientIPResolver(cfg *config.Config, logger *zap.Logger) *clientip.Resolver {
+	resolver, err := clientip.NewResolver(cfg.ClientIP)
+	if err != nil {
+		logger.Error("Invalid client IP configuration, forwarded headers ignored", zap.Error(err))
+		return &clientip.Resolver{}
+	}
+	return resolver
+}
+
+// newWAFEngine 創建 WAF 規則引擎並啟動規則文件熱重載，規則文件無效時使用內建規則
+func newWAFEngine(cfg *config.Config, logger *zap.Logger) *waf.Engine {
+	engine, err := waf.NewEngine(cfg.Security.WAF, logger)
+	if err != nil {
+		logger.Error("Failed to load WAF rules, using built-in rules", zap.Error(err))
+		engine = waf.NewDefaultEngine(cfg.Security.WAF, logger)
+	}
+	engine.Start()
+	return engine
+}
+
+// setupOIDCRoutes 設置 OIDC 登入相關路由
+func setupOIDCRoutes(r *gin.Engine, sessionMiddleware *auth.SessionMiddleware, csrfMiddleware *security.CSRFMiddleware) {
+	r.GET("/auth/csrf", csrfMiddleware.IssueToken())
+
+	oidc := r.Group("/auth/oidc")
+	{
+		oidc.GET("/login", sessionMiddleware.Login())
+		oidc.GET("/callback", sessionMiddleware.Callback())
+		// 登出僅接受帶 CSRF token 的 POST，防止其他站點以連結或圖片強制登出
+		oidc.POST("/logout", csrfMiddleware.CSRFProtection(), sessionMiddleware.Logout())
+	}
 }
 
 // setupDynamicRoutes 設置動態路由
 func setupDynamicRoutes(
 	r *gin.Engine,
 	jwtMiddleware *auth.JWTMiddleware,
+	impersonationMiddleware *auth.ImpersonationMiddleware,
+	csrfMiddleware *security.CSRFMiddleware,
+	rateLimitMiddleware *ratelimit.RateLimitMiddleware,
+	quotaMiddleware *quota.QuotaMiddleware,
+	concurrencyMiddleware *concurrency.ConcurrencyMiddleware,
+	admissionMiddleware *admission.AdmissionMiddleware,
+	ipFilterMiddleware *ipfilter.IPFilterMiddleware,
+	uploadMiddleware *upload.UploadMiddleware,
+	loginGuardMiddleware *loginguard.LoginGuardMiddleware,
+	bodyLimitMiddleware *bodylimit.BodyLimitMiddleware,
+	headersMiddleware *headers.HeadersMiddleware,
+	corsMiddleware *cors.CORSMiddleware,
+	wafEngine *waf.Engine,
 	h *handler.Handler,
 	routeParser *proxy.RouteParser,
-) {
-	// 載入路由配置
+) error {
+	// 載入路由配置，拒絕引用未註冊 Token 驗證器或上游 TLS 配置無效的配置
+	routeParser.SetTokenValidators(jwtMiddleware.ValidatorNames())
 	if err := routeParser.LoadConfig(); err != nil {
-		// 如果載入失敗，使用靜態路由
-		return
+		// 路由配置文件不存在時使用靜態路由
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	ipFilterMiddleware.SetGlobalRule(routeParser.GetIPFilter())
+	globalSecurity := routeParser.GetSecurity()
+	wafEngine.SetGlobalPolicy(globalSecurity)
+	if globalSecurity != nil {
+		headersMiddleware.SetGlobalPolicy(globalSecurity.Headers)
 	}
 
 	// 獲取所有路由配置
 	routes := routeParser.GetAllRoutes()
 	groups := routeParser.GetAllGroups()
+	services := routeParser.GetAllServices()
 
 	// 設置路由組
 	for _, group := range groups {
 		groupRouter := r.Group(group.Prefix)
+		groupSecurity := group.Security.Inherit(globalSecurity)
+		if group.IPFilter != nil {
+			groupRouter.Use(ipFilterMiddleware.Filter("group:"+group.Prefix, group.IPFilter))
+		}
+
+		// 組未啟用 cors 時不發送 CORS 響應頭，瀏覽器拒絕跨源請求
+		corsMiddleware.SetGroupPolicy(group.Prefix, nil)
 
 		// 添加組級別中間件
+		groupAuth := false
 		for _, middlewareName := range group.Middleware {
 			switch middlewareName {
 			case "auth":
-				groupRouter.Use(jwtMiddleware.Authenticate())
+				// 組認證在各路由添加，使路由指定的 Token 驗證器生效
+				groupAuth = true
+			case "csrf":
+				groupRouter.Use(csrfMiddleware.CSRFProtection())
 			case "cors":
-				// CORS 已在全局設置
+				// CORS 由全局中間件依路徑選擇組的策略處理，使未註冊 OPTIONS 的路由也能回應預檢請求
+				corsPolicy := group.CORS
+				if corsPolicy == nil {
+					corsPolicy = &config.CORSConfig{}
+				}
+				corsMiddleware.SetGroupPolicy(group.Prefix, corsPolicy)
 			case "ratelimit":
 				// 限流已在全局設置
 			}
@@ -225,7 +431,15 @@ func setupDynamicRoutes(
 
 		// 設置組內路由
 		for _, route := range group.Routes {
-			setupRoute(groupRouter, &route, jwtMiddleware, h)
+			// 路由未指定驗證器時沿用組設定
+			if route.TokenValidator == "" {
+				route.TokenValidator = group.TokenValidator
+			}
+			if groupAuth {
+				route.AuthRequired = true
+			}
+			route.Security = route.Security.Inherit(groupSecurity)
+			setupRoute(groupRouter, &route, jwtMiddleware, impersonationMiddleware, rateLimitMiddleware, quotaMiddleware, concurrencyMiddleware, admissionMiddleware, ipFilterMiddleware, uploadMiddleware, loginGuardMiddleware, bodyLimitMiddleware, headersMiddleware, wafEngine, services, h)
 		}
 	}
 
@@ -233,8 +447,11 @@ func setupDynamicRoutes(
 	for _, route := range routes {
 		// 為全局路由創建一個組
 		routeGroup := r.Group("")
-		setupRoute(routeGroup, route, jwtMiddleware, h)
+		routeCopy := *route
+		routeCopy.Security = routeCopy.Security.Inherit(globalSecurity)
+		setupRoute(routeGroup, &routeCopy, jwtMiddleware, impersonationMiddleware, rateLimitMiddleware, quotaMiddleware, concurrencyMiddleware, admissionMiddleware, ipFilterMiddleware, uploadMiddleware, loginGuardMiddleware, bodyLimitMiddleware, headersMiddleware, wafEngine, services, h)
 	}
+	return nil
 }
 
 // setupRoute 設置單個路由
@@ -242,6 +459,18 @@ func setupRoute(
 	router interface{},
 	route *proxy.RouteConfig,
 	jwtMiddleware *auth.JWTMiddleware,
+	impersonationMiddleware *auth.ImpersonationMiddleware,
+	rateLimitMiddleware *ratelimit.RateLimitMiddleware,
+	quotaMiddleware *quota.QuotaMiddleware,
+	concurrencyMiddleware *concurrency.ConcurrencyMiddleware,
+	admissionMiddleware *admission.AdmissionMiddleware,
+	ipFilterMiddleware *ipfilter.IPFilterMiddleware,
+	uploadMiddleware *upload.UploadMiddleware,
+	loginGuardMiddleware *loginguard.LoginGuardMiddleware,
+	bodyLimitMiddleware *bodylimit.BodyLimitMiddleware,
+	headersMiddleware *headers.HeadersMiddleware,
+	wafEngine *waf.Engine,
+	services map[string]*proxy.ServiceConfig,
 	h *handler.Handler,
 ) {
 	// 確定 HTTP 方法
@@ -253,9 +482,43 @@ func setupRoute(
 	// 設置中間件
 	var handlers []gin.HandlerFunc
 
+	// 計算完整路徑與路由名稱
+	fullPattern := route.Pattern
+	if base, ok := router.(interface{ BasePath() string }); ok {
+		fullPattern = strings.TrimSuffix(base.BasePath(), "/") + route.Pattern
+	}
+	name := route.ID
+	if name == "" {
+		name = fullPattern
+	}
+
+	// 註冊路由的 WAF 規則排除
+	if route.Security != nil {
+		wafEngine.SetRoutePolicy(fullPattern, *route.Security)
+	}
+
+	// 註冊路由的請求體上限，由全局中間件在讀取請求體之前檢查
+	service := services[route.Service]
+	var serviceBodyLimit int64
+	if service != nil {
+		serviceBodyLimit = service.MaxBodySize
+	}
+	bodyLimitMiddleware.SetRouteLimit(fullPattern, bodyLimitMiddleware.ResolveLimit(route.MaxBodySize, route.Service, serviceBodyLimit))
+
+	// 添加組或路由級別的安全響應頭策略（替換全局策略設置的響應頭）
+	if route.Security != nil && route.Security.Headers != nil {
+		handlers = append(handlers, headersMiddleware.Policy(route.Security.Headers))
+	}
+
+	// 添加 IP 訪問控制（在認證之前，儘早拒絕）
+	if route.IPFilter != nil {
+		handlers = append(handlers, ipFilterMiddleware.Filter("route:"+name, route.IPFilter))
+	}
+
 	// 添加認證中間件
 	if route.AuthRequired {
-		handlers = append(handlers, jwtMiddleware.Authenticate())
+		handlers = append(handlers, jwtMiddleware.AuthenticateWith(route.TokenValidator))
+		handlers = append(handlers, impersonationMiddleware.Impersonate())
 
 		// 添加角色檢查
 		if len(route.Roles) > 0 {
@@ -263,6 +526,40 @@ func setupRoute(
 		}
 	}
 
+	// 添加准入控制（在認證之後，可按角色判斷優先級；過載時先拒絕低優先級請求）
+	if admissionMiddleware.Enabled() {
+		handlers = append(handlers, admissionMiddleware.Admit(route.Priority))
+	}
+
+	// 添加路由限流（在認證之後，可按用戶或公司計數）
+	if rule, ok := rateLimitMiddleware.ResolveRouteRule(route.ID, fullPattern, route.RateLimit); ok {
+		handlers = append(handlers, rateLimitMiddleware.RouteRateLimit(name, rule))
+	}
+
+	// 添加登入防護（在路由限流之後，依上游響應記錄登入失敗）
+	if route.LoginGuard && loginGuardMiddleware.Enabled() {
+		handlers = append(handlers, loginGuardMiddleware.Protect())
+	}
+
+	// 添加上傳策略（在佔用上游並發與扣減配額之前，被拒絕的上傳不消耗兩者）
+	if route.Upload != nil {
+		handlers = append(handlers, uploadMiddleware.Enforce(name, route.Upload))
+	}
+
+	// 添加上游並發限制（被拒絕的請求不扣減配額）
+	var serviceRule *config.ConcurrencyRule
+	if service != nil {
+		serviceRule = service.Concurrency
+	}
+	if limiters := concurrencyMiddleware.ResolveLimiters(name, route.Concurrency, route.Service, serviceRule); len(limiters) > 0 {
+		handlers = append(handlers, concurrencyMiddleware.Limit(limiters...))
+	}
+
+	// 添加用量配額（短窗口限流通過後才扣減）
+	if cost := quotaMiddleware.ResolveCost(route.ID, fullPattern, route.QuotaCost); cost > 0 {
+		handlers = append(handlers, quotaMiddleware.Enforce(name, cost))
+	}
+
 	// 添加代理處理器
 	handlers = append(handlers, h.ProxyHandler)
 
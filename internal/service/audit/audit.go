@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/redact"
+
+	"go.uber.org/zap"
+)
+
+// Entry 審計記錄
+// 每筆記錄包含前一筆的雜湊值，形成雜湊鏈以偵測竄改或刪除
+type Entry struct {
+	Timestamp       time.Time         `json:"timestamp"`
+	Event           string            `json:"event"`
+	ActorID         string            `json:"actor_id"`
+	TargetUserID    string            `json:"target_user_id,omitempty"`
+	TargetCompanyID string            `json:"target_company_id,omitempty"`
+	Method          string            `json:"method,omitempty"`
+	Path            string            `json:"path,omitempty"`
+	ClientIP        string            `json:"client_ip,omitempty"`
+	RequestID       string            `json:"request_id,omitempty"`
+	Outcome         string            `json:"outcome"`
+	Details         map[string]string `json:"details,omitempty"`
+	PrevHash        string            `json:"prev_hash"`
+	Hash            string            `json:"hash"`
+}
+
+// Service 審計日誌服務，以僅追加的 JSON Lines 文件保存
+type Service struct {
+	logger   *zap.Logger
+	redactor *redact.Redactor
+	filePath string
+	file     *os.File
+	lastHash string
+	mutex    sync.Mutex
+}
+
+// New 創建新的審計日誌服務
+func New(cfg *config.Config, logger *zap.Logger) (*Service, error) {
+	filePath := cfg.Audit.FilePath
+	if filePath == "" {
+		filePath = "logs/audit.jsonl"
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	// 接續既有文件的雜湊鏈
+	lastHash, err := lastEntryHash(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &Service{
+		logger:   logger,
+		redactor: redact.New(&cfg.Redaction),
+		filePath: filePath,
+		file:     file,
+		lastHash: lastHash,
+	}, nil
+}
+
+// Record 寫入審計記錄並同步到磁碟，路徑與詳情在計算雜湊前遮蔽
+func (s *Service) Record(entry Entry) error {
+	entry.Path = s.redactor.String(entry.Path)
+	entry.Details = s.redactor.Map(entry.Details)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	entry.PrevHash = s.lastHash
+	entry.Hash = ""
+
+	hash, err := entryHash(entry)
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	s.lastHash = hash
+	return nil
+}
+
+// Close 關閉審計日誌
+func (s *Service) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// Verify 驗證審計日誌的雜湊鏈，返回已驗證的記錄數
+func Verify(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	count := 0
+	prevHash := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return count, fmt.Errorf("invalid audit entry at line %d: %w", count+1, err)
+		}
+		if entry.PrevHash != prevHash {
+			return count, fmt.Errorf("audit chain broken at line %d", count+1)
+		}
+
+		recorded := entry.Hash
+		entry.Hash = ""
+		hash, err := entryHash(entry)
+		if err != nil {
+			return count, err
+		}
+		if hash != recorded {
+			return count, fmt.Errorf("audit entry tampered at line %d", count+1)
+		}
+
+		prevHash = recorded
+		count++
+	}
+
+	return count, scanner.Err()
+}
+
+// entryHash 計算記錄的雜湊值（Hash 欄位需為空）
+func entryHash(entry Entry) (string, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastEntryHash 讀取既有文件最後一筆記錄的雜湊值
+func lastEntryHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	lastHash := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return "", fmt.Errorf("invalid audit log %s: %w", filePath, err)
+		}
+		lastHash = entry.Hash
+	}
+
+	return lastHash, scanner.Err()
+}
@@ -11,12 +11,16 @@ import (
 
 // Metrics 監控指標
 type Metrics struct {
-	RequestCount    int64                       `json:"request_count"`
-	ErrorCount      int64                       `json:"error_count"`
-	ResponseTime    time.Duration               `json:"avg_response_time"`
-	StatusCodes     map[int]int64               `json:"status_codes"`
-	EndpointMetrics map[string]*EndpointMetrics `json:"endpoint_metrics"`
-	LastUpdated     time.Time                   `json:"last_updated"`
+	RequestCount    int64                          `json:"request_count"`
+	ErrorCount      int64                          `json:"error_count"`
+	ResponseTime    time.Duration                  `json:"avg_response_time"`
+	StatusCodes     map[int]int64                  `json:"status_codes"`
+	EndpointMetrics map[string]*EndpointMetrics    `json:"endpoint_metrics"`
+	Concurrency     map[string]*ConcurrencyMetrics `json:"concurrency"`
+	Admission       map[string]*AdmissionMetrics   `json:"admission"`
+	BlockedRequests map[string]int64               `json:"blocked_requests"` // 按原因統計被 IP 訪問控制拒絕的請求
+	SecurityEvents  map[string]*SecurityMetrics    `json:"security_events"`  // 按檢測類別（xss, sqli）統計
+	LastUpdated     time.Time                      `json:"last_updated"`
 }
 
 // EndpointMetrics 端點指標
@@ -27,6 +31,28 @@ type EndpointMetrics struct {
 	StatusCodes  map[int]int64 `json:"status_codes"`
 }
 
+// ConcurrencyMetrics 上游並發限制指標（即時值，重置指標時保留）
+type ConcurrencyMetrics struct {
+	Limit    int   `json:"limit"`
+	InFlight int   `json:"in_flight"`
+	Queued   int   `json:"queue_depth"`
+	Rejected int64 `json:"rejected"`
+	Timeouts int64 `json:"queue_timeouts"`
+}
+
+// AdmissionMetrics 單個優先級的准入決策統計
+type AdmissionMetrics struct {
+	Admitted int64 `json:"admitted"`
+	Shed     int64 `json:"shed"`
+}
+
+// SecurityMetrics 單個檢測類別的安全事件統計
+type SecurityMetrics struct {
+	Blocked   int64            `json:"blocked"`
+	Monitored int64            `json:"monitored"` // monitor 模式下命中但放行的請求
+	Rules     map[string]int64 `json:"rules"`     // 各規則的命中次數
+}
+
 // Monitor 監控服務
 type Monitor struct {
 	config  *config.Config
@@ -44,6 +70,10 @@ func New(cfg *config.Config, logger *zap.Logger) *Monitor {
 		metrics: &Metrics{
 			StatusCodes:     make(map[int]int64),
 			EndpointMetrics: make(map[string]*EndpointMetrics),
+			Concurrency:     make(map[string]*ConcurrencyMetrics),
+			Admission:       make(map[string]*AdmissionMetrics),
+			BlockedRequests: make(map[string]int64),
+			SecurityEvents:  make(map[string]*SecurityMetrics),
 			LastUpdated:     time.Now(),
 		},
 		stopCh: make(chan struct{}),
@@ -112,6 +142,59 @@ func (m *Monitor) RecordRequest(endpoint string, statusCode int, responseTime ti
 	m.metrics.LastUpdated = time.Now()
 }
 
+// UpdateConcurrency 更新並發限制指標
+func (m *Monitor) UpdateConcurrency(name string, metrics ConcurrencyMetrics) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.metrics.Concurrency[name] = &metrics
+}
+
+// RecordAdmission 記錄准入決策
+func (m *Monitor) RecordAdmission(priority string, admitted bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	metric := m.metrics.Admission[priority]
+	if metric == nil {
+		metric = &AdmissionMetrics{}
+		m.metrics.Admission[priority] = metric
+	}
+	if admitted {
+		metric.Admitted++
+	} else {
+		metric.Shed++
+	}
+}
+
+// RecordBlocked 記錄被 IP 訪問控制拒絕的請求
+func (m *Monitor) RecordBlocked(reason string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.metrics.BlockedRequests[reason]++
+}
+
+// RecordSecurityEvent 記錄 XSS、SQL 注入等檢測命中，monitored 表示只記錄未攔截
+func (m *Monitor) RecordSecurityEvent(category string, monitored bool, ruleIDs []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	metric := m.metrics.SecurityEvents[category]
+	if metric == nil {
+		metric = &SecurityMetrics{Rules: make(map[string]int64)}
+		m.metrics.SecurityEvents[category] = metric
+	}
+	if monitored {
+		metric.Monitored++
+	} else {
+		metric.Blocked++
+	}
+	for _, id := range ruleIDs {
+		metric.Rules[id]++
+	}
+}
+
 // GetMetrics 獲取監控指標
 func (m *Monitor) GetMetrics() *Metrics {
 	m.mutex.RLock()
@@ -124,6 +207,10 @@ func (m *Monitor) GetMetrics() *Metrics {
 		ResponseTime:    m.metrics.ResponseTime,
 		StatusCodes:     make(map[int]int64),
 		EndpointMetrics: make(map[string]*EndpointMetrics),
+		Concurrency:     make(map[string]*ConcurrencyMetrics),
+		Admission:       make(map[string]*AdmissionMetrics),
+		BlockedRequests: make(map[string]int64),
+		SecurityEvents:  make(map[string]*SecurityMetrics),
 		LastUpdated:     m.metrics.LastUpdated,
 	}
 
@@ -146,6 +233,36 @@ func (m *Monitor) GetMetrics() *Metrics {
 		}
 	}
 
+	// 拷貝並發限制指標
+	for name, metric := range m.metrics.Concurrency {
+		metricCopy := *metric
+		metricsCopy.Concurrency[name] = &metricCopy
+	}
+
+	// 拷貝准入決策統計
+	for priority, metric := range m.metrics.Admission {
+		metricCopy := *metric
+		metricsCopy.Admission[priority] = &metricCopy
+	}
+
+	// 拷貝 IP 訪問控制統計
+	for reason, count := range m.metrics.BlockedRequests {
+		metricsCopy.BlockedRequests[reason] = count
+	}
+
+	// 拷貝安全事件統計
+	for category, metric := range m.metrics.SecurityEvents {
+		metricCopy := &SecurityMetrics{
+			Blocked:   metric.Blocked,
+			Monitored: metric.Monitored,
+			Rules:     make(map[string]int64, len(metric.Rules)),
+		}
+		for id, count := range metric.Rules {
+			metricCopy.Rules[id] = count
+		}
+		metricsCopy.SecurityEvents[category] = metricCopy
+	}
+
 	return metricsCopy
 }
 
@@ -205,6 +322,9 @@ func (m *Monitor) ResetMetrics() {
 	m.metrics.ResponseTime = 0
 	m.metrics.StatusCodes = make(map[int]int64)
 	m.metrics.EndpointMetrics = make(map[string]*EndpointMetrics)
+	m.metrics.Admission = make(map[string]*AdmissionMetrics)
+	m.metrics.BlockedRequests = make(map[string]int64)
+	m.metrics.SecurityEvents = make(map[string]*SecurityMetrics)
 	m.metrics.LastUpdated = time.Now()
 
 	m.logger.Info("Metrics reset")
@@ -8,9 +8,14 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/bodylimit"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/middleware/cors"
+	"expense-api-gateway/internal/middleware/headers"
 	"expense-api-gateway/internal/service/discovery"
 
 	"github.com/gin-gonic/gin"
@@ -25,6 +30,9 @@ type ProxyService struct {
 	discovery       discovery.ServiceDiscovery
 	httpClient      *http.Client
 	maintenanceMode *bool // 指向維護模式狀態的指針
+	transports      map[string]*http.Transport
+	transportMutex  sync.Mutex
+	clientIP        *clientip.Resolver
 }
 
 // ProxyRequest 代理請求
@@ -49,6 +57,11 @@ type ProxyResponse struct {
 // NewProxyService 創建新的代理服務
 func NewProxyService(cfg *config.Config, logger *zap.Logger, routeParser *RouteParser, discovery discovery.ServiceDiscovery) *ProxyService {
 	maintenanceMode := false
+	resolver, err := clientip.NewResolver(cfg.ClientIP)
+	if err != nil {
+		logger.Error("Invalid client IP configuration, forwarded headers ignored", zap.Error(err))
+		resolver = &clientip.Resolver{}
+	}
 	return &ProxyService{
 		config:          cfg,
 		logger:          logger,
@@ -56,6 +69,8 @@ func NewProxyService(cfg *config.Config, logger *zap.Logger, routeParser *RouteP
 		discovery:       discovery,
 		httpClient:      &http.Client{Timeout: 30 * time.Second},
 		maintenanceMode: &maintenanceMode,
+		transports:      make(map[string]*http.Transport),
+		clientIP:        resolver,
 	}
 }
 
@@ -152,7 +167,16 @@ func (p *ProxyService) ProxyRequest(ctx context.Context, req *ProxyRequest) (*Pr
 	}
 
 	// 執行請求
-	resp, err := p.httpClient.Do(httpReq)
+	transport, err := p.transportFor(route.Service, service)
+	if err != nil {
+		return &ProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("failed to create transport: %w", err),
+			Duration:   time.Since(start),
+		}, err
+	}
+	client := &http.Client{Timeout: p.httpClient.Timeout, Transport: transport}
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		return &ProxyResponse{
 			StatusCode: http.StatusBadGateway,
@@ -255,8 +279,23 @@ func (p *ProxyService) ProxyGinRequest(c *gin.Context) {
 		return
 	}
 
+	// 獲取上游傳輸層（支援 TLS/mTLS）
+	transport, err := p.transportFor(route.Service, service)
+	if err != nil {
+		p.logger.Error("Failed to create upstream transport",
+			zap.String("service", route.Service),
+			zap.Error(err))
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Internal server error",
+		})
+		return
+	}
+
 	// 創建反向代理
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.Transport = transport
 
 	// 自定義 Director 函數
 	originalDirector := proxy.Director
@@ -273,6 +312,16 @@ func (p *ProxyService) ProxyGinRequest(c *gin.Context) {
 
 	// 自定義 ErrorHandler
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// 分塊傳輸的請求體在轉發過程中超過上限
+		if limit, exceeded := bodylimit.ExceededLimit(err); exceeded {
+			p.logger.Warn("Request body exceeded limit while proxying",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			bodylimit.Reject(c, limit)
+			return
+		}
+
 		p.logger.Error("Proxy error",
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
@@ -298,8 +347,12 @@ func (p *ProxyService) ProxyGinRequest(c *gin.Context) {
 // buildTargetURL 構建目標 URL
 func (p *ProxyService) buildTargetURL(instance *discovery.ServiceInstance, path string, route *RouteConfig, service *ServiceConfig) (*url.URL, error) {
 	// 構建基礎 URL
+	scheme := "http"
+	if service != nil && service.TLS != nil && service.TLS.Enabled {
+		scheme = "https"
+	}
 	targetURL := &url.URL{
-		Scheme: "http",
+		Scheme: scheme,
 		Host:   fmt.Sprintf("%s:%d", instance.Address, instance.Port),
 	}
 
@@ -335,15 +388,48 @@ func (p *ProxyService) setRequestHeaders(req *http.Request, headers map[string]s
 	}
 
 	// 設置代理相關的請求頭
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
 	req.Header.Set("X-Forwarded-Host", req.Host)
-	req.Header.Set("X-Forwarded-Proto", "http")
-	req.Header.Set("X-Forwarded-For", req.RemoteAddr)
+	req.Header.Set("X-Forwarded-Proto", proto)
+}
+
+// setForwardedFor 設置客戶端地址相關的轉發請求頭
+// 只保留受信任代理轉發的部分鏈，ReverseProxy 會在 X-Forwarded-For 末尾附加直接連線的對端地址
+func (p *ProxyService) setForwardedFor(req *http.Request, c *gin.Context) {
+	chain := p.clientIP.ForwardedChain(c.Request)
+	if len(chain) > 0 {
+		req.Header.Set("X-Forwarded-For", strings.Join(chain, ", "))
+	} else {
+		req.Header.Del("X-Forwarded-For")
+	}
+	req.Header.Set("X-Real-IP", clientip.FromContext(c))
+
+	// 以驗證過的鏈重建 Forwarded，不轉發客戶端提供的值
+	nodes := append(chain, clientip.RemoteIP(c.Request))
+	elements := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node == "" {
+			continue
+		}
+		if strings.Contains(node, ":") {
+			node = `"[` + node + `]"`
+		}
+		elements = append(elements, "for="+node)
+	}
+	req.Header.Del("Forwarded")
+	if len(elements) > 0 {
+		req.Header.Set("Forwarded", strings.Join(elements, ", "))
+	}
 }
 
 // customizeRequest 自定義請求
 func (p *ProxyService) customizeRequest(req *http.Request, c *gin.Context, route *RouteConfig, service *ServiceConfig) {
 	// 設置請求頭
 	p.setRequestHeaders(req, make(map[string]string), route, service)
+	p.setForwardedFor(req, c)
 
 	// 設置用戶信息（如果存在）
 	if userID, exists := c.Get("user_id"); exists {
@@ -353,13 +439,6 @@ func (p *ProxyService) customizeRequest(req *http.Request, c *gin.Context, route
 	if companyID, exists := c.Get("company_id"); exists {
 		req.Header.Set("X-Company-ID", companyID.(string))
 	}
-
-	// 設置請求體大小限制
-	if route.MaxBodySize > 0 {
-		req.ContentLength = route.MaxBodySize
-	} else if service.MaxBodySize > 0 {
-		req.ContentLength = service.MaxBodySize
-	}
 }
 
 // customizeResponse 自定義響應
@@ -367,6 +446,39 @@ func (p *ProxyService) customizeResponse(resp *http.Response, c *gin.Context) {
 	// 設置響應頭
 	resp.Header.Set("X-Proxy-By", "expense-api-gateway")
 	resp.Header.Set("X-Proxy-Time", time.Now().Format(time.RFC3339))
+
+	// 依策略合併安全響應頭
+	headers.ApplyUpstream(c, resp.Header)
+	cors.MergeUpstream(c, resp.Header)
+}
+
+// transportFor 獲取服務對應的傳輸層，啟用 TLS 的服務使用獨立的連接池
+// TLS 配置在載入路由配置時已建立並驗證
+func (p *ProxyService) transportFor(serviceName string, service *ServiceConfig) (http.RoundTripper, error) {
+	if service == nil || service.TLS == nil || !service.TLS.Enabled {
+		return http.DefaultTransport, nil
+	}
+	if service.tlsConfig == nil {
+		return nil, fmt.Errorf("TLS configuration for service %s is not loaded", serviceName)
+	}
+
+	p.transportMutex.Lock()
+	defer p.transportMutex.Unlock()
+
+	transport, exists := p.transports[serviceName]
+	if exists && transport.TLSClientConfig == service.tlsConfig {
+		return transport, nil
+	}
+	// 路由配置重載後使用新的 TLS 配置重建連接池
+	if exists {
+		transport.CloseIdleConnections()
+	}
+
+	transport = http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = service.tlsConfig
+	p.transports[serviceName] = transport
+
+	return transport, nil
 }
 
 // isMaintenanceMode 檢查是否處於維護模式
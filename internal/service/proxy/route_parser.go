@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
 	"regexp"
@@ -8,6 +9,9 @@ import (
 	"sync"
 	"time"
 
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/tlsconfig"
+
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
@@ -16,18 +20,35 @@ import (
 // 注意：service 對應 services.yaml 的 key
 // pattern 支援 /xxx/*
 type RouteConfig struct {
-	ID           string            `yaml:"id"`
-	Pattern      string            `yaml:"pattern"`
-	Service      string            `yaml:"service"`
-	Methods      []string          `yaml:"methods"`
-	AuthRequired bool              `yaml:"auth_required"`
-	Roles        []string          `yaml:"roles"`
-	Timeout      time.Duration     `yaml:"timeout"`
-	MaxBodySize  int64             `yaml:"max_body_size"`
-	Streaming    bool              `yaml:"streaming"`
-	Headers      map[string]string `yaml:"headers"`
-	StripPrefix  bool              `yaml:"strip_prefix"`
-	RewritePath  string            `yaml:"rewrite_path"`
+	ID             string            `yaml:"id"`
+	Pattern        string            `yaml:"pattern"`
+	Service        string            `yaml:"service"`
+	Methods        []string          `yaml:"methods"`
+	AuthRequired   bool              `yaml:"auth_required"`
+	Roles          []string          `yaml:"roles"`
+	TokenValidator string            `yaml:"token_validator"` // jwt, introspection，空值時使用預設驗證器
+	Timeout        time.Duration     `yaml:"timeout"`
+	MaxBodySize    int64             `yaml:"max_body_size"`
+	Streaming      bool              `yaml:"streaming"`
+	Headers        map[string]string `yaml:"headers"`
+	StripPrefix    bool              `yaml:"strip_prefix"`
+	RewritePath    string            `yaml:"rewrite_path"`
+	// 路由限流，未設置時依 ID 或模式查找 config.yaml 的 rate_limit.api_limit
+	RateLimit *config.RateLimitRule `yaml:"rate_limit"`
+	// 每次請求消耗的配額單位，未設置時依 ID 或模式查找 config.yaml 的 quota.costs
+	QuotaCost int64 `yaml:"quota_cost"`
+	// 路由級別的並發限制，與服務級別的限制同時生效
+	Concurrency *config.ConcurrencyRule `yaml:"concurrency"`
+	// 過載時的准入優先級：critical, high, normal, low
+	Priority string `yaml:"priority"`
+	// 路由級別的 IP 訪問控制，與全局、組級別的規則同時生效
+	IPFilter *config.IPFilterRule `yaml:"ip_filter"`
+	// 路由級別的 WAF 規則排除，與組級別的設定合併
+	Security *config.RouteSecurityConfig `yaml:"security"`
+	// 路由級別的上傳策略：允許的文件類型、數量、大小、圖片尺寸與惡意軟件掃描
+	Upload *config.UploadPolicy `yaml:"upload"`
+	// 啟用 config.yaml 的 login_guard：追蹤登入失敗、遞增延遲、臨時鎖定與挑戰
+	LoginGuard bool `yaml:"login_guard"`
 }
 
 // ServiceConfig 服務配置
@@ -36,20 +57,31 @@ type RouteConfig struct {
 // port、health_check、headers、max_body_size
 // ...
 type ServiceConfig struct {
-	Hosts       []string          `yaml:"hosts"`
-	Port        int               `yaml:"port"`
-	HealthCheck string            `yaml:"health_check"`
-	Timeout     time.Duration     `yaml:"timeout"`
-	MaxBodySize int64             `yaml:"max_body_size"`
-	Headers     map[string]string `yaml:"headers"`
+	Hosts       []string                  `yaml:"hosts"`
+	Port        int                       `yaml:"port"`
+	HealthCheck string                    `yaml:"health_check"`
+	Timeout     time.Duration             `yaml:"timeout"`
+	MaxBodySize int64                     `yaml:"max_body_size"`
+	Headers     map[string]string         `yaml:"headers"`
+	TLS         *config.UpstreamTLSConfig `yaml:"tls"`
+	Concurrency *config.ConcurrencyRule   `yaml:"concurrency"` // 服務所有路由共用的並發限制
+
+	tlsConfig *tls.Config // 載入配置時由 TLS 建立
 }
 
 // RouteGroup 路由組配置
 type RouteGroup struct {
-	Name       string        `yaml:"name"`
-	Prefix     string        `yaml:"prefix"`
-	Middleware []string      `yaml:"middleware"`
-	Routes     []RouteConfig `yaml:"routes"`
+	Name           string        `yaml:"name"`
+	Prefix         string        `yaml:"prefix"`
+	Middleware     []string      `yaml:"middleware"`
+	TokenValidator string        `yaml:"token_validator"` // 組內路由預設的 Token 驗證器
+	Routes         []RouteConfig `yaml:"routes"`
+	// 組級別的 IP 訪問控制
+	IPFilter *config.IPFilterRule `yaml:"ip_filter"`
+	// 組級別的 WAF 規則排除，組內路由繼承
+	Security *config.RouteSecurityConfig `yaml:"security"`
+	// 組級別的 CORS 策略，middleware 包含 cors 時生效，未設置的字段繼承 config.yaml 的 cors
+	CORS *config.CORSConfig `yaml:"cors"`
 }
 
 // ServicesConfig services.yaml 結構
@@ -58,6 +90,10 @@ type ServicesConfig struct {
 	Routes   []RouteConfig            `yaml:"routes"`
 	Services map[string]ServiceConfig `yaml:"services"`
 	Version  string                   `yaml:"version"`
+	// 全局 IP 訪問控制，作用於所有請求
+	IPFilter *config.IPFilterRule `yaml:"ip_filter"`
+	// 全局安全檢查設定，組與路由繼承
+	Security *config.RouteSecurityConfig `yaml:"security"`
 }
 
 // RouteParser 路由解析器
@@ -66,9 +102,13 @@ type RouteParser struct {
 	routes     []*RouteConfig
 	services   map[string]*ServiceConfig
 	groups     []*RouteGroup
+	security   *config.RouteSecurityConfig
+	ipFilter   *config.IPFilterRule
 	mutex      sync.RWMutex
 	lastReload time.Time
 	filePath   string
+	// 已註冊的 Token 驗證器名稱，nil 時不檢查路由的 token_validator
+	validators map[string]bool
 }
 
 // NewRouteParser 創建新的路由解析器
@@ -83,6 +123,23 @@ func NewRouteParser(_ interface{}, logger *zap.Logger) *RouteParser {
 	}
 }
 
+// SetFilePath 設置 services.yaml 路徑
+func (p *RouteParser) SetFilePath(filePath string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.filePath = filePath
+}
+
+// SetTokenValidators 設置已註冊的 Token 驗證器名稱，載入時拒絕引用未註冊驗證器的路由配置
+func (p *RouteParser) SetTokenValidators(names []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.validators = make(map[string]bool, len(names))
+	for _, name := range names {
+		p.validators[name] = true
+	}
+}
+
 // LoadConfig 載入路由配置
 func (p *RouteParser) LoadConfig() error {
 	p.mutex.Lock()
@@ -97,15 +154,24 @@ func (p *RouteParser) LoadConfig() error {
 	if err := yaml.Unmarshal(data, &servicesConfig); err != nil {
 		return fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err := p.validateTokenValidators(&servicesConfig); err != nil {
+		if p.logger != nil {
+			p.logger.Error("Invalid route configuration", zap.Error(err))
+		}
+		return err
+	}
+	services, err := buildServices(servicesConfig.Services)
+	if err != nil {
+		if p.logger != nil {
+			p.logger.Error("Invalid route configuration", zap.Error(err))
+		}
+		return err
+	}
 
 	p.routes = make([]*RouteConfig, 0)
-	p.services = make(map[string]*ServiceConfig)
+	p.services = services
 	p.groups = make([]*RouteGroup, 0)
 
-	for name, service := range servicesConfig.Services {
-		serviceCopy := service
-		p.services[name] = &serviceCopy
-	}
 	for _, route := range servicesConfig.Routes {
 		routeCopy := route
 		p.routes = append(p.routes, &routeCopy)
@@ -115,6 +181,9 @@ func (p *RouteParser) LoadConfig() error {
 		p.groups = append(p.groups, &groupCopy)
 	}
 
+	p.ipFilter = servicesConfig.IPFilter
+	p.security = servicesConfig.Security
+
 	p.lastReload = time.Now()
 	if p.logger != nil {
 		p.logger.Info("Route configuration loaded successfully",
@@ -126,6 +195,53 @@ func (p *RouteParser) LoadConfig() error {
 	return nil
 }
 
+// buildServices 複製服務配置並建立上游 TLS 配置，證書或 CA 無法載入時拒絕整份配置
+func buildServices(configs map[string]ServiceConfig) (map[string]*ServiceConfig, error) {
+	services := make(map[string]*ServiceConfig, len(configs))
+	for name, service := range configs {
+		serviceCopy := service
+		if service.TLS != nil && service.TLS.Enabled {
+			tlsConfig, err := tlsconfig.NewUpstreamTLSConfig(service.TLS)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TLS configuration for service %s: %w", name, err)
+			}
+			serviceCopy.tlsConfig = tlsConfig
+		}
+		services[name] = &serviceCopy
+	}
+	return services, nil
+}
+
+// validateTokenValidators 檢查組與路由指定的 Token 驗證器均已註冊
+func (p *RouteParser) validateTokenValidators(servicesConfig *ServicesConfig) error {
+	if p.validators == nil {
+		return nil
+	}
+	check := func(owner, name string) error {
+		if name != "" && !p.validators[name] {
+			return fmt.Errorf("unknown token validator %q for %s", name, owner)
+		}
+		return nil
+	}
+
+	for _, route := range servicesConfig.Routes {
+		if err := check("route "+route.Pattern, route.TokenValidator); err != nil {
+			return err
+		}
+	}
+	for _, group := range servicesConfig.Groups {
+		if err := check("group "+group.Prefix, group.TokenValidator); err != nil {
+			return err
+		}
+		for _, route := range group.Routes {
+			if err := check("route "+group.Prefix+route.Pattern, route.TokenValidator); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // MatchRoute 匹配路由
 func (p *RouteParser) MatchRoute(method, path string) (*RouteConfig, *ServiceConfig, error) {
 	p.mutex.RLock()
@@ -210,6 +326,20 @@ func (p *RouteParser) GetAllServices() map[string]*ServiceConfig {
 	return p.services
 }
 
+// GetIPFilter 取得全局 IP 訪問控制規則，未設置時返回 nil
+func (p *RouteParser) GetIPFilter() *config.IPFilterRule {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.ipFilter
+}
+
+// GetSecurity 取得全局安全檢查設定，未設置時返回 nil
+func (p *RouteParser) GetSecurity() *config.RouteSecurityConfig {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.security
+}
+
 // GetLastReloadTime 取得最後重載時間
 func (p *RouteParser) GetLastReloadTime() time.Time {
 	p.mutex.RLock()
@@ -0,0 +1,401 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	_ "time/tzdata" // 確保容器內沒有時區資料時也能載入配置的時區
+
+	"expense-api-gateway/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// 配額範圍與週期
+const (
+	ScopeCompany = "company"
+	ScopeUser    = "user"
+	PeriodDay    = "day"
+	PeriodMonth  = "month"
+)
+
+// ErrUnknownPolicy 配額策略不存在
+var ErrUnknownPolicy = errors.New("unknown quota policy")
+
+// Subject 配額計算對象
+type Subject struct {
+	UserID    string
+	CompanyID string
+}
+
+// Usage 單個策略在當前週期的用量
+type Usage struct {
+	Policy    string    `json:"policy"`
+	Scope     string    `json:"scope"`
+	SubjectID string    `json:"subject_id"`
+	Period    string    `json:"period"`
+	Limit     int64     `json:"limit"` // 基本額度加追加額度
+	Granted   int64     `json:"granted"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+	Status    int       `json:"-"` // 用盡時返回的狀態碼
+}
+
+// Result 扣減結果
+type Result struct {
+	Allowed  bool
+	Usages   []Usage // 所有適用策略的用量
+	Exceeded *Usage  // 額度不足的策略
+}
+
+// Lowest 返回剩餘額度最少的用量
+func (r Result) Lowest() (Usage, bool) {
+	if r.Exceeded != nil {
+		return *r.Exceeded, true
+	}
+	if len(r.Usages) == 0 {
+		return Usage{}, false
+	}
+	lowest := r.Usages[0]
+	for _, usage := range r.Usages[1:] {
+		if usage.Remaining < lowest.Remaining {
+			lowest = usage
+		}
+	}
+	return lowest, true
+}
+
+// counter 持久化的用量計數
+type counter struct {
+	Used    int64     `json:"used"`
+	Granted int64     `json:"granted"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// Service 配額服務，用量保存在記憶體並定期寫入文件
+type Service struct {
+	logger   *zap.Logger
+	policies []config.QuotaPolicy
+	location *time.Location
+	filePath string
+	counters map[string]*counter
+	dirty    bool
+	mutex    sync.Mutex
+	now      func() time.Time
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// New 創建新的配額服務並載入已保存的用量
+func New(cfg *config.Config, logger *zap.Logger) (*Service, error) {
+	location := time.UTC
+	if cfg.Quota.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Quota.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota timezone: %w", err)
+		}
+		location = loc
+	}
+
+	s := &Service{
+		logger:   logger,
+		policies: cfg.Quota.Policies,
+		location: location,
+		filePath: cfg.Quota.FilePath,
+		counters: make(map[string]*counter),
+		now:      time.Now,
+		stopCh:   make(chan struct{}),
+	}
+	if s.filePath == "" {
+		s.filePath = "data/quota.json"
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if cfg.Quota.FlushInterval > 0 {
+		go s.flushLoop(cfg.Quota.FlushInterval)
+	}
+
+	return s, nil
+}
+
+// Consume 檢查所有適用策略並扣減用量，任一策略不足時不扣減
+func (s *Service) Consume(subject Subject, cost int64) Result {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	result := Result{Allowed: true}
+	type pending struct {
+		counter *counter
+		index   int
+	}
+	var updates []pending
+
+	for _, policy := range s.policies {
+		subjectID := subjectFor(policy, subject)
+		if subjectID == "" {
+			continue
+		}
+
+		c := s.counterFor(policy, subjectID, now)
+		usage := s.usage(policy, subjectID, c, now)
+		if usage.Remaining < cost {
+			result.Allowed = false
+			exceeded := usage
+			result.Exceeded = &exceeded
+			result.Usages = append(result.Usages, usage)
+			continue
+		}
+		updates = append(updates, pending{counter: c, index: len(result.Usages)})
+		result.Usages = append(result.Usages, usage)
+	}
+
+	if !result.Allowed || cost == 0 {
+		return result
+	}
+	for _, update := range updates {
+		update.counter.Used += cost
+		result.Usages[update.index].Used += cost
+		result.Usages[update.index].Remaining -= cost
+	}
+	s.dirty = true
+	return result
+}
+
+// Refund 退還已扣減的用量（僅限仍在同一週期的計數）
+func (s *Service) Refund(result Result, cost int64) {
+	if !result.Allowed || cost == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, usage := range result.Usages {
+		c, exists := s.counters[counterKey(usage.Policy, usage.SubjectID, usage.Period)]
+		if !exists {
+			continue
+		}
+		c.Used -= cost
+		if c.Used < 0 {
+			c.Used = 0
+		}
+	}
+	s.dirty = true
+}
+
+// Usage 返回對象在各策略當前週期的用量
+func (s *Service) Usage(scope, subjectID string) []Usage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	usages := make([]Usage, 0)
+	for _, policy := range s.policies {
+		if policy.Scope != scope {
+			continue
+		}
+		c := s.counterFor(policy, subjectID, now)
+		usages = append(usages, s.usage(policy, subjectID, c, now))
+	}
+	return usages
+}
+
+// Grant 為對象在當前週期追加額度
+func (s *Service) Grant(policyName, subjectID string, amount int64) (Usage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, policy := range s.policies {
+		if policy.Name != policyName {
+			continue
+		}
+		now := s.now()
+		c := s.counterFor(policy, subjectID, now)
+		c.Granted += amount
+		s.dirty = true
+		return s.usage(policy, subjectID, c, now), nil
+	}
+	return Usage{}, ErrUnknownPolicy
+}
+
+// Flush 將用量寫入文件
+func (s *Service) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// Close 停止定期寫入並保存用量
+func (s *Service) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	return s.Flush()
+}
+
+// SetClock 設置時間來源（用於測試）
+func (s *Service) SetClock(now func() time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.now = now
+}
+
+// counterFor 取得或創建當前週期的計數
+func (s *Service) counterFor(policy config.QuotaPolicy, subjectID string, now time.Time) *counter {
+	period, resetAt := s.period(policy.Period, now)
+	key := counterKey(policy.Name, subjectID, period)
+
+	c, exists := s.counters[key]
+	if !exists {
+		c = &counter{ResetAt: resetAt}
+		s.counters[key] = c
+	}
+	return c
+}
+
+// usage 組合用量資訊
+func (s *Service) usage(policy config.QuotaPolicy, subjectID string, c *counter, now time.Time) Usage {
+	period, _ := s.period(policy.Period, now)
+
+	limit := policy.Limit
+	if override, exists := policy.Overrides[subjectID]; exists {
+		limit = override
+	}
+	limit += c.Granted
+
+	remaining := limit - c.Used
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Usage{
+		Policy:    policy.Name,
+		Scope:     policy.Scope,
+		SubjectID: subjectID,
+		Period:    period,
+		Limit:     limit,
+		Granted:   c.Granted,
+		Used:      c.Used,
+		Remaining: remaining,
+		ResetAt:   c.ResetAt,
+		Status:    exhaustedStatus(policy),
+	}
+}
+
+// period 返回週期標識與週期結束時間（依配置時區的自然日或自然月）
+func (s *Service) period(kind string, now time.Time) (string, time.Time) {
+	local := now.In(s.location)
+	if kind == PeriodDay {
+		start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.location)
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+	}
+	start := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, s.location)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// load 從文件載入用量，已過期的週期會被忽略
+func (s *Service) load() error {
+	data, err := os.ReadFile(s.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read quota file: %w", err)
+	}
+
+	counters := make(map[string]*counter)
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return fmt.Errorf("failed to parse quota file: %w", err)
+	}
+
+	now := s.now()
+	for key, c := range counters {
+		if c.ResetAt.After(now) {
+			s.counters[key] = c
+		}
+	}
+	return nil
+}
+
+// save 以臨時文件加重命名的方式寫入，避免中途失敗留下不完整的文件
+func (s *Service) save() error {
+	now := s.now()
+	for key, c := range s.counters {
+		if !c.ResetAt.After(now) {
+			delete(s.counters, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(s.counters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal quota usage: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0o750); err != nil {
+		return fmt.Errorf("failed to create quota directory: %w", err)
+	}
+
+	tmp := s.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write quota file: %w", err)
+	}
+	if err := os.Rename(tmp, s.filePath); err != nil {
+		return fmt.Errorf("failed to replace quota file: %w", err)
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// flushLoop 定期寫入用量
+func (s *Service) flushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("Failed to flush quota usage", zap.Error(err))
+			}
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// subjectFor 返回策略適用的對象 ID，無法適用時返回空字符串
+func subjectFor(policy config.QuotaPolicy, subject Subject) string {
+	if policy.Scope == ScopeCompany {
+		return subject.CompanyID
+	}
+	return subject.UserID
+}
+
+// exhaustedStatus 額度用盡時的狀態碼
+func exhaustedStatus(policy config.QuotaPolicy) int {
+	if policy.Status != 0 {
+		return policy.Status
+	}
+	if policy.Period == PeriodDay {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusPaymentRequired
+}
+
+// counterKey 計數鍵
+func counterKey(policy, subjectID, period string) string {
+	return policy + "|" + subjectID + "|" + period
+}
@@ -29,6 +29,11 @@ func NewJWTManager(secretKey string, tokenExpiry, refreshExpiry time.Duration, i
 
 // GenerateToken 生成 JWT Token
 func (j *JWTManager) GenerateToken(user *domain.AuthUser) (string, error) {
+	return j.GenerateTokenWithExpiry(user, j.tokenExpiry)
+}
+
+// GenerateTokenWithExpiry 生成指定有效期的 JWT Token
+func (j *JWTManager) GenerateTokenWithExpiry(user *domain.AuthUser, expiry time.Duration) (string, error) {
 	now := time.Now()
 	claims := &domain.JWTClaims{
 		UserID:    user.ID,
@@ -37,10 +42,12 @@ func (j *JWTManager) GenerateToken(user *domain.AuthUser) (string, error) {
 		Email:     user.Email,
 		Username:  user.Username,
 		Roles:     user.Roles,
-		Exp:       now.Add(j.tokenExpiry).Unix(),
+		Exp:       now.Add(expiry).Unix(),
 		Iat:       now.Unix(),
 		IssuedAt:  now.Unix(),
-		ExpiresAt: now.Add(j.tokenExpiry).Unix(),
+		ExpiresAt: now.Add(expiry).Unix(),
+
+		ImpersonatorID: user.ImpersonatorID,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
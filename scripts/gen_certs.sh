@@ -0,0 +1,59 @@
+#!/bin/bash
+
+# 本地開發用證書生成腳本
+# 生成 CA、Gateway 服務端證書、客戶端證書與上游服務證書
+
+set -e
+
+CERT_DIR=${1:-certs}
+DAYS=${DAYS:-365}
+
+# 顏色定義
+GREEN='\033[0;32m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+print_info() {
+    echo -e "${BLUE}[INFO]${NC} $1"
+}
+
+print_success() {
+    echo -e "${GREEN}[SUCCESS]${NC} $1"
+}
+
+# 簽發證書 name cn san
+issue_cert() {
+    local name=$1
+    local cn=$2
+    local san=$3
+    local usage=$4
+
+    openssl req -newkey rsa:2048 -nodes \
+        -keyout "$CERT_DIR/$name.key" \
+        -out "$CERT_DIR/$name.csr" \
+        -subj "/CN=$cn" 2>/dev/null
+
+    printf "subjectAltName=%s\nextendedKeyUsage=%s\n" "$san" "$usage" > "$CERT_DIR/$name.ext"
+
+    openssl x509 -req -in "$CERT_DIR/$name.csr" \
+        -CA "$CERT_DIR/ca.crt" -CAkey "$CERT_DIR/ca.key" -CAcreateserial \
+        -out "$CERT_DIR/$name.crt" -days "$DAYS" \
+        -extfile "$CERT_DIR/$name.ext" 2>/dev/null
+
+    rm -f "$CERT_DIR/$name.csr" "$CERT_DIR/$name.ext"
+    print_success "已生成 $CERT_DIR/$name.crt"
+}
+
+mkdir -p "$CERT_DIR"
+
+print_info "生成本地 CA..."
+openssl req -x509 -newkey rsa:2048 -nodes \
+    -keyout "$CERT_DIR/ca.key" -out "$CERT_DIR/ca.crt" \
+    -days "$DAYS" -subj "/CN=expense-local-ca" 2>/dev/null
+print_success "已生成 $CERT_DIR/ca.crt"
+
+issue_cert "gateway" "localhost" "DNS:localhost,DNS:api.expense.local,IP:127.0.0.1" "serverAuth"
+issue_cert "client" "ocr-worker" "DNS:ocr-worker.expense.local,URI:spiffe://expense/ocr-worker" "clientAuth"
+issue_cert "upstream" "localhost" "DNS:localhost,IP:127.0.0.1" "serverAuth"
+
+print_info "證書已生成於 $CERT_DIR/，可在 configs/config.yaml 的 tls 區塊中引用"
@@ -0,0 +1,164 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/middleware/admission"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newAdmissionTestConfig() *config.Config {
+	return &config.Config{
+		Admission: config.AdmissionConfig{
+			Enabled:         true,
+			MaxInFlight:     100,
+			CPUThreshold:    0.8,
+			TrustedClients:  []string{"svc-batch"},
+			DefaultPriority: "normal",
+			RolePriorities:  map[string]string{"finance": "high"},
+			RetryAfter:      2 * time.Second,
+		},
+	}
+}
+
+func newAdmissionTestRouter(middleware *admission.AdmissionMiddleware, routePriority string) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if id := c.GetHeader("X-Test-Service"); id != "" {
+			auth.SetAuthContext(c, &domain.AuthUser{ID: id, Role: "service"}, auth.AuthMethodClientCert, nil)
+		} else {
+			auth.SetAuthContext(c, &domain.AuthUser{ID: "u-1", Role: c.GetHeader("X-Test-Role")}, auth.AuthMethodBearer, nil)
+		}
+		c.Next()
+	})
+	r.GET("/test", middleware.Admit(routePriority), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("request_priority"))
+	})
+	return r
+}
+
+func TestAdmissionMiddleware_Priority(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware := admission.NewAdmissionMiddleware(newAdmissionTestConfig(), zap.NewNop(), nil)
+	middleware.SetCPUSource(func(time.Time) float64 { return 0 })
+
+	tests := []struct {
+		name          string
+		routePriority string
+		headers       map[string]string
+		expected      string
+	}{
+		{name: "默認優先級", expected: "normal"},
+		{name: "按角色", headers: map[string]string{"X-Test-Role": "finance"}, expected: "high"},
+		{name: "路由配置優先於角色", routePriority: "low", headers: map[string]string{"X-Test-Role": "finance"}, expected: "low"},
+		{name: "不受信任的請求頭被忽略", headers: map[string]string{"X-Request-Priority": "critical"}, expected: "normal"},
+		{name: "未列入白名單的客戶端證書", headers: map[string]string{"X-Request-Priority": "critical", "X-Test-Service": "svc-other"}, expected: "normal"},
+		{name: "受信任客戶端的請求頭", routePriority: "low", headers: map[string]string{"X-Request-Priority": "critical", "X-Test-Service": "svc-batch"}, expected: "critical"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newAdmissionTestRouter(middleware, tt.routePriority)
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+		})
+	}
+}
+
+func TestAdmissionMiddleware_ShedLowestPriorityFirst(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := newAdmissionTestConfig()
+	monitorService := monitor.New(cfg, zap.NewNop())
+	middleware := admission.NewAdmissionMiddleware(cfg, zap.NewNop(), monitorService)
+
+	cpu := 0.0
+	middleware.SetCPUSource(func(time.Time) float64 { return cpu })
+
+	serve := func(routePriority string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		newAdmissionTestRouter(middleware, routePriority).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+		return w
+	}
+
+	// 負載 0.75：只拒絕 low
+	cpu = 0.6
+	assert.InDelta(t, 0.75, middleware.Signals().Load, 0.001)
+	w := serve("low")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "GATEWAY_OVERLOADED")
+	assert.Equal(t, http.StatusOK, serve("normal").Code)
+
+	// 負載 0.9：拒絕 normal，保留 high
+	cpu = 0.72
+	assert.Equal(t, http.StatusServiceUnavailable, serve("normal").Code)
+	assert.Equal(t, http.StatusOK, serve("high").Code)
+
+	// 負載超過 1：只保留 critical
+	cpu = 0.9
+	assert.Equal(t, http.StatusServiceUnavailable, serve("high").Code)
+	assert.Equal(t, http.StatusOK, serve("critical").Code)
+
+	metrics := monitorService.GetMetrics().Admission
+	require.Contains(t, metrics, "low")
+	assert.Equal(t, int64(1), metrics["low"].Shed)
+	assert.Equal(t, int64(1), metrics["normal"].Admitted)
+	assert.Equal(t, int64(1), metrics["normal"].Shed)
+	assert.Equal(t, int64(1), metrics["high"].Admitted)
+	assert.Equal(t, int64(1), metrics["high"].Shed)
+	assert.Equal(t, int64(1), metrics["critical"].Admitted)
+}
+
+func TestAdmissionMiddleware_LatencySignal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := newAdmissionTestConfig()
+	cfg.Admission.CPUThreshold = 0
+	cfg.Admission.TargetLatency = time.Second
+	middleware := admission.NewAdmissionMiddleware(cfg, zap.NewNop(), nil)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	middleware.SetClock(func() time.Time { return now })
+
+	r := gin.New()
+	r.GET("/slow", middleware.Admit("normal"), func(c *gin.Context) {
+		now = now.Add(950 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	r.GET("/low", middleware.Admit("low"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	signals := middleware.Signals()
+	assert.Equal(t, 950*time.Millisecond, signals.Latency)
+	assert.InDelta(t, 0.95, signals.Load, 0.001)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/low", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// 長時間沒有樣本時忽略延遲信號
+	now = now.Add(10 * time.Second)
+	assert.Zero(t, middleware.Signals().Load)
+}
@@ -0,0 +1,174 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/bodylimit"
+	"expense-api-gateway/internal/middleware/security"
+	"expense-api-gateway/internal/service/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// chunkedReader 隱藏長度的讀取器，使請求以分塊傳輸發送
+type chunkedReader struct {
+	io.Reader
+}
+
+func TestBodyLimitMiddleware_ResolveLimit(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.MaxBodySize = 1000
+	cfg.Discovery.Services = map[string]config.ServiceConfig{
+		"file-service": {MaxBodySize: 500},
+	}
+	middleware := bodylimit.NewBodyLimitMiddleware(cfg, zap.NewNop())
+
+	assert.Equal(t, int64(100), middleware.ResolveLimit(100, "file-service", 200))
+	assert.Equal(t, int64(200), middleware.ResolveLimit(0, "file-service", 200))
+	assert.Equal(t, int64(500), middleware.ResolveLimit(0, "file-service", 0))
+	assert.Equal(t, int64(1000), middleware.ResolveLimit(0, "user-service", 0))
+
+	middleware.SetRouteLimit("/api/v1/files/upload", 5000)
+	assert.Equal(t, int64(5000), middleware.Limit("/api/v1/files/upload"))
+	assert.Equal(t, int64(1000), middleware.Limit("/api/v1/users"))
+	middleware.SetRouteLimit("/api/v1/files/upload", 0)
+	assert.Equal(t, int64(1000), middleware.Limit("/api/v1/files/upload"))
+}
+
+func TestBodyLimitMiddleware_Global(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.Server.MaxBodySize = 16
+	middleware := bodylimit.NewBodyLimitMiddleware(cfg, zap.NewNop())
+	middleware.SetRouteLimit("/upload", 64)
+
+	router := gin.New()
+	router.Use(middleware.Global())
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if limit, exceeded := bodylimit.ExceededLimit(err); exceeded {
+			bodylimit.Reject(c, limit)
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	}
+	router.POST("/upload", echo)
+	router.POST("/notes", echo)
+
+	send := func(path string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		if _, ok := body.(chunkedReader); ok {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 路由上限高於全局上限
+	w := send("/upload", strings.NewReader(strings.Repeat("a", 64)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "64", w.Body.String())
+
+	// 聲明的長度超過上限時在讀取前拒絕
+	w = send("/notes", strings.NewReader(strings.Repeat("a", 17)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "PAYLOAD_TOO_LARGE", response["code"])
+	assert.Equal(t, float64(16), response["limit"])
+
+	// 未聲明長度的請求讀取超過上限時返回錯誤
+	w = send("/upload", chunkedReader{strings.NewReader(strings.Repeat("a", 65))})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = send("/upload", chunkedReader{strings.NewReader(strings.Repeat("a", 10))})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Body.String())
+}
+
+func TestBodyLimitMiddleware_Proxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type received struct {
+		contentLength int64
+		size          int
+	}
+	requests := make(chan received, 10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		requests <- received{contentLength: r.ContentLength, size: len(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	servicesFile := filepath.Join(t.TempDir(), "services.yaml")
+	require.NoError(t, os.WriteFile(servicesFile, []byte(`
+routes:
+  - pattern: "/api/v1/expenses/*"
+    service: "expense-service"
+    max_body_size: 1024
+services:
+  expense-service:
+    hosts: ["127.0.0.1"]
+`), 0600))
+
+	logger := zap.NewNop()
+	routeParser := proxy.NewRouteParser(nil, logger)
+	routeParser.SetFilePath(servicesFile)
+	require.NoError(t, routeParser.LoadConfig())
+
+	cfg := &config.Config{}
+	cfg.Security.XSS.Enabled = true
+	proxyService := proxy.NewProxyService(cfg, logger, routeParser, newStaticDiscovery(t, upstream.URL))
+	middleware := bodylimit.NewBodyLimitMiddleware(cfg, logger)
+	middleware.SetRouteLimit("/api/v1/expenses/*path", 1024)
+
+	router := gin.New()
+	router.Use(middleware.Global())
+	router.Use(security.NewXSSMiddleware(cfg, logger).XSSProtection())
+	router.Any("/api/v1/expenses/*path", proxyService.ProxyGinRequest)
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	send := func(body io.Reader) int {
+		req, err := http.NewRequest(http.MethodPost, gateway.URL+"/api/v1/expenses/create", body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// 轉發的 Content-Length 與實際請求體一致，不再被改為路由上限
+	payload := `{"description":"taxi"}`
+	require.Equal(t, http.StatusOK, send(strings.NewReader(payload)))
+	got := <-requests
+	assert.Equal(t, int64(len(payload)), got.contentLength)
+	assert.Equal(t, len(payload), got.size)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(bytes.NewReader(make([]byte, 2048))))
+
+	// 分塊傳輸的請求體超過上限時，不轉發截斷的內容
+	large := `{"description":"` + strings.Repeat("a", 2048) + `"}`
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(chunkedReader{strings.NewReader(large)}))
+	assert.Equal(t, http.StatusOK, send(chunkedReader{strings.NewReader(payload)}))
+	got = <-requests
+	assert.Equal(t, len(payload), got.size)
+	assert.Empty(t, requests, "超過上限的請求不應到達上游")
+}
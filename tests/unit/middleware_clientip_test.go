@@ -0,0 +1,208 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/clientip"
+	"expense-api-gateway/internal/middleware/ratelimit"
+	"expense-api-gateway/internal/service/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestClientIPResolver_Resolve(t *testing.T) {
+	resolver, err := clientip.NewResolver(config.ClientIPConfig{
+		TrustedProxies: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.1"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "不受信任的對端忽略轉發請求頭",
+			remoteAddr: "203.0.113.9:4000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "由右至左跳過受信任代理",
+			remoteAddr: "10.0.0.2:4000",
+			headers:    map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.0.0.5"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "全部為受信任代理時取最左側",
+			remoteAddr: "10.0.0.2:4000",
+			headers:    map[string]string{"X-Forwarded-For": "10.1.1.1, 10.0.0.5"},
+			expected:   "10.1.1.1",
+		},
+		{
+			name:       "無效地址中斷鏈",
+			remoteAddr: "10.0.0.2:4000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7, garbage, 10.0.0.5"},
+			expected:   "10.0.0.5",
+		},
+		{
+			name:       "Forwarded 優先於 X-Forwarded-For",
+			remoteAddr: "192.168.1.1:4000",
+			headers: map[string]string{
+				"Forwarded":       `for=198.51.100.7;proto=https, for="[2001:db8:cafe::17]:4711"`,
+				"X-Forwarded-For": "6.6.6.6",
+			},
+			expected: "198.51.100.7",
+		},
+		{
+			name:       "Forwarded 的 IPv6 客戶端",
+			remoteAddr: "10.0.0.2:4000",
+			headers:    map[string]string{"Forwarded": `for="[2001:db9::1]:4711";by=10.0.0.2`},
+			expected:   "2001:db9::1",
+		},
+		{
+			name:       "Forwarded 隱藏地址時回退到下一個請求頭",
+			remoteAddr: "10.0.0.2:4000",
+			headers: map[string]string{
+				"Forwarded": "for=_hidden",
+				"X-Real-IP": "198.51.100.8",
+			},
+			expected: "198.51.100.8",
+		},
+		{
+			name:       "沒有轉發請求頭時使用對端地址",
+			remoteAddr: "10.0.0.2:4000",
+			expected:   "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.expected, resolver.Resolve(req))
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:4000"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 198.51.100.7, 10.0.0.5")
+	assert.Equal(t, []string{"198.51.100.7", "10.0.0.5"}, resolver.ForwardedChain(req), "不應轉發無法驗證的部分")
+
+	_, err = clientip.NewResolver(config.ClientIPConfig{TrustedProxies: []string{"not-a-cidr"}})
+	assert.Error(t, err)
+	_, err = clientip.NewResolver(config.ClientIPConfig{Headers: []string{"X-Client-IP"}})
+	assert.Error(t, err)
+}
+
+func TestClientIP_RateLimitSpoofing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled: true,
+			IPLimit: config.RateLimitRule{Requests: 1, Window: time.Minute},
+		},
+	}
+	rateLimitMiddleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+	defer rateLimitMiddleware.Close()
+
+	resolver, err := clientip.NewResolver(config.ClientIPConfig{})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(clientip.Middleware(resolver))
+	r.Use(rateLimitMiddleware.IPRateLimit())
+	r.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, clientip.FromContext(c))
+	})
+
+	send := func(forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "203.0.113.9:4000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("1.1.1.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "203.0.113.9", w.Body.String())
+	assert.Equal(t, http.StatusTooManyRequests, send("2.2.2.2").Code, "偽造 X-Forwarded-For 不應繞過 IP 限流")
+}
+
+func TestProxyService_ForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	servicesFile := filepath.Join(t.TempDir(), "services.yaml")
+	require.NoError(t, os.WriteFile(servicesFile, []byte(`
+routes:
+  - pattern: "/api/v1/expenses/*"
+    service: "expense-service"
+services:
+  expense-service:
+    hosts: ["127.0.0.1"]
+`), 0600))
+
+	logger := zap.NewNop()
+	routeParser := proxy.NewRouteParser(nil, logger)
+	routeParser.SetFilePath(servicesFile)
+	require.NoError(t, routeParser.LoadConfig())
+
+	send := func(cfg *config.Config) http.Header {
+		resolver, err := clientip.NewResolver(cfg.ClientIP)
+		require.NoError(t, err)
+		proxyService := proxy.NewProxyService(cfg, logger, routeParser, newStaticDiscovery(t, upstream.URL))
+
+		router := gin.New()
+		router.Use(clientip.Middleware(resolver))
+		router.Any("/api/v1/expenses/*path", proxyService.ProxyGinRequest)
+		gateway := httptest.NewServer(router)
+		defer gateway.Close()
+
+		req, err := http.NewRequest(http.MethodGet, gateway.URL+"/api/v1/expenses/list", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", "6.6.6.6, 198.51.100.7")
+		req.Header.Set("Forwarded", "for=6.6.6.6")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return <-received
+	}
+
+	// 網關直接面對客戶端：丟棄客戶端提供的鏈
+	headers := send(&config.Config{})
+	assert.Equal(t, "127.0.0.1", headers.Get("X-Forwarded-For"))
+	assert.Equal(t, "127.0.0.1", headers.Get("X-Real-IP"))
+	assert.Equal(t, "for=127.0.0.1", headers.Get("Forwarded"))
+
+	// 位於受信任負載均衡之後：保留可驗證的鏈並附加對端地址
+	headers = send(&config.Config{ClientIP: config.ClientIPConfig{
+		TrustedProxies: []string{"127.0.0.1"},
+		Headers:        []string{"X-Forwarded-For"},
+	}})
+	assert.Equal(t, "198.51.100.7, 127.0.0.1", headers.Get("X-Forwarded-For"))
+	assert.Equal(t, "198.51.100.7", headers.Get("X-Real-IP"))
+	assert.Equal(t, "for=198.51.100.7, for=127.0.0.1", headers.Get("Forwarded"))
+}
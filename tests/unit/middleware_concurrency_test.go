@@ -0,0 +1,215 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/concurrency"
+	"expense-api-gateway/internal/service/monitor"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestConcurrencyLimiter_Queue(t *testing.T) {
+	limiter := concurrency.NewLimiter("route:ocr", config.ConcurrencyRule{
+		MaxConcurrent: 1,
+		MaxQueue:      1,
+		QueueTimeout:  time.Second,
+	})
+	ctx := context.Background()
+
+	require.NoError(t, limiter.Acquire(ctx))
+
+	// 第二個請求進入隊列，名額釋放後獲得
+	acquired := make(chan error, 1)
+	go func() { acquired <- limiter.Acquire(ctx) }()
+	require.Eventually(t, func() bool { return limiter.Stats().Queued == 1 }, time.Second, 5*time.Millisecond)
+
+	// 隊列已滿時直接拒絕
+	assert.ErrorIs(t, limiter.Acquire(ctx), concurrency.ErrQueueFull)
+
+	limiter.Release(10*time.Millisecond, false)
+	require.NoError(t, <-acquired)
+
+	stats := limiter.Stats()
+	assert.Equal(t, 1, stats.InFlight)
+	assert.Equal(t, 0, stats.Queued)
+	assert.Equal(t, int64(1), stats.Rejected)
+
+	limiter.Release(10*time.Millisecond, false)
+	assert.Equal(t, 0, limiter.Stats().InFlight)
+}
+
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	limiter := concurrency.NewLimiter("service:ai", config.ConcurrencyRule{
+		MaxConcurrent: 1,
+		MaxQueue:      5,
+		QueueTimeout:  20 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	require.NoError(t, limiter.Acquire(ctx))
+	assert.ErrorIs(t, limiter.Acquire(ctx), concurrency.ErrQueueTimeout)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, limiter.Acquire(cancelled), context.Canceled)
+
+	stats := limiter.Stats()
+	assert.Equal(t, 0, stats.Queued, "超時或取消的請求應離開隊列")
+	assert.Equal(t, int64(1), stats.Timeouts)
+}
+
+func TestConcurrencyLimiter_AIMD(t *testing.T) {
+	limiter := concurrency.NewLimiter("service:ai", config.ConcurrencyRule{
+		Mode:             concurrency.ModeAIMD,
+		MaxConcurrent:    10,
+		MinLimit:         2,
+		MaxLimit:         12,
+		LatencyThreshold: time.Second,
+	})
+	ctx := context.Background()
+
+	// 使用率高且延遲正常時逐步增加
+	for i := 0; i < 10; i++ {
+		require.NoError(t, limiter.Acquire(ctx))
+	}
+	for i := 0; i < 10; i++ {
+		limiter.Release(100*time.Millisecond, false)
+	}
+	assert.Equal(t, 12, limiter.Stats().Limit, "不應超過 max_limit")
+
+	// 延遲超過閾值時乘性降低
+	require.NoError(t, limiter.Acquire(ctx))
+	limiter.Release(2*time.Second, false)
+	assert.Equal(t, 10, limiter.Stats().Limit)
+
+	// 上游過載時持續降低，但不低於 min_limit
+	for i := 0; i < 50; i++ {
+		require.NoError(t, limiter.Acquire(ctx))
+		limiter.Release(100*time.Millisecond, true)
+	}
+	assert.Equal(t, 2, limiter.Stats().Limit)
+}
+
+func TestConcurrencyLimiter_Gradient(t *testing.T) {
+	limiter := concurrency.NewLimiter("service:ai", config.ConcurrencyRule{
+		Mode:          concurrency.ModeGradient,
+		MaxConcurrent: 20,
+		MinLimit:      5,
+		MaxLimit:      100,
+	})
+	ctx := context.Background()
+
+	run := func(rtt time.Duration, rounds int) {
+		for i := 0; i < rounds; i++ {
+			held := limiter.Stats().Limit
+			for j := 0; j < held; j++ {
+				require.NoError(t, limiter.Acquire(ctx))
+			}
+			for j := 0; j < held; j++ {
+				limiter.Release(rtt, false)
+			}
+		}
+	}
+
+	// 延遲穩定時上限逐步增加
+	run(100*time.Millisecond, 3)
+	grown := limiter.Stats().Limit
+	assert.Greater(t, grown, 20)
+
+	// 延遲明顯上升時上限下降
+	run(time.Second, 3)
+	assert.Less(t, limiter.Stats().Limit, grown)
+	assert.GreaterOrEqual(t, limiter.Stats().Limit, 5)
+}
+
+func TestConcurrencyMiddleware_Limit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Concurrency: config.ConcurrencyConfig{Enabled: true, RetryAfter: 3 * time.Second},
+	}
+	monitorService := monitor.New(cfg, zap.NewNop())
+	middleware := concurrency.NewConcurrencyMiddleware(cfg, zap.NewNop(), monitorService)
+
+	routeRule := &config.ConcurrencyRule{MaxConcurrent: 5}
+	serviceRule := &config.ConcurrencyRule{MaxConcurrent: 1}
+	limiters := middleware.ResolveLimiters("/api/v1/ai/ocr", routeRule, "ai-service", serviceRule)
+	require.Len(t, limiters, 2)
+	assert.Same(t, limiters[1], middleware.ResolveLimiters("/api/v1/ai/analyze", nil, "ai-service", serviceRule)[0],
+		"同一服務的路由應共用服務級別限制器")
+
+	release := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	r := gin.New()
+	r.POST("/api/v1/ai/ocr", middleware.Limit(limiters...), func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/ai/ocr", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}()
+	<-entered
+
+	// 服務名額已用完且不排隊，返回 503
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/ai/ocr", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "UPSTREAM_SATURATED")
+	assert.Equal(t, 1, limiters[0].Stats().InFlight, "被拒絕時應歸還已取得的路由名額")
+
+	metrics := monitorService.GetMetrics().Concurrency["service:ai-service"]
+	require.NotNil(t, metrics)
+	assert.Equal(t, 1, metrics.InFlight)
+	assert.Equal(t, int64(1), metrics.Rejected)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 0, limiters[0].Stats().InFlight)
+	assert.Equal(t, 0, monitorService.GetMetrics().Concurrency["route:/api/v1/ai/ocr"].InFlight)
+}
+
+func TestConcurrencyMiddleware_ReleaseOnPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Concurrency: config.ConcurrencyConfig{Enabled: true}}
+	middleware := concurrency.NewConcurrencyMiddleware(cfg, zap.NewNop(), nil)
+	limiters := middleware.ResolveLimiters("/api/v1/ai/ocr", &config.ConcurrencyRule{MaxConcurrent: 1}, "", nil)
+	require.Len(t, limiters, 1)
+
+	// 客戶端斷開時反向代理以 http.ErrAbortHandler panic，由 Recovery 捕獲
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.POST("/api/v1/ai/ocr", middleware.Limit(limiters...), func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/ai/ocr", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code, "名額應在 panic 後歸還")
+	}
+	assert.Equal(t, 0, limiters[0].Stats().InFlight)
+}
+
+func TestConcurrencyMiddleware_Disabled(t *testing.T) {
+	middleware := concurrency.NewConcurrencyMiddleware(&config.Config{}, zap.NewNop(), nil)
+	assert.Empty(t, middleware.ResolveLimiters("/api/v1/ai/ocr", &config.ConcurrencyRule{MaxConcurrent: 1}, "ai-service", nil))
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func TestCORSMiddleware_AllowedOrigin(t *testing.T) {
@@ -115,3 +117,237 @@ func TestCORSMiddleware_Disabled(t *testing.T) {
 	// 因為它會使用空配置，但對於允許的來源仍會設置標頭
 	assert.Equal(t, "http://localhost:3000", w.Header().Get("Access-Control-Allow-Origin"))
 }
+
+func TestCORSMiddleware_WildcardWithoutCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		CORS: config.CORSConfig{
+			Enabled:        true,
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST"},
+			AllowedHeaders: []string{"Content-Type"},
+			MaxAge:         86400,
+		},
+	}
+
+	router := gin.New()
+	router.Use(cors.Middleware(cfg))
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// 允許所有來源時不得允許攜帶憑證
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+// corsRequest 發送帶 Origin 的請求，preflightMethod 不為空時作為預檢請求
+func corsRequest(router http.Handler, method, path, origin, preflightMethod string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Origin", origin)
+	if preflightMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", preflightMethod)
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type, X-CSRF-Token")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSMiddleware_OriginPatterns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		CORS: config.CORSConfig{
+			AllowedOrigins: []string{
+				"https://app.example.com",
+				"https://*.tenant.example.com",
+				`regex:https://review-[0-9]+\.preview\.example\.com`,
+			},
+			AllowedMethods:   []string{"GET", "POST"},
+			AllowedHeaders:   []string{"*"},
+			ExposedHeaders:   []string{"X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           600,
+		},
+	}
+	router := gin.New()
+	router.Use(cors.Middleware(cfg))
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	for _, origin := range []string{
+		"https://app.example.com",
+		"https://acme.tenant.example.com",
+		"https://eu.acme.tenant.example.com",
+		"https://review-42.preview.example.com",
+	} {
+		w := corsRequest(router, http.MethodGet, "/test", origin, "")
+		assert.Equal(t, http.StatusOK, w.Code, origin)
+		assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"), origin)
+		assert.Equal(t, "X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"), origin)
+		assert.Contains(t, w.Header().Values("Vary"), "Origin", origin)
+	}
+
+	for _, origin := range []string{
+		"https://tenant.example.com",
+		"http://acme.tenant.example.com",
+		"https://acme.tenant.example.com.evil.com",
+		"https://evil.com/.tenant.example.com",
+		"https://review-42.preview.example.com.evil.com",
+		"https://review-x.preview.example.com",
+		"null",
+	} {
+		w := corsRequest(router, http.MethodGet, "/test", origin, "")
+		assert.Equal(t, http.StatusForbidden, w.Code, origin)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	// 預檢請求：* 請求頭以聲明的值回應
+	w := corsRequest(router, http.MethodOptions, "/test", "https://app.example.com", "POST")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-CSRF-Token", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSMiddleware_WildcardWithExplicitOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		CORS: config.CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com", "*"},
+			AllowedMethods:   []string{"GET"},
+			AllowCredentials: true,
+		},
+	}
+	router := gin.New()
+	router.Use(cors.Middleware(cfg))
+	router.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// 明確列出的來源允許攜帶憑證
+	w := corsRequest(router, http.MethodGet, "/test", "https://app.example.com", "")
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// 其他來源只以 * 回應，不允許攜帶憑證
+	w = corsRequest(router, http.MethodGet, "/test", "https://evil.example.com", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// 同源請求不需要 CORS 響應頭
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Host = "gateway.example.com"
+	req.Header.Set("Origin", "https://gateway.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_GroupPolicies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		CORS: config.CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "Authorization"},
+			MaxAge:         86400,
+		},
+	}
+	middleware := cors.NewCORSMiddleware(cfg, zap.NewNop())
+	middleware.SetGroupPolicy("/api/v1/auth", &config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"POST"},
+		AllowCredentials: true,
+	})
+	middleware.SetGroupPolicy("/api/v1/admin", nil)
+	middleware.SetGroupPolicy("/api/v1/files", &config.CORSConfig{})
+
+	router := gin.New()
+	router.Use(middleware.Global())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/api/v1/auth/login", ok)
+	router.GET("/api/v1/admin/users", ok)
+	router.GET("/api/v1/files/list", ok)
+	router.GET("/health", ok)
+
+	// 組策略：只允許前端來源並允許攜帶憑證，其餘字段繼承默認策略
+	w := corsRequest(router, http.MethodOptions, "/api/v1/auth/login", "https://app.example.com", "POST")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "86400", w.Header().Get("Access-Control-Max-Age"))
+	w = corsRequest(router, http.MethodPost, "/api/v1/auth/login", "https://other.example.com", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 未啟用 cors 的組不發送 CORS 響應頭
+	w = corsRequest(router, http.MethodGet, "/api/v1/admin/users", "https://app.example.com", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	w = corsRequest(router, http.MethodOptions, "/api/v1/admin/users", "https://app.example.com", "GET")
+	assert.NotEqual(t, http.StatusNoContent, w.Code)
+
+	// 啟用 cors 但未聲明策略的組與組外請求使用默認策略
+	for _, path := range []string{"/api/v1/files/list", "/health"} {
+		w = corsRequest(router, http.MethodGet, path, "https://any.example.com", "")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"), path)
+	}
+
+	// 前綴需以路徑分段匹配
+	router.GET("/api/v1/authz", ok)
+	w = corsRequest(router, http.MethodGet, "/api/v1/authz", "https://any.example.com", "")
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_MergeUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	upstream := http.Header{}
+	upstream.Set("Access-Control-Allow-Origin", "*")
+	upstream.Set("Content-Type", "application/json")
+
+	// 網關未處理 CORS 時保留上游的響應頭
+	cors.MergeUpstream(c, upstream)
+	assert.Equal(t, "*", upstream.Get("Access-Control-Allow-Origin"))
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "https://app.example.com")
+	cors.MergeUpstream(c, upstream)
+	assert.Empty(t, upstream.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "application/json", upstream.Get("Content-Type"))
+}
+
+func TestCORSConfig_Validate(t *testing.T) {
+	valid := config.CORSConfig{AllowedOrigins: []string{
+		"*", "https://app.example.com", "https://*.example.com", "http://*.example.com:8080", `regex:https://[a-z]+\.example\.com`,
+	}}
+	require.NoError(t, valid.Validate())
+
+	for _, origin := range []string{"app.example.com", "https://app.*.com", "https://*example.com", "*.example.com", "regex:(["} {
+		invalid := config.CORSConfig{AllowedOrigins: []string{origin}}
+		assert.Error(t, invalid.Validate(), origin)
+	}
+
+	// 無效的組策略拒絕跨源請求
+	middleware := cors.NewCORSMiddleware(&config.Config{CORS: config.CORSConfig{AllowedOrigins: []string{"*"}}}, zap.NewNop())
+	middleware.SetGroupPolicy("/api/v1/auth", &config.CORSConfig{AllowedOrigins: []string{"regex:(["}})
+	router := gin.New()
+	router.Use(middleware.Global())
+	router.GET("/api/v1/auth/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+	w := corsRequest(router, http.MethodGet, "/api/v1/auth/me", "https://app.example.com", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
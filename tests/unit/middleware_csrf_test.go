@@ -0,0 +1,156 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newCSRFTestRouter 創建 CSRF 測試路由，以 Authorization 頭區分 Bearer 與會話認證
+func newCSRFTestRouter(enabled bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		Security: config.SecurityConfig{
+			CSRF: config.CSRFConfig{
+				Enabled:        enabled,
+				TrustedOrigins: []string{"https://app.example.com"},
+			},
+		},
+		ClientIP: config.ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}},
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		user := &domain.AuthUser{ID: "u-1", Role: "user"}
+		if c.GetHeader("Authorization") != "" {
+			auth.SetAuthContext(c, user, auth.AuthMethodBearer, nil)
+		} else if _, err := c.Request.Cookie("gw_session"); err == nil {
+			auth.SetAuthContext(c, user, auth.AuthMethodSession, nil)
+		}
+		c.Next()
+	})
+	r.Use(security.NewCSRFMiddleware(cfg, zap.NewNop()).CSRFProtection())
+	r.Any("/api/expenses", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	return r
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	r := newCSRFTestRouter(true)
+
+	// 安全方法簽發 CSRF token
+	req := httptest.NewRequest(http.MethodGet, "http://gateway.local/api/expenses", nil)
+	req.AddCookie(&http.Cookie{Name: "gw_session", Value: "session"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	csrfCookie := findCookie(w, "gw_csrf")
+	require.NotNil(t, csrfCookie)
+	assert.False(t, csrfCookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, csrfCookie.SameSite)
+
+	tests := []struct {
+		name       string
+		session    bool
+		bearer     bool
+		token      string
+		origin     string
+		referer    string
+		wantStatus int
+	}{
+		{"session without token", true, false, "", "", "", http.StatusForbidden},
+		{"session with wrong token", true, false, "forged", "", "", http.StatusForbidden},
+		{"session with token same origin", true, false, csrfCookie.Value, "http://gateway.local", "", http.StatusOK},
+		{"session with token trusted origin", true, false, csrfCookie.Value, "https://app.example.com", "", http.StatusOK},
+		{"session with token same host other scheme", true, false, csrfCookie.Value, "https://gateway.local", "", http.StatusForbidden},
+		{"session with token cross origin", true, false, csrfCookie.Value, "https://evil.example.com", "", http.StatusForbidden},
+		{"session with token cross site referer", true, false, csrfCookie.Value, "", "https://evil.example.com/page", http.StatusForbidden},
+		{"session with token null origin", true, false, csrfCookie.Value, "null", "", http.StatusForbidden},
+		{"bearer without token", false, true, "", "https://evil.example.com", "", http.StatusOK},
+		{"anonymous without token", false, false, "", "", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://gateway.local/api/expenses", nil)
+			if tt.session {
+				req.AddCookie(&http.Cookie{Name: "gw_session", Value: "session"})
+				req.AddCookie(csrfCookie)
+			}
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			if tt.token != "" {
+				req.Header.Set("X-CSRF-Token", tt.token)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestCSRFMiddleware_SchemeMismatch(t *testing.T) {
+	r := newCSRFTestRouter(true)
+
+	send := func(remoteAddr, target, origin, forwardedProto string) int {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.RemoteAddr = remoteAddr
+		req.AddCookie(&http.Cookie{Name: "gw_session", Value: "session"})
+		req.AddCookie(&http.Cookie{Name: "gw_csrf", Value: "token"})
+		req.Header.Set("X-CSRF-Token", "token")
+		req.Header.Set("Origin", origin)
+		if forwardedProto != "" {
+			req.Header.Set("X-Forwarded-Proto", forwardedProto)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	const client, proxy = "203.0.113.7:51000", "10.0.0.5:51000"
+
+	// https 部署不接受同主機的 http 來源
+	assert.Equal(t, http.StatusOK, send(client, "https://gateway.local/api/expenses", "https://gateway.local", ""))
+	assert.Equal(t, http.StatusForbidden, send(client, "https://gateway.local/api/expenses", "http://gateway.local", ""))
+
+	// TLS 由受信任代理終止時依 X-Forwarded-Proto 判斷
+	assert.Equal(t, http.StatusOK, send(proxy, "http://gateway.local/api/expenses", "https://gateway.local", "https"))
+	assert.Equal(t, http.StatusForbidden, send(proxy, "http://gateway.local/api/expenses", "http://gateway.local", "https"))
+
+	// 非受信任來源的 X-Forwarded-Proto 被忽略
+	assert.Equal(t, http.StatusForbidden, send(client, "http://gateway.local/api/expenses", "https://gateway.local", "https"))
+	assert.Equal(t, http.StatusOK, send(client, "http://gateway.local/api/expenses", "http://gateway.local", "https"))
+}
+
+func TestCSRFMiddleware_Disabled(t *testing.T) {
+	r := newCSRFTestRouter(false)
+
+	req := httptest.NewRequest(http.MethodDelete, "http://gateway.local/api/expenses", nil)
+	req.AddCookie(&http.Cookie{Name: "gw_session", Value: "session"})
+	req.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,253 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/headers"
+	"expense-api-gateway/internal/middleware/security"
+	"expense-api-gateway/internal/service/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// headersTestConfig 測試用的全局響應頭策略
+func headersTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Security.XSS.Enabled = true
+	cfg.Security.Headers = config.SecurityHeadersConfig{
+		Upstream: config.UpstreamHeadersPreserve,
+		CSP: &config.CSPConfig{
+			Policy:    "default-src 'none'; frame-ancestors 'none'",
+			ReportURI: "/csp-report",
+		},
+		HSTS:                      &config.HSTSConfig{MaxAge: 365 * 24 * time.Hour, IncludeSubdomains: true},
+		ReferrerPolicy:            "strict-origin-when-cross-origin",
+		PermissionsPolicy:         "camera=(), microphone=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginResourcePolicy: "same-origin",
+		FrameOptions:              "DENY",
+		ContentTypeOptions:        "nosniff",
+	}
+	return cfg
+}
+
+func TestHeadersMiddleware_Global(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := headersTestConfig()
+	middleware := headers.NewHeadersMiddleware(cfg, zap.NewNop())
+
+	router := gin.New()
+	router.Use(middleware.Global())
+	router.Use(security.NewXSSMiddleware(cfg, zap.NewNop()).XSSProtection())
+	router.GET("/api/v1/users", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "default-src 'none'; frame-ancestors 'none'; report-uri /csp-report; report-to csp-endpoint",
+		w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, `csp-endpoint="/csp-report"`, w.Header().Get("Reporting-Endpoints"))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "camera=(), microphone=()", w.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Cross-Origin-Opener-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Cross-Origin-Resource-Policy"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	// 已棄用的 X-XSS-Protection 不再發送
+	assert.Empty(t, w.Header().Get("X-XSS-Protection"))
+	assert.Empty(t, w.Header().Get("Cross-Origin-Embedder-Policy"))
+
+	// services.yaml 的全局設定覆寫 config.yaml
+	middleware.SetGlobalPolicy(&config.SecurityHeadersConfig{
+		ReferrerPolicy: "no-referrer",
+		FrameOptions:   config.HeaderOff,
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Empty(t, w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+}
+
+func TestHeadersMiddleware_Policy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware := headers.NewHeadersMiddleware(headersTestConfig(), zap.NewNop())
+
+	router := gin.New()
+	router.Use(middleware.Global())
+	router.GET("/api/v1/files/download/:path", middleware.Policy(&config.SecurityHeadersConfig{
+		CSP:                       &config.CSPConfig{Policy: "default-src 'self'; script-src 'nonce-{nonce}'", ReportOnly: true},
+		HSTS:                      &config.HSTSConfig{},
+		CrossOriginResourcePolicy: "cross-origin",
+		FrameOptions:              config.HeaderOff,
+	}), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetHeader(headers.NonceHeader))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download/receipt.pdf", nil)
+	req.Header.Set(headers.NonceHeader, "forged")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 組策略整塊替換 CSP，以只報告模式發送
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+	assert.Empty(t, w.Header().Get("Reporting-Endpoints"))
+	csp := w.Header().Get("Content-Security-Policy-Report-Only")
+	require.True(t, strings.HasPrefix(csp, "default-src 'self'; script-src 'nonce-"), csp)
+
+	// nonce 由網關生成並轉發給上游，客戶端偽造的值被移除
+	nonce := w.Body.String()
+	assert.NotEmpty(t, nonce)
+	assert.NotEqual(t, "forged", nonce)
+	assert.Equal(t, "default-src 'self'; script-src 'nonce-"+nonce+"'", csp)
+
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "cross-origin", w.Header().Get("Cross-Origin-Resource-Policy"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	// 每個請求的 nonce 不同
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, "/api/v1/files/download/receipt.pdf", nil))
+	assert.NotEqual(t, nonce, w2.Body.String())
+}
+
+func TestHeadersMiddleware_Upstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	servicesFile := filepath.Join(t.TempDir(), "services.yaml")
+	require.NoError(t, os.WriteFile(servicesFile, []byte(`
+routes:
+  - pattern: "/api/v1/reports/*"
+    service: "report-service"
+  - pattern: "/api/v1/exports/*"
+    service: "report-service"
+services:
+  report-service:
+    hosts: ["127.0.0.1"]
+`), 0600))
+
+	logger := zap.NewNop()
+	routeParser := proxy.NewRouteParser(nil, logger)
+	routeParser.SetFilePath(servicesFile)
+	require.NoError(t, routeParser.LoadConfig())
+
+	cfg := headersTestConfig()
+	proxyService := proxy.NewProxyService(cfg, logger, routeParser, newStaticDiscovery(t, upstream.URL))
+	middleware := headers.NewHeadersMiddleware(cfg, logger)
+
+	router := gin.New()
+	router.Use(middleware.Global())
+	router.Any("/api/v1/reports/*path", proxyService.ProxyGinRequest)
+	router.Any("/api/v1/exports/*path", middleware.Policy(&config.SecurityHeadersConfig{
+		Upstream: config.UpstreamHeadersOverride,
+	}), proxyService.ProxyGinRequest)
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	get := func(path string) http.Header {
+		resp, err := http.Get(gateway.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header
+	}
+
+	// preserve：保留上游設置的響應頭，其餘由策略補上，且不重複
+	preserved := get("/api/v1/reports/monthly")
+	assert.Equal(t, []string{"SAMEORIGIN"}, preserved.Values("X-Frame-Options"))
+	assert.Equal(t, []string{"default-src 'self'"}, preserved.Values("Content-Security-Policy"))
+	assert.Equal(t, []string{"nosniff"}, preserved.Values("X-Content-Type-Options"))
+
+	// override：以策略覆寫上游響應頭
+	overridden := get("/api/v1/exports/monthly")
+	assert.Equal(t, []string{"DENY"}, overridden.Values("X-Frame-Options"))
+	assert.Len(t, overridden.Values("Content-Security-Policy"), 1)
+	assert.True(t, strings.HasPrefix(overridden.Get("Content-Security-Policy"), "default-src 'none'"))
+}
+
+func TestHeadersMiddleware_CSPReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware := headers.NewHeadersMiddleware(&config.Config{}, zap.NewNop())
+	router := gin.New()
+	router.POST(headers.ReportPath, middleware.CSPReport())
+
+	send := func(contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, headers.ReportPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	legacy := `{"csp-report":{"document-uri":"https://app.example.com/expenses","blocked-uri":"inline","violated-directive":"script-src","script-sample":"alert(1)"}}`
+	assert.Equal(t, http.StatusNoContent, send("application/csp-report", legacy))
+
+	reporting := `[{"type":"csp-violation","body":{"documentURL":"https://app.example.com/","blockedURL":"https://evil.example.com/x.js","effectiveDirective":"script-src-elem","disposition":"report"}},
+		{"type":"deprecation","body":{"id":"x"}}]`
+	assert.Equal(t, http.StatusNoContent, send("application/reports+json", reporting))
+
+	assert.Equal(t, http.StatusBadRequest, send("application/json", `{"foo":"bar"}`))
+	assert.Equal(t, http.StatusBadRequest, send("application/json", `not json`))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send("application/csp-report", strings.Repeat("a", 65<<10)))
+}
+
+func TestParseCSPReports(t *testing.T) {
+	violations := headers.ParseCSPReports([]byte(`{"csp-report":{"document-uri":"https://app.example.com/","blocked-uri":"eval","violated-directive":"script-src 'self'","line-number":12}}`))
+	require.Len(t, violations, 1)
+	assert.Equal(t, "https://app.example.com/", violations[0].DocumentURI)
+	assert.Equal(t, "eval", violations[0].BlockedURI)
+	assert.Equal(t, "script-src 'self'", violations[0].EffectiveDirective)
+	assert.Equal(t, 12, violations[0].LineNumber)
+
+	violations = headers.ParseCSPReports([]byte(`[{"type":"csp-violation","body":{"documentURL":"https://a/","blockedURL":"https://b/","effectiveDirective":"img-src","sample":"x"}}]`))
+	require.Len(t, violations, 1)
+	assert.Equal(t, "img-src", violations[0].EffectiveDirective)
+	assert.Equal(t, "x", violations[0].Sample)
+}
+
+func TestSecurityHeadersConfig_Inherit(t *testing.T) {
+	parent := &config.SecurityHeadersConfig{
+		Upstream:       config.UpstreamHeadersPreserve,
+		CSP:            &config.CSPConfig{Policy: "default-src 'none'", ReportURI: "/csp-report"},
+		HSTS:           &config.HSTSConfig{MaxAge: time.Hour},
+		ReferrerPolicy: "no-referrer",
+		FrameOptions:   "DENY",
+	}
+
+	var unset *config.SecurityHeadersConfig
+	assert.Equal(t, parent, unset.Inherit(parent))
+
+	merged := (&config.SecurityHeadersConfig{
+		CSP:          &config.CSPConfig{Policy: "default-src 'self'"},
+		FrameOptions: config.HeaderOff,
+	}).Inherit(parent)
+	assert.Equal(t, config.UpstreamHeadersPreserve, merged.Upstream)
+	// CSP 整塊覆寫，不繼承上層的報告地址
+	assert.Equal(t, "default-src 'self'", merged.CSP.Policy)
+	assert.Empty(t, merged.CSP.ReportURI)
+	assert.Equal(t, time.Hour, merged.HSTS.MaxAge)
+	assert.Equal(t, "no-referrer", merged.ReferrerPolicy)
+	assert.Equal(t, config.HeaderOff, merged.FrameOptions)
+}
@@ -0,0 +1,300 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/infrastructure/jwt"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/service/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newImpersonationTestRouter 創建代理登入測試路由，鏈順序為 認證 → 代理 → 角色檢查
+func newImpersonationTestRouter(t *testing.T) (*gin.Engine, *config.Config, *jwt.JWTService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:            "test-secret-key-very-long-for-testing",
+			Expiration:        time.Hour,
+			RefreshExpiration: 24 * time.Hour,
+		},
+		Auth: config.AuthConfig{
+			Impersonation: config.ImpersonationConfig{
+				Enabled:           true,
+				AdminRoles:        []string{"admin", "super_admin"},
+				CrossCompanyRoles: []string{"super_admin"},
+				TokenTTL:          5 * time.Minute,
+				BlockedRoutes: []config.ImpersonationBlockRule{
+					{Pattern: "/api/v1/finance/payouts*"},
+				},
+			},
+		},
+		Audit: config.AuditConfig{FilePath: filepath.Join(t.TempDir(), "audit.jsonl")},
+	}
+
+	jwtService := jwt.NewJWTService(cfg, zap.NewNop())
+	jwtMiddleware := auth.NewJWTMiddlewareWithService(cfg, zap.NewNop(), jwtService)
+	impersonation := auth.NewImpersonationMiddleware(cfg, zap.NewNop(), jwtService)
+
+	r := gin.New()
+	r.Use(impersonation.StripHeaders())
+	echo := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":         c.Request.Header.Get("X-User-ID"),
+			"impersonator_id": c.Request.Header.Get("X-Impersonator-ID"),
+		})
+	}
+	api := r.Group("/api/v1", jwtMiddleware.Authenticate(), impersonation.Impersonate())
+	api.GET("/expenses", jwtMiddleware.RequireRoles("user"), echo)
+	api.POST("/finance/payouts", echo)
+	api.GET("/reports", jwtMiddleware.RequireRoles("admin"), echo)
+
+	// 未掛載 Impersonate 的路由
+	r.GET("/public/echo", jwtMiddleware.OptionalAuth(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"impersonate_user":    c.Request.Header.Get(auth.HeaderImpersonateUser),
+			"impersonate_company": c.Request.Header.Get(auth.HeaderImpersonateCompany),
+			"impersonator_id":     c.Request.Header.Get(auth.HeaderImpersonatorID),
+		})
+	})
+
+	admin := r.Group("/admin", jwtMiddleware.Authenticate(), impersonation.Impersonate(), jwtMiddleware.RequireRoles("admin", "super_admin"))
+	admin.POST("/impersonate", impersonation.MintToken())
+
+	return r, cfg, jwtService
+}
+
+func issueTestToken(t *testing.T, jwtService *jwt.JWTService, user *domain.AuthUser) string {
+	t.Helper()
+	tokenPair, err := jwtService.GenerateToken(user)
+	require.NoError(t, err)
+	return tokenPair.AccessToken
+}
+
+func TestImpersonationMiddleware_Header(t *testing.T) {
+	r, cfg, jwtService := newImpersonationTestRouter(t)
+	adminToken := issueTestToken(t, jwtService, &domain.AuthUser{ID: "admin-1", CompanyID: "c-1", Role: "admin"})
+	userToken := issueTestToken(t, jwtService, &domain.AuthUser{ID: "u-1", CompanyID: "c-1", Role: "user"})
+
+	tests := []struct {
+		name         string
+		token        string
+		impersonate  string
+		spoof        string
+		method       string
+		path         string
+		wantStatus   int
+		wantUser     string
+		wantImperson string
+	}{
+		{"admin impersonates user", adminToken, "emp-7", "", http.MethodGet, "/api/v1/expenses", http.StatusOK, "emp-7", "admin-1"},
+		{"impersonated user lacks admin role", adminToken, "emp-7", "", http.MethodGet, "/api/v1/reports", http.StatusForbidden, "", ""},
+		{"blocked route during impersonation", adminToken, "emp-7", "", http.MethodPost, "/api/v1/finance/payouts", http.StatusForbidden, "", ""},
+		{"non-admin cannot impersonate", userToken, "emp-7", "", http.MethodGet, "/api/v1/expenses", http.StatusForbidden, "", ""},
+		{"client cannot spoof impersonator header", userToken, "", "admin-1", http.MethodGet, "/api/v1/expenses", http.StatusOK, "u-1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.impersonate != "" {
+				req.Header.Set(auth.HeaderImpersonateUser, tt.impersonate)
+			}
+			if tt.spoof != "" {
+				req.Header.Set(auth.HeaderImpersonatorID, tt.spoof)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, tt.wantStatus, w.Code)
+
+			if tt.wantStatus == http.StatusOK {
+				var body map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, tt.wantUser, body["user_id"])
+				assert.Equal(t, tt.wantImperson, body["impersonator_id"])
+			}
+		})
+	}
+
+	// 每個代理請求（含被阻擋的）都有審計記錄，且雜湊鏈完整
+	count, err := audit.Verify(cfg.Audit.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestImpersonationMiddleware_HeaderTargetChecks(t *testing.T) {
+	r, cfg, jwtService := newImpersonationTestRouter(t)
+	adminToken := issueTestToken(t, jwtService, &domain.AuthUser{ID: "admin-1", CompanyID: "c-1", Role: "admin"})
+	superToken := issueTestToken(t, jwtService, &domain.AuthUser{ID: "admin-2", CompanyID: "c-1", Role: "super_admin"})
+
+	impersonate := func(token, company string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/expenses", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(auth.HeaderImpersonateUser, "emp-7")
+		if company != "" {
+			req.Header.Set(auth.HeaderImpersonateCompany, company)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 同公司可代理，跨公司需具備 cross_company_roles 中的角色
+	assert.Equal(t, http.StatusOK, impersonate(adminToken, "c-1"))
+	assert.Equal(t, http.StatusForbidden, impersonate(adminToken, "c-2"))
+	assert.Equal(t, http.StatusOK, impersonate(superToken, "c-2"))
+
+	// 預設角色不在可代理角色中時拒絕
+	cfg.Auth.Impersonation.DefaultRole = "finance"
+	assert.Equal(t, http.StatusForbidden, impersonate(adminToken, ""))
+
+	// 被拒絕的請求不轉發，也不寫入審計記錄
+	count, err := audit.Verify(cfg.Audit.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestImpersonationMiddleware_StripsHeadersOnAllRoutes(t *testing.T) {
+	r, _, jwtService := newImpersonationTestRouter(t)
+	adminToken := issueTestToken(t, jwtService, &domain.AuthUser{ID: "admin-1", CompanyID: "c-1", Role: "admin"})
+
+	// 未掛載 Impersonate 的路由也不轉發客戶端提供的代理 headers
+	for _, token := range []string{"", adminToken} {
+		req := httptest.NewRequest(http.MethodGet, "/public/echo", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set(auth.HeaderImpersonateUser, "emp-7")
+		req.Header.Set(auth.HeaderImpersonateCompany, "c-2")
+		req.Header.Set(auth.HeaderImpersonatorID, "admin-1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, map[string]string{"impersonate_user": "", "impersonate_company": "", "impersonator_id": ""}, body)
+	}
+}
+
+func TestImpersonationMiddleware_MintedToken(t *testing.T) {
+	r, cfg, jwtService := newImpersonationTestRouter(t)
+	adminToken := issueTestToken(t, jwtService, &domain.AuthUser{ID: "admin-1", CompanyID: "c-1", Role: "admin"})
+
+	// 理由為必填
+	req := httptest.NewRequest(http.MethodPost, "/admin/impersonate", strings.NewReader(`{"user_id":"emp-9"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 不可代理管理員角色
+	req = httptest.NewRequest(http.MethodPost, "/admin/impersonate", strings.NewReader(`{"user_id":"admin-2","role":"admin","reason":"x"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 一般管理員不可代理其他公司的用戶
+	body, _ := json.Marshal(map[string]string{"user_id": "emp-9", "company_id": "c-2", "reason": "TICKET-123 receipt upload fails"})
+	req = httptest.NewRequest(http.MethodPost, "/admin/impersonate", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	superToken := issueTestToken(t, jwtService, &domain.AuthUser{ID: "admin-1", CompanyID: "c-1", Role: "super_admin"})
+	req = httptest.NewRequest(http.MethodPost, "/admin/impersonate", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+superToken)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var minted struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &minted))
+	require.NotEmpty(t, minted.Data.Token)
+
+	// 使用代理 token 存取
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expenses", nil)
+	req.Header.Set("Authorization", "Bearer "+minted.Data.Token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var echoed map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &echoed))
+	assert.Equal(t, "emp-9", echoed["user_id"])
+	assert.Equal(t, "admin-1", echoed["impersonator_id"])
+
+	// 代理 token 不可再次簽發或巢狀代理
+	req = httptest.NewRequest(http.MethodPost, "/admin/impersonate", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+minted.Data.Token)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/expenses", nil)
+	req.Header.Set("Authorization", "Bearer "+minted.Data.Token)
+	req.Header.Set(auth.HeaderImpersonateUser, "emp-10")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	count, err := audit.Verify(cfg.Audit.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count) // 簽發、代理請求、以代理 token 存取管理端點、巢狀代理
+}
+
+func TestAuditService_TamperDetection(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := &config.Config{Audit: config.AuditConfig{FilePath: filePath}}
+
+	auditor, err := audit.New(cfg, zap.NewNop())
+	require.NoError(t, err)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		require.NoError(t, auditor.Record(audit.Entry{Event: "test", ActorID: "admin-1", Path: path, Outcome: "forwarded"}))
+	}
+	require.NoError(t, auditor.Close())
+
+	// 重新開啟後接續雜湊鏈
+	auditor, err = audit.New(cfg, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, auditor.Record(audit.Entry{Event: "test", ActorID: "admin-1", Path: "/d", Outcome: "forwarded"}))
+	require.NoError(t, auditor.Close())
+
+	count, err := audit.Verify(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath, bytes.Replace(data, []byte(`"/b"`), []byte(`"/x"`), 1), 0o600))
+
+	_, err = audit.Verify(filePath)
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/infrastructure/introspection"
+	"expense-api-gateway/internal/infrastructure/jwt"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/service/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newIntrospectionStub 創建模擬的 introspection 端點
+func newIntrospectionStub(t *testing.T, tokens map[string]map[string]interface{}, calls *int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "gateway" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response, exists := tokens[r.PostForm.Get("token")]
+		if !exists {
+			response = map[string]interface{}{"active": false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestIntrospectionValidator_FieldMappingAndCache(t *testing.T) {
+	var calls int32
+	exp := time.Now().Add(time.Hour).Unix()
+	server := newIntrospectionStub(t, map[string]map[string]interface{}{
+		"opaque-active": {
+			"active":    true,
+			"sub":       "u-100",
+			"email":     "alice@example.com",
+			"tenant":    "c-7",
+			"scope":     "manager user",
+			"exp":       exp,
+			"client_id": "web",
+		},
+	}, &calls)
+
+	validator := introspection.NewValidator(config.IntrospectionConfig{
+		Endpoint:         server.URL,
+		ClientID:         "gateway",
+		ClientSecret:     "secret",
+		CacheTTL:         time.Minute,
+		NegativeCacheTTL: time.Minute,
+		FieldMapping: config.ClaimMapping{
+			CompanyID: "tenant",
+			Roles:     "scope",
+		},
+	}, zap.NewNop())
+
+	result, err := validator.ValidateToken("opaque-active")
+	require.NoError(t, err)
+	require.True(t, result.Success)
+	assert.Equal(t, "u-100", result.User.ID)
+	assert.Equal(t, "alice@example.com", result.User.Email)
+	assert.Equal(t, "c-7", result.User.CompanyID)
+	assert.Equal(t, "manager", result.User.Role)
+	assert.Equal(t, []string{"manager", "user"}, result.User.Roles)
+
+	// 第二次命中快取
+	_, err = validator.ValidateToken("opaque-active")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// 無效 token 也會被快取
+	result, err = validator.ValidateToken("opaque-revoked")
+	assert.Error(t, err)
+	assert.False(t, result.Success)
+	_, _ = validator.ValidateToken("opaque-revoked")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestIntrospectionValidator_CacheBoundedByExpiry(t *testing.T) {
+	var calls int32
+	now := time.Now()
+	server := newIntrospectionStub(t, map[string]map[string]interface{}{
+		"short-lived": {
+			"active": true,
+			"sub":    "u-1",
+			"exp":    now.Add(10 * time.Second).Unix(),
+		},
+	}, &calls)
+
+	validator := introspection.NewValidator(config.IntrospectionConfig{
+		Endpoint:     server.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		CacheTTL:     time.Hour,
+	}, zap.NewNop())
+	validator.SetClock(func() time.Time { return now })
+
+	_, err := validator.ValidateToken("short-lived")
+	require.NoError(t, err)
+
+	// 超過 token exp 後快取失效，重新向端點查詢並判定為過期
+	validator.SetClock(func() time.Time { return now.Add(15 * time.Second) })
+	result, err := validator.ValidateToken("short-lived")
+	assert.Error(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestJWTMiddleware_PerRouteValidator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls int32
+	server := newIntrospectionStub(t, map[string]map[string]interface{}{
+		"opaque-token": {
+			"active":     true,
+			"sub":        "svc-9",
+			"company_id": "c-1",
+			"roles":      []string{"admin"},
+		},
+	}, &calls)
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:            "test-secret-key-very-long-for-testing",
+			Expiration:        time.Hour,
+			RefreshExpiration: 24 * time.Hour,
+		},
+		Auth: config.AuthConfig{
+			Introspection: config.IntrospectionConfig{
+				Endpoint:     server.URL,
+				ClientID:     "gateway",
+				ClientSecret: "secret",
+			},
+		},
+	}
+
+	jwtService := jwt.NewJWTService(cfg, zap.NewNop())
+	tokenPair, err := jwtService.GenerateToken(&domain.AuthUser{ID: "1", CompanyID: "1", Role: "user"})
+	require.NoError(t, err)
+
+	jwtMiddleware := auth.NewJWTMiddleware(cfg, zap.NewNop())
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id")})
+	}
+	r.GET("/local", jwtMiddleware.AuthenticateWith(""), handler)
+	r.GET("/opaque", jwtMiddleware.AuthenticateWith(jwt.ValidatorIntrospection), jwtMiddleware.RequireRoles("admin"), handler)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"local route accepts JWT", "/local", tokenPair.AccessToken, http.StatusOK},
+		{"local route rejects opaque token", "/local", "opaque-token", http.StatusUnauthorized},
+		{"introspection route accepts opaque token", "/opaque", "opaque-token", http.StatusOK},
+		{"introspection route rejects unknown token", "/opaque", "unknown", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK && tt.path == "/opaque" {
+				assert.Equal(t, "svc-9", req.Header.Get("X-User-ID"))
+			}
+		})
+	}
+
+	// 未註冊的驗證器應拒絕請求
+	r.GET("/missing", jwtMiddleware.AuthenticateWith("saml"), handler)
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenPair.AccessToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRouteParser_RejectsUnknownTokenValidator(t *testing.T) {
+	load := func(services string) error {
+		servicesFile := filepath.Join(t.TempDir(), "services.yaml")
+		require.NoError(t, os.WriteFile(servicesFile, []byte(services), 0600))
+		routeParser := proxy.NewRouteParser(nil, zap.NewNop())
+		routeParser.SetFilePath(servicesFile)
+		routeParser.SetTokenValidators([]string{jwt.ValidatorJWT})
+		return routeParser.LoadConfig()
+	}
+
+	assert.NoError(t, load(`
+groups:
+  - prefix: "/api/v1"
+    middleware: ["auth"]
+    token_validator: "jwt"
+    routes:
+      - pattern: "/expenses/*"
+        service: "expense-service"
+`))
+
+	// 未註冊的驗證器在載入時拒絕，而非每個請求返回 401
+	err := load(`
+groups:
+  - prefix: "/api/v1"
+    middleware: ["auth"]
+    routes:
+      - pattern: "/partners/*"
+        service: "partner-service"
+        token_validator: "introspection"
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "introspection")
+
+	assert.Error(t, load(`
+routes:
+  - pattern: "/api/v1/sso/*"
+    service: "sso-service"
+    token_validator: "saml"
+`))
+}
@@ -0,0 +1,302 @@
+package unit
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/geoip"
+	"expense-api-gateway/internal/middleware/ipfilter"
+	"expense-api-gateway/internal/service/monitor"
+	"expense-api-gateway/internal/service/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeTestGeoIPDatabase 生成最小的 IPv4 MaxMind 國家數據庫（24 位記錄），networks 為 CIDR 到國家代碼
+func writeTestGeoIPDatabase(t *testing.T, networks map[string]string) string {
+	t.Helper()
+
+	type node struct{ children [2]int } // -1 表示沒有記錄，<= -2 表示數據 -(index+2)
+	nodes := []node{{children: [2]int{-1, -1}}}
+
+	var data bytes.Buffer
+	encodeString := func(buf *bytes.Buffer, value string) {
+		buf.WriteByte(2<<5 | byte(len(value)))
+		buf.WriteString(value)
+	}
+	var offsets []int
+
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+
+		offsets = append(offsets, data.Len())
+		data.WriteByte(7<<5 | 1)
+		encodeString(&data, "country")
+		data.WriteByte(7<<5 | 1)
+		encodeString(&data, "iso_code")
+		encodeString(&data, networks[cidr])
+
+		current := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[current].children[bit] = -(len(offsets) + 1)
+				break
+			}
+			if nodes[current].children[bit] < 0 {
+				nodes = append(nodes, node{children: [2]int{-1, -1}})
+				nodes[current].children[bit] = len(nodes) - 1
+			}
+			current = nodes[current].children[bit]
+		}
+	}
+
+	nodeCount := len(nodes)
+	var file bytes.Buffer
+	for _, n := range nodes {
+		for _, child := range n.children {
+			var record int
+			switch {
+			case child == -1:
+				record = nodeCount
+			case child < -1:
+				record = nodeCount + 16 + offsets[-child-2]
+			default:
+				record = child
+			}
+			file.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+	file.WriteByte(7<<5 | 4)
+	encodeString(&file, "database_type")
+	encodeString(&file, "Test-Country")
+	encodeString(&file, "ip_version")
+	file.Write([]byte{5<<5 | 1, 4})
+	encodeString(&file, "record_size")
+	file.Write([]byte{5<<5 | 1, 24})
+	encodeString(&file, "node_count")
+	file.Write([]byte{6<<5 | 4, byte(nodeCount >> 24), byte(nodeCount >> 16), byte(nodeCount >> 8), byte(nodeCount)})
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.WriteFile(path, file.Bytes(), 0600))
+	return path
+}
+
+func newIPFilterTestRouter(middleware *ipfilter.IPFilterMiddleware, rule *config.IPFilterRule) *gin.Engine {
+	r := gin.New()
+	r.Use(middleware.Global())
+	r.GET("/test", middleware.Filter("test", rule), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/admin/ip-rules", middleware.ListRules())
+	r.POST("/admin/ip-rules", middleware.CreateRule())
+	r.DELETE("/admin/ip-rules", middleware.DeleteRule())
+	return r
+}
+
+func serveFromIP(r *gin.Engine, method, target, ip string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = net.JoinHostPort(ip, "4000")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGeoIPReader_Country(t *testing.T) {
+	path := writeTestGeoIPDatabase(t, map[string]string{
+		"203.0.113.0/24":  "TW",
+		"198.51.100.0/24": "JP",
+	})
+	reader, err := geoip.Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Test-Country", reader.Metadata().DatabaseType)
+
+	country, err := reader.Country(net.ParseIP("203.0.113.77"))
+	require.NoError(t, err)
+	assert.Equal(t, "TW", country)
+
+	country, err = reader.Country(net.ParseIP("198.51.100.1"))
+	require.NoError(t, err)
+	assert.Equal(t, "JP", country)
+
+	country, err = reader.Country(net.ParseIP("192.0.2.1"))
+	require.NoError(t, err)
+	assert.Empty(t, country, "未收錄的地址應返回空字符串")
+
+	_, err = geoip.FromBytes([]byte("not a database"))
+	assert.ErrorIs(t, err, geoip.ErrInvalidDatabase)
+}
+
+func TestIPFilterMiddleware_CIDRRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{IPFilter: config.IPFilterConfig{Enabled: true}}
+	monitorService := monitor.New(cfg, zap.NewNop())
+	middleware := ipfilter.NewIPFilterMiddleware(cfg, zap.NewNop(), monitorService)
+	middleware.SetGlobalRule(&config.IPFilterRule{Deny: []string{"192.0.2.0/24"}})
+
+	r := newIPFilterTestRouter(middleware, &config.IPFilterRule{
+		Allow: []string{"10.0.0.0/8", "2001:db8::/32"},
+		Deny:  []string{"10.9.0.0/16"},
+	})
+
+	tests := []struct {
+		name     string
+		ip       string
+		expected int
+	}{
+		{name: "允許清單內", ip: "10.1.2.3", expected: http.StatusOK},
+		{name: "允許清單內的 IPv6", ip: "2001:db8::1", expected: http.StatusOK},
+		{name: "拒絕清單優先於允許清單", ip: "10.9.1.1", expected: http.StatusForbidden},
+		{name: "不在允許清單", ip: "203.0.113.1", expected: http.StatusForbidden},
+		{name: "全局拒絕清單", ip: "192.0.2.10", expected: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveFromIP(r, http.MethodGet, "/test", tt.ip, "")
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusForbidden {
+				assert.Contains(t, w.Body.String(), "IP_BLOCKED")
+			}
+		})
+	}
+
+	blocked := monitorService.GetMetrics().BlockedRequests
+	assert.Equal(t, int64(2), blocked[ipfilter.ReasonDeny])
+	assert.Equal(t, int64(1), blocked[ipfilter.ReasonNotAllowed])
+
+	// 未啟用時不檢查
+	cfg.IPFilter.Enabled = false
+	assert.Equal(t, http.StatusOK, serveFromIP(r, http.MethodGet, "/test", "192.0.2.10", "").Code)
+}
+
+func TestIPFilterMiddleware_CountryRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{IPFilter: config.IPFilterConfig{
+		Enabled: true,
+		GeoIPDatabase: writeTestGeoIPDatabase(t, map[string]string{
+			"203.0.113.0/24":  "TW",
+			"198.51.100.0/24": "KP",
+		}),
+	}}
+	middleware := ipfilter.NewIPFilterMiddleware(cfg, zap.NewNop(), nil)
+
+	allowTW := newIPFilterTestRouter(middleware, &config.IPFilterRule{
+		Allow:          []string{"10.0.0.0/8"},
+		AllowCountries: []string{"tw"},
+	})
+	assert.Equal(t, http.StatusOK, serveFromIP(allowTW, http.MethodGet, "/test", "203.0.113.5", "").Code)
+	assert.Equal(t, http.StatusOK, serveFromIP(allowTW, http.MethodGet, "/test", "10.0.0.5", "").Code, "允許清單內的地址不需要國家匹配")
+	assert.Equal(t, http.StatusForbidden, serveFromIP(allowTW, http.MethodGet, "/test", "198.51.100.5", "").Code)
+	assert.Equal(t, http.StatusForbidden, serveFromIP(allowTW, http.MethodGet, "/test", "192.0.2.1", "").Code, "無法判斷國家時應拒絕")
+
+	denyKP := newIPFilterTestRouter(middleware, &config.IPFilterRule{DenyCountries: []string{"KP"}})
+	assert.Equal(t, http.StatusForbidden, serveFromIP(denyKP, http.MethodGet, "/test", "198.51.100.5", "").Code)
+	assert.Equal(t, http.StatusOK, serveFromIP(denyKP, http.MethodGet, "/test", "192.0.2.1", "").Code)
+}
+
+func TestIPFilterMiddleware_DynamicRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{IPFilter: config.IPFilterConfig{
+		Enabled:    true,
+		DefaultTTL: time.Hour,
+		MaxTTL:     24 * time.Hour,
+	}}
+	monitorService := monitor.New(cfg, zap.NewNop())
+	middleware := ipfilter.NewIPFilterMiddleware(cfg, zap.NewNop(), monitorService)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	middleware.SetClock(func() time.Time { return now })
+	r := newIPFilterTestRouter(middleware, nil)
+
+	w := serveFromIP(r, http.MethodPost, "/admin/ip-rules", "10.0.0.1", `{"cidr": "203.0.113.9/24", "ttl": "30m", "reason": "credential stuffing"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"cidr":"203.0.113.0/24"`)
+
+	assert.Equal(t, http.StatusForbidden, serveFromIP(r, http.MethodGet, "/test", "203.0.113.50", "").Code)
+	assert.Equal(t, http.StatusOK, serveFromIP(r, http.MethodGet, "/test", "198.51.100.1", "").Code)
+	assert.Equal(t, int64(1), monitorService.GetMetrics().BlockedRequests[ipfilter.ReasonDynamic])
+
+	// 超過 max_ttl 時截斷
+	rule, err := middleware.AddRule("198.51.100.7", 90*24*time.Hour, "scanner", "admin-1")
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.7/32", rule.CIDR)
+	assert.Equal(t, now.Add(24*time.Hour), rule.ExpiresAt)
+	assert.Len(t, middleware.Rules(), 2)
+
+	// 過期後自動失效
+	now = now.Add(31 * time.Minute)
+	assert.Equal(t, http.StatusOK, serveFromIP(r, http.MethodGet, "/test", "203.0.113.50", "").Code)
+	assert.Len(t, middleware.Rules(), 1)
+
+	// 手動移除
+	assert.Equal(t, http.StatusForbidden, serveFromIP(r, http.MethodGet, "/test", "198.51.100.7", "").Code)
+	assert.Equal(t, http.StatusOK, serveFromIP(r, http.MethodDelete, "/admin/ip-rules?cidr=198.51.100.7", "10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusOK, serveFromIP(r, http.MethodGet, "/test", "198.51.100.7", "").Code)
+	assert.Equal(t, http.StatusNotFound, serveFromIP(r, http.MethodDelete, "/admin/ip-rules?cidr=198.51.100.7", "10.0.0.1", "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, serveFromIP(r, http.MethodPost, "/admin/ip-rules", "10.0.0.1", `{"cidr": "bogus", "reason": "x"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serveFromIP(r, http.MethodPost, "/admin/ip-rules", "10.0.0.1", `{"cidr": "192.0.2.1"}`).Code, "必須填寫原因")
+}
+
+func TestRouteParser_IPFilter(t *testing.T) {
+	servicesFile := filepath.Join(t.TempDir(), "services.yaml")
+	require.NoError(t, os.WriteFile(servicesFile, []byte(`
+ip_filter:
+  deny: ["192.0.2.0/24"]
+groups:
+  - name: "finance"
+    prefix: "/api/v1/finance"
+    ip_filter:
+      allow: ["10.0.0.0/8"]
+    routes:
+      - pattern: "/:path"
+        service: "finance-service"
+        ip_filter:
+          deny_countries: ["KP"]
+services:
+  finance-service:
+    hosts: ["127.0.0.1"]
+`), 0600))
+
+	routeParser := proxy.NewRouteParser(nil, zap.NewNop())
+	routeParser.SetFilePath(servicesFile)
+	require.NoError(t, routeParser.LoadConfig())
+
+	require.NotNil(t, routeParser.GetIPFilter())
+	assert.Equal(t, []string{"192.0.2.0/24"}, routeParser.GetIPFilter().Deny)
+
+	groups := routeParser.GetAllGroups()
+	require.Len(t, groups, 1)
+	require.NotNil(t, groups[0].IPFilter)
+	assert.Equal(t, []string{"10.0.0.0/8"}, groups[0].IPFilter.Allow)
+	require.Len(t, groups[0].Routes, 1)
+	require.NotNil(t, groups[0].Routes[0].IPFilter)
+	assert.Equal(t, []string{"KP"}, groups[0].Routes[0].IPFilter.DenyCountries)
+}
@@ -0,0 +1,385 @@
+package unit
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/loginguard"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// loginGuardTestRouter 創建登入路由，密碼為 correct 時上游返回 200，否則返回 401
+func loginGuardTestRouter(t *testing.T, guard config.LoginGuardConfig) (*gin.Engine, *loginguard.LoginGuardMiddleware, *time.Time) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	guard.Enabled = true
+	middleware := loginguard.NewLoginGuardMiddleware(&config.Config{LoginGuard: guard}, zap.NewNop(), nil)
+	t.Cleanup(middleware.Close)
+	now := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	middleware.SetClock(func() time.Time { return now })
+
+	router := gin.New()
+	router.POST("/api/v1/auth/login", middleware.Protect(), func(c *gin.Context) {
+		// 挑戰請求頭不轉發給上游
+		assert.Empty(t, c.GetHeader(loginguard.ChallengeHeader))
+		assert.Empty(t, c.GetHeader(loginguard.SolutionHeader))
+		assert.Empty(t, c.GetHeader(loginguard.CaptchaHeader))
+
+		password := c.PostForm("password")
+		if password == "" {
+			var body map[string]string
+			_ = c.ShouldBindJSON(&body)
+			password = body["password"]
+		}
+		if password != "correct" {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Invalid credentials"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+	})
+	router.GET("/admin/login-guard", middleware.ListEntries())
+	router.POST("/admin/login-guard/unlock", middleware.UnlockEntry())
+	return router, middleware, &now
+}
+
+// login 發送 JSON 登入請求
+func login(router http.Handler, ip, username, password string, headers map[string]string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":40000"
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// responseCode 返回錯誤響應的 code
+func responseCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	code, _ := response["code"].(string)
+	return code
+}
+
+// solvePoW 找出使 SHA-256(nonce + solution) 前 difficulty 位為 0 的解
+func solvePoW(nonce string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(nonce + solution))
+		zeros := 0
+		for _, b := range sum {
+			zeros += bits.LeadingZeros8(b)
+			if b != 0 {
+				break
+			}
+		}
+		if zeros >= difficulty {
+			return solution
+		}
+	}
+}
+
+func TestLoginGuard_DelayAndLockout(t *testing.T) {
+	router, middleware, now := loginGuardTestRouter(t, config.LoginGuardConfig{
+		Window: 15 * time.Minute,
+		Delay:  config.LoginDelayConfig{After: 2, Base: time.Second, Max: 4 * time.Second},
+		Lockout: config.LoginLockoutConfig{
+			UserThreshold: 4,
+			Duration:      15 * time.Minute,
+			MaxDuration:   time.Hour,
+		},
+	})
+	advance := func(d time.Duration) { *now = now.Add(d) }
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.1", "alice", "wrong", nil).Code)
+	// 用戶名不區分大小寫與首尾空白
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.2", " Alice ", "wrong", nil).Code)
+
+	// 第二次失敗後需等待 1 秒
+	w := login(router, "198.51.100.3", "alice", "correct", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, loginguard.CodeThrottled, responseCode(t, w))
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// 延遲加倍
+	advance(time.Second)
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.3", "alice", "wrong", nil).Code)
+	advance(time.Second)
+	w = login(router, "198.51.100.4", "alice", "wrong", nil)
+	assert.Equal(t, loginguard.CodeThrottled, responseCode(t, w))
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// 達到用戶名的失敗上限後鎖定，正確的密碼也被拒絕
+	advance(time.Second)
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.4", "alice", "wrong", nil).Code)
+	w = login(router, "198.51.100.5", "alice", "correct", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, loginguard.CodeLocked, responseCode(t, w))
+	assert.Equal(t, "900", w.Header().Get("Retry-After"))
+
+	// 其他用戶不受影響
+	assert.Equal(t, http.StatusOK, login(router, "198.51.100.5", "bob", "correct", nil).Code)
+
+	entries := middleware.Entries()
+	require.NotEmpty(t, entries)
+	assert.Equal(t, loginguard.KindUsername, entries[0].Kind)
+	assert.Equal(t, "alice", entries[0].Key)
+	require.NotNil(t, entries[0].LockedUntil)
+	assert.Equal(t, now.Add(15*time.Minute), *entries[0].LockedUntil)
+	assert.Equal(t, 1, entries[0].Lockouts)
+
+	// 鎖定結束後再次達到上限，鎖定時長加倍
+	advance(15 * time.Minute)
+	for i := 0; i < 4; i++ {
+		advance(5 * time.Second)
+		assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.6", "alice", "wrong", nil).Code)
+	}
+	w = login(router, "198.51.100.7", "alice", "correct", nil)
+	assert.Equal(t, loginguard.CodeLocked, responseCode(t, w))
+	assert.Equal(t, "1800", w.Header().Get("Retry-After"))
+
+	// 管理端點查詢與解鎖
+	req := httptest.NewRequest(http.MethodGet, "/admin/login-guard", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"key":"alice"`)
+
+	unlock := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/login-guard/unlock", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, unlock(`{}`))
+	assert.Equal(t, http.StatusNotFound, unlock(`{"username":"carol"}`))
+	assert.Equal(t, http.StatusOK, unlock(`{"username":"ALICE"}`))
+	assert.Equal(t, http.StatusOK, login(router, "198.51.100.7", "alice", "correct", nil).Code)
+}
+
+func TestLoginGuard_CredentialStuffing(t *testing.T) {
+	router, middleware, _ := loginGuardTestRouter(t, config.LoginGuardConfig{
+		Window:            15 * time.Minute,
+		MaxUsernamesPerIP: 3,
+		Lockout:           config.LoginLockoutConfig{Duration: 10 * time.Minute},
+	})
+
+	// 表單請求體的用戶名
+	formLogin := func(ip, username, password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {username}, "password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		assert.Equal(t, http.StatusUnauthorized, formLogin("203.0.113.9", username, "Winter2024!").Code)
+	}
+	// 相同用戶名不重複計數
+	assert.Equal(t, http.StatusUnauthorized, formLogin("203.0.113.9", "carol", "Summer2024!").Code)
+
+	// 第四個不同的用戶名觸發 IP 鎖定
+	assert.Equal(t, http.StatusUnauthorized, formLogin("203.0.113.9", "dave", "Winter2024!").Code)
+	w := formLogin("203.0.113.9", "erin", "correct")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, loginguard.CodeLocked, responseCode(t, w))
+	assert.Equal(t, "600", w.Header().Get("Retry-After"))
+
+	// 其他 IP 不受影響
+	assert.Equal(t, http.StatusOK, formLogin("203.0.113.10", "alice", "correct").Code)
+
+	assert.True(t, middleware.Unlock("", "203.0.113.9"))
+	assert.Equal(t, http.StatusOK, formLogin("203.0.113.9", "erin", "correct").Code)
+}
+
+func TestLoginGuard_PoWChallenge(t *testing.T) {
+	router, _, now := loginGuardTestRouter(t, config.LoginGuardConfig{
+		Window: 15 * time.Minute,
+		Challenge: config.LoginChallengeConfig{
+			Type:       config.LoginChallengePoW,
+			After:      2,
+			Difficulty: 8,
+			TTL:        time.Minute,
+		},
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.1", "alice", "wrong", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.1", "alice", "wrong", nil).Code)
+
+	challenge := func(w *httptest.ResponseRecorder) loginguard.Challenge {
+		t.Helper()
+		require.Equal(t, http.StatusPreconditionRequired, w.Code)
+		var response struct {
+			Challenge loginguard.Challenge `json:"challenge"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Equal(t, config.LoginChallengePoW, response.Challenge.Type)
+		require.NotEmpty(t, response.Challenge.Nonce)
+		require.Equal(t, 8, response.Challenge.Difficulty)
+		return response.Challenge
+	}
+
+	// 未提交挑戰
+	w := login(router, "198.51.100.1", "alice", "correct", nil)
+	assert.Equal(t, loginguard.CodeChallengeRequired, responseCode(t, w))
+	issued := challenge(w)
+
+	solved := map[string]string{
+		loginguard.ChallengeHeader: issued.Nonce,
+		loginguard.SolutionHeader:  solvePoW(issued.Nonce, issued.Difficulty),
+	}
+	assert.Equal(t, http.StatusOK, login(router, "198.51.100.1", "alice", "correct", solved).Code)
+
+	// 用戶名的記錄已清除，但 IP 仍需挑戰；挑戰只能使用一次
+	w = login(router, "198.51.100.1", "bob", "correct", solved)
+	assert.Equal(t, loginguard.CodeChallengeFailed, responseCode(t, w))
+	issued = challenge(w)
+
+	// 挑戰綁定簽發時的 IP
+	moved := map[string]string{
+		loginguard.ChallengeHeader: issued.Nonce,
+		loginguard.SolutionHeader:  solvePoW(issued.Nonce, issued.Difficulty),
+	}
+	*now = now.Add(time.Second)
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.2", "alice", "wrong", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.2", "alice", "wrong", nil).Code)
+	w = login(router, "198.51.100.2", "alice", "correct", moved)
+	assert.Equal(t, loginguard.CodeChallengeFailed, responseCode(t, w))
+
+	// 錯誤的解與過期的挑戰
+	issued = challenge(w)
+	w = login(router, "198.51.100.2", "alice", "correct", map[string]string{
+		loginguard.ChallengeHeader: issued.Nonce,
+		loginguard.SolutionHeader:  "not-a-solution-" + strings.Repeat("x", 64),
+	})
+	assert.Equal(t, loginguard.CodeChallengeFailed, responseCode(t, w))
+	issued = challenge(w)
+	*now = now.Add(2 * time.Minute)
+	w = login(router, "198.51.100.2", "alice", "correct", map[string]string{
+		loginguard.ChallengeHeader: issued.Nonce,
+		loginguard.SolutionHeader:  solvePoW(issued.Nonce, issued.Difficulty),
+	})
+	assert.Equal(t, loginguard.CodeChallengeFailed, responseCode(t, w))
+}
+
+func TestLoginGuard_PoWChallengeBounded(t *testing.T) {
+	router, middleware, now := loginGuardTestRouter(t, config.LoginGuardConfig{
+		Window: 15 * time.Minute,
+		Challenge: config.LoginChallengeConfig{
+			Type:       config.LoginChallengePoW,
+			After:      1,
+			Difficulty: 8,
+			TTL:        time.Minute,
+			MaxPending: 3,
+		},
+	})
+
+	nonce := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		require.Equal(t, http.StatusPreconditionRequired, w.Code)
+		var response struct {
+			Challenge loginguard.Challenge `json:"challenge"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Challenge.Nonce
+	}
+
+	// 同一 IP 重複請求時沿用未過期的挑戰
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.1", "alice", "wrong", nil).Code)
+	first := nonce(login(router, "198.51.100.1", "alice", "correct", nil))
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, nonce(login(router, "198.51.100.1", "alice", "correct", nil)))
+	}
+	assert.Equal(t, 1, middleware.PendingChallenges())
+
+	// 挑戰過期後簽發新挑戰
+	*now = now.Add(time.Minute)
+	assert.NotEqual(t, first, nonce(login(router, "198.51.100.1", "alice", "correct", nil)))
+	assert.Equal(t, 1, middleware.PendingChallenges())
+
+	// 未使用的挑戰數量不超過上限，淘汰最早簽發的挑戰
+	var nonces []string
+	for i := 2; i <= 5; i++ {
+		ip, username := "198.51.100."+strconv.Itoa(i), "user"+strconv.Itoa(i)
+		assert.Equal(t, http.StatusUnauthorized, login(router, ip, username, "wrong", nil).Code)
+		nonces = append(nonces, nonce(login(router, ip, username, "correct", nil)))
+	}
+	assert.Equal(t, 3, middleware.PendingChallenges())
+	w := login(router, "198.51.100.2", "user2", "correct", map[string]string{
+		loginguard.ChallengeHeader: nonces[0],
+		loginguard.SolutionHeader:  solvePoW(nonces[0], 8),
+	})
+	assert.Equal(t, loginguard.CodeChallengeFailed, responseCode(t, w), "被淘汰的挑戰不能使用")
+	assert.Equal(t, http.StatusOK, login(router, "198.51.100.5", "user5", "correct", map[string]string{
+		loginguard.ChallengeHeader: nonces[3],
+		loginguard.SolutionHeader:  solvePoW(nonces[3], 8),
+	}).Code)
+}
+
+func TestLoginGuard_CaptchaChallenge(t *testing.T) {
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		success := r.PostForm.Get("secret") == "captcha-secret" &&
+			r.PostForm.Get("response") == "valid-token" &&
+			r.PostForm.Get("remoteip") == "198.51.100.1"
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": success})
+	}))
+	defer verifier.Close()
+
+	router, _, _ := loginGuardTestRouter(t, config.LoginGuardConfig{
+		Challenge: config.LoginChallengeConfig{
+			Type:      config.LoginChallengeCaptcha,
+			After:     1,
+			VerifyURL: verifier.URL,
+			Secret:    "captcha-secret",
+		},
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.1", "alice", "wrong", nil).Code)
+	w := login(router, "198.51.100.1", "alice", "correct", nil)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.Equal(t, loginguard.CodeChallengeRequired, responseCode(t, w))
+	assert.Contains(t, w.Body.String(), `"type":"captcha"`)
+
+	w = login(router, "198.51.100.1", "alice", "correct", map[string]string{loginguard.CaptchaHeader: "forged"})
+	assert.Equal(t, loginguard.CodeChallengeFailed, responseCode(t, w))
+	w = login(router, "198.51.100.1", "alice", "correct", map[string]string{loginguard.CaptchaHeader: "valid-token"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLoginGuard_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware := loginguard.NewLoginGuardMiddleware(&config.Config{LoginGuard: config.LoginGuardConfig{
+		Lockout: config.LoginLockoutConfig{UserThreshold: 1},
+	}}, zap.NewNop(), nil)
+	router := gin.New()
+	router.POST("/api/v1/auth/login", middleware.Protect(), func(c *gin.Context) {
+		c.Status(http.StatusUnauthorized)
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login(router, "198.51.100.1", "alice", "wrong", nil).Code)
+	}
+	assert.Empty(t, middleware.Entries())
+}
@@ -0,0 +1,410 @@
+package unit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/tlsconfig"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/service/discovery"
+	"expense-api-gateway/internal/service/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testCA 測試用 CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCA 生成測試用 CA
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "expense-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue 簽發證書並寫入文件，返回證書與私鑰路徑
+func (ca *testCA) issue(t *testing.T, dir, name, cn string, serial int64, dnsNames []string, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
+
+// writeCA 將 CA 證書寫入文件
+func (ca *testCA) writeCA(t *testing.T, dir string) string {
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	return caFile
+}
+
+// staticDiscovery 返回固定實例的服務發現
+type staticDiscovery struct {
+	instances []*discovery.ServiceInstance
+}
+
+func (d *staticDiscovery) Register(instance *discovery.ServiceInstance) error { return nil }
+func (d *staticDiscovery) Deregister(serviceID string) error                  { return nil }
+func (d *staticDiscovery) Discover(serviceName string) ([]*discovery.ServiceInstance, error) {
+	return d.instances, nil
+}
+func (d *staticDiscovery) Watch(serviceName string) (<-chan []*discovery.ServiceInstance, error) {
+	return nil, nil
+}
+func (d *staticDiscovery) Start() error { return nil }
+func (d *staticDiscovery) Stop() error  { return nil }
+
+// newStaticDiscovery 以上游測試服務器地址創建服務發現
+func newStaticDiscovery(t *testing.T, serverURL string) *staticDiscovery {
+	u, err := url.Parse(serverURL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	return &staticDiscovery{
+		instances: []*discovery.ServiceInstance{
+			{ID: "upstream-1", Address: u.Hostname(), Port: port, Health: discovery.HealthStatusHealthy},
+		},
+	}
+}
+
+func TestCertStore_SNISelection(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	defaultCert, defaultKey := ca.issue(t, dir, "default", "localhost", 10, []string{"localhost"}, x509.ExtKeyUsageServerAuth)
+	adminCert, adminKey := ca.issue(t, dir, "admin", "admin", 11, []string{"admin.expense.local"}, x509.ExtKeyUsageServerAuth)
+
+	store, err := tlsconfig.NewCertStore(config.TLSConfig{
+		CertFile: defaultCert,
+		KeyFile:  defaultKey,
+		Certificates: []config.CertificateConfig{
+			{CertFile: adminCert, KeyFile: adminKey},
+		},
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "admin.expense.local"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), cert.Leaf.SerialNumber.Int64(), "SNI 應該選擇對應的證書")
+
+	cert, err = store.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), cert.Leaf.SerialNumber.Int64(), "未知的 SNI 應該使用默認證書")
+}
+
+func TestCertStore_HotReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, dir, "gateway", "localhost", 20, []string{"localhost"}, x509.ExtKeyUsageServerAuth)
+
+	store, err := tlsconfig.NewCertStore(config.TLSConfig{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: 10 * time.Millisecond,
+	}, zap.NewNop())
+	require.NoError(t, err)
+	store.Start()
+	defer store.Stop()
+
+	// 覆蓋證書文件並推後修改時間
+	ca.issue(t, dir, "gateway", "localhost", 21, []string{"localhost"}, x509.ExtKeyUsageServerAuth)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	assert.Eventually(t, func() bool {
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+		return err == nil && cert.Leaf.SerialNumber.Int64() == 21
+	}, 2*time.Second, 10*time.Millisecond, "證書更新後應該自動重載")
+}
+
+func TestClientCertMiddleware_IdentityMapping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := ca.writeCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", "localhost", 30, []string{"localhost"}, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "client", "ocr-worker", 31, nil, x509.ExtKeyUsageClientAuth)
+	unknownCert, unknownKey := ca.issue(t, dir, "unknown", "someone-else", 32, nil, x509.ExtKeyUsageClientAuth)
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:     "test-secret-key-very-long-for-testing",
+			Expiration: time.Hour,
+		},
+		TLS: config.TLSConfig{
+			Enabled:  true,
+			CertFile: serverCert,
+			KeyFile:  serverKey,
+			ClientAuth: config.ClientAuthConfig{
+				Mode:   "verify_if_given",
+				CAFile: caFile,
+				Identities: []config.ClientIdentityConfig{
+					{CommonName: "ocr-worker", ServiceAccount: "svc-ocr-worker", Roles: []string{"service"}},
+				},
+			},
+		},
+	}
+
+	logger := zap.NewNop()
+	store, err := tlsconfig.NewCertStore(cfg.TLS, logger)
+	require.NoError(t, err)
+	serverTLS, err := tlsconfig.NewServerTLSConfig(cfg.TLS, store)
+	require.NoError(t, err)
+
+	jwtMiddleware := auth.NewJWTMiddleware(cfg, logger)
+	router := gin.New()
+	router.Use(auth.NewClientCertMiddleware(cfg, logger).Authenticate())
+	router.GET("/internal/ocr",
+		jwtMiddleware.Authenticate(),
+		jwtMiddleware.RequireRoles("service"),
+		func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"user_id":   c.GetString("user_id"),
+				"forwarded": c.Request.Header.Get("X-User-ID"),
+			})
+		})
+
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = serverTLS
+	server.StartTLS()
+	defer server.Close()
+
+	newClient := func(certFile, keyFile string) *http.Client {
+		pool, err := tlsconfig.LoadCertPool(caFile)
+		require.NoError(t, err)
+		clientTLS := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			require.NoError(t, err)
+			clientTLS.Certificates = []tls.Certificate{cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	}
+
+	// 已映射的客戶端證書應該通過認證
+	resp, err := newClient(clientCert, clientKey).Get(server.URL + "/internal/ocr")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "已映射的客戶端證書應該通過認證")
+
+	// 未映射的證書應該退回 Bearer 認證
+	resp, err = newClient(unknownCert, unknownKey).Get(server.URL + "/internal/ocr")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "未映射的證書不應該獲得身份")
+
+	// 沒有證書也沒有 token 應該被拒絕
+	resp, err = newClient("", "").Get(server.URL + "/internal/ocr")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "沒有證書應該被拒絕")
+}
+
+func TestClientCertMiddleware_ResolveIdentity(t *testing.T) {
+	spiffe, err := url.Parse("spiffe://expense/notification-worker")
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		TLS: config.TLSConfig{
+			ClientAuth: config.ClientAuthConfig{
+				Identities: []config.ClientIdentityConfig{
+					{CommonName: "ocr-worker", ServiceAccount: "svc-ocr-worker"},
+					{SAN: "spiffe://expense/notification-worker", ServiceAccount: "svc-notification-worker"},
+					{CommonName: "finance-worker", SAN: "finance.internal", ServiceAccount: "svc-finance-worker"},
+					{ServiceAccount: "svc-unconstrained"},
+				},
+			},
+		},
+	}
+	middleware := auth.NewClientCertMiddleware(cfg, zap.NewNop())
+
+	resolve := func(cert *x509.Certificate) string {
+		if user := middleware.ResolveIdentity(cert); user != nil {
+			return user.ID
+		}
+		return ""
+	}
+
+	assert.Equal(t, "svc-ocr-worker", resolve(&x509.Certificate{Subject: pkix.Name{CommonName: "ocr-worker"}}))
+	assert.Equal(t, "svc-notification-worker", resolve(&x509.Certificate{URIs: []*url.URL{spiffe}}))
+
+	// 同時設置 CN 與 SAN 時兩者都需符合
+	assert.Equal(t, "svc-finance-worker", resolve(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "finance-worker"},
+		DNSNames: []string{"finance.internal"},
+	}))
+	assert.Empty(t, resolve(&x509.Certificate{Subject: pkix.Name{CommonName: "finance-worker"}}))
+	assert.Empty(t, resolve(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "other-worker"},
+		DNSNames: []string{"finance.internal"},
+	}))
+
+	// 未設置任何條件的映射不匹配任何證書
+	assert.Empty(t, resolve(&x509.Certificate{Subject: pkix.Name{CommonName: "someone-else"}}))
+}
+
+func TestProxyService_UpstreamMTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := ca.writeCA(t, dir)
+	upstreamCert, upstreamKey := ca.issue(t, dir, "upstream", "localhost", 40, []string{"localhost"}, x509.ExtKeyUsageServerAuth)
+	gatewayCert, gatewayKey := ca.issue(t, dir, "gateway-client", "expense-api-gateway", 41, nil, x509.ExtKeyUsageClientAuth)
+
+	// 上游服務要求客戶端證書
+	var peerCN string
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCN = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	cert, err := tls.LoadX509KeyPair(upstreamCert, upstreamKey)
+	require.NoError(t, err)
+	pool, err := tlsconfig.LoadCertPool(caFile)
+	require.NoError(t, err)
+	upstream.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	servicesFile := filepath.Join(dir, "services.yaml")
+	require.NoError(t, os.WriteFile(servicesFile, []byte(`
+routes:
+  - pattern: "/api/v1/finance/*"
+    service: "finance-service"
+services:
+  finance-service:
+    hosts: ["127.0.0.1"]
+    tls:
+      enabled: true
+      ca_file: "`+caFile+`"
+      cert_file: "`+gatewayCert+`"
+      key_file: "`+gatewayKey+`"
+      server_name: "localhost"
+`), 0600))
+
+	logger := zap.NewNop()
+	routeParser := proxy.NewRouteParser(nil, logger)
+	routeParser.SetFilePath(servicesFile)
+	require.NoError(t, routeParser.LoadConfig())
+
+	proxyService := proxy.NewProxyService(&config.Config{}, logger, routeParser, newStaticDiscovery(t, upstream.URL))
+
+	router := gin.New()
+	router.Any("/api/v1/finance/*path", proxyService.ProxyGinRequest)
+
+	// ReverseProxy 需要真實連接，通過測試服務器發送請求
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL + "/api/v1/finance/reports")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "應該透過 mTLS 轉發到上游服務")
+	assert.Equal(t, "expense-api-gateway", peerCN, "上游服務應該收到 Gateway 的客戶端證書")
+}
+
+func TestRouteParser_InvalidUpstreamTLS(t *testing.T) {
+	dir := t.TempDir()
+	servicesFile := filepath.Join(dir, "services.yaml")
+	writeServices := func(caFile string) {
+		require.NoError(t, os.WriteFile(servicesFile, []byte(`
+routes:
+  - pattern: "/api/v1/finance/*"
+    service: "finance-service"
+services:
+  finance-service:
+    hosts: ["127.0.0.1"]
+    tls:
+      enabled: true
+      ca_file: "`+caFile+`"
+`), 0600))
+	}
+
+	routeParser := proxy.NewRouteParser(nil, zap.NewNop())
+	routeParser.SetFilePath(servicesFile)
+
+	caFile := newTestCA(t).writeCA(t, dir)
+	writeServices(caFile)
+	require.NoError(t, routeParser.LoadConfig())
+
+	// CA 文件無法載入時在載入配置時失敗，而非在第一個請求時
+	writeServices(filepath.Join(dir, "missing-ca.pem"))
+	err := routeParser.LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "finance-service")
+
+	// 保留原有的有效配置
+	_, service, err := routeParser.MatchRoute(http.MethodGet, "/api/v1/finance/reports")
+	require.NoError(t, err)
+	assert.Equal(t, caFile, service.TLS.CAFile)
+}
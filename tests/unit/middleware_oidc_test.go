@@ -0,0 +1,334 @@
+package unit
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/oidc"
+	"expense-api-gateway/internal/middleware/auth"
+
+	"github.com/gin-gonic/gin"
+	jwtlib "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testIssuer 本地測試用 OIDC 身份提供者
+type testIssuer struct {
+	server       *httptest.Server
+	key          *rsa.PrivateKey
+	expiresIn    int64
+	refreshCalls int32
+
+	mutex sync.Mutex
+	codes map[string]issuedCode
+}
+
+// issuedCode 已簽發的授權碼
+type issuedCode struct {
+	nonce     string
+	challenge string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	issuer := &testIssuer{
+		key:       key,
+		expiresIn: 3600,
+		codes:     make(map[string]issuedCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+			"end_session_endpoint":   issuer.server.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", issuer.handleToken)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+// authorize 模擬使用者在 IdP 完成登入並簽發授權碼
+func (i *testIssuer) authorize(authURL string) (code, state string, err error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	code = "code-" + query.Get("state")[:8]
+	i.codes[code] = issuedCode{
+		nonce:     query.Get("nonce"),
+		challenge: query.Get("code_challenge"),
+	}
+	return code, query.Get("state"), nil
+}
+
+func (i *testIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != "expense-web" || clientSecret != "web-secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_ = r.ParseForm()
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		i.mutex.Lock()
+		issued, exists := i.codes[r.PostForm.Get("code")]
+		delete(i.codes, r.PostForm.Get("code"))
+		i.mutex.Unlock()
+
+		if !exists || oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != issued.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		i.writeToken(w, issued.nonce, "user", "refresh-1")
+	case "refresh_token":
+		atomic.AddInt32(&i.refreshCalls, 1)
+		if r.PostForm.Get("refresh_token") != "refresh-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		i.writeToken(w, "", "manager", "refresh-2")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (i *testIssuer) writeToken(w http.ResponseWriter, nonce, role, refreshToken string) {
+	claims := jwtlib.MapClaims{
+		"iss":        i.server.URL,
+		"aud":        "expense-web",
+		"sub":        "u-42",
+		"email":      "bob@example.com",
+		"company_id": "c-3",
+		"roles":      []string{role},
+		"iat":        time.Now().Unix(),
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	token := jwtlib.NewWithClaims(jwtlib.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	idToken, _ := token.SignedString(i.key)
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  "access-" + role,
+		"token_type":    "Bearer",
+		"id_token":      idToken,
+		"refresh_token": refreshToken,
+		"expires_in":    i.expiresIn,
+	})
+}
+
+func newOIDCTestRouter(issuer *testIssuer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{Secret: "test-secret-key-very-long-for-testing", Expiration: time.Hour},
+		OIDC: config.OIDCConfig{
+			Enabled:       true,
+			Issuer:        issuer.server.URL,
+			ClientID:      "expense-web",
+			ClientSecret:  "web-secret",
+			RedirectURL:   "http://gateway.local/auth/oidc/callback",
+			Scopes:        []string{"openid", "email"},
+			RefreshBefore: time.Minute,
+			Session: config.SessionCookieConfig{
+				Name:   "gw_session",
+				Secret: "0123456789abcdef0123456789abcdef",
+				MaxAge: time.Hour,
+			},
+		},
+	}
+
+	sessionMiddleware := auth.NewSessionMiddleware(cfg, zap.NewNop())
+	jwtMiddleware := auth.NewJWTMiddleware(cfg, zap.NewNop())
+
+	r := gin.New()
+	r.Use(sessionMiddleware.Authenticate())
+	r.GET("/auth/oidc/login", sessionMiddleware.Login())
+	r.GET("/auth/oidc/callback", sessionMiddleware.Callback())
+	r.POST("/auth/oidc/logout", sessionMiddleware.Logout())
+	r.GET("/api/me", jwtMiddleware.Authenticate(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"user_id": c.Request.Header.Get("X-User-ID"),
+			"role":    c.Request.Header.Get("X-User-Role"),
+			"method":  auth.GetAuthMethodFromContext(c),
+			"cookie":  c.Request.Header.Get("Cookie"),
+		})
+	})
+
+	return r
+}
+
+// findCookie 從回應中查找 Cookie
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// oidcLogin 執行完整登入流程並返回會話 Cookie
+func oidcLogin(t *testing.T, r *gin.Engine, issuer *testIssuer) *http.Cookie {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?return_to=/reports", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	location := w.Header().Get("Location")
+	assert.Contains(t, location, "code_challenge_method=S256")
+	loginCookie := findCookie(w, "gw_session_login")
+	require.NotNil(t, loginCookie)
+	assert.True(t, loginCookie.HttpOnly)
+
+	code, state, err := issuer.authorize(location)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code="+code+"&state="+state, nil)
+	req.AddCookie(loginCookie)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/reports", w.Header().Get("Location"))
+
+	sessionCookie := findCookie(w, "gw_session")
+	require.NotNil(t, sessionCookie)
+	assert.True(t, sessionCookie.HttpOnly)
+	return sessionCookie
+}
+
+func TestSessionMiddleware_LoginFlow(t *testing.T) {
+	issuer := newTestIssuer(t)
+	r := newOIDCTestRouter(issuer)
+
+	sessionCookie := oidcLogin(t, r, issuer)
+
+	// 會話 Cookie 轉換為上游身份 headers，且不轉發給上游
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(sessionCookie)
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "u-42", body["user_id"])
+	assert.Equal(t, "user", body["role"])
+	assert.Equal(t, auth.AuthMethodSession, body["method"])
+	assert.Equal(t, "theme=dark", body["cookie"])
+	assert.Equal(t, int32(0), atomic.LoadInt32(&issuer.refreshCalls))
+
+	// 竄改的 Cookie 無法通過驗證
+	tampered := *sessionCookie
+	tampered.Value = tampered.Value[:len(tampered.Value)-4] + "AAAA"
+	req = httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(&tampered)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 登出清除 Cookie 並重定向到 IdP
+	req = httptest.NewRequest(http.MethodPost, "/auth/oidc/logout", nil)
+	req.AddCookie(sessionCookie)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), issuer.server.URL+"/logout?")
+	assert.Contains(t, w.Header().Get("Location"), "id_token_hint=")
+	cleared := findCookie(w, "gw_session")
+	require.NotNil(t, cleared)
+	assert.True(t, cleared.MaxAge < 0)
+}
+
+func TestSessionMiddleware_SilentRefresh(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.expiresIn = 30 // 小於 refresh_before，下一次請求即刷新
+	r := newOIDCTestRouter(issuer)
+
+	sessionCookie := oidcLogin(t, r, issuer)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(sessionCookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "manager", body["role"])
+	assert.Equal(t, int32(1), atomic.LoadInt32(&issuer.refreshCalls))
+
+	refreshed := findCookie(w, "gw_session")
+	require.NotNil(t, refreshed)
+	assert.NotEqual(t, sessionCookie.Value, refreshed.Value)
+}
+
+func TestSessionMiddleware_CallbackRejectsInvalidState(t *testing.T) {
+	issuer := newTestIssuer(t)
+	r := newOIDCTestRouter(issuer)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?return_to=//evil.example.com", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	loginCookie := findCookie(w, "gw_session_login")
+	require.NotNil(t, loginCookie)
+
+	code, _, err := issuer.authorize(w.Header().Get("Location"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code="+code+"&state=forged", nil)
+	req.AddCookie(loginCookie)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, findCookie(w, "gw_session"))
+
+	// 無登入狀態 Cookie 時拒絕回調
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code="+code+"&state=x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
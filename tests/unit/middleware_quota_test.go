@@ -0,0 +1,182 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/middleware/auth"
+	"expense-api-gateway/internal/middleware/quota"
+	quotasvc "expense-api-gateway/internal/service/quota"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newQuotaTestConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		Quota: config.QuotaConfig{
+			Enabled:       true,
+			FilePath:      filepath.Join(t.TempDir(), "quota.json"),
+			Timezone:      "Asia/Taipei",
+			RefundOnError: true,
+			Policies: []config.QuotaPolicy{
+				{Name: "company-monthly", Scope: "company", Period: "month", Limit: 10},
+				{Name: "user-daily", Scope: "user", Period: "day", Limit: 6},
+			},
+			Costs: map[string]int64{
+				"/api/v1/ai/ocr":     5,
+				"/api/v1/ai/analyze": 1,
+			},
+		},
+	}
+}
+
+func TestQuotaMiddleware_Enforce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := newQuotaTestConfig(t)
+	middleware := quota.NewQuotaMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	assert.Equal(t, int64(5), middleware.ResolveCost("", "/api/v1/ai/ocr", 0))
+	assert.Equal(t, int64(2), middleware.ResolveCost("", "/api/v1/ai/ocr", 2), "路由自身設定優先")
+	assert.Equal(t, int64(0), middleware.ResolveCost("", "/api/v1/ai/:path", 0))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		auth.SetAuthContext(c, &domain.AuthUser{
+			ID:        c.GetHeader("X-Test-User"),
+			CompanyID: "c-1",
+			Role:      "user",
+		}, auth.AuthMethodBearer, nil)
+		c.Next()
+	})
+	r.POST("/api/v1/ai/ocr", middleware.Enforce("ocr", 5), func(c *gin.Context) {
+		if c.GetHeader("X-Test-Fail") != "" {
+			c.JSON(http.StatusBadGateway, gin.H{"status": "error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+	})
+
+	call := func(user string, fail bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/ai/ocr", nil)
+		req.Header.Set("X-Test-User", user)
+		if fail {
+			req.Header.Set("X-Test-Fail", "1")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 上游失敗時退還用量
+	w := call("u-1", true)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	w = call("u-1", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Quota-Remaining"), "以剩餘最少的策略為準")
+	assert.Equal(t, "user-daily", w.Header().Get("X-Quota-Policy"))
+
+	// 用戶每日額度不足時返回 429
+	w = call("u-1", false)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "QUOTA_EXCEEDED")
+
+	w = call("u-2", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-Quota-Remaining"))
+
+	// 公司每月額度用盡時返回 402
+	w = call("u-3", false)
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+
+	// 追加額度後恢復
+	_, err := middleware.Service().Grant("company-monthly", "c-1", 5)
+	require.NoError(t, err)
+	w = call("u-3", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestQuotaMiddleware_AdminEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := newQuotaTestConfig(t)
+	middleware := quota.NewQuotaMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	middleware.Service().Consume(quotasvc.Subject{UserID: "u-1", CompanyID: "c-1"}, 4)
+
+	r := gin.New()
+	r.GET("/admin/quota", middleware.GetUsage())
+	r.POST("/admin/quota/topup", middleware.TopUp())
+
+	body, _ := json.Marshal(gin.H{"policy": "company-monthly", "subject_id": "c-1", "amount": 20, "reason": "合約加購"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/quota/topup", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body, _ = json.Marshal(gin.H{"policy": "missing", "subject_id": "c-1", "amount": 1, "reason": "x"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/admin/quota/topup", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/quota?scope=company&id=c-1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data struct {
+			Usage []quotasvc.Usage `json:"usage"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data.Usage, 1)
+	assert.Equal(t, int64(30), resp.Data.Usage[0].Limit)
+	assert.Equal(t, int64(4), resp.Data.Usage[0].Used)
+	assert.Equal(t, int64(26), resp.Data.Usage[0].Remaining)
+}
+
+func TestQuotaService_PersistenceAndPeriods(t *testing.T) {
+	cfg := newQuotaTestConfig(t)
+
+	// UTC 10/31 16:30 為台北時間 11/1 00:30，應計入 11 月
+	now := time.Date(2026, 10, 31, 16, 30, 0, 0, time.UTC)
+	service, err := quotasvc.New(cfg, zap.NewNop())
+	require.NoError(t, err)
+	service.SetClock(func() time.Time { return now })
+
+	result := service.Consume(quotasvc.Subject{UserID: "u-1", CompanyID: "c-1"}, 3)
+	require.True(t, result.Allowed)
+	usage := service.Usage("company", "c-1")
+	require.Len(t, usage, 1)
+	assert.Equal(t, "2026-11", usage[0].Period)
+	require.NoError(t, service.Close())
+
+	// 重啟後保留用量
+	restarted, err := quotasvc.New(cfg, zap.NewNop())
+	require.NoError(t, err)
+	restarted.SetClock(func() time.Time { return now })
+	assert.Equal(t, int64(3), restarted.Usage("company", "c-1")[0].Used)
+	assert.Equal(t, int64(3), restarted.Usage("user", "u-1")[0].Used)
+
+	// 隔日重置每日額度，每月額度保留
+	now = now.Add(24 * time.Hour)
+	assert.Equal(t, int64(0), restarted.Usage("user", "u-1")[0].Used)
+	assert.Equal(t, int64(3), restarted.Usage("company", "c-1")[0].Used)
+
+	// 下個月重置每月額度
+	now = time.Date(2026, 11, 30, 16, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2026-12", restarted.Usage("company", "c-1")[0].Period)
+	assert.Equal(t, int64(0), restarted.Usage("company", "c-1")[0].Used)
+	require.NoError(t, restarted.Close())
+}
@@ -1,16 +1,22 @@
 package unit
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
 	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/domain"
+	"expense-api-gateway/internal/handler"
+	"expense-api-gateway/internal/middleware/auth"
 	"expense-api-gateway/internal/middleware/ratelimit"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -220,3 +226,303 @@ func TestRateLimitMiddleware_Reset(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code, "重置後的第一個請求應該成功")
 }
+
+func TestRateLimitMiddleware_Headers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 2,
+			IPLimit: config.RateLimitRule{
+				Requests: 10,
+				Window:   time.Minute,
+			},
+			Headers: "all",
+		},
+	}
+
+	middleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	router := gin.New()
+	router.Use(middleware.GlobalRateLimit())
+	router.Use(middleware.IPRateLimit())
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	// 允許的請求帶有所有策略，RateLimit 反映最嚴格的限流器
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"global";q=2;w=60, "ip";q=10;w=60`, w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, `"global";r=1;t=30`, w.Header().Get("RateLimit"))
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	// 被限流的請求帶有 Retry-After
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, `"global";r=0;t=60`, w.Header().Get("RateLimit"))
+	assert.Contains(t, w.Body.String(), `"retry_after":30`)
+}
+
+func TestRateLimitMiddleware_HeadersOnlyWhenLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 1,
+		},
+	}
+
+	middleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	router := gin.New()
+	router.Use(middleware.GlobalRateLimit())
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit"), "默認只在限流時輸出響應頭")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.NotEmpty(t, w.Header().Get("RateLimit-Policy"))
+}
+
+func TestRateLimitMiddleware_APILimitMatchesRoutePattern(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 1000,
+			APILimit: map[string]config.RateLimitRule{
+				"/api/v1/users": {Requests: 2, Window: time.Minute, KeyBy: []string{"ip"}},
+			},
+		},
+	}
+
+	middleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	router := gin.New()
+	router.Use(middleware.APIRateLimit())
+	router.GET("/api/v1/users/:id", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	// 不同的路徑參數共享同一個路由限流
+	codes := make([]int, 0, 3)
+	for _, id := range []string{"1", "2", "3"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/users/"+id, nil))
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimitMiddleware_ConcurrentLimiterCreation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	apiLimit := make(map[string]config.RateLimitRule)
+	for i := 0; i < 20; i++ {
+		apiLimit[fmt.Sprintf("/api/v1/r%d", i)] = config.RateLimitRule{Requests: 100, Window: time.Minute}
+	}
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 1000,
+			IPLimit:     config.RateLimitRule{Requests: 1000, Window: time.Minute},
+			UserLimit:   config.RateLimitRule{Requests: 1000, Window: time.Minute},
+			APILimit:    apiLimit,
+		},
+	}
+
+	middleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		auth.SetAuthContext(c, &domain.AuthUser{ID: "u-1", Role: "user"}, auth.AuthMethodBearer, nil)
+		c.Next()
+	})
+	router.Use(middleware.IPRateLimit(), middleware.UserRateLimit(), middleware.APIRateLimit())
+	for pattern := range apiLimit {
+		router.GET(pattern, func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+	}
+
+	// IP 與用戶限流讀取 limiters 時，API 限流器同時被創建（需以 -race 執行）
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/v1/r%d", i), nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRateLimitMiddleware_RouteRateLimitKeyBy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 1000,
+			APILimit: map[string]config.RateLimitRule{
+				"expense-upload":     {Requests: 5, Window: time.Minute},
+				"/api/v1/expenses/*": {Requests: 7, Window: time.Minute},
+			},
+		},
+	}
+
+	middleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	// 規則優先順序：路由自身 > 路由 ID > 路由模式
+	own := &config.RateLimitRule{Requests: 1, Window: time.Minute}
+	rule, ok := middleware.ResolveRouteRule("expense-upload", "/api/v1/expenses/upload", own)
+	assert.True(t, ok)
+	assert.Equal(t, 1, rule.Requests)
+	rule, _ = middleware.ResolveRouteRule("expense-upload", "/api/v1/expenses/upload", nil)
+	assert.Equal(t, 5, rule.Requests)
+	rule, _ = middleware.ResolveRouteRule("", "/api/v1/expenses/:path", nil)
+	assert.Equal(t, 7, rule.Requests)
+	_, ok = middleware.ResolveRouteRule("", "/api/v1/approvals/:path", nil)
+	assert.False(t, ok)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		auth.SetAuthContext(c, &domain.AuthUser{
+			ID:        c.GetHeader("X-Test-User"),
+			CompanyID: c.GetHeader("X-Test-Company"),
+			Role:      "user",
+		}, auth.AuthMethodBearer, nil)
+		c.Next()
+	})
+	router.GET("/api/v1/reports/:report",
+		middleware.RouteRateLimit("reports", config.RateLimitRule{
+			Requests: 1,
+			Window:   time.Minute,
+			KeyBy:    []string{"company", "param:report"},
+		}),
+		func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "success"})
+		})
+
+	request := func(user, company, report string) int {
+		req := httptest.NewRequest("GET", "/api/v1/reports/"+report, nil)
+		req.Header.Set("X-Test-User", user)
+		req.Header.Set("X-Test-Company", company)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("u1", "c1", "monthly"))
+	assert.Equal(t, http.StatusTooManyRequests, request("u2", "c1", "monthly"), "同公司的不同用戶共享額度")
+	assert.Equal(t, http.StatusOK, request("u1", "c1", "yearly"), "不同路徑參數各自計數")
+	assert.Equal(t, http.StatusOK, request("u3", "c2", "monthly"), "不同公司各自計數")
+}
+
+func TestRateLimitMiddleware_AdminStatsAndReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 1000,
+			IPLimit:     config.RateLimitRule{Requests: 2, Window: time.Minute},
+		},
+	}
+	logger := zap.NewNop()
+	middleware := ratelimit.NewRateLimitMiddleware(cfg, logger)
+	defer middleware.Close()
+	h := handler.NewWithRateLimit(cfg, logger, nil, nil, nil, middleware)
+
+	router := gin.New()
+	router.Use(middleware.GlobalRateLimit())
+	router.Use(middleware.IPRateLimit())
+	router.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	admin := gin.New()
+	admin.GET("/admin/rate-limit/stats", h.GetRateLimitStats)
+	admin.GET("/admin/rate-limit/keys", h.GetRateLimitKey)
+	admin.POST("/admin/rate-limit/reset", h.ResetRateLimit)
+
+	send := func(ip string) int {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.RemoteAddr = ip + ":4000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	callAdmin := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	for i := 0; i < 4; i++ {
+		send("203.0.113.1")
+	}
+	assert.Equal(t, http.StatusOK, send("198.51.100.1"))
+
+	// 即時統計
+	var ipStats ratelimit.LimiterStats
+	for _, stats := range middleware.Stats(5) {
+		if stats.Name == "ip" {
+			ipStats = stats
+		}
+	}
+	assert.Equal(t, 2, ipStats.ActiveKeys)
+	assert.Equal(t, int64(3), ipStats.Allowed)
+	assert.Equal(t, int64(2), ipStats.Rejected)
+	require.Len(t, ipStats.TopThrottled, 1)
+	assert.Equal(t, ratelimit.KeyCount{Key: "ip:203.0.113.1", Rejected: 2}, ipStats.TopThrottled[0])
+
+	w := callAdmin("GET", "/admin/rate-limit/stats?top=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"top_throttled":[{"key":"ip:203.0.113.1","rejected":2}]`)
+
+	// 查詢單個 key
+	w = callAdmin("GET", "/admin/rate-limit/keys?key=ip:203.0.113.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"limiter":"ip"`)
+	assert.Contains(t, w.Body.String(), `"remaining":0`)
+	assert.Equal(t, http.StatusNotFound, callAdmin("GET", "/admin/rate-limit/keys?key=ip:192.0.2.1").Code)
+
+	// 按模式重置，不影響其他 key
+	assert.Equal(t, http.StatusBadRequest, callAdmin("POST", "/admin/rate-limit/reset").Code)
+	w = callAdmin("POST", "/admin/rate-limit/reset?pattern=ip:203.0.113.*")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"reset":1`)
+	assert.Equal(t, http.StatusOK, send("203.0.113.1"), "重置後應該允許")
+
+	state := middleware.LookupKey("ip:198.51.100.1")
+	require.Len(t, state, 1)
+	assert.Equal(t, 1, state[0].Remaining, "未匹配的 key 不應被重置")
+}
@@ -0,0 +1,451 @@
+package unit
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/upload"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testEICAR EICAR 防毒測試文件內容
+const testEICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// uploadPart 測試用的多部分表單文件
+type uploadPart struct {
+	field       string
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// receivedFile 上游收到的文件
+type receivedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// testImage 生成指定尺寸的 JPEG 或 PNG 圖片
+func testImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, x%height, color.RGBA{R: uint8(x), G: 80, B: 160, A: 255})
+	}
+	var buf bytes.Buffer
+	if format == "png" {
+		require.NoError(t, png.Encode(&buf, img))
+	} else {
+		require.NoError(t, jpeg.Encode(&buf, img, nil))
+	}
+	return buf.Bytes()
+}
+
+// buildUploadBody 組裝多部分表單請求體
+func buildUploadBody(t *testing.T, fields map[string]string, parts ...uploadPart) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, writer.WriteField(name, value))
+	}
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="`+part.field+`"; filename="`+part.filename+`"`)
+		if part.contentType != "" {
+			header.Set("Content-Type", part.contentType)
+		}
+		w, err := writer.CreatePart(header)
+		require.NoError(t, err)
+		_, err = w.Write(part.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return &body, writer.FormDataContentType()
+}
+
+// setupUploadRouter 創建帶上傳策略的路由，上游處理器返回收到的文件與字段
+func setupUploadRouter(cfg *config.Config, policy *config.UploadPolicy, scanner upload.Scanner) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	middleware := upload.NewUploadMiddlewareWithScanner(cfg, zap.NewNop(), nil, scanner)
+	router.POST("/upload", middleware.Enforce("upload", policy), func(c *gin.Context) {
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var files []receivedFile
+		for field, headers := range c.Request.MultipartForm.File {
+			for _, header := range headers {
+				files = append(files, receivedFile{
+					Field:       field,
+					Filename:    header.Filename,
+					ContentType: header.Header.Get("Content-Type"),
+					Size:        header.Size,
+				})
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"files": files, "fields": c.Request.MultipartForm.Value})
+	})
+	return router
+}
+
+// performUpload 發送上傳請求並返回響應
+func performUpload(router *gin.Engine, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// uploadErrorCode 取出錯誤響應的 code
+func uploadErrorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response struct {
+		Code string `json:"code"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Code
+}
+
+// receivedFiles 取出上游收到的文件
+func receivedFiles(t *testing.T, w *httptest.ResponseRecorder) ([]receivedFile, map[string][]string) {
+	t.Helper()
+	var response struct {
+		Files  []receivedFile      `json:"files"`
+		Fields map[string][]string `json:"fields"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Files, response.Fields
+}
+
+func TestUploadMiddleware_ContentSniffing(t *testing.T) {
+	policy := &config.UploadPolicy{AllowedTypes: []string{"image/jpeg", "image/png", "application/pdf"}}
+	router := setupUploadRouter(&config.Config{}, policy, nil)
+	jpg := testImage(t, "jpeg", 40, 30)
+	pdf := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n")
+
+	t.Run("declared type matches content", func(t *testing.T) {
+		body, contentType := buildUploadBody(t, map[string]string{"expense_id": "exp-1"},
+			uploadPart{field: "receipt", filename: "receipt.jpg", contentType: "image/jpeg", data: jpg})
+		w := performUpload(router, body, contentType)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		files, fields := receivedFiles(t, w)
+		require.Len(t, files, 1)
+		assert.Equal(t, "receipt.jpg", files[0].Filename)
+		assert.Equal(t, "image/jpeg", files[0].ContentType)
+		assert.Equal(t, int64(len(jpg)), files[0].Size)
+		assert.Equal(t, []string{"exp-1"}, fields["expense_id"])
+	})
+
+	t.Run("generic declared type uses content", func(t *testing.T) {
+		body, contentType := buildUploadBody(t, nil,
+			uploadPart{field: "receipt", filename: "invoice", contentType: "application/octet-stream", data: pdf})
+		w := performUpload(router, body, contentType)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		files, _ := receivedFiles(t, w)
+		require.Len(t, files, 1)
+		assert.Equal(t, "application/pdf", files[0].ContentType)
+		assert.Equal(t, "invoice.pdf", files[0].Filename)
+	})
+
+	t.Run("executable disguised as image", func(t *testing.T) {
+		exe := append([]byte("MZ\x90\x00\x03\x00\x00\x00"), make([]byte, 256)...)
+		body, contentType := buildUploadBody(t, nil,
+			uploadPart{field: "receipt", filename: "receipt.jpg", contentType: "image/jpeg", data: exe})
+		w := performUpload(router, body, contentType)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, "UPLOAD_TYPE_NOT_ALLOWED", uploadErrorCode(t, w))
+	})
+
+	t.Run("declared type contradicts content", func(t *testing.T) {
+		body, contentType := buildUploadBody(t, nil,
+			uploadPart{field: "receipt", filename: "receipt.png", contentType: "image/png", data: jpg})
+		w := performUpload(router, body, contentType)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, "UPLOAD_TYPE_MISMATCH", uploadErrorCode(t, w))
+	})
+
+	t.Run("raw body is treated as a single file", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader([]byte("plain text")))
+		req.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
+
+func TestUploadMiddleware_Limits(t *testing.T) {
+	jpg := testImage(t, "jpeg", 40, 30)
+	policy := &config.UploadPolicy{
+		AllowedTypes: []string{"image/*"},
+		MaxFiles:     2,
+		MaxFileSize:  int64(len(jpg)),
+	}
+	// 記憶體上限很小，文件與重建後的請求體都經過臨時文件
+	cfg := &config.Config{}
+	cfg.Security.Upload.MemoryLimit = 64
+	router := setupUploadRouter(cfg, policy, nil)
+
+	part := uploadPart{field: "receipts", filename: "r.jpg", contentType: "image/jpeg", data: jpg}
+
+	body, contentType := buildUploadBody(t, nil, part, part)
+	w := performUpload(router, body, contentType)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	files, _ := receivedFiles(t, w)
+	assert.Len(t, files, 2)
+
+	body, contentType = buildUploadBody(t, nil, part, part, part)
+	w = performUpload(router, body, contentType)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "UPLOAD_TOO_MANY_FILES", uploadErrorCode(t, w))
+
+	oversized := part
+	oversized.data = append(append([]byte{}, jpg...), 0)
+	body, contentType = buildUploadBody(t, nil, oversized)
+	w = performUpload(router, body, contentType)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "UPLOAD_FILE_TOO_LARGE", uploadErrorCode(t, w))
+
+	body, contentType = buildUploadBody(t, nil, part)
+	w = performUpload(router, bytes.NewBuffer(body.Bytes()[:body.Len()/2]), contentType)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "INVALID_UPLOAD", uploadErrorCode(t, w))
+}
+
+func TestUploadMiddleware_UnsafeContent(t *testing.T) {
+	policy := &config.UploadPolicy{AllowedTypes: []string{"image/jpeg", "image/svg+xml", "application/pdf"}}
+	router := setupUploadRouter(&config.Config{}, policy, nil)
+	jpg := testImage(t, "jpeg", 40, 30)
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	entry, err := zipWriter.Create("payload.jsp")
+	require.NoError(t, err)
+	_, err = entry.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		status   int
+	}{
+		{"clean jpeg", "r.jpg", jpg, http.StatusOK},
+		{"jpeg with php", "r.jpg", append(append([]byte{}, jpg...), []byte("<?php system($_GET['c']); ?>")...), http.StatusUnprocessableEntity},
+		{"jpeg with appended zip", "r.jpg", append(append([]byte{}, jpg...), archive.Bytes()...), http.StatusUnprocessableEntity},
+		{"clean svg", "logo.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>`), http.StatusOK},
+		{"svg with script", "logo.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), http.StatusUnprocessableEntity},
+		{"svg with event handler", "logo.svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><rect onload = "alert(1)"/></svg>`), http.StatusUnprocessableEntity},
+		{"pdf with javascript", "r.pdf", []byte("%PDF-1.4\n1 0 obj\n<< /OpenAction << /S /JavaScript /JS (app.alert(1)) >> >>\nendobj\n"), http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := buildUploadBody(t, nil, uploadPart{field: "file", filename: tt.filename, data: tt.data})
+			w := performUpload(router, body, contentType)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status != http.StatusOK {
+				assert.Equal(t, "UPLOAD_UNSAFE_CONTENT", uploadErrorCode(t, w))
+			}
+		})
+	}
+}
+
+func TestUploadMiddleware_ImageDimensions(t *testing.T) {
+	policy := &config.UploadPolicy{AllowedTypes: []string{"image/*"}, MaxImageWidth: 100, MaxImageHeight: 80}
+	router := setupUploadRouter(&config.Config{}, policy, nil)
+
+	for _, tt := range []struct {
+		format        string
+		width, height int
+		status        int
+	}{
+		{"jpeg", 100, 80, http.StatusOK},
+		{"jpeg", 101, 80, http.StatusUnprocessableEntity},
+		{"png", 50, 81, http.StatusUnprocessableEntity},
+	} {
+		body, contentType := buildUploadBody(t, nil,
+			uploadPart{field: "file", filename: "r." + tt.format, data: testImage(t, tt.format, tt.width, tt.height)})
+		w := performUpload(router, body, contentType)
+		assert.Equal(t, tt.status, w.Code, "%s %dx%d", tt.format, tt.width, tt.height)
+	}
+
+	// 聲稱是 JPEG 但文件頭損壞
+	body, contentType := buildUploadBody(t, nil,
+		uploadPart{field: "file", filename: "r.jpg", data: []byte("\xFF\xD8\xFF\xE0broken")})
+	w := performUpload(router, body, contentType)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "UPLOAD_INVALID_IMAGE", uploadErrorCode(t, w))
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"receipt.jpg", "receipt.jpg"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\收據 2024.pdf`, "收據 2024.pdf"},
+		{"in\x00voice\r\n.pdf", "invoice.pdf"},
+		{"a<b>c:d|e?.png", "a_b_c_d_e_.png"},
+		{"...", "upload"},
+		{"  .hidden  ", "hidden"},
+		{"CON.txt", "_CON.txt"},
+		{"\u202Etxt.exe", "txt.exe"},
+		{strings.Repeat("長", 200) + ".jpg", strings.Repeat("長", 83) + ".jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := upload.SanitizeFilename(tt.input)
+			assert.Equal(t, tt.expected, result)
+			assert.LessOrEqual(t, len(result), 255)
+		})
+	}
+}
+
+func TestUploadMiddleware_FilenameRewrite(t *testing.T) {
+	router := setupUploadRouter(&config.Config{}, &config.UploadPolicy{AllowedTypes: []string{"image/jpeg"}}, nil)
+	jpg := testImage(t, "jpeg", 20, 20)
+
+	body, contentType := buildUploadBody(t, nil,
+		uploadPart{field: "a", filename: "../../var/www/shell.php", data: jpg},
+		uploadPart{field: "b", filename: "scan 2024.03.jpeg", contentType: "image/jpg", data: jpg})
+	w := performUpload(router, body, contentType)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	files, _ := receivedFiles(t, w)
+	names := map[string]string{}
+	for _, file := range files {
+		names[file.Field] = file.Filename
+	}
+	assert.Equal(t, "shell.jpg", names["a"])
+	assert.Equal(t, "scan 2024_03.jpeg", names["b"])
+}
+
+// startFakeClamd 啟動模擬 clamd 的 TCP 服務，按 INSTREAM 協議接收內容，包含 EICAR 時回覆 FOUND
+func startFakeClamd(t *testing.T) (string, func() int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	scans := make(chan struct{}, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				command, err := reader.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var content bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, reader, int64(size)); err != nil {
+						return
+					}
+				}
+				scans <- struct{}{}
+				if bytes.Contains(content.Bytes(), []byte(testEICAR)) {
+					conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), func() int { return len(scans) }
+}
+
+func TestUploadMiddleware_MalwareScan(t *testing.T) {
+	address, scanned := startFakeClamd(t)
+	policy := &config.UploadPolicy{AllowedTypes: []string{"text/plain", "image/jpeg"}, Scan: true}
+	router := setupUploadRouter(&config.Config{}, policy, upload.NewClamdScanner(address, 5*time.Second))
+
+	// 大於一個 INSTREAM 數據塊，EICAR 位於第二個數據塊
+	infected := append(bytes.Repeat([]byte("a"), 40<<10), []byte(testEICAR)...)
+	body, contentType := buildUploadBody(t, nil, uploadPart{field: "file", filename: "notes.txt", data: infected})
+	w := performUpload(router, body, contentType)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "UPLOAD_MALWARE_DETECTED", uploadErrorCode(t, w))
+	assert.Contains(t, w.Body.String(), "Win.Test.EICAR_HDB-1")
+
+	body, contentType = buildUploadBody(t, nil, uploadPart{field: "file", filename: "r.jpg", data: testImage(t, "jpeg", 20, 20)})
+	w = performUpload(router, body, contentType)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 2, scanned())
+
+	// 本地替身同樣識別 EICAR
+	result, err := upload.StubScanner{}.Scan(context.Background(), bytes.NewReader(infected))
+	require.NoError(t, err)
+	assert.False(t, result.Clean)
+	stub := upload.NewScanner(config.UploadScannerConfig{Type: config.UploadScannerStub})
+	result, err = stub.Scan(context.Background(), strings.NewReader("clean"))
+	require.NoError(t, err)
+	assert.True(t, result.Clean)
+}
+
+func TestUploadMiddleware_ScannerFailMode(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	policy := &config.UploadPolicy{AllowedTypes: []string{"image/jpeg"}, Scan: true}
+	jpg := testImage(t, "jpeg", 20, 20)
+
+	cfg := &config.Config{}
+	cfg.Security.Upload.Scanner.FailMode = "closed"
+	router := setupUploadRouter(cfg, policy, upload.NewClamdScanner(address, time.Second))
+	body, contentType := buildUploadBody(t, nil, uploadPart{field: "file", filename: "r.jpg", data: jpg})
+	w := performUpload(router, body, contentType)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "UPLOAD_SCAN_UNAVAILABLE", uploadErrorCode(t, w))
+
+	cfg.Security.Upload.Scanner.FailMode = "open"
+	body, contentType = buildUploadBody(t, nil, uploadPart{field: "file", filename: "r.jpg", data: jpg})
+	w = performUpload(router, body, contentType)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,673 @@
+package unit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/middleware/security"
+	"expense-api-gateway/internal/middleware/waf"
+	"expense-api-gateway/internal/service/monitor"
+	"expense-api-gateway/internal/service/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// bodyInput 建立請求體輸入
+func bodyInput(name, value string) []waf.Input {
+	return []waf.Input{{Target: waf.TargetBody, Name: name, Value: value}}
+}
+
+// newWAFTestRouter 創建掛載 XSS 與 SQL 注入檢測的測試路由
+func newWAFTestRouter(engine *waf.Engine, monitorService *monitor.Monitor, patterns ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Security: config.SecurityConfig{
+			XSS:          config.XSSConfig{Enabled: true},
+			SQLInjection: config.SQLInjectionConfig{Enabled: true},
+		},
+	}
+	logger := zap.NewNop()
+
+	r := gin.New()
+	r.Use(security.NewXSSMiddlewareWithEngine(cfg, logger, engine, monitorService).XSSProtection())
+	r.Use(security.NewSQLInjectionMiddlewareWithEngine(cfg, logger, engine, monitorService).SQLInjectionProtection())
+	for _, pattern := range patterns {
+		r.POST(pattern, func(c *gin.Context) {
+			body, _ := c.GetRawData()
+			c.String(http.StatusOK, string(body))
+		})
+	}
+	return r
+}
+
+// writeWAFRules 寫入規則文件
+func writeWAFRules(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestWAFEngine_AnomalyScoring(t *testing.T) {
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+
+	// 一般報銷說明不應被布爾運算符規則誤判
+	for _, text := range []string{"Taxi and dinner", "Hotel or Airbnb, not both", "Lunch with client #42"} {
+		result := engine.Evaluate(waf.CategorySQLi, "", bodyInput("description", text))
+		assert.False(t, result.Blocked, text)
+		assert.Zero(t, result.Score, text)
+	}
+
+	// 單個低嚴重程度的命中低於閾值
+	result := engine.Evaluate(waf.CategorySQLi, "", bodyInput("note", "discount%27"))
+	assert.False(t, result.Blocked)
+	assert.Equal(t, 3, result.Score)
+	assert.Equal(t, []string{"942190"}, result.RuleIDs())
+
+	// 多條規則的分數累計達到閾值
+	result = engine.Evaluate(waf.CategorySQLi, "", append(bodyInput("note", "discount%27"),
+		waf.Input{Target: waf.TargetQuery, Name: "q", Value: "select name from users"}))
+	assert.True(t, result.Blocked)
+	assert.Equal(t, 7, result.Score)
+	assert.ElementsMatch(t, []string{"942180", "942190"}, result.RuleIDs())
+
+	// 同一規則在多個輸入中命中只計分一次
+	result = engine.Evaluate(waf.CategoryXSS, "", append(bodyInput("a", "<script>"), bodyInput("b", "<SCRIPT src=x>")...))
+	assert.Equal(t, 5, result.Score)
+	assert.Len(t, result.Matches, 1)
+	assert.Equal(t, "a", result.Matches[0].Name)
+
+	// 類別只評分對應標籤的規則
+	assert.Zero(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("a", "<script>")).Score)
+}
+
+func TestWAFEngine_ParanoiaLevel(t *testing.T) {
+	inputs := bodyInput("description", "Taxi and dinner")
+
+	level1 := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+	assert.Zero(t, level1.Evaluate(waf.CategorySQLi, "", inputs).Score)
+
+	level4 := waf.NewDefaultEngine(config.WAFConfig{ParanoiaLevel: 4, AnomalyThreshold: 2}, zap.NewNop())
+	result := level4.Evaluate(waf.CategorySQLi, "", inputs)
+	assert.True(t, result.Blocked)
+	assert.Equal(t, []string{"942220"}, result.RuleIDs())
+}
+
+func TestWAFMiddleware_RouteExclusions(t *testing.T) {
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+	engine.SetRoutePolicy("/login", config.RouteSecurityConfig{ExcludeRules: []string{"942120"}})
+	engine.SetRoutePolicy("/notes", config.RouteSecurityConfig{ExcludeRules: []string{"tag:xss"}})
+	r := newWAFTestRouter(engine, nil, "/login", "/notes", "/expenses")
+
+	post := func(path, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	password := `{"username":"alice","password":"p@ss-- word"}`
+	assert.Equal(t, http.StatusOK, post("/login", password))
+	assert.Equal(t, http.StatusBadRequest, post("/expenses", password))
+
+	markup := `{"items":[{"description":"<script>alert(1)</script>"}]}`
+	assert.Equal(t, http.StatusOK, post("/notes", markup))
+	assert.Equal(t, http.StatusBadRequest, post("/expenses", markup))
+
+	// 排除 XSS 規則不影響 SQL 注入檢測
+	assert.Equal(t, http.StatusBadRequest, post("/notes", `{"id":"1 UNION SELECT password FROM users"}`))
+
+	// 請求體在檢測後仍可被下游讀取
+	req := httptest.NewRequest(http.MethodPost, "/expenses", strings.NewReader(`{"description":"Taxi and dinner"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"description":"Taxi and dinner"}`, w.Body.String())
+}
+
+func TestWAFMiddleware_MultipartFields(t *testing.T) {
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+	r := newWAFTestRouter(engine, nil, "/upload")
+
+	upload := func(field, file string) int {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		require.NoError(t, writer.WriteField("description", field))
+		part, err := writer.CreateFormFile("receipt", "receipt.txt")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(file))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 文件內容不作為輸入檢查
+	assert.Equal(t, http.StatusOK, upload("Taxi and dinner", "<script>DROP TABLE receipts; --</script>"))
+	assert.Equal(t, http.StatusBadRequest, upload("<iframe src=x>", "receipt"))
+}
+
+func TestWAFEngine_RulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "waf_rules.yaml")
+	writeWAFRules(t, path, `
+rules:
+  - id: "913100"
+    targets: ["header:User-Agent"]
+    operator: pm
+    patterns: ["sqlmap"]
+    tags: ["sqli"]
+  - id: "942170"
+    disabled: true
+  - id: "990001"
+    targets: ["body:description"]
+    operator: contains
+    pattern: "forbidden"
+    severity: warning
+    tags: ["sqli"]
+`)
+
+	engine, err := waf.NewEngine(config.WAFConfig{RulesFile: path}, zap.NewNop())
+	require.NoError(t, err)
+
+	userAgent := []waf.Input{{Target: waf.TargetHeader, Name: "user-agent", Value: "sqlmap/1.7"}}
+	assert.True(t, engine.Evaluate(waf.CategorySQLi, "", userAgent).Blocked)
+
+	// 停用的內建規則不再命中
+	assert.Zero(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("hex", "0x73656C656374")).Score)
+
+	// 限定名稱的目標只檢查對應字段
+	assert.Equal(t, 3, engine.Evaluate(waf.CategorySQLi, "", bodyInput("description", "forbidden")).Score)
+	assert.Zero(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("comment", "forbidden")).Score)
+
+	// 內建規則仍然載入
+	assert.True(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("id", "1 UNION SELECT 1")).Blocked)
+
+	// JSON 格式與 exclude_defaults
+	jsonPath := filepath.Join(t.TempDir(), "waf_rules.json")
+	writeWAFRules(t, jsonPath, `{"exclude_defaults": true, "rules": [{"id": "1", "targets": ["query"], "pattern": "(?i)evil", "tags": ["xss"]}]}`)
+	engine, err = waf.NewEngine(config.WAFConfig{RulesFile: jsonPath}, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, engine.Rules(), 1)
+	assert.True(t, engine.Evaluate(waf.CategoryXSS, "", []waf.Input{{Target: waf.TargetQuery, Name: "q", Value: "EVIL"}}).Blocked)
+	assert.False(t, engine.Evaluate(waf.CategoryXSS, "", bodyInput("a", "<script>")).Blocked)
+
+	// 無效的規則文件返回錯誤
+	for _, content := range []string{
+		`rules: [{id: "1", targets: ["cookie"], pattern: "x", tags: ["xss"]}]`,
+		`rules: [{id: "1", targets: ["query"], pattern: "(", tags: ["xss"]}]`,
+		`rules: [{id: "1", targets: ["query"], pattern: "x", severity: "fatal", tags: ["xss"]}]`,
+		`rules: [{id: "1", targets: ["query"], pattern: "x"}, {id: "1", targets: ["query"], pattern: "y"}]`,
+	} {
+		writeWAFRules(t, path, content)
+		_, err := waf.NewEngine(config.WAFConfig{RulesFile: path}, zap.NewNop())
+		assert.Error(t, err, content)
+	}
+}
+
+func TestWAFEngine_HotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "waf_rules.yaml")
+	writeWAFRules(t, path, `rules: [{id: "990001", targets: ["query"], operator: equals, pattern: "first", tags: ["xss"]}]`)
+
+	engine, err := waf.NewEngine(config.WAFConfig{RulesFile: path, ReloadInterval: 20 * time.Millisecond}, zap.NewNop())
+	require.NoError(t, err)
+	engine.Start()
+	defer engine.Stop()
+
+	query := func(value string) []waf.Input {
+		return []waf.Input{{Target: waf.TargetQuery, Name: "q", Value: value}}
+	}
+	assert.True(t, engine.Evaluate(waf.CategoryXSS, "", query("first")).Blocked)
+
+	// 修改規則文件後自動重載
+	writeWAFRules(t, path, `rules: [{id: "990001", targets: ["query"], operator: equals, pattern: "second", tags: ["xss"]}]`)
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, future, future))
+	assert.Eventually(t, func() bool {
+		return engine.Evaluate(waf.CategoryXSS, "", query("second")).Blocked
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.False(t, engine.Evaluate(waf.CategoryXSS, "", query("first")).Blocked)
+
+	// 無效的規則文件不影響已載入的規則
+	writeWAFRules(t, path, `rules: [{id: "990001", targets: ["query"], pattern: "(", tags: ["xss"]}]`)
+	later := future.Add(time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, engine.Evaluate(waf.CategoryXSS, "", query("second")).Blocked)
+}
+
+func TestRouteSecurityConfig_Inherit(t *testing.T) {
+	group := &config.RouteSecurityConfig{
+		Mode:         config.SecurityModeMonitor,
+		ExcludeRules: []string{"942120"},
+		ExemptFields: []string{"notes"},
+		SQLInjection: &config.DetectorSecurityConfig{Mode: config.SecurityModeOff},
+	}
+	route := &config.RouteSecurityConfig{
+		ExcludeRules: []string{"tag:xss", "942120"},
+		SQLInjection: &config.DetectorSecurityConfig{ExemptFields: []string{"query"}},
+	}
+
+	assert.Nil(t, (*config.RouteSecurityConfig)(nil).Inherit(nil))
+	assert.Equal(t, []string{"942120"}, (*config.RouteSecurityConfig)(nil).Inherit(group).ExcludeRules)
+
+	merged := route.Inherit(group)
+	assert.Equal(t, config.SecurityModeMonitor, merged.Mode)
+	assert.Equal(t, []string{"942120", "tag:xss"}, merged.ExcludeRules)
+	assert.Equal(t, []string{"notes"}, merged.ExemptFields)
+	assert.Equal(t, config.SecurityModeOff, merged.SQLInjection.Mode)
+	assert.Equal(t, []string{"query"}, merged.SQLInjection.ExemptFields)
+	assert.Nil(t, merged.XSS)
+
+	// 下層的模式優先，且不修改原設定
+	route.Mode = config.SecurityModeBlock
+	assert.Equal(t, config.SecurityModeBlock, route.Inherit(group).Mode)
+	assert.Equal(t, []string{"tag:xss", "942120"}, route.ExcludeRules)
+}
+
+func TestWAFEngine_Mode(t *testing.T) {
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+
+	// 未設置路由設定時使用中間件配置，空值視為 block
+	assert.Equal(t, config.SecurityModeBlock, engine.Mode(waf.CategoryXSS, "/a", ""))
+	assert.Equal(t, config.SecurityModeMonitor, engine.Mode(waf.CategoryXSS, "/a", config.SecurityModeMonitor))
+
+	engine.SetGlobalPolicy(&config.RouteSecurityConfig{Mode: config.SecurityModeMonitor})
+	assert.Equal(t, config.SecurityModeMonitor, engine.Mode(waf.CategoryXSS, "/a", config.SecurityModeBlock))
+
+	engine.SetRoutePolicy("/b", config.RouteSecurityConfig{
+		Mode: config.SecurityModeMonitor,
+		XSS:  &config.DetectorSecurityConfig{Mode: config.SecurityModeOff},
+	})
+	assert.Equal(t, config.SecurityModeOff, engine.Mode(waf.CategoryXSS, "/b", config.SecurityModeBlock))
+	assert.Equal(t, config.SecurityModeMonitor, engine.Mode(waf.CategorySQLi, "/b", config.SecurityModeBlock))
+
+	// 無效的模式視為 block
+	engine.SetRoutePolicy("/c", config.RouteSecurityConfig{Mode: "audit"})
+	assert.Equal(t, config.SecurityModeBlock, engine.Mode(waf.CategorySQLi, "/c", config.SecurityModeMonitor))
+}
+
+func TestWAFMiddleware_MonitorModeAndExemptions(t *testing.T) {
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+	engine.SetRoutePolicy("/expenses", config.RouteSecurityConfig{
+		ExemptFields: []string{"description", "items.notes"},
+		SQLInjection: &config.DetectorSecurityConfig{Mode: config.SecurityModeMonitor},
+	})
+	engine.SetRoutePolicy("/reports", config.RouteSecurityConfig{Mode: config.SecurityModeOff})
+	monitorService := monitor.New(&config.Config{}, zap.NewNop())
+	r := newWAFTestRouter(engine, monitorService, "/expenses", "/reports", "/users")
+
+	post := func(path, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 豁免的字段不檢查，包括數組內的字段
+	assert.Equal(t, http.StatusOK, post("/expenses", `{"description":"<script>alert(1)</script>"}`))
+	assert.Equal(t, http.StatusOK, post("/expenses", `{"items":[{"notes":"<iframe src=x>"}]}`))
+	assert.Equal(t, http.StatusBadRequest, post("/expenses", `{"items":[{"vendor":"<iframe src=x>"}]}`))
+	assert.Equal(t, http.StatusBadRequest, post("/expenses", `{"notes":"<iframe src=x>"}`))
+
+	// monitor 模式只記錄不攔截
+	assert.Equal(t, http.StatusOK, post("/expenses", `{"vendor":"1 UNION SELECT password FROM users"}`))
+	assert.Equal(t, http.StatusBadRequest, post("/users", `{"vendor":"1 UNION SELECT password FROM users"}`))
+
+	// off 模式不檢測
+	assert.Equal(t, http.StatusOK, post("/reports", `{"vendor":"<script>alert(1)</script>"}`))
+	assert.Equal(t, http.StatusOK, post("/reports", `{"vendor":"1 UNION SELECT password FROM users"}`))
+
+	events := monitorService.GetMetrics().SecurityEvents
+	require.Contains(t, events, waf.CategoryXSS)
+	require.Contains(t, events, waf.CategorySQLi)
+	assert.Equal(t, int64(2), events[waf.CategoryXSS].Blocked)
+	assert.Zero(t, events[waf.CategoryXSS].Monitored)
+	assert.Equal(t, int64(1), events[waf.CategorySQLi].Blocked)
+	assert.Equal(t, int64(1), events[waf.CategorySQLi].Monitored)
+	assert.Equal(t, int64(2), events[waf.CategorySQLi].Rules["942100"])
+}
+
+func TestRouteParser_Security(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.yaml")
+	writeWAFRules(t, path, `
+security:
+  mode: monitor
+groups:
+  - name: expenses
+    prefix: /api/v1/expenses
+    security:
+      exempt_fields: ["description"]
+    routes:
+      - pattern: /:path
+        service: expense-service
+        security:
+          mode: block
+          sql_injection:
+            exempt_fields: ["notes"]
+services:
+  expense-service:
+    hosts: ["localhost"]
+    port: 8082
+`)
+
+	parser := proxy.NewRouteParser(nil, zap.NewNop())
+	parser.SetFilePath(path)
+	require.NoError(t, parser.LoadConfig())
+	require.NotNil(t, parser.GetSecurity())
+	assert.Equal(t, config.SecurityModeMonitor, parser.GetSecurity().Mode)
+
+	group := parser.GetAllGroups()[0]
+	route := group.Routes[0].Security.Inherit(group.Security.Inherit(parser.GetSecurity()))
+	assert.Equal(t, config.SecurityModeBlock, route.Mode)
+	assert.Equal(t, []string{"description"}, route.ExemptFields)
+	assert.Equal(t, []string{"notes"}, route.SQLInjection.ExemptFields)
+}
+
+func TestWAFEngine_Normalization(t *testing.T) {
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+
+	xss := []string{
+		"%253Cscript%253Ealert(1)",          // 雙重 URL 編碼
+		"%25253Cscript%25253E",              // 三重 URL 編碼
+		"&lt;script&gt;alert(1)",            // HTML 實體
+		"&#x3c;ScRiPt&#x3e;",                // 十六進制 HTML 實體與大小寫混合
+		`\u003cscript\u003ealert(1)`,        // Unicode 轉義
+		"%u003Cscript%u003E",                // %u 轉義
+		`\x3cscript\x3e`,                    // \x 轉義
+		"%26lt%3Bscript%26gt%3B",            // URL 編碼的 HTML 實體
+		"<img src=x\n\t  onerror=alert(1)>", // 換行與多個空白
+	}
+	for _, payload := range xss {
+		assert.True(t, engine.Evaluate(waf.CategoryXSS, "", bodyInput("a", payload)).Blocked, payload)
+	}
+
+	sqli := []string{
+		"1 UnIoN\t\n  SeLeCt password",
+		"1%2520UNION%2520SELECT%2520password",
+		`1 \u0055NION \u0053ELECT password`,
+	}
+	for _, payload := range sqli {
+		assert.True(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("a", payload)).Blocked, payload)
+	}
+
+	// 正常內容標準化後仍不應命中
+	for _, text := range []string{"Taxi &amp; dinner", "100%25 reimbursed", "Café ☕ with team", "C++ workshop"} {
+		assert.Zero(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("a", text)).Score, text)
+		assert.Zero(t, engine.Evaluate(waf.CategoryXSS, "", bodyInput("a", text)).Score, text)
+	}
+}
+
+func TestRequestInputs_JSONPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+
+	inputsOf := func(body string) map[string]string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/expenses?status=draft", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+		values := make(map[string]string)
+		for _, input := range engine.RequestInputs(c) {
+			if input.Target == waf.TargetBody {
+				values[input.Name] = input.Value
+			}
+		}
+
+		// 請求體恢復後可再次讀取
+		restored, err := c.GetRawData()
+		require.NoError(t, err)
+		assert.Equal(t, body, string(restored))
+		return values
+	}
+
+	values := inputsOf(`{"title":"Trip","amount":120.5,"approved":false,"payee":{"name":"ACME"},
+		"items":[{"description":"Taxi","tags":["travel","local"]},{"description":"Dinner","notes":null}],
+		"matrix":[[{"x":"deep"}]]}`)
+	assert.Equal(t, map[string]string{
+		"title#key":                "title",
+		"title":                    "Trip",
+		"amount#key":               "amount",
+		"amount":                   "120.5",
+		"approved#key":             "approved",
+		"approved":                 "false",
+		"payee#key":                "payee",
+		"payee.name#key":           "name",
+		"payee.name":               "ACME",
+		"items#key":                "items",
+		"items[0].description#key": "description",
+		"items[0].description":     "Taxi",
+		"items[0].tags#key":        "tags",
+		"items[0].tags[0]":         "travel",
+		"items[0].tags[1]":         "local",
+		"items[1].description#key": "description",
+		"items[1].description":     "Dinner",
+		"items[1].notes#key":       "notes",
+		"matrix#key":               "matrix",
+		"matrix[0][0].x#key":       "x",
+		"matrix[0][0].x":           "deep",
+	}, values)
+
+	// 頂層數組與字符串
+	assert.Equal(t, map[string]string{"[0].note#key": "note", "[0].note": "a", "[1]": "b"}, inputsOf(`[{"note":"a"},"b"]`))
+	assert.Equal(t, map[string]string{"": "plain"}, inputsOf(`"plain"`))
+
+	// 無效或嵌套過深的 JSON 作為整體檢查
+	assert.Equal(t, map[string]string{"": `{"a":"<script>"`}, inputsOf(`{"a":"<script>"`))
+	assert.Equal(t, map[string]string{"": `{"a":"b"} trailing`}, inputsOf(`{"a":"b"} trailing`))
+	deep := strings.Repeat("[", 100) + `"x"` + strings.Repeat("]", 100)
+	assert.Equal(t, map[string]string{"": deep}, inputsOf(deep))
+}
+
+func TestWAFMiddleware_JSONKeys(t *testing.T) {
+	engine := waf.NewDefaultEngine(config.WAFConfig{}, zap.NewNop())
+	r := newWAFTestRouter(engine, nil, "/expenses")
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/expenses", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 惡意內容放在鍵名中同樣被攔截
+	assert.Equal(t, http.StatusBadRequest, post(`{"<script>alert(1)</script>": 1}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"items":[{"1' OR '1'='1": true}]}`))
+
+	// 正常鍵名與數字、布爾值不受影響
+	assert.Equal(t, http.StatusOK, post(`{"title":"Trip","amount":120.5,"approved":false}`))
+}
+
+func TestWAFEngine_PathRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "waf_rules.yaml")
+	writeWAFRules(t, path, `
+rules:
+  - id: "990010"
+    targets: ["body:items[*].currency"]
+    operator: regex
+    pattern: "^[a-z]{3}$"
+    transforms: ["normalize"]
+    severity: notice
+    tags: ["sqli"]
+  - id: "990011"
+    targets: ["body:$.payee.account"]
+    operator: contains
+    pattern: "'"
+    tags: ["sqli"]
+`)
+	engine, err := waf.NewEngine(config.WAFConfig{RulesFile: path}, zap.NewNop())
+	require.NoError(t, err)
+
+	// 通配符路徑只匹配對應層級
+	assert.Equal(t, 2, engine.Evaluate(waf.CategorySQLi, "", bodyInput("items[3].currency", "TWD")).Score)
+	assert.Zero(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("currency", "TWD")).Score)
+	assert.Zero(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("items[0].lines[0].currency", "TWD")).Score)
+
+	// $. 前綴的完整路徑
+	assert.True(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("payee.account", "12'34")).Blocked)
+	assert.False(t, engine.Evaluate(waf.CategorySQLi, "", bodyInput("payer.account", "12'34")).Blocked)
+
+	// 路徑豁免：通配符、$. 前綴與不含索引的後綴
+	engine.SetRoutePolicy("/expenses", config.RouteSecurityConfig{
+		ExemptFields: []string{"items[*].notes", "$.memo", "attachments.caption"},
+	})
+	exempt := func(name string) bool {
+		return !engine.Evaluate(waf.CategoryXSS, "/expenses", bodyInput(name, "<script>")).Blocked
+	}
+	assert.True(t, exempt("items[0].notes"))
+	assert.True(t, exempt("memo"))
+	assert.True(t, exempt("attachments[2].caption"))
+	assert.True(t, exempt("report.attachments[0].caption"))
+	assert.False(t, exempt("items[0].description"))
+	assert.False(t, exempt("items.notes.extra"))
+	assert.False(t, exempt("payee.memo.text"))
+}
+
+func TestWAFMiddleware_MultipartStreaming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spoolDir := t.TempDir()
+	t.Setenv("TMPDIR", spoolDir)
+
+	// 上游服務返回收到的請求體與文件的摘要
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		reader := multipart.NewReader(bytes.NewReader(body), strings.TrimPrefix(r.Header.Get("Content-Type"), "multipart/form-data; boundary="))
+		files := make(map[string]string)
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			if part.FileName() != "" {
+				files[part.FormName()] = fmt.Sprintf("%x", sha256.Sum256(data))
+			}
+		}
+		w.Header().Set("X-Body-Sha256", fmt.Sprintf("%x", sha256.Sum256(body)))
+		w.Header().Set("X-File-Sha256", files["receipt"])
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	newGateway := func(limits config.MultipartInspectConfig) *gin.Engine {
+		engine := waf.NewDefaultEngine(config.WAFConfig{Multipart: limits}, zap.NewNop())
+		r := newWAFTestRouter(engine, nil)
+		r.POST("/upload", gin.WrapH(httputil.NewSingleHostReverseProxy(target)))
+		return r
+	}
+
+	receipt := make([]byte, 3<<20)
+	_, err = rand.Read(receipt)
+	require.NoError(t, err)
+	copy(receipt[1024:], "<script>alert(1)</script> UNION SELECT password FROM users --")
+
+	type field struct {
+		name, value, contentType string
+	}
+	upload := func(r *gin.Engine, fields ...field) (*http.Response, string) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for _, f := range fields {
+			switch {
+			case f.name == "receipt":
+				part, err := writer.CreateFormFile("receipt", "receipt.jpg")
+				require.NoError(t, err)
+				_, err = part.Write(receipt)
+				require.NoError(t, err)
+			case f.contentType != "":
+				header := textproto.MIMEHeader{}
+				header.Set("Content-Disposition", `form-data; name="`+f.name+`"`)
+				header.Set("Content-Type", f.contentType)
+				part, err := writer.CreatePart(header)
+				require.NoError(t, err)
+				_, err = part.Write([]byte(f.value))
+				require.NoError(t, err)
+			default:
+				require.NoError(t, writer.WriteField(f.name, f.value))
+			}
+		}
+		require.NoError(t, writer.Close())
+		digest := fmt.Sprintf("%x", sha256.Sum256(body.Bytes()))
+
+		// 反向代理需要真實的連接，通過測試伺服器發送請求
+		gateway := httptest.NewServer(r)
+		defer gateway.Close()
+		resp, err := http.Post(gateway.URL+"/upload", writer.FormDataContentType(), &body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp, digest
+	}
+	receiptDigest := fmt.Sprintf("%x", sha256.Sum256(receipt))
+
+	// 文件超過記憶體上限時寫入臨時文件，轉發的內容與原請求體逐字節一致
+	gateway := newGateway(config.MultipartInspectConfig{MemoryLimit: 64 << 10})
+	w, digest := upload(gateway,
+		field{name: "description", value: "Taxi and dinner"},
+		field{name: "receipt"},
+		field{name: "notes", value: "Paid by card"})
+	require.Equal(t, http.StatusOK, w.StatusCode)
+	assert.Equal(t, digest, w.Header.Get("X-Body-Sha256"))
+	assert.Equal(t, receiptDigest, w.Header.Get("X-File-Sha256"))
+
+	// 文件之後的文本字段仍會檢查
+	w, _ = upload(gateway, field{name: "receipt"}, field{name: "notes", value: "<script>alert(1)</script>"})
+	assert.Equal(t, http.StatusBadRequest, w.StatusCode)
+
+	// 無文件名的部分不論 Content-Type 都是字段值，同樣檢查
+	w, _ = upload(gateway, field{name: "blob", value: "<script>alert(1)</script>", contentType: "application/octet-stream"})
+	assert.Equal(t, http.StatusBadRequest, w.StatusCode)
+
+	// 字段數未超過上限時文件不計入，完整轉發
+	limited := newGateway(config.MultipartInspectConfig{MaxFields: 1})
+	w, digest = upload(limited,
+		field{name: "description", value: "Taxi"},
+		field{name: "receipt"})
+	require.Equal(t, http.StatusOK, w.StatusCode)
+	assert.Equal(t, digest, w.Header.Get("X-Body-Sha256"))
+	assert.Equal(t, receiptDigest, w.Header.Get("X-File-Sha256"))
+
+	// 超過字段數上限時其餘字段無法檢查，攔截請求
+	w, _ = upload(limited,
+		field{name: "description", value: "Taxi"},
+		field{name: "receipt"},
+		field{name: "notes", value: "Paid by card"})
+	assert.Equal(t, http.StatusBadRequest, w.StatusCode)
+
+	// 字段超過 max_field_size 時超過部分無法檢查，攔截請求
+	truncated := newGateway(config.MultipartInspectConfig{MaxFieldSize: 16})
+	w, _ = upload(truncated, field{name: "notes", value: strings.Repeat("a", 16) + "<script>alert(1)</script>"})
+	assert.Equal(t, http.StatusBadRequest, w.StatusCode)
+	w, _ = upload(truncated, field{name: "notes", value: strings.Repeat("a", 16)})
+	assert.Equal(t, http.StatusOK, w.StatusCode)
+
+	// 請求結束後臨時文件已刪除
+	entries, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
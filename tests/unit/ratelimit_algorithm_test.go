@@ -0,0 +1,155 @@
+package unit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/middleware/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clockedLimiter 可設置時間來源的限流器
+type clockedLimiter interface {
+	ratelimit.RateLimiter
+	SetClock(now func() time.Time)
+	Len() int
+	Sweep()
+	Stop()
+}
+
+func newAlgorithmLimiters(limit int, window time.Duration, burst int) map[string]clockedLimiter {
+	opts := ratelimit.LimiterOptions{Burst: burst, Shards: 4}
+	return map[string]clockedLimiter{
+		ratelimit.AlgorithmTokenBucket: ratelimit.NewTokenBucketLimiter(limit, window, opts),
+		ratelimit.AlgorithmGCRA:        ratelimit.NewGCRALimiter(limit, window, opts),
+	}
+}
+
+func TestRateLimitAlgorithms_BurstAndRefill(t *testing.T) {
+	for name, limiter := range newAlgorithmLimiters(60, time.Minute, 5) {
+		t.Run(name, func(t *testing.T) {
+			defer limiter.Stop()
+			now := time.Unix(1700000000, 0)
+			limiter.SetClock(func() time.Time { return now })
+
+			// 突發量內的請求全部允許
+			for i := 0; i < 5; i++ {
+				assert.True(t, limiter.Allow("k").Allowed, "突發量內的第 %d 個請求應該允許", i+1)
+			}
+			assert.False(t, limiter.Allow("k").Allowed, "超過突發量應該被限流")
+
+			// 每秒補充一個請求額度
+			now = now.Add(time.Second)
+			assert.True(t, limiter.Allow("k").Allowed, "補充後應該允許")
+			assert.False(t, limiter.Allow("k").Allowed, "額度用完後應該被限流")
+
+			// 其他 key 不受影響
+			assert.True(t, limiter.Allow("other").Allowed)
+
+			// 重置後恢復完整突發量
+			limiter.Reset("k")
+			assert.True(t, limiter.Allow("k").Allowed)
+		})
+	}
+}
+
+func TestRateLimitAlgorithms_Decision(t *testing.T) {
+	for name, limiter := range newAlgorithmLimiters(60, time.Minute, 5) {
+		t.Run(name, func(t *testing.T) {
+			defer limiter.Stop()
+			now := time.Unix(1700000000, 0)
+			limiter.SetClock(func() time.Time { return now })
+
+			decision := limiter.Allow("k")
+			assert.True(t, decision.Allowed)
+			assert.Equal(t, 5, decision.Limit)
+			assert.Equal(t, 4, decision.Remaining)
+			assert.Equal(t, time.Second, decision.Reset)
+			assert.Equal(t, time.Minute, decision.Window)
+
+			for i := 0; i < 4; i++ {
+				limiter.Allow("k")
+			}
+			decision = limiter.Allow("k")
+			assert.False(t, decision.Allowed)
+			assert.Equal(t, 0, decision.Remaining)
+			assert.Equal(t, time.Second, decision.RetryAfter, "每秒恢復一個額度")
+			assert.Equal(t, 5*time.Second, decision.Reset, "五秒後完全恢復")
+		})
+	}
+}
+
+func TestRateLimitAlgorithms_IdleEviction(t *testing.T) {
+	for name, limiter := range newAlgorithmLimiters(10, time.Second, 0) {
+		t.Run(name, func(t *testing.T) {
+			defer limiter.Stop()
+			now := time.Unix(1700000000, 0)
+			limiter.SetClock(func() time.Time { return now })
+
+			for i := 0; i < 100; i++ {
+				limiter.Allow(fmt.Sprintf("key-%d", i))
+			}
+			assert.Equal(t, 100, limiter.Len())
+
+			// 尚未回復的 key 不會被清理
+			limiter.Sweep()
+			assert.Equal(t, 100, limiter.Len())
+
+			now = now.Add(time.Second)
+			limiter.Sweep()
+			assert.Equal(t, 0, limiter.Len(), "回復完整額度的 key 應該被清理")
+		})
+	}
+}
+
+func TestNewRateLimiter_Algorithm(t *testing.T) {
+	assert.IsType(t, &ratelimit.MemoryRateLimiter{}, ratelimit.NewRateLimiter(10, time.Minute, ratelimit.LimiterOptions{Algorithm: ratelimit.AlgorithmSlidingLog}))
+	assert.IsType(t, &ratelimit.TokenBucketLimiter{}, ratelimit.NewRateLimiter(10, time.Minute, ratelimit.LimiterOptions{Algorithm: ratelimit.AlgorithmTokenBucket}))
+	assert.IsType(t, &ratelimit.GCRALimiter{}, ratelimit.NewRateLimiter(10, time.Minute, ratelimit.LimiterOptions{}))
+}
+
+func benchmarkLimiter(b *testing.B, limiter ratelimit.RateLimiter, keys int) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			limiter.Allow(fmt.Sprintf("key-%d", i%keys))
+			i++
+		}
+	})
+}
+
+func BenchmarkRateLimiter_SingleKey(b *testing.B) {
+	b.Run("sliding_log", func(b *testing.B) {
+		benchmarkLimiter(b, ratelimit.NewMemoryRateLimiter(1000, time.Minute), 1)
+	})
+	b.Run("token_bucket", func(b *testing.B) {
+		limiter := ratelimit.NewTokenBucketLimiter(1000, time.Minute, ratelimit.LimiterOptions{})
+		defer limiter.Stop()
+		benchmarkLimiter(b, limiter, 1)
+	})
+	b.Run("gcra", func(b *testing.B) {
+		limiter := ratelimit.NewGCRALimiter(1000, time.Minute, ratelimit.LimiterOptions{})
+		defer limiter.Stop()
+		benchmarkLimiter(b, limiter, 1)
+	})
+}
+
+func BenchmarkRateLimiter_ManyKeys(b *testing.B) {
+	b.Run("sliding_log", func(b *testing.B) {
+		benchmarkLimiter(b, ratelimit.NewMemoryRateLimiter(100, time.Minute), 10000)
+	})
+	b.Run("token_bucket", func(b *testing.B) {
+		limiter := ratelimit.NewTokenBucketLimiter(100, time.Minute, ratelimit.LimiterOptions{})
+		defer limiter.Stop()
+		benchmarkLimiter(b, limiter, 10000)
+	})
+	b.Run("gcra", func(b *testing.B) {
+		limiter := ratelimit.NewGCRALimiter(100, time.Minute, ratelimit.LimiterOptions{})
+		defer limiter.Stop()
+		benchmarkLimiter(b, limiter, 10000)
+	})
+}
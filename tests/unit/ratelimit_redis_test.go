@@ -0,0 +1,339 @@
+package unit
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"expense-api-gateway/internal/config"
+	"expense-api-gateway/internal/infrastructure/redis"
+	"expense-api-gateway/internal/middleware/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeRedis 進程內 Redis 替身，以 Go 實現限流腳本的 GCRA 語義
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	tats     map[string]int64
+	scripts  map[string]bool
+	commands map[string]int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeRedis{
+		listener: listener,
+		tats:     make(map[string]int64),
+		scripts:  make(map[string]bool),
+		commands: make(map[string]int),
+	}
+	go f.serve()
+	t.Cleanup(func() { listener.Close() })
+	return f
+}
+
+func (f *fakeRedis) config() config.RedisConfig {
+	addr := f.listener.Addr().(*net.TCPAddr)
+	return config.RedisConfig{Host: "127.0.0.1", Port: addr.Port, PoolSize: 4}
+}
+
+func (f *fakeRedis) count(cmd string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.commands[cmd]
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	f.commands[cmd]++
+
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.tats[key]; ok {
+				delete(f.tats, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "GET":
+		tat, ok := f.tats[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		value := strconv.FormatInt(tat, 10)
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SCAN":
+		// 只支援前綴模式，一次返回所有 key
+		prefix := strings.TrimSuffix(strings.ReplaceAll(args[3], "\\", ""), "*")
+		var keys []string
+		for key := range f.tats {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, fmt.Sprintf("$%d\r\n%s\r\n", len(key), key))
+			}
+		}
+		return fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n%s", len(keys), strings.Join(keys, ""))
+	case "EVAL":
+		sum := sha1.Sum([]byte(args[1]))
+		f.scripts[hex.EncodeToString(sum[:])] = true
+		return f.gcra(args[3], args[4], args[5])
+	case "EVALSHA":
+		if !f.scripts[args[1]] {
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		}
+		return f.gcra(args[3], args[4], args[5])
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func (f *fakeRedis) gcra(key, emissionArg, toleranceArg string) string {
+	emission, _ := strconv.ParseInt(emissionArg, 10, 64)
+	tolerance, _ := strconv.ParseInt(toleranceArg, 10, 64)
+	now := time.Now().UnixMicro()
+
+	tat, ok := f.tats[key]
+	if !ok || tat < now {
+		tat = now
+	}
+	newTAT := tat + emission
+	if newTAT-now > tolerance {
+		return fmt.Sprintf("*4\r\n:0\r\n:0\r\n:%d\r\n:%d\r\n", tat-now, newTAT-now-tolerance)
+	}
+	f.tats[key] = newTAT
+	return fmt.Sprintf("*4\r\n:1\r\n:%d\r\n:%d\r\n:0\r\n", (tolerance-(newTAT-now))/emission, newTAT-now)
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		args[i] = string(value[:size])
+	}
+	return args, nil
+}
+
+func TestRedisRateLimiter_SharedAcrossReplicas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newFakeRedis(t)
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 4,
+			Backend:     "redis",
+			KeyPrefix:   "test:",
+		},
+		Redis: server.config(),
+	}
+
+	// 兩個網關副本共享同一個 Redis
+	var routers []*gin.Engine
+	for i := 0; i < 2; i++ {
+		middleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+		defer middleware.Close()
+
+		router := gin.New()
+		router.Use(middleware.GlobalRateLimit())
+		router.GET("/test", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "success"})
+		})
+		routers = append(routers, router)
+	}
+
+	allowed := 0
+	for i := 0; i < 8; i++ {
+		w := httptest.NewRecorder()
+		routers[i%2].ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+		if w.Code == http.StatusOK {
+			allowed++
+		}
+	}
+	assert.Equal(t, 4, allowed, "副本之間應共享限流額度")
+
+	// 腳本只在首次 NOSCRIPT 時以 EVAL 載入
+	assert.Equal(t, 1, server.count("EVAL"))
+	assert.Equal(t, 8, server.count("EVALSHA"))
+}
+
+func TestRedisRateLimiter_NamespacedPerLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newFakeRedis(t)
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{
+			Enabled:     true,
+			GlobalLimit: 1000,
+			IPLimit:     config.RateLimitRule{Requests: 5, Window: time.Minute},
+			Backend:     "redis",
+			KeyPrefix:   "test:",
+		},
+		Redis: server.config(),
+	}
+	middleware := ratelimit.NewRateLimitMiddleware(cfg, zap.NewNop())
+	defer middleware.Close()
+
+	router := gin.New()
+	router.Use(middleware.GlobalRateLimit())
+	router.Use(middleware.IPRateLimit())
+	router.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	for _, ip := range []string{"203.0.113.1", "198.51.100.1"} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.RemoteAddr = ip + ":4000"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// 各限流器只枚舉自己的 key
+	activeKeys := make(map[string]int)
+	for _, stats := range middleware.Stats(5) {
+		activeKeys[stats.Name] = stats.ActiveKeys
+	}
+	assert.Equal(t, map[string]int{"global": 1, "ip": 2}, activeKeys)
+
+	state := middleware.LookupKey("ip:203.0.113.1")
+	require.Len(t, state, 1)
+	assert.Equal(t, "ip", state[0].Limiter)
+	assert.Equal(t, 5, state[0].Limit)
+	assert.Equal(t, 4, state[0].Remaining)
+
+	assert.Equal(t, 2, middleware.ResetPattern("ip:*"))
+}
+
+func TestRedisRateLimiter_Reset(t *testing.T) {
+	server := newFakeRedis(t)
+	client := redis.New(server.config())
+	defer client.Close()
+
+	limiter := ratelimit.NewRedisRateLimiter(client, 1, time.Minute, ratelimit.LimiterOptions{KeyPrefix: "test:"}, nil)
+
+	assert.True(t, limiter.Allow("user:1").Allowed)
+	assert.False(t, limiter.Allow("user:1").Allowed)
+	assert.True(t, limiter.Allow("user:2").Allowed, "不同 key 不受影響")
+
+	limiter.Reset("user:1")
+	assert.Equal(t, 1, server.count("DEL"))
+	assert.True(t, limiter.Allow("user:1").Allowed, "重置後應該允許")
+}
+
+func TestRedisRateLimiter_Inspect(t *testing.T) {
+	server := newFakeRedis(t)
+	client := redis.New(server.config())
+	defer client.Close()
+
+	limiter := ratelimit.NewRedisRateLimiter(client, 3, time.Minute, ratelimit.LimiterOptions{KeyPrefix: "test:"}, nil)
+	limiter.Allow("user:1")
+	limiter.Allow("user:1")
+	limiter.Allow("ip:10.0.0.1")
+
+	assert.ElementsMatch(t, []string{"user:1", "ip:10.0.0.1"}, limiter.Keys(), "應去除 key 前綴")
+
+	state, found := limiter.Peek("user:1")
+	require.True(t, found)
+	assert.Equal(t, 3, state.Limit)
+	assert.Equal(t, 1, state.Remaining)
+	assert.Equal(t, int64(40), state.ResetSeconds)
+
+	_, found = limiter.Peek("user:2")
+	assert.False(t, found)
+}
+
+func TestRedisRateLimiter_Unavailable(t *testing.T) {
+	// 取得一個沒有服務監聽的地址
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	client := redis.New(config.RedisConfig{Host: "127.0.0.1", Port: port, DialTimeout: 100 * time.Millisecond})
+	defer client.Close()
+
+	t.Run("local", func(t *testing.T) {
+		fallback := ratelimit.NewGCRALimiter(2, time.Minute, ratelimit.LimiterOptions{})
+		defer fallback.Stop()
+		limiter := ratelimit.NewRedisRateLimiter(client, 2, time.Minute, ratelimit.LimiterOptions{FailMode: ratelimit.FailModeLocal}, fallback)
+
+		assert.True(t, limiter.Allow("k").Allowed)
+		assert.True(t, limiter.Allow("k").Allowed)
+		assert.False(t, limiter.Allow("k").Allowed, "回退到本地限流器後仍應限流")
+	})
+
+	t.Run("open", func(t *testing.T) {
+		limiter := ratelimit.NewRedisRateLimiter(client, 1, time.Minute, ratelimit.LimiterOptions{FailMode: ratelimit.FailModeOpen}, nil)
+		for i := 0; i < 3; i++ {
+			assert.True(t, limiter.Allow("k").Allowed, "fail open 時應該放行")
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		limiter := ratelimit.NewRedisRateLimiter(client, 1, time.Minute, ratelimit.LimiterOptions{FailMode: ratelimit.FailModeClosed}, nil)
+		assert.False(t, limiter.Allow("k").Allowed, "fail closed 時應該拒絕")
+	})
+}